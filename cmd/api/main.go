@@ -6,9 +6,26 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"api-watchtower/internal/api"
 	"api-watchtower/internal/config"
+	"api-watchtower/internal/db"
+	"api-watchtower/internal/monitoring"
+	"api-watchtower/internal/selfcheck"
+)
+
+// shutdownTimeout bounds how long shutdown waits for in-flight requests,
+// monitoring checks and log analysis.
+const shutdownTimeout = 30 * time.Second
+
+// Self-check thresholds: a log buffer fuller than this, or no analysis
+// cycle for this long, fails its probe. Failed self-checks alert at most
+// once per selfCheckCooldown.
+const (
+	selfCheckMaxPressure = 0.9
+	selfCheckMaxCycleAge = 10 * time.Minute
+	selfCheckCooldown    = 15 * time.Minute
 )
 
 func main() {
@@ -18,16 +35,30 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if cfg.Database.IDFormat == "ulid" {
+		db.SetIDGenerator(&db.ULIDGenerator{})
+	}
+
 	// Create context that listens for the interrupt signal from the OS
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	// Initialize and start the server
-	server, err := api.NewServer(cfg)
+	services := api.Services{}
+	server, err := api.NewServer(cfg, services)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
+	if services.Monitoring != nil {
+		services.Monitoring.SetSecretProvider(secretProvider(cfg.Secrets))
+	}
+
+	monitor, err := startSelfChecks(services)
+	if err != nil {
+		log.Fatalf("Failed to start self-checks: %v", err)
+	}
+
 	// Start server in a goroutine
 	go func() {
 		if err := server.Start(); err != nil {
@@ -39,7 +70,65 @@ func main() {
 	<-ctx.Done()
 
 	// Shutdown gracefully
-	if err := server.Shutdown(context.Background()); err != nil {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
+	if err := monitor.Stop(shutdownCtx); err != nil {
+		log.Printf("Self-checks forced to stop: %v", err)
+	}
+	if services.Monitoring != nil {
+		if err := services.Monitoring.Stop(shutdownCtx); err != nil {
+			log.Printf("Monitoring forced to stop: %v", err)
+		}
+	}
+	if services.Analyzer != nil {
+		if err := services.Analyzer.Stop(shutdownCtx); err != nil {
+			log.Printf("Analyzer forced to stop: %v", err)
+		}
+	}
+}
+
+// secretProvider returns the provider for ${secret:NAME} references in
+// monitoring targets, or nil when none is configured.
+func secretProvider(cfg config.SecretsConfig) monitoring.SecretProvider {
+	switch cfg.Provider {
+	case "env":
+		return monitoring.EnvSecrets{Prefix: cfg.EnvPrefix}
+	case "file":
+		return monitoring.FileSecrets{Dir: cfg.Dir}
+	}
+	return nil
+}
+
+// startSelfChecks probes each of the configured services and alerts about
+// failed probes through the alert manager, if there is one.
+func startSelfChecks(services api.Services) (*selfcheck.Monitor, error) {
+	var probes []selfcheck.Probe
+	if services.Ingester != nil {
+		probes = append(probes, selfcheck.IngestionProbe(services.Ingester, selfCheckMaxPressure))
+	}
+	if services.Analyzer != nil {
+		probes = append(probes, selfcheck.AnalyzerProbe(services.Analyzer, selfCheckMaxCycleAge))
+	}
+	if services.Notifications != nil {
+		probes = append(probes, selfcheck.NotificationProbe(services.Notifications))
+	}
+
+	// Nil services are left as nil interfaces, which the monitor skips
+	var recorder selfcheck.Recorder
+	if services.Monitoring != nil {
+		recorder = services.Monitoring
+	}
+	var alerts selfcheck.AlertProcessor
+	if services.Alerts != nil {
+		if err := services.Alerts.AddRule(selfcheck.AlertRule(selfCheckCooldown)); err != nil {
+			return nil, err
+		}
+		alerts = services.Alerts
+	}
+
+	return selfcheck.NewMonitor(selfcheck.Config{}, recorder, alerts, probes...)
 }
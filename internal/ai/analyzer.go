@@ -3,100 +3,667 @@ package ai
 import (
 	"context"
 	"encoding/json"
-	"regexp"
 	"fmt"
+	"log"
+	"regexp"
+	"sort"
 	"sync"
 	"time"
 
+	"api-watchtower/internal/clock"
 	"api-watchtower/internal/db"
-
-	"gonum.org/v1/gonum/stat"
 )
 
 type Analyzer struct {
-	storage          Storage
-	baselineMetrics  map[string]*baselineMetrics
-	patternClusters  map[string]*patternCluster
+	storage         Storage
+	baselineMetrics map[string]*baselineMetrics
+	patternClusters map[string]*patternCluster
 	mu              sync.RWMutex
 	updateInterval  time.Duration
+	workers         int
+	groupBudget     time.Duration
+	explain         bool
+	baselineWindow  int
+	baselineAlpha   float64
+	clock           clock.Clock
+
+	// openAnomalies holds the latest analysis for each ongoing anomaly,
+	// keyed by group and analysis type
+	openAnomalies   map[string]*db.AIAnalysis
+	anomalyCooldown time.Duration
+
+	window      AnalysisWindow
+	appWindows  map[string]AnalysisWindow
+	maxLookback time.Duration
+	minLogs     int
+
+	patternHalfLife time.Duration
+	traceURL        string
+	resolveAfter    time.Duration
+
+	// recovering holds when each open anomaly's series last came back
+	// within range, keyed like openAnomalies
+	recovering     map[string]time.Time
+	recoveryPeriod time.Duration
+
+	// fastPath holds the series run through the detector's fast mode, and
+	// fastMethod the method it runs
+	fastPath   map[string]bool
+	fastMethod string
+	// detector is the configured baseline detector every series' detector
+	// is copied from
+	detector AnomalyDetector
+
+	// clusterer groups error logs by message similarity for SimilarErrors
+	clusterer *LogClusterer
+
+	// feedbackMu serializes status changes, whether from analyst feedback
+	// or the lifecycle
+	feedbackMu sync.Mutex
+
+	// lastCycle is when the last analysis cycle completed
+	lastCycle time.Time
+
+	// cancel stops the background analysis, which closes done on exit
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// AnalyzerConfig controls how often and how widely the Analyzer works.
+type AnalyzerConfig struct {
+	// UpdateInterval is the time between analysis cycles
+	UpdateInterval time.Duration
+	// Workers is how many application/service groups are analyzed in
+	// parallel. Defaults to 4.
+	Workers int
+	// GroupBudget bounds the time spent on a single group per cycle so one
+	// noisy tenant can't delay the rest. Defaults to 30s.
+	GroupBudget time.Duration
+	// ExplainAnomalies stores an AnomalyExplanation in the details of every
+	// detected anomaly. Off by default since it runs the full detector on
+	// every series outside FastPathSeries.
+	ExplainAnomalies bool
+	// BaselineWindow is how many cycles the per-group baselines cover.
+	// Defaults to 60.
+	BaselineWindow int
+	// BaselineExponential weights baselines exponentially towards recent
+	// cycles, with an alpha of 2/(BaselineWindow+1) so they still reflect
+	// about BaselineWindow cycles. Off by default, weighing the window
+	// equally.
+	BaselineExponential bool
+	// AnomalyCooldown is how long an anomaly can go undetected and still be
+	// the same ongoing condition. Repeat detections within it update the
+	// stored analysis instead of adding another. Defaults to 30m.
+	AnomalyCooldown time.Duration
+	// Window is the lookback and bucket size used for applications without
+	// an entry in AppWindows. Zero fields take DefaultLookback and
+	// DefaultBucketSize.
+	Window AnalysisWindow
+	// AppWindows overrides Window per application ID
+	AppWindows map[string]AnalysisWindow
+	// MinLogs is the fewest logs the latest bucket needs for its error
+	// rate to be trusted. Quieter groups are marked as having insufficient
+	// data and neither update their baseline nor raise anomalies.
+	// Defaults to 10.
+	MinLogs int
+	// PatternHalfLife is how long it takes an error pattern's frequency
+	// score to halve once it stops occurring. Defaults to 1h.
+	PatternHalfLife time.Duration
+	// TraceURLTemplate links analyses to the traces of their error logs,
+	// e.g. "https://tempo.example.com/trace/{traceID}". Empty disables
+	// trace links.
+	TraceURLTemplate string
+	// ResolveAfter is how long an active or confirmed analysis's condition
+	// can go unseen before it is resolved automatically. Defaults to
+	// DefaultResolveAfter; negative disables auto-resolution.
+	ResolveAfter time.Duration
+	// FastPathSeries lists the series, by their "application:service"
+	// key, whose anomaly explanations and reported thresholds come from
+	// FastMethod alone instead of the full ensemble: cheaper for
+	// low-priority series, at some accuracy. Whether a cycle raises an
+	// anomaly is decided against the baseline alike for every series.
+	FastPathSeries []string
+	// FastMethod is the method fast-path series run: zscore, the default,
+	// iqr or ewma.
+	FastMethod string
+	// EnsembleMode is how the baseline detector combines its methods'
+	// verdicts: weighted, the default, majority, max or any.
+	EnsembleMode string
+	// DetectionMode is ensemble, the default, or percentile, which expects
+	// each series within its LowerPercentile to UpperPercentile interval.
+	// Fast mode is set per series through FastPathSeries.
+	DetectionMode string
+	// LowerPercentile and UpperPercentile bound percentile mode's expected
+	// range, as percentiles strictly between 0 and 100. Default to 1 and
+	// 99.
+	LowerPercentile float64
+	UpperPercentile float64
+	// SeasonalPeriod is how many cycles a season of the baselines spans,
+	// e.g. 1440 for a daily pattern in one-minute cycles. Zero, the
+	// default, leaves the seasonal method out of the ensemble.
+	SeasonalPeriod int
+	// TrendMethod smooths the seasonal method's trend: moving_average, the
+	// default, or median, which keeps a spike from shifting its
+	// neighbours' expected ranges.
+	TrendMethod string
+	// RecoveryPeriod is how long an anomalous series must stay within its
+	// expected range before its anomaly is resolved and a recovered
+	// analysis emitted, so alerts raised from it can resolve too. It must
+	// be shorter than AnomalyCooldown. Zero leaves anomalies to
+	// ResolveAfter.
+	RecoveryPeriod time.Duration
+	// ClusterEps and ClusterMinPoints configure the DBSCAN step of the
+	// similarity clustering behind SimilarErrors. They default to 0.5 and
+	// 3. ClusterSampleSize caps how many logs it fits on; defaults to 2000.
+	// Larger inputs are reservoir sampled down to it, seeded by
+	// ClusterSeed so the same logs always give the same clusters.
+	ClusterEps        float64
+	ClusterMinPoints  int
+	ClusterSampleSize int
+	ClusterSeed       uint64
 }
 
 type Storage interface {
 	GetRecentLogs(ctx context.Context, duration time.Duration) ([]*db.ApplicationLog, error)
 	SaveAnalysis(ctx context.Context, analysis *db.AIAnalysis) error
+	// BatchSaveAnalysis saves many analyses in one round trip: either all
+	// of them are stored or none is
+	BatchSaveAnalysis(ctx context.Context, analyses []*db.AIAnalysis) error
+	UpdateAnalysis(ctx context.Context, analysis *db.AIAnalysis) error
+	// GetAnalysis returns nil when no analysis has the given ID
+	GetAnalysis(ctx context.Context, id string) (*db.AIAnalysis, error)
+	GetAnalyses(ctx context.Context, query AnalysisQuery) ([]*db.AIAnalysis, error)
 }
 
+type AnalysisQuery struct {
+	Types     []string
+	Status    string
+	StartTime time.Time
+	EndTime   time.Time
+	Limit     int
+	Offset    int
+}
+
+// Analysis types produced by the analyzer
+const (
+	TypeErrorRateAnomaly = "error_rate_anomaly"
+	TypeErrorPattern     = "error_pattern"
+)
+
+// anomalyTypes are the analysis types returned by GetAnomalies
+var anomalyTypes = []string{TypeErrorRateAnomaly}
+
 type baselineMetrics struct {
 	ErrorRate     movingAverage
 	ResponseTimes movingAverage
-	UpdatedAt    time.Time
+	UpdatedAt     time.Time
+	// InsufficientData is set while the latest bucket has fewer logs than
+	// the analyzer's MinLogs
+	InsufficientData bool
+	// fedUntil is the end of the last bucket fed into the averages
+	fedUntil time.Time
 }
 
-type movingAverage struct {
-	Values []float64
-	Window int
-}
+const (
+	// maxPatternClusters caps the persistent clusters across all groups
+	maxPatternClusters = 1000
+	// maxPatternsPerCycle caps the distinct patterns tracked per group and cycle
+	maxPatternsPerCycle = 200
+	// maxPatternExamples caps the example messages kept per cluster
+	maxPatternExamples = 5
+	// patternRateWindow is the trailing window a pattern's rate is
+	// measured over
+	patternRateWindow = 5 * time.Minute
+	// patternSignificance is the decayed score a pattern needs to be
+	// reported
+	patternSignificance = 3
+	// baselineMaxAge is how stale a baseline can get before the latest
+	// bucket is no longer judged against it
+	baselineMaxAge = time.Hour
+)
 
 type patternCluster struct {
-	Pattern     string
-	Count       int
-	LastSeen    time.Time
-	Examples    []string
-	Severity    string
+	Pattern string
+	Count   int
+	// Overcount is how much of Count was inherited from the pattern this
+	// one evicted from a full per-cycle table. Only Count-Overcount
+	// occurrences are certain; the rest may belong to other patterns.
+	Overcount int
+	LastSeen  time.Time
+	Examples  []string
+	Severity  string
+	// Score is the pattern's exponentially decayed frequency as of
+	// LastSeen; see decayedScore
+	Score float64
+	// Overscore is the part of Score inherited on eviction, like
+	// Overcount, as of LastSeen
+	Overscore float64
+	// RecentCount is this cycle's count within patternRateWindow; it isn't
+	// kept in the persistent clusters
+	RecentCount int
+	// TraceIDs are trace IDs of this cycle's matching logs; like
+	// RecentCount they aren't kept
+	TraceIDs []string
+}
+
+// baselineAlpha is the exponential weight baselines give each new cycle,
+// or zero for equal weights.
+func baselineAlpha(cfg AnalyzerConfig) float64 {
+	if !cfg.BaselineExponential {
+		return 0
+	}
+	return 2 / float64(cfg.BaselineWindow+1)
 }
 
-func NewAnalyzer(storage Storage, updateInterval time.Duration) *Analyzer {
+func validatePercentile(field string, p float64, errs *db.ValidationErrors) {
+	if p <= 0 || p >= 100 {
+		errs.Add(field, db.CodeInvalid, fmt.Sprintf("percentile must be strictly between 0 and 100, got %g", p))
+	}
+}
+
+// NewAnalyzer validates cfg and starts the background analysis. Every
+// lookback must be a whole number of buckets.
+func NewAnalyzer(storage Storage, cfg AnalyzerConfig) (*Analyzer, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.GroupBudget <= 0 {
+		cfg.GroupBudget = 30 * time.Second
+	}
+	if cfg.BaselineWindow <= 0 {
+		cfg.BaselineWindow = 60
+	}
+	if cfg.AnomalyCooldown <= 0 {
+		cfg.AnomalyCooldown = 30 * time.Minute
+	}
+	if cfg.MinLogs <= 0 {
+		cfg.MinLogs = 10
+	}
+	if cfg.PatternHalfLife <= 0 {
+		cfg.PatternHalfLife = time.Hour
+	}
+	if cfg.ResolveAfter == 0 {
+		cfg.ResolveAfter = DefaultResolveAfter
+	}
+	if cfg.Window.Lookback == 0 {
+		cfg.Window.Lookback = DefaultLookback
+	}
+	if cfg.Window.BucketSize == 0 {
+		cfg.Window.BucketSize = DefaultBucketSize
+	}
+	if cfg.ClusterEps <= 0 {
+		cfg.ClusterEps = 0.5
+	}
+	if cfg.ClusterMinPoints <= 0 {
+		cfg.ClusterMinPoints = 3
+	}
+	if cfg.ClusterSampleSize <= 0 {
+		cfg.ClusterSampleSize = 2000
+	}
+	if cfg.LowerPercentile == 0 {
+		cfg.LowerPercentile = 100 * defaultLowerPercentile
+	}
+	if cfg.UpperPercentile == 0 {
+		cfg.UpperPercentile = 100 * defaultUpperPercentile
+	}
+
+	var errs db.ValidationErrors
+	cfg.Window.validate("window", &errs)
+	validateTraceURLTemplate(cfg.TraceURLTemplate, &errs)
+	if cfg.RecoveryPeriod < 0 || (cfg.RecoveryPeriod > 0 && cfg.RecoveryPeriod >= cfg.AnomalyCooldown) {
+		errs.Add("recovery_period", db.CodeInvalid, fmt.Sprintf("recovery period must be between 0 and the anomaly cooldown (%s), got %s", cfg.AnomalyCooldown, cfg.RecoveryPeriod))
+	}
+	switch cfg.FastMethod {
+	case "", MethodZScore, MethodIQR, MethodEWMA:
+	default:
+		errs.Add("fast_method", db.CodeUnsupported, fmt.Sprintf("unsupported fast method %q; use %s, %s or %s", cfg.FastMethod, MethodZScore, MethodIQR, MethodEWMA))
+	}
+	switch cfg.EnsembleMode {
+	case "", EnsembleWeighted, EnsembleMajority, EnsembleMax, EnsembleAny:
+	default:
+		errs.Add("ensemble_mode", db.CodeUnsupported, fmt.Sprintf("unsupported ensemble mode %q; use %s, %s, %s or %s", cfg.EnsembleMode, EnsembleWeighted, EnsembleMajority, EnsembleMax, EnsembleAny))
+	}
+	switch cfg.DetectionMode {
+	case "", DetectionEnsemble, DetectionPercentile:
+	default:
+		errs.Add("detection_mode", db.CodeUnsupported, fmt.Sprintf("unsupported detection mode %q; use %s or %s", cfg.DetectionMode, DetectionEnsemble, DetectionPercentile))
+	}
+	switch cfg.TrendMethod {
+	case "", TrendMovingAverage, TrendMedian:
+	default:
+		errs.Add("trend_method", db.CodeUnsupported, fmt.Sprintf("unsupported trend method %q; use %s or %s", cfg.TrendMethod, TrendMovingAverage, TrendMedian))
+	}
+	if cfg.SeasonalPeriod < 0 {
+		errs.Add("seasonal_period", db.CodeInvalid, fmt.Sprintf("seasonal period must not be negative, got %d", cfg.SeasonalPeriod))
+	}
+	validatePercentile("lower_percentile", cfg.LowerPercentile, &errs)
+	validatePercentile("upper_percentile", cfg.UpperPercentile, &errs)
+	if cfg.LowerPercentile >= cfg.UpperPercentile {
+		errs.Add("lower_percentile", db.CodeInvalid, fmt.Sprintf("lower percentile %g must be below the upper percentile %g", cfg.LowerPercentile, cfg.UpperPercentile))
+	}
+	maxLookback := cfg.Window.Lookback
+	for app, w := range cfg.AppWindows {
+		w.validate(fmt.Sprintf("app_windows[%s]", app), &errs)
+		if w.Lookback > maxLookback {
+			maxLookback = w.Lookback
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	fastPath := make(map[string]bool, len(cfg.FastPathSeries))
+	for _, key := range cfg.FastPathSeries {
+		fastPath[key] = true
+	}
+	clusterer := NewLogClusterer(cfg.ClusterEps, cfg.ClusterMinPoints)
+	clusterer.SampleSize = cfg.ClusterSampleSize
+	clusterer.Seed = cfg.ClusterSeed
+	detector := baselineDetector()
+	if cfg.EnsembleMode != "" {
+		detector.EnsembleMode = cfg.EnsembleMode
+	}
+	if cfg.DetectionMode != "" {
+		detector.DetectionMode = cfg.DetectionMode
+	}
+	if cfg.TrendMethod != "" {
+		detector.TrendMethod = cfg.TrendMethod
+	}
+	detector.SeasonalPeriod = cfg.SeasonalPeriod
+	detector.LowerPercentile = cfg.LowerPercentile / 100
+	detector.UpperPercentile = cfg.UpperPercentile / 100
+
 	a := &Analyzer{
 		storage:         storage,
 		baselineMetrics: make(map[string]*baselineMetrics),
 		patternClusters: make(map[string]*patternCluster),
-		updateInterval:  updateInterval,
+		updateInterval:  cfg.UpdateInterval,
+		workers:         cfg.Workers,
+		groupBudget:     cfg.GroupBudget,
+		explain:         cfg.ExplainAnomalies,
+		baselineWindow:  cfg.BaselineWindow,
+		baselineAlpha:   baselineAlpha(cfg),
+		clock:           clock.Real{},
+		openAnomalies:   make(map[string]*db.AIAnalysis),
+		anomalyCooldown: cfg.AnomalyCooldown,
+		window:          cfg.Window,
+		appWindows:      cfg.AppWindows,
+		maxLookback:     maxLookback,
+		minLogs:         cfg.MinLogs,
+		patternHalfLife: cfg.PatternHalfLife,
+		traceURL:        cfg.TraceURLTemplate,
+		resolveAfter:    cfg.ResolveAfter,
+		recovering:      make(map[string]time.Time),
+		recoveryPeriod:  cfg.RecoveryPeriod,
+		fastPath:        fastPath,
+		fastMethod:      cfg.FastMethod,
+		detector:        *detector,
+		clusterer:       clusterer,
+		done:            make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	go a.backgroundAnalysis(ctx)
+	return a, nil
+}
+
+// Stop ends the background analysis, cancelling a cycle in progress, and
+// waits for it to return. If ctx ends first it returns ctx's error.
+func (a *Analyzer) Stop(ctx context.Context) error {
+	a.cancel()
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("analysis still running: %v", ctx.Err())
+	}
+}
+
+// windowFor returns the analysis window for an application.
+func (a *Analyzer) windowFor(applicationID string) AnalysisWindow {
+	if w, ok := a.appWindows[applicationID]; ok {
+		return w
+	}
+	return a.window
+}
+
+// SetClock replaces the time source used for baseline freshness and
+// detection timestamps.
+func (a *Analyzer) SetClock(c clock.Clock) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clock = c
+}
+
+// GetAnomalies returns stored anomaly analyses matching query; query.Types
+// is ignored.
+func (a *Analyzer) GetAnomalies(ctx context.Context, query AnalysisQuery) ([]*db.AIAnalysis, error) {
+	query.Types = anomalyTypes
+	return a.storage.GetAnalyses(ctx, query)
+}
+
+// GetAnalysis returns a single stored analysis, or nil if it doesn't exist.
+func (a *Analyzer) GetAnalysis(ctx context.Context, id string) (*db.AIAnalysis, error) {
+	return a.storage.GetAnalysis(ctx, id)
+}
+
+// SeriesThresholds describes the limits currently applied to one group's
+// baseline series.
+type SeriesThresholds struct {
+	Key    string `json:"key"`
+	Metric string `json:"metric"`
+	// AlertAbove is the value above which the analyzer raises an anomaly
+	AlertAbove float64 `json:"alert_above"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"stddev"`
+	// Expected and Methods are the detector's combined and per-method ranges
+	// for the latest point; empty until the history is long enough
+	Expected Range            `json:"expected"`
+	Methods  map[string]Range `json:"methods,omitempty"`
+	Points   int              `json:"points"`
+	// InsufficientData is set while the group logs too little to analyze
+	InsufficientData bool `json:"insufficient_data"`
+}
+
+// Thresholds reports the current error rate thresholds for every group, or
+// only for key when it is non-empty, sorted by key.
+func (a *Analyzer) Thresholds(key string) []SeriesThresholds {
+	type snapshot struct {
+		key          string
+		mean, stdDev float64
+		history      []float64
+		insufficient bool
+	}
+
+	a.mu.RLock()
+	snapshots := make([]snapshot, 0, len(a.baselineMetrics))
+	for k, baseline := range a.baselineMetrics {
+		if key != "" && k != key {
+			continue
+		}
+		mean, stdDev := baseline.ErrorRate.meanStdDev()
+		snapshots = append(snapshots, snapshot{k, mean, stdDev, baseline.ErrorRate.history(), baseline.InsufficientData})
+	}
+	a.mu.RUnlock()
+
+	thresholds := make([]SeriesThresholds, len(snapshots))
+	for i, s := range snapshots {
+		detector := a.seriesDetector(s.key)
+		points := historyPoints(s.history)
+		thresholds[i] = SeriesThresholds{
+			Key:        s.key,
+			Metric:     "error_rate",
+			AlertAbove: s.mean + 2*s.stdDev,
+			Mean:       s.mean,
+			StdDev:     s.stdDev,
+			Expected:   detector.CurrentThresholds(points),
+			Methods:    detector.MethodThresholds(points),
+			Points:     len(points),
+
+			InsufficientData: s.insufficient,
+		}
 	}
 
-	go a.backgroundAnalysis()
-	return a
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i].Key < thresholds[j].Key })
+	return thresholds
 }
 
-func (a *Analyzer) backgroundAnalysis() {
+func (a *Analyzer) backgroundAnalysis(ctx context.Context) {
+	defer close(a.done)
+
 	ticker := time.NewTicker(a.updateInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		a.analyze(ctx)
-		cancel()
+	for {
+		select {
+		case <-ticker.C:
+			cycleCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			a.analyze(cycleCtx)
+			a.resolveStale(cycleCtx)
+			cancel()
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
 func (a *Analyzer) analyze(ctx context.Context) {
 	// Get recent logs for analysis
-	logs, err := a.storage.GetRecentLogs(ctx, 24*time.Hour)
+	logs, err := a.storage.GetRecentLogs(ctx, a.maxLookback)
 	if err != nil {
 		return
 	}
 
+	a.pruneAnomalies()
+
 	// Group logs by application and service
 	groupedLogs := a.groupLogs(logs)
 
-	// Analyze each group
-	for key, logs := range groupedLogs {
-		// Update baseline metrics
-		a.updateBaseline(key, logs)
+	// Analyze groups on a bounded pool so a single large group only occupies
+	// one worker. New analyses are collected and saved together.
+	keys := make(chan string)
+	var wg sync.WaitGroup
+	var createdMu sync.Mutex
+	var created []*db.AIAnalysis
+	for w := 0; w < a.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				analyses := a.analyzeGroup(ctx, key, groupedLogs[key])
+				createdMu.Lock()
+				created = append(created, analyses...)
+				createdMu.Unlock()
+			}
+		}()
+	}
 
-		// Detect anomalies
-		anomalies := a.detectAnomalies(key, logs)
-		for _, anomaly := range anomalies {
-			a.storage.SaveAnalysis(ctx, anomaly)
+	for key := range groupedLogs {
+		select {
+		case keys <- key:
+		case <-ctx.Done():
 		}
+	}
+	close(keys)
+	wg.Wait()
+
+	a.saveAnalyses(ctx, created)
+
+	a.mu.Lock()
+	a.lastCycle = a.clock.Now()
+	a.mu.Unlock()
+}
+
+// LastCycle returns when the last analysis cycle completed, or the zero
+// time if none has yet. A cycle that couldn't load logs doesn't count.
+func (a *Analyzer) LastCycle() time.Time {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.lastCycle
+}
 
-		// Update error patterns
-		patterns := a.updateErrorPatterns(key, logs)
-		for _, pattern := range patterns {
-			a.storage.SaveAnalysis(ctx, pattern)
+// saveAnalyses writes a cycle's new analyses in one batch. If the batch
+// fails they are saved one at a time, so one bad analysis or a batch too
+// large for storage doesn't lose the whole cycle.
+func (a *Analyzer) saveAnalyses(ctx context.Context, analyses []*db.AIAnalysis) {
+	if len(analyses) == 0 {
+		return
+	}
+
+	err := a.storage.BatchSaveAnalysis(ctx, analyses)
+	if err == nil {
+		return
+	}
+	log.Printf("Failed to save %d analyses in a batch, saving them one at a time: %v", len(analyses), err)
+	for _, analysis := range analyses {
+		if err := a.storage.SaveAnalysis(ctx, analysis); err != nil {
+			log.Printf("Failed to save analysis %s: %v", analysis.ID, err)
 		}
 	}
 }
 
+// analyzeGroup runs one group's analysis within its time budget and returns
+// the new analyses to save; ongoing anomalies are updated directly. A group
+// that runs out of budget is skipped for the rest of this cycle.
+func (a *Analyzer) analyzeGroup(ctx context.Context, key string, logs []*db.ApplicationLog) []*db.AIAnalysis {
+	ctx, cancel := context.WithTimeout(ctx, a.groupBudget)
+	defer cancel()
+
+	skipped := func(stage string) bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		log.Printf("Skipping analysis of %s (%d logs) after %s: %v", key, len(logs), stage, ctx.Err())
+		return true
+	}
+
+	a.mu.RLock()
+	now := a.clock.Now()
+	a.mu.RUnlock()
+
+	// Trim to the application's lookback and aggregate into its buckets
+	window := a.windowFor(logs[0].ApplicationID)
+	logs = window.withinLookback(logs, now)
+	if len(logs) == 0 {
+		return nil
+	}
+	buckets := window.bucketLogs(ctx, logs, now)
+	if skipped("bucketing") {
+		return nil
+	}
+
+	// Update baseline metrics
+	a.updateBaseline(key, buckets, window, now)
+	if skipped("baseline update") {
+		return nil
+	}
+
+	// Detect anomalies
+	anomalies := a.detectAnomalies(key, buckets, window)
+	if skipped("anomaly detection") {
+		return nil
+	}
+	var created []*db.AIAnalysis
+	for _, anomaly := range anomalies {
+		if analysis, ongoing := a.trackAnomaly(key, anomaly); ongoing {
+			a.recordOccurrence(ctx, analysis)
+		} else {
+			created = append(created, analysis)
+		}
+	}
+	if recovered := a.observeRecovery(ctx, key, buckets[len(buckets)-1]); recovered != nil {
+		created = append(created, recovered)
+	}
+
+	// Update error patterns
+	patterns := a.updateErrorPatterns(ctx, key, logs)
+	if skipped("pattern clustering") {
+		return created
+	}
+	return append(created, patterns...)
+}
+
 func (a *Analyzer) groupLogs(logs []*db.ApplicationLog) map[string][]*db.ApplicationLog {
 	groups := make(map[string][]*db.ApplicationLog)
 	for _, log := range logs {
@@ -106,111 +673,310 @@ func (a *Analyzer) groupLogs(logs []*db.ApplicationLog) map[string][]*db.Applica
 	return groups
 }
 
-func (a *Analyzer) updateBaseline(key string, logs []*db.ApplicationLog) {
+// updateBaseline feeds the error rate and latency of every bucket not fed
+// before into the group's baselines, oldest first, so the first cycle
+// learns from the whole lookback. Buckets end at now; one counts as new
+// when most of it lies after the last bucket fed, which tolerates cycles
+// that don't line up exactly with the bucket size. Buckets with fewer than
+// minLogs logs are skipped, and the latest one marks the group as having
+// insufficient data.
+func (a *Analyzer) updateBaseline(key string, buckets []logBucket, window AnalysisWindow, now time.Time) {
+	latest := buckets[len(buckets)-1]
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	if _, exists := a.baselineMetrics[key]; !exists {
 		a.baselineMetrics[key] = &baselineMetrics{
-			ErrorRate: movingAverage{Window: 60}, // 1 hour with minute resolution
-			ResponseTimes: movingAverage{Window: 60},
+			ErrorRate:     newMovingAverage(a.baselineWindow, a.baselineAlpha),
+			ResponseTimes: newMovingAverage(a.baselineWindow, a.baselineAlpha),
 		}
 	}
 
-	// Calculate error rate
-	errorCount := 0
-	for _, log := range logs {
-		if log.Severity == "ERROR" {
-			errorCount++
+	baseline := a.baselineMetrics[key]
+	baseline.InsufficientData = latest.logs < a.minLogs
+
+	fed := false
+	for i, bucket := range buckets {
+		end := now.Add(-time.Duration(len(buckets)-1-i) * window.BucketSize)
+		if end.Sub(baseline.fedUntil) <= window.BucketSize/2 {
+			continue
+		}
+		baseline.fedUntil = end
+		if bucket.logs < a.minLogs {
+			continue
 		}
-	}
-	errorRate := float64(errorCount) / float64(len(logs))
 
-	// Update moving averages
-	baseline := a.baselineMetrics[key]
-	baseline.ErrorRate.Values = append(baseline.ErrorRate.Values, errorRate)
-	if len(baseline.ErrorRate.Values) > baseline.ErrorRate.Window {
-		baseline.ErrorRate.Values = baseline.ErrorRate.Values[1:]
+		baseline.ErrorRate.add(bucket.errorRate())
+		if latency, ok := bucket.latency(); ok {
+			baseline.ResponseTimes.add(latency)
+		}
+		fed = true
 	}
 
-	baseline.UpdatedAt = time.Now()
+	if fed {
+		baseline.UpdatedAt = a.clock.Now()
+	}
 }
 
-func (a *Analyzer) detectAnomalies(key string, logs []*db.ApplicationLog) []*db.AIAnalysis {
+// detectAnomalies compares the latest bucket's error rate with the group's
+// baseline.
+func (a *Analyzer) detectAnomalies(key string, buckets []logBucket, window AnalysisWindow) []*db.AIAnalysis {
+	// A rate over a handful of logs swings wildly, so quiet groups are
+	// skipped
+	latest := buckets[len(buckets)-1]
+	if latest.logs < a.minLogs {
+		return nil
+	}
+
 	a.mu.RLock()
 	baseline, exists := a.baselineMetrics[key]
+	now := a.clock.Now()
+	var history []float64
+	var mean, stdDev float64
+	if exists {
+		mean, stdDev = baseline.ErrorRate.meanStdDev()
+		if a.explain {
+			history = baseline.ErrorRate.history()
+		}
+	}
 	a.mu.RUnlock()
 
-	if !exists || time.Since(baseline.UpdatedAt) > time.Hour {
+	// A baseline is fed once per bucket, so long buckets age it further
+	maxAge := baselineMaxAge
+	if 2*window.BucketSize > maxAge {
+		maxAge = 2 * window.BucketSize
+	}
+	if !exists || now.Sub(baseline.UpdatedAt) > maxAge {
 		return nil
 	}
 
 	var anomalies []*db.AIAnalysis
 
 	// Check for error rate anomalies
-	currentErrorRate := float64(countErrors(logs)) / float64(len(logs))
-	mean, stdDev := stat.MeanStdDev(baseline.ErrorRate.Values, nil)
-	
+	currentErrorRate := latest.errorRate()
+
+	// Keep in sync with SeriesThresholds.AlertAbove
 	if currentErrorRate > mean+2*stdDev {
+		details := map[string]interface{}{
+			"current_rate":    currentErrorRate,
+			"baseline_mean":   mean,
+			"baseline_stddev": stdDev,
+			"bucket_size":     window.BucketSize.String(),
+		}
+		if latency, ok := latest.latency(); ok {
+			details["current_latency_ms"] = latency
+		}
+		if urls := a.traceURLs(latest.traceIDs); len(urls) > 0 {
+			details["trace_urls"] = urls
+		}
+		if a.explain {
+			if explanation := explainLatest(a.seriesDetector(key), history); explanation != nil {
+				details["explanation"] = explanation
+			}
+		}
+		detailsJSON, err := json.Marshal(details)
+		if err != nil {
+			// A flat history yields infinite per-method scores, which JSON
+			// can't represent
+			delete(details, "explanation")
+			detailsJSON, _ = json.Marshal(details)
+		}
+
 		anomalies = append(anomalies, &db.AIAnalysis{
-			Type:        "error_rate_anomaly",
+			ID:          db.NewID(),
+			Type:        TypeErrorRateAnomaly,
 			Severity:    "high",
 			Description: "Abnormal increase in error rate detected",
-			Details: json.RawMessage(fmt.Sprintf(`{
-				"current_rate": %f,
-				"baseline_mean": %f,
-				"baseline_stddev": %f
-			}`, currentErrorRate, mean, stdDev)),
-			DetectedAt: time.Now(),
-			Status:    "active",
+			Details:     detailsJSON,
+			DetectedAt:  now,
+			Status:      StatusActive,
 		})
 	}
 
 	return anomalies
 }
 
-func (a *Analyzer) updateErrorPatterns(key string, logs []*db.ApplicationLog) []*db.AIAnalysis {
+// trackAnomaly folds a fresh detection into the group's open anomaly of the
+// same type. It returns the analysis to store and whether it continues one
+// already stored, in which case its count and LastSeen have been bumped and
+// its details refreshed.
+func (a *Analyzer) trackAnomaly(key string, anomaly *db.AIAnalysis) (*db.AIAnalysis, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id := key + "/" + anomaly.Type
+	if open, exists := a.openAnomalies[id]; exists && anomaly.DetectedAt.Sub(open.LastSeen) <= a.anomalyCooldown {
+		open.Occurrences++
+		open.LastSeen = anomaly.DetectedAt
+		open.Details = anomaly.Details
+		open.Severity = anomaly.Severity
+		updated := *open
+		return &updated, true
+	}
+
+	anomaly.Occurrences = 1
+	anomaly.LastSeen = anomaly.DetectedAt
+	open := *anomaly
+	a.openAnomalies[id] = &open
+	return anomaly, false
+}
+
+// recordOccurrence stores an ongoing anomaly's latest occurrence. Only the
+// fields detection owns are written, onto the stored analysis and under
+// feedbackMu, so a status or verdict set meanwhile isn't overwritten.
+func (a *Analyzer) recordOccurrence(ctx context.Context, update *db.AIAnalysis) {
+	a.feedbackMu.Lock()
+	defer a.feedbackMu.Unlock()
+
+	analysis, err := a.storage.GetAnalysis(ctx, update.ID)
+	if err != nil || analysis == nil {
+		log.Printf("Failed to load ongoing analysis %s: %v", update.ID, err)
+		return
+	}
+	analysis.Occurrences = update.Occurrences
+	analysis.LastSeen = update.LastSeen
+	analysis.Details = update.Details
+	analysis.Severity = update.Severity
+	if err := a.storage.UpdateAnalysis(ctx, analysis); err != nil {
+		log.Printf("Failed to update ongoing analysis %s: %v", update.ID, err)
+	}
+}
+
+// pruneAnomalies forgets anomalies that haven't been seen within the
+// cooldown, so their next detection starts a new analysis.
+func (a *Analyzer) pruneAnomalies() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	for id, open := range a.openAnomalies {
+		if now.Sub(open.LastSeen) > a.anomalyCooldown {
+			delete(a.openAnomalies, id)
+			delete(a.recovering, id)
+		}
+	}
+}
+
+// baselineDetector is the default detector run over per-cycle baseline
+// histories, before AnalyzerConfig's detector options are applied.
+func baselineDetector() *AnomalyDetector {
+	return NewAnomalyDetector(10, 0.95, 0)
+}
+
+// seriesDetector returns a copy of the configured baseline detector for
+// series key, in fast mode if the series is on the fast path.
+func (a *Analyzer) seriesDetector(key string) *AnomalyDetector {
+	detector := a.detector
+	if a.fastPath[key] {
+		detector.DetectionMode = DetectionFast
+		detector.FastMethod = a.fastMethod
+	}
+	return &detector
+}
+
+func historyPoints(history []float64) []TimeSeriesPoint {
+	points := make([]TimeSeriesPoint, len(history))
+	for i, v := range history {
+		points[i] = TimeSeriesPoint{Value: v}
+	}
+	return points
+}
+
+// explainLatest runs detector over a per-cycle history and explains its
+// most recent value.
+func explainLatest(detector *AnomalyDetector, history []float64) *AnomalyExplanation {
+	detector.Explain = true
+
+	results := detector.DetectAnomalies(historyPoints(history))
+	if len(results) == 0 {
+		return nil
+	}
+	return results[len(results)-1].Explanation
+}
+
+// updateErrorPatterns counts the error patterns among logs into the
+// group's tracked clusters and returns an analysis for each that recurs.
+// If ctx ends first it returns nil, leaving the tracked clusters alone.
+func (a *Analyzer) updateErrorPatterns(ctx context.Context, key string, logs []*db.ApplicationLog) []*db.AIAnalysis {
 	errorLogs := filterErrorLogs(logs)
 	if len(errorLogs) == 0 {
 		return nil
 	}
 
+	a.mu.RLock()
+	now := a.clock.Now()
+	a.mu.RUnlock()
+	recentCutoff := now.Add(-patternRateWindow)
+
+	// Count patterns with the space-saving algorithm so a flood of unique
+	// messages can't grow the per-cycle map beyond maxPatternsPerCycle while
+	// frequent patterns still keep accurate counts.
 	patterns := make(map[string]*patternCluster)
-	
-	// Group similar error messages
-	for _, log := range errorLogs {
+	for n, log := range errorLogs {
+		if n%budgetCheckInterval == 0 && ctx.Err() != nil {
+			return nil
+		}
 		pattern := extractErrorPattern(log.Message)
-		if _, exists := patterns[pattern]; !exists {
-			patterns[pattern] = &patternCluster{
+		cluster, exists := patterns[pattern]
+		if !exists {
+			cluster = &patternCluster{
 				Pattern:  pattern,
-				Examples: make([]string, 0),
+				Examples: make([]string, 0, maxPatternExamples),
 				Severity: log.Severity,
+				LastSeen: log.Timestamp,
+			}
+			if len(patterns) >= maxPatternsPerCycle {
+				evicted := leastFrequent(patterns)
+				cluster.Count = evicted.Count
+				cluster.Overcount = evicted.Count
+				cluster.Score = evicted.decayedScore(log.Timestamp, a.patternHalfLife)
+				cluster.Overscore = cluster.Score
+				delete(patterns, evicted.Pattern)
 			}
+			patterns[pattern] = cluster
 		}
-		
-		cluster := patterns[pattern]
+
 		cluster.Count++
-		cluster.LastSeen = log.Timestamp
-		if len(cluster.Examples) < 5 {
+		cluster.observe(log.Timestamp, a.patternHalfLife)
+		if log.Timestamp.After(recentCutoff) {
+			cluster.RecentCount++
+		}
+		if len(cluster.Examples) < maxPatternExamples {
 			cluster.Examples = append(cluster.Examples, log.Message)
 		}
+		if log.TraceID != "" && len(cluster.TraceIDs) < maxTraceLinks {
+			cluster.TraceIDs = append(cluster.TraceIDs, log.TraceID)
+		}
 	}
 
-	// Convert significant patterns to analysis entries
+	a.mergePatternClusters(key, patterns)
+
+	// Convert currently recurring patterns to analysis entries; a pattern
+	// that was frequent but has stopped decays below the threshold, and one
+	// that took over an evicted pattern's score needs enough of its own
 	var analyses []*db.AIAnalysis
 	for _, cluster := range patterns {
-		if cluster.Count >= 3 { // Threshold for significance
+		if score := cluster.certainScore(now, a.patternHalfLife); score >= patternSignificance {
+			fields := map[string]interface{}{
+				"pattern":         cluster.Pattern,
+				"count":           cluster.certainCount(),
+				"score":           score,
+				"rate_per_minute": float64(cluster.RecentCount) / patternRateWindow.Minutes(),
+				"examples":        cluster.Examples,
+			}
+			if urls := a.traceURLs(cluster.TraceIDs); len(urls) > 0 {
+				fields["trace_urls"] = urls
+			}
+			details, _ := json.Marshal(fields)
 			analyses = append(analyses, &db.AIAnalysis{
-				Type:        "error_pattern",
+				ID:          db.NewID(),
+				Type:        TypeErrorPattern,
 				Severity:    cluster.Severity,
 				Description: "Recurring error pattern detected",
-				Details: json.RawMessage(fmt.Sprintf(`{
-					"pattern": %q,
-					"count": %d,
-					"examples": %v
-				}`, cluster.Pattern, cluster.Count, cluster.Examples)),
-				DetectedAt: cluster.LastSeen,
-				Status:    "active",
+				Details:     details,
+				DetectedAt:  cluster.LastSeen,
+				Status:      StatusActive,
 			})
 		}
 	}
@@ -218,14 +984,73 @@ func (a *Analyzer) updateErrorPatterns(key string, logs []*db.ApplicationLog) []
 	return analyses
 }
 
-func countErrors(logs []*db.ApplicationLog) int {
-	count := 0
-	for _, log := range logs {
-		if log.Severity == "ERROR" {
-			count++
+// mergePatternClusters folds one cycle's patterns for key into the persistent
+// clusters and evicts the lowest scoring clusters beyond maxPatternClusters.
+func (a *Analyzer) mergePatternClusters(key string, patterns map[string]*patternCluster) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for pattern, cycle := range patterns {
+		clusterKey := key + "|" + pattern
+		cluster, exists := a.patternClusters[clusterKey]
+		if !exists {
+			a.patternClusters[clusterKey] = &patternCluster{
+				Pattern:  cycle.Pattern,
+				Count:    cycle.certainCount(),
+				LastSeen: cycle.LastSeen,
+				Examples: append([]string(nil), cycle.Examples...),
+				Severity: cycle.Severity,
+				Score:    cycle.Score - cycle.Overscore,
+			}
+			continue
+		}
+
+		// Each cycle re-reads the whole lookback window, so the latest count
+		// and score replace the previous ones rather than adding to them.
+		cluster.Count = cycle.certainCount()
+		cluster.Score = cycle.Score - cycle.Overscore
+		if cycle.LastSeen.After(cluster.LastSeen) {
+			cluster.LastSeen = cycle.LastSeen
+		}
+		for _, example := range cycle.Examples {
+			if len(cluster.Examples) >= maxPatternExamples {
+				break
+			}
+			cluster.Examples = append(cluster.Examples, example)
+		}
+	}
+
+	if len(a.patternClusters) <= maxPatternClusters {
+		return
+	}
+
+	keys := make([]string, 0, len(a.patternClusters))
+	for k := range a.patternClusters {
+		keys = append(keys, k)
+	}
+	now := a.clock.Now()
+	sort.Slice(keys, func(i, j int) bool {
+		ci, cj := a.patternClusters[keys[i]], a.patternClusters[keys[j]]
+		si, sj := ci.decayedScore(now, a.patternHalfLife), cj.decayedScore(now, a.patternHalfLife)
+		if si != sj {
+			return si < sj
+		}
+		return ci.LastSeen.Before(cj.LastSeen)
+	})
+	for _, k := range keys[:len(keys)-maxPatternClusters] {
+		delete(a.patternClusters, k)
+	}
+}
+
+func leastFrequent(patterns map[string]*patternCluster) *patternCluster {
+	var least *patternCluster
+	for _, cluster := range patterns {
+		if least == nil || cluster.Count < least.Count ||
+			(cluster.Count == least.Count && cluster.LastSeen.Before(least.LastSeen)) {
+			least = cluster
 		}
 	}
-	return count
+	return least
 }
 
 func filterErrorLogs(logs []*db.ApplicationLog) []*db.ApplicationLog {
@@ -241,18 +1066,18 @@ func filterErrorLogs(logs []*db.ApplicationLog) []*db.ApplicationLog {
 func extractErrorPattern(message string) string {
 	// Remove variable parts like IDs, timestamps, etc.
 	pattern := message
-	
+
 	// Replace numbers
 	pattern = regexp.MustCompile(`\d+`).ReplaceAllString(pattern, "N")
-	
+
 	// Replace UUIDs
 	pattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`).ReplaceAllString(pattern, "UUID")
-	
+
 	// Replace timestamps
 	pattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`).ReplaceAllString(pattern, "TIMESTAMP")
-	
+
 	// Replace email addresses
 	pattern = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`).ReplaceAllString(pattern, "EMAIL")
-	
+
 	return pattern
 }
@@ -0,0 +1,432 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/clock"
+	"api-watchtower/internal/db"
+)
+
+// memStorage is an in-memory Storage.
+type memStorage struct {
+	mu       sync.Mutex
+	logs     []*db.ApplicationLog
+	analyses map[string]*db.AIAnalysis
+	saved    []string
+	// batchErr fails BatchSaveAnalysis while set
+	batchErr error
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{analyses: make(map[string]*db.AIAnalysis)}
+}
+
+func (s *memStorage) GetRecentLogs(ctx context.Context, duration time.Duration) ([]*db.ApplicationLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*db.ApplicationLog(nil), s.logs...), nil
+}
+
+func (s *memStorage) SaveAnalysis(ctx context.Context, analysis *db.AIAnalysis) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *analysis
+	s.analyses[analysis.ID] = &copied
+	s.saved = append(s.saved, analysis.ID)
+	return nil
+}
+
+func (s *memStorage) BatchSaveAnalysis(ctx context.Context, analyses []*db.AIAnalysis) error {
+	s.mu.Lock()
+	err := s.batchErr
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, analysis := range analyses {
+		s.SaveAnalysis(ctx, analysis)
+	}
+	return nil
+}
+
+func (s *memStorage) UpdateAnalysis(ctx context.Context, analysis *db.AIAnalysis) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *analysis
+	s.analyses[analysis.ID] = &copied
+	return nil
+}
+
+func (s *memStorage) GetAnalysis(ctx context.Context, id string) (*db.AIAnalysis, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	analysis, ok := s.analyses[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *analysis
+	return &copied, nil
+}
+
+func (s *memStorage) GetAnalyses(ctx context.Context, query AnalysisQuery) ([]*db.AIAnalysis, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var analyses []*db.AIAnalysis
+	for _, analysis := range s.analyses {
+		copied := *analysis
+		analyses = append(analyses, &copied)
+	}
+	return analyses, nil
+}
+
+// newTestAnalyzer returns an analyzer on a fake clock whose background
+// cycles never run, so tests drive analyze themselves.
+func newTestAnalyzer(t *testing.T, storage Storage, cfg AnalyzerConfig) (*Analyzer, *clock.Fake) {
+	t.Helper()
+	cfg.UpdateInterval = time.Hour
+	a, err := NewAnalyzer(storage, cfg)
+	if err != nil {
+		t.Fatalf("NewAnalyzer: %v", err)
+	}
+	t.Cleanup(func() { a.Stop(context.Background()) })
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	a.SetClock(clk)
+	return a, clk
+}
+
+func errorLog(message string, ts time.Time) *db.ApplicationLog {
+	return &db.ApplicationLog{
+		ApplicationID: "app",
+		ServiceName:   "api",
+		Severity:      "ERROR",
+		Message:       message,
+		Timestamp:     ts,
+	}
+}
+
+func TestUpdateErrorPatternsBoundsUniqueFlood(t *testing.T) {
+	a, clk := newTestAnalyzer(t, newMemStorage(), AnalyzerConfig{})
+	now := clk.Now()
+
+	// A flood of messages that each occur once, as with unique request
+	// payloads in the message, followed by one genuinely recurring pattern
+	var logs []*db.ApplicationLog
+	for i := 0; i < 5*maxPatternsPerCycle; i++ {
+		logs = append(logs, errorLog(fmt.Sprintf("unexpected token %s", letters(i)), now))
+	}
+	for i := 0; i < 5; i++ {
+		logs = append(logs, errorLog("connection refused by upstream", now))
+	}
+
+	analyses := a.updateErrorPatterns(context.Background(), "app:api", logs)
+
+	a.mu.RLock()
+	clusters := len(a.patternClusters)
+	a.mu.RUnlock()
+	if clusters > maxPatternsPerCycle {
+		t.Errorf("tracked %d clusters, want at most %d", clusters, maxPatternsPerCycle)
+	}
+	if len(analyses) != 1 {
+		t.Fatalf("got %d pattern analyses, want 1 for the recurring pattern", len(analyses))
+	}
+	if got := string(analyses[0].Details); !strings.Contains(got, "connection refused by upstream") {
+		t.Errorf("reported pattern %s, want the recurring one", got)
+	}
+
+	// Scores taken over from evicted patterns aren't the new ones' own
+	for _, cluster := range a.ErrorClusters("app:api", 0) {
+		if cluster.Pattern != "connection refused by upstream" && cluster.Score >= patternSignificance {
+			t.Errorf("pattern %q scored %.1f from one occurrence", cluster.Pattern, cluster.Score)
+		}
+	}
+}
+
+// letters spells i in base 26, since patterns mask out digits.
+func letters(i int) string {
+	s := string(rune('a' + i%26))
+	for i /= 26; i > 0; i /= 26 {
+		s = string(rune('a'+i%26)) + s
+	}
+	return s
+}
+
+func TestLowVolumeGroupRaisesNoAnomaly(t *testing.T) {
+	storage := newMemStorage()
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{
+		Window: AnalysisWindow{Lookback: time.Minute, BucketSize: time.Minute},
+	})
+
+	for i := 0; i < 10; i++ {
+		runCycle(t, a, clk, storage, 1+i%2)
+	}
+	// Two logs, both errors: a 100% error rate from too few logs to trust
+	runCycleOf(t, a, clk, storage, 2, 2)
+
+	if got := analysesOfType(storage, TypeErrorRateAnomaly); len(got) != 0 {
+		t.Errorf("got %d anomalies from two logs, want none", len(got))
+	}
+	thresholds := a.Thresholds("app:api")
+	if len(thresholds) == 0 || !thresholds[0].InsufficientData {
+		t.Errorf("thresholds %+v, want the group marked as having insufficient data", thresholds)
+	}
+
+	// The same error rate from enough logs is an anomaly
+	runCycle(t, a, clk, storage, 20)
+	if got := analysesOfType(storage, TypeErrorRateAnomaly); len(got) != 1 {
+		t.Errorf("got %d anomalies from a full minute of errors, want 1", len(got))
+	}
+}
+
+// blockingStorage holds GetRecentLogs until its context ends.
+type blockingStorage struct {
+	*memStorage
+	started chan struct{}
+}
+
+func (s *blockingStorage) GetRecentLogs(ctx context.Context, duration time.Duration) ([]*db.ApplicationLog, error) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestStopCancelsCycleAndExits(t *testing.T) {
+	storage := &blockingStorage{memStorage: newMemStorage(), started: make(chan struct{}, 1)}
+	a, err := NewAnalyzer(storage, AnalyzerConfig{UpdateInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewAnalyzer: %v", err)
+	}
+
+	// Wait for a cycle to be in flight
+	select {
+	case <-storage.started:
+	case <-time.After(time.Second):
+		t.Fatal("no analysis cycle started")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := a.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case <-a.done:
+	default:
+		t.Error("background loop still running after Stop")
+	}
+}
+
+func TestAnalyzeGroupStopsWhenBudgetRunsOut(t *testing.T) {
+	a, clk := newTestAnalyzer(t, newMemStorage(), AnalyzerConfig{})
+	var logs []*db.ApplicationLog
+	for i := 0; i < 3*budgetCheckInterval; i++ {
+		logs = append(logs, errorLog("connection refused by upstream", clk.Now().Add(-time.Second)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if analyses := a.analyzeGroup(ctx, "app:api", logs); len(analyses) != 0 {
+		t.Errorf("got %d analyses after the budget ran out", len(analyses))
+	}
+	if analyses := a.updateErrorPatterns(ctx, "app:api", logs); analyses != nil {
+		t.Errorf("got %d pattern analyses after the budget ran out", len(analyses))
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if len(a.baselineMetrics) != 0 || len(a.patternClusters) != 0 {
+		t.Errorf("tracked %d baselines and %d patterns from an analysis out of budget", len(a.baselineMetrics), len(a.patternClusters))
+	}
+}
+
+func TestExponentialBaselineFollowsWindow(t *testing.T) {
+	storage := newMemStorage()
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{
+		Window:              AnalysisWindow{Lookback: time.Minute, BucketSize: time.Minute},
+		BaselineWindow:      9,
+		BaselineExponential: true,
+	})
+	runCycle(t, a, clk, storage, 1)
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if len(a.baselineMetrics) == 0 {
+		t.Fatal("no baseline after a cycle")
+	}
+	for key, baseline := range a.baselineMetrics {
+		if baseline.ErrorRate.Alpha != 0.2 || baseline.ResponseTimes.Alpha != 0.2 {
+			t.Errorf("%s baselines use alpha %v and %v, want 2/(9+1)", key, baseline.ErrorRate.Alpha, baseline.ResponseTimes.Alpha)
+		}
+	}
+}
+
+func TestFailedBatchFallsBackToSingleSaves(t *testing.T) {
+	storage := newMemStorage()
+	storage.batchErr = errors.New("batch too large")
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{
+		Window: AnalysisWindow{Lookback: time.Minute, BucketSize: time.Minute},
+	})
+
+	for i := range 10 {
+		runCycle(t, a, clk, storage, 1+i%2)
+	}
+	runCycle(t, a, clk, storage, 18)
+
+	if got := analysesOfType(storage, TypeErrorRateAnomaly); len(got) != 1 {
+		t.Errorf("saved %d anomalies with batches failing, want 1", len(got))
+	}
+}
+
+func TestBaselineLearnsWholeLookback(t *testing.T) {
+	storage := newMemStorage()
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{
+		Window: AnalysisWindow{Lookback: 10 * time.Minute, BucketSize: time.Minute},
+	})
+
+	// One bucket's worth of logs, ending a second before end
+	addMinute := func(end time.Time) {
+		storage.mu.Lock()
+		defer storage.mu.Unlock()
+		for i := range 20 {
+			severity := "INFO"
+			if i < 2 {
+				severity = "ERROR"
+			}
+			storage.logs = append(storage.logs, &db.ApplicationLog{
+				ID: db.NewID(), ApplicationID: "app", ServiceName: "api", Severity: severity, Message: "request handled",
+				Timestamp: end.Add(-time.Second),
+			})
+		}
+	}
+
+	// Ten minutes of history
+	for m := range 10 {
+		addMinute(clk.Now().Add(-time.Duration(m) * time.Minute))
+	}
+
+	baselineValues := func() int {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return len(a.baselineMetrics["app:api"].ErrorRate.history())
+	}
+
+	a.analyze(context.Background())
+	if got := baselineValues(); got != 10 {
+		t.Fatalf("baseline holds %d buckets after the first cycle, want the lookback's 10", got)
+	}
+
+	// The next cycle only adds the bucket it hasn't seen
+	a.analyze(context.Background())
+	if got := baselineValues(); got != 10 {
+		t.Errorf("baseline holds %d buckets after rerunning on the same minute, want 10", got)
+	}
+	clk.Advance(time.Minute)
+	addMinute(clk.Now())
+	a.analyze(context.Background())
+	if got := baselineValues(); got != 11 {
+		t.Errorf("baseline holds %d buckets a minute later, want 11", got)
+	}
+}
+
+func TestEnsembleModes(t *testing.T) {
+	// Per-method results for z-score, IQR and seasonal
+	var (
+		oneConfident = []AnomalyResult{{IsAnomaly: true, Score: 2}, {Score: 0.5}, {Score: 0.5}}
+		oneMild      = []AnomalyResult{{IsAnomaly: true, Score: 1.5}, {Score: 0.3}, {Score: 0.3}}
+		oneUnflagged = []AnomalyResult{{Score: 1.2}, {Score: 0.2}, {Score: 0.2}}
+		twoFlagged   = []AnomalyResult{{IsAnomaly: true, Score: 1.1}, {IsAnomaly: true, Score: 1.1}, {Score: 0}}
+	)
+
+	tests := []struct {
+		mode string
+		want []bool // verdicts for oneConfident, oneMild, oneUnflagged, twoFlagged
+	}{
+		{"", []bool{true, false, false, false}},
+		{EnsembleWeighted, []bool{true, false, false, false}},
+		{EnsembleMajority, []bool{false, false, false, true}},
+		{EnsembleMax, []bool{true, true, true, true}},
+		{EnsembleAny, []bool{true, true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			a, _ := newTestAnalyzer(t, newMemStorage(), AnalyzerConfig{EnsembleMode: tt.mode})
+			detector := a.seriesDetector("app:api")
+			for i, results := range [][]AnomalyResult{oneConfident, oneMild, oneUnflagged, twoFlagged} {
+				if got := detector.ensembleResults(results...).IsAnomaly; got != tt.want[i] {
+					t.Errorf("case %d: anomaly = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	var errs db.ValidationErrors
+	if _, err := NewAnalyzer(newMemStorage(), AnalyzerConfig{EnsembleMode: "unanimous"}); !errors.As(err, &errs) || errs[0].Field != "ensemble_mode" {
+		t.Errorf("NewAnalyzer with an unknown ensemble mode returned %v, want an ensemble_mode validation error", err)
+	}
+}
+
+func TestPercentileModeFromConfig(t *testing.T) {
+	// A right-skewed series: mostly small values with a long tail
+	points := make([]TimeSeriesPoint, 100)
+	sorted := make([]float64, len(points))
+	for i := range points {
+		points[i] = TimeSeriesPoint{Value: math.Exp(float64(i%50) / 8)}
+		sorted[i] = points[i].Value
+	}
+	sort.Float64s(sorted)
+
+	flagged := func(lower, upper float64) (Range, int) {
+		t.Helper()
+		a, _ := newTestAnalyzer(t, newMemStorage(), AnalyzerConfig{
+			DetectionMode:   DetectionPercentile,
+			LowerPercentile: lower,
+			UpperPercentile: upper,
+		})
+		detector := a.seriesDetector("app:api")
+		n := 0
+		for _, r := range detector.DetectAnomalies(points) {
+			if r.IsAnomaly {
+				n++
+			}
+		}
+		return detector.CurrentThresholds(points), n
+	}
+
+	expected, narrow := flagged(10, 90)
+	if want := (Range{Lower: quantile(sorted, 0.1), Upper: quantile(sorted, 0.9)}); expected != want {
+		t.Errorf("expected range %+v, want the 10th to 90th percentiles %+v", expected, want)
+	}
+	if _, wide := flagged(0, 0); wide >= narrow {
+		t.Errorf("default 1st to 99th percentiles flag %d points, want fewer than the %d of 10th to 90th", wide, narrow)
+	}
+
+	for _, tt := range []struct {
+		name         string
+		lower, upper float64
+	}{
+		{"equal", 50, 50},
+		{"inverted", 90, 10},
+		{"negative", -1, 99},
+		{"hundred", 1, 100},
+		{"lower above default upper", 99.5, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs db.ValidationErrors
+			_, err := NewAnalyzer(newMemStorage(), AnalyzerConfig{LowerPercentile: tt.lower, UpperPercentile: tt.upper})
+			if !errors.As(err, &errs) {
+				t.Errorf("percentiles %g and %g got %v, want a validation error", tt.lower, tt.upper, err)
+			}
+		})
+	}
+}
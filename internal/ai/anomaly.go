@@ -9,358 +9,294 @@ import (
 	"gonum.org/v1/gonum/stat/distuv"
 )
 
-// AnomalyDetector implements various statistical methods for anomaly detection
+// AnomalyDetector implements various anomaly detection algorithms
 type AnomalyDetector struct {
-	// Configuration parameters
-	MinDataPoints    int     // Minimum number of points needed for analysis
-	ConfidenceLevel float64 // Statistical confidence level (e.g., 0.95)
-	WindowSize      int     // Size of sliding window for local analysis
-	SeasonalPeriod  int     // For seasonal patterns (e.g., 24 for hourly data)
+	// Configuration
+	MinDataPoints   int
+	ConfidenceLevel float64
+	SeasonalPeriod  int    // For seasonal data (e.g., 24 for hourly data with daily patterns)
+	EnsembleMode    string // How per-method verdicts combine; see the Ensemble* constants
+	Explain         bool   // Attach an Explanation to every result; off by default
+	TrendMethod     string // How the seasonal trend is smoothed; see the Trend* constants
+	DetectionMode   string // Ensemble of methods or a percentile interval; see the Detection* constants
+
+	// LowerPercentile and UpperPercentile bound the expected range in
+	// percentile mode, as quantiles between 0 and 1. Default to 0.01 and
+	// 0.99.
+	LowerPercentile float64
+	UpperPercentile float64
+
+	// FastMethod is the only method run in fast mode and by
+	// DetectAnomaliesFast: zscore, the default, iqr or ewma.
+	FastMethod string
 }
 
-// TimeSeriesPoint represents a single observation in time
+// Detection modes
+const (
+	// DetectionEnsemble combines the z-score, IQR and seasonal methods; it
+	// is the default
+	DetectionEnsemble = "ensemble"
+	// DetectionPercentile expects values within an empirical quantile
+	// interval of the series, which suits skewed metrics that sigma-based
+	// methods misjudge
+	DetectionPercentile = "percentile"
+	// DetectionFast runs FastMethod alone, without the ensemble; see
+	// DetectAnomaliesFast
+	DetectionFast = "fast"
+)
+
+const (
+	defaultLowerPercentile = 0.01
+	defaultUpperPercentile = 0.99
+)
+
+// Ensemble modes for combining the z-score, IQR and seasonal verdicts
+const (
+	// EnsembleWeighted flags a point when the weighted mean score exceeds 1
+	EnsembleWeighted = "weighted"
+	// EnsembleMajority flags a point when at least two of three methods do
+	EnsembleMajority = "majority"
+	// EnsembleMax uses the strongest single method's score
+	EnsembleMax = "max"
+	// EnsembleAny flags a point when any method is confident it is anomalous
+	EnsembleAny = "any"
+)
+
+// Trend smoothing methods for seasonal decomposition
+const (
+	// TrendMovingAverage averages each point's window; it is the default
+	TrendMovingAverage = "moving_average"
+	// TrendMedian takes each window's median, so a single spike doesn't
+	// pull the trend, and with it the expected range, of its neighbours
+	TrendMedian = "median"
+)
+
+func NewAnomalyDetector(minDataPoints int, confidenceLevel float64, seasonalPeriod int) *AnomalyDetector {
+	return &AnomalyDetector{
+		MinDataPoints:   minDataPoints,
+		ConfidenceLevel: confidenceLevel,
+		SeasonalPeriod:  seasonalPeriod,
+		EnsembleMode:    EnsembleWeighted,
+		TrendMethod:     TrendMovingAverage,
+		DetectionMode:   DetectionEnsemble,
+	}
+}
+
+// TimeSeriesPoint represents a data point in time series
 type TimeSeriesPoint struct {
 	Timestamp time.Time
 	Value     float64
-	Metadata  map[string]interface{}
 }
 
-// AnomalyResult contains the analysis results for a data point
+// AnomalyResult represents the result of anomaly detection
 type AnomalyResult struct {
 	IsAnomaly       bool
-	Score           float64    // Normalized anomaly score (0-1)
-	Probability     float64    // Probability of being normal
-	ExpectedRange   Range      // Expected value range
-	Method          string     // Detection method used
-	Timestamp       time.Time
+	Score           float64
+	ExpectedRange   Range
+	DeviationFactor float64
+	// Explanation is only set when the detector's Explain flag is on
+	Explanation *AnomalyExplanation
 }
 
 type Range struct {
-	Lower float64
-	Upper float64
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
 }
 
-func NewAnomalyDetector(config map[string]interface{}) *AnomalyDetector {
-	detector := &AnomalyDetector{
-		MinDataPoints:    30,
-		ConfidenceLevel: 0.95,
-		WindowSize:      20,
-		SeasonalPeriod:  24,
-	}
-
-	// Override defaults with provided config
-	if minPoints, ok := config["min_data_points"].(int); ok {
-		detector.MinDataPoints = minPoints
-	}
-	if confidence, ok := config["confidence_level"].(float64); ok {
-		detector.ConfidenceLevel = confidence
-	}
-	if window, ok := config["window_size"].(int); ok {
-		detector.WindowSize = window
-	}
-	if period, ok := config["seasonal_period"].(int); ok {
-		detector.SeasonalPeriod = period
-	}
+// AnomalyExplanation describes why a point was, or was not, flagged.
+type AnomalyExplanation struct {
+	// Methods holds each detection method's own verdict
+	Methods []MethodVerdict `json:"methods"`
+	// Sigmas is the distance from the mean in standard deviations
+	Sigmas float64 `json:"sigmas"`
+	// MADs is the distance from the median in median absolute deviations
+	MADs float64 `json:"mads"`
+	// Trend and Seasonal are the point's trend and seasonal offsets from the
+	// series mean; both are zero when the series is too short to decompose
+	Trend    float64 `json:"trend"`
+	Seasonal float64 `json:"seasonal"`
+	// DominantComponent is "trend" or "seasonal", whichever offset is larger
+	DominantComponent string `json:"dominant_component,omitempty"`
+}
 
-	return detector
+type MethodVerdict struct {
+	Method        string  `json:"method"`
+	IsAnomaly     bool    `json:"is_anomaly"`
+	Score         float64 `json:"score"`
+	ExpectedRange Range   `json:"expected_range"`
 }
 
-// DetectAnomalies performs ensemble anomaly detection using multiple methods
+// Detection method names used in explanations
+const (
+	MethodZScore   = "zscore"
+	MethodIQR      = "iqr"
+	MethodSeasonal = "seasonal"
+	// MethodPercentile is the only method of percentile mode
+	MethodPercentile = "percentile"
+	// MethodEWMA compares each point with an exponentially weighted
+	// average of the points before it; fast mode only
+	MethodEWMA = "ewma"
+)
+
+// DetectAnomalies uses multiple methods to detect anomalies
 func (d *AnomalyDetector) DetectAnomalies(points []TimeSeriesPoint) []AnomalyResult {
 	if len(points) < d.MinDataPoints {
 		return make([]AnomalyResult, len(points))
 	}
 
-	results := make([]AnomalyResult, len(points))
-	
-	// Apply different detection methods
-	statisticalResults := d.statisticalDetection(points)
-	seasonalResults := d.seasonalDetection(points)
-	robustResults := d.robustDetection(points)
-
-	// Combine results using weighted ensemble
-	weights := map[string]float64{
-		"statistical": 0.4,
-		"seasonal":   0.3,
-		"robust":     0.3,
+	if d.DetectionMode == DetectionPercentile {
+		results := d.percentileDetection(points)
+		if d.Explain {
+			for i := range results {
+				results[i].Explanation = &AnomalyExplanation{
+					Methods: []MethodVerdict{verdict(MethodPercentile, results[i])},
+				}
+			}
+		}
+		return results
 	}
-
-	for i := range points {
-		results[i] = d.ensembleResults(
-			statisticalResults[i],
-			seasonalResults[i],
-			robustResults[i],
-			weights,
-			points[i].Timestamp,
-		)
+	if d.DetectionMode == DetectionFast {
+		return d.DetectAnomaliesFast(points)
 	}
 
-	return results
-}
-
-// statisticalDetection uses parametric statistical methods
-func (d *AnomalyDetector) statisticalDetection(points []TimeSeriesPoint) []AnomalyResult {
-	values := make([]float64, len(points))
-	for i, p := range points {
-		values[i] = p.Value
-	}
+	// Get results from different methods
+	zscore := d.zScoreDetection(points)
+	iqr := d.iqrDetection(points)
+	seasonal := d.seasonalDecomposition(points)
 
+	// Combine results using ensemble method
 	results := make([]AnomalyResult, len(points))
-	
-	// Calculate rolling statistics
 	for i := range points {
-		start := max(0, i-d.WindowSize)
-		window := values[start:i+1]
-		
-		if len(window) < 3 {
-			continue
-		}
+		results[i] = d.ensembleResults(zscore[i], iqr[i], seasonal[i])
+	}
 
-		mean, std := stat.MeanStdDev(window, nil)
-		
-		// Use Student's t-distribution for small sample sizes
-		df := float64(len(window) - 1)
-		dist := distuv.StudentsT{Mu: mean, Sigma: std, Nu: df}
-		
-		value := points[i].Value
-		prob := 2 * min(dist.CDF(value), 1-dist.CDF(value)) // Two-tailed test
-		
-		criticalValue := dist.Quantile(1 - (1-d.ConfidenceLevel)/2)
-		
-		results[i] = AnomalyResult{
-			IsAnomaly:   prob < (1 - d.ConfidenceLevel),
-			Score:       math.Abs((value - mean) / std),
-			Probability: prob,
-			ExpectedRange: Range{
-				Lower: mean - criticalValue*std,
-				Upper: mean + criticalValue*std,
-			},
-			Method:    "statistical",
-			Timestamp: points[i].Timestamp,
-		}
+	if d.Explain {
+		d.explain(points, results, zscore, iqr, seasonal)
 	}
 
 	return results
 }
 
-// seasonalDetection handles seasonal patterns in the data
-func (d *AnomalyDetector) seasonalDetection(points []TimeSeriesPoint) []AnomalyResult {
-	if len(points) < 2*d.SeasonalPeriod {
-		return make([]AnomalyResult, len(points))
-	}
-
-	results := make([]AnomalyResult, len(points))
-	
-	// Calculate seasonal components
-	seasonal := make([]float64, d.SeasonalPeriod)
-	seasonalStd := make([]float64, d.SeasonalPeriod)
-	
-	for i := 0; i < d.SeasonalPeriod; i++ {
-		values := make([]float64, 0)
-		for j := i; j < len(points); j += d.SeasonalPeriod {
-			values = append(values, points[j].Value)
-		}
-		
-		if len(values) > 0 {
-			seasonal[i], seasonalStd[i] = stat.MeanStdDev(values, nil)
+// CurrentThresholds returns the combined expected range DetectAnomalies would
+// apply to the latest point of the series, without classifying anything.
+// It is the zero Range when the series is too short to judge.
+func (d *AnomalyDetector) CurrentThresholds(points []TimeSeriesPoint) Range {
+	if d.DetectionMode == DetectionPercentile {
+		if len(points) == 0 || len(points) < d.MinDataPoints {
+			return Range{}
 		}
+		return d.percentileDetection(points)[len(points)-1].ExpectedRange
 	}
-
-	// Detect anomalies using seasonal patterns
-	for i, point := range points {
-		idx := i % d.SeasonalPeriod
-		expected := seasonal[idx]
-		stdDev := seasonalStd[idx]
-		
-		if stdDev == 0 {
-			continue
-		}
-
-		deviation := math.Abs(point.Value - expected) / stdDev
-		prob := 2 * (1 - stat.NormalCDF(deviation, 0, 1))
-
-		results[i] = AnomalyResult{
-			IsAnomaly:   deviation > 3, // 3-sigma rule
-			Score:       deviation / 3,  // Normalize to 0-1
-			Probability: prob,
-			ExpectedRange: Range{
-				Lower: expected - 3*stdDev,
-				Upper: expected + 3*stdDev,
-			},
-			Method:    "seasonal",
-			Timestamp: point.Timestamp,
+	if d.DetectionMode == DetectionFast {
+		if len(points) == 0 || len(points) < d.MinDataPoints {
+			return Range{}
 		}
+		return d.DetectAnomaliesFast(points)[len(points)-1].ExpectedRange
 	}
 
-	return results
-}
-
-// robustDetection uses non-parametric methods resistant to outliers
-func (d *AnomalyDetector) robustDetection(points []TimeSeriesPoint) []AnomalyResult {
-	results := make([]AnomalyResult, len(points))
-	
-	for i := range points {
-		start := max(0, i-d.WindowSize)
-		window := make([]float64, i-start+1)
-		for j := range window {
-			window[j] = points[start+j].Value
-		}
-		
-		if len(window) < 3 {
-			continue
-		}
-
-		// Calculate median and MAD (Median Absolute Deviation)
-		median := stat.Quantile(0.5, stat.Empirical, window, nil)
-		deviations := make([]float64, len(window))
-		for j := range window {
-			deviations[j] = math.Abs(window[j] - median)
-		}
-		mad := stat.Quantile(0.5, stat.Empirical, deviations, nil) * 1.4826 // Scale factor for normal distribution
-
-		value := points[i].Value
-		score := math.Abs(value - median) / mad
-		
-		results[i] = AnomalyResult{
-			IsAnomaly:   score > 3.5, // Approximately equivalent to 3-sigma
-			Score:       score / 3.5,
-			Probability: 2 * (1 - stat.NormalCDF(score, 0, 1)),
-			ExpectedRange: Range{
-				Lower: median - 3.5*mad,
-				Upper: median + 3.5*mad,
-			},
-			Method:    "robust",
-			Timestamp: points[i].Timestamp,
-		}
+	zscore, iqr, seasonal, ok := d.latestMethodResults(points)
+	if !ok {
+		return Range{}
 	}
-
-	return results
+	return d.ensembleResults(zscore, iqr, seasonal).ExpectedRange
 }
 
-// ensembleResults combines results from multiple detection methods
-func (d *AnomalyDetector) ensembleResults(results ...AnomalyResult) AnomalyResult {
-	weights := map[string]float64{
-		"statistical": 0.4,
-		"seasonal":   0.3,
-		"robust":     0.3,
-	}
-
-	var weightedScore float64
-	var weightedProb float64
-	var totalWeight float64
-
-	for _, result := range results {
-		if weight, ok := weights[result.Method]; ok {
-			weightedScore += result.Score * weight
-			weightedProb += result.Probability * weight
-			totalWeight += weight
+// MethodThresholds breaks CurrentThresholds down by detection method.
+// Methods that can't judge the series, such as seasonal decomposition on a
+// short series, are left out.
+func (d *AnomalyDetector) MethodThresholds(points []TimeSeriesPoint) map[string]Range {
+	if d.DetectionMode == DetectionPercentile {
+		if r := d.CurrentThresholds(points); r != (Range{}) {
+			return map[string]Range{MethodPercentile: r}
 		}
+		return nil
 	}
-
-	if totalWeight > 0 {
-		weightedScore /= totalWeight
-		weightedProb /= totalWeight
-	}
-
-	// Combine ranges using weighted average
-	var combinedRange Range
-	for _, result := range results {
-		if weight, ok := weights[result.Method]; ok {
-			combinedRange.Lower += result.ExpectedRange.Lower * weight
-			combinedRange.Upper += result.ExpectedRange.Upper * weight
+	if d.DetectionMode == DetectionFast {
+		if r := d.CurrentThresholds(points); r != (Range{}) {
+			return map[string]Range{d.fastMethod(): r}
 		}
-	}
-	
-	if totalWeight > 0 {
-		combinedRange.Lower /= totalWeight
-		combinedRange.Upper /= totalWeight
+		return nil
 	}
 
-	return AnomalyResult{
-		IsAnomaly:     weightedScore > 1.0,
-		Score:         weightedScore,
-		Probability:   weightedProb,
-		ExpectedRange: combinedRange,
-		Method:        "ensemble",
-		Timestamp:     results[0].Timestamp,
+	zscore, iqr, seasonal, ok := d.latestMethodResults(points)
+	if !ok {
+		return nil
 	}
-}
 
-func max(a, b int) int {
-	if a > b {
-		return a
+	thresholds := make(map[string]Range)
+	for method, result := range map[string]AnomalyResult{
+		MethodZScore:   zscore,
+		MethodIQR:      iqr,
+		MethodSeasonal: seasonal,
+	} {
+		if result.ExpectedRange.Lower != result.ExpectedRange.Upper {
+			thresholds[method] = result.ExpectedRange
+		}
 	}
-	return b
+	return thresholds
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+func (d *AnomalyDetector) latestMethodResults(points []TimeSeriesPoint) (AnomalyResult, AnomalyResult, AnomalyResult, bool) {
+	if len(points) == 0 || len(points) < d.MinDataPoints {
+		return AnomalyResult{}, AnomalyResult{}, AnomalyResult{}, false
 	}
-	return b
-}
-
-import (
-	"math"
-	"sort"
-	"time"
-
-	"gonum.org/v1/gonum/stat"
-)
 
-// AnomalyDetector implements various anomaly detection algorithms
-type AnomalyDetector struct {
-	// Configuration
-	MinDataPoints    int
-	ConfidenceLevel float64
-	SeasonalPeriod  int // For seasonal data (e.g., 24 for hourly data with daily patterns)
+	last := len(points) - 1
+	return d.zScoreDetection(points)[last], d.iqrDetection(points)[last], d.seasonalDecomposition(points)[last], true
 }
 
-func NewAnomalyDetector(minDataPoints int, confidenceLevel float64, seasonalPeriod int) *AnomalyDetector {
-	return &AnomalyDetector{
-		MinDataPoints:    minDataPoints,
-		ConfidenceLevel: confidenceLevel,
-		SeasonalPeriod:  seasonalPeriod,
+// explain attaches an Explanation to every result from the per-method
+// results it was combined from.
+func (d *AnomalyDetector) explain(points []TimeSeriesPoint, results, zscore, iqr, seasonal []AnomalyResult) {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Value
 	}
-}
-
-// TimeSeriesPoint represents a data point in time series
-type TimeSeriesPoint struct {
-	Timestamp time.Time
-	Value     float64
-}
-
-// AnomalyResult represents the result of anomaly detection
-type AnomalyResult struct {
-	IsAnomaly       bool
-	Score           float64
-	ExpectedRange   Range
-	DeviationFactor float64
-}
-
-type Range struct {
-	Lower float64
-	Upper float64
-}
+	mean := stat.Mean(values, nil)
 
-// DetectAnomalies uses multiple methods to detect anomalies
-func (d *AnomalyDetector) DetectAnomalies(points []TimeSeriesPoint) []AnomalyResult {
-	if len(points) < d.MinDataPoints {
-		return make([]AnomalyResult, len(points))
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	median := quantile(sorted, 0.5)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
 	}
+	sort.Float64s(deviations)
+	mad := quantile(deviations, 0.5)
 
-	// Get results from different methods
-	zscore := d.zScoreDetection(points)
-	iqr := d.iqrDetection(points)
-	seasonal := d.seasonalDecomposition(points)
+	trend, phase := d.decompose(points)
 
-	// Combine results using ensemble method
-	results := make([]AnomalyResult, len(points))
-	for i := range points {
-		results[i] = d.ensembleResults(zscore[i], iqr[i], seasonal[i])
+	for i, v := range values {
+		explanation := &AnomalyExplanation{
+			Methods: []MethodVerdict{
+				verdict(MethodZScore, zscore[i]),
+				verdict(MethodIQR, iqr[i]),
+				verdict(MethodSeasonal, seasonal[i]),
+			},
+			Sigmas: zscore[i].DeviationFactor,
+		}
+		if mad > 0 {
+			explanation.MADs = math.Abs(v-median) / mad
+		}
+		if trend != nil {
+			explanation.Trend = trend[i] - mean
+			explanation.Seasonal = phase[i%d.SeasonalPeriod] - mean
+			explanation.DominantComponent = "trend"
+			if math.Abs(explanation.Seasonal) > math.Abs(explanation.Trend) {
+				explanation.DominantComponent = "seasonal"
+			}
+		}
+		results[i].Explanation = explanation
 	}
+}
 
-	return results
+func verdict(method string, result AnomalyResult) MethodVerdict {
+	return MethodVerdict{
+		Method:        method,
+		IsAnomaly:     result.IsAnomaly,
+		Score:         result.Score,
+		ExpectedRange: result.ExpectedRange,
+	}
 }
 
 // Z-Score based anomaly detection
@@ -371,7 +307,7 @@ func (d *AnomalyDetector) zScoreDetection(points []TimeSeriesPoint) []AnomalyRes
 	}
 
 	mean, std := stat.MeanStdDev(values, nil)
-	threshold := stat.InvNormalCDF(1-(1-d.ConfidenceLevel)/2) // Two-tailed test
+	threshold := distuv.UnitNormal.Quantile(1 - (1-d.ConfidenceLevel)/2) // Two-tailed test
 
 	results := make([]AnomalyResult, len(points))
 	for i, v := range values {
@@ -427,26 +363,63 @@ func (d *AnomalyDetector) iqrDetection(points []TimeSeriesPoint) []AnomalyResult
 	return results
 }
 
-// Seasonal decomposition and anomaly detection
-func (d *AnomalyDetector) seasonalDecomposition(points []TimeSeriesPoint) []AnomalyResult {
-	if len(points) < 2*d.SeasonalPeriod {
-		return make([]AnomalyResult, len(points))
+// percentileDetection expects every value within the configured quantile
+// interval of the series. Values outside it are scored by their distance
+// beyond the interval in IQR units.
+func (d *AnomalyDetector) percentileDetection(points []TimeSeriesPoint) []AnomalyResult {
+	lowerQ, upperQ := d.LowerPercentile, d.UpperPercentile
+	if lowerQ <= 0 || lowerQ >= 1 {
+		lowerQ = defaultLowerPercentile
+	}
+	if upperQ <= lowerQ || upperQ >= 1 {
+		upperQ = defaultUpperPercentile
 	}
 
-	// Calculate seasonal components
-	seasonal := make([]float64, d.SeasonalPeriod)
-	for i := 0; i < d.SeasonalPeriod; i++ {
-		var sum float64
-		count := 0
-		for j := i; j < len(points); j += d.SeasonalPeriod {
-			sum += points[j].Value
-			count++
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Value
+	}
+	sort.Float64s(values)
+
+	lower := quantile(values, lowerQ)
+	upper := quantile(values, upperQ)
+
+	// A series that is mostly constant has no spread to measure distance
+	// in, so fall back to the interval's width, then to raw units
+	scale := quantile(values, 0.75) - quantile(values, 0.25)
+	if scale <= 0 {
+		scale = upper - lower
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+
+	results := make([]AnomalyResult, len(points))
+	for i, p := range points {
+		deviation := 0.0
+		if p.Value < lower {
+			deviation = (lower - p.Value) / scale
+		} else if p.Value > upper {
+			deviation = (p.Value - upper) / scale
+		}
+
+		results[i] = AnomalyResult{
+			IsAnomaly:       deviation > 0,
+			Score:           deviation,
+			ExpectedRange:   Range{Lower: lower, Upper: upper},
+			DeviationFactor: deviation,
 		}
-		seasonal[i] = sum / float64(count)
 	}
 
-	// Calculate trend using moving average
-	trend := d.calculateTrend(points)
+	return results
+}
+
+// Seasonal decomposition and anomaly detection
+func (d *AnomalyDetector) seasonalDecomposition(points []TimeSeriesPoint) []AnomalyResult {
+	trend, seasonal := d.decompose(points)
+	if trend == nil {
+		return make([]AnomalyResult, len(points))
+	}
 
 	// Calculate residuals and detect anomalies
 	results := make([]AnomalyResult, len(points))
@@ -460,7 +433,7 @@ func (d *AnomalyDetector) seasonalDecomposition(points []TimeSeriesPoint) []Anom
 
 	// Calculate residual statistics
 	mean, std := stat.MeanStdDev(residuals, nil)
-	threshold := stat.InvNormalCDF(1-(1-d.ConfidenceLevel)/2) * std
+	threshold := distuv.UnitNormal.Quantile(1-(1-d.ConfidenceLevel)/2) * std
 
 	for i, r := range residuals {
 		deviation := math.Abs(r - mean)
@@ -478,15 +451,52 @@ func (d *AnomalyDetector) seasonalDecomposition(points []TimeSeriesPoint) []Anom
 	return results
 }
 
+// decompose returns the smoothed trend for every point and the mean
+// value of each seasonal phase, or nils when the series is shorter than two
+// seasonal periods.
+func (d *AnomalyDetector) decompose(points []TimeSeriesPoint) ([]float64, []float64) {
+	if d.SeasonalPeriod <= 0 || len(points) < 2*d.SeasonalPeriod {
+		return nil, nil
+	}
+
+	// Calculate seasonal components
+	seasonal := make([]float64, d.SeasonalPeriod)
+	for i := 0; i < d.SeasonalPeriod; i++ {
+		var sum float64
+		count := 0
+		for j := i; j < len(points); j += d.SeasonalPeriod {
+			sum += points[j].Value
+			count++
+		}
+		seasonal[i] = sum / float64(count)
+	}
+
+	return d.calculateTrend(points), seasonal
+}
+
 // Helper functions
+
+// calculateTrend smooths the series over a window of one seasonal period
+// centred on each point, using the configured TrendMethod.
 func (d *AnomalyDetector) calculateTrend(points []TimeSeriesPoint) []float64 {
 	windowSize := d.SeasonalPeriod
 	trend := make([]float64, len(points))
 
+	window := make([]float64, 0, windowSize+1)
 	for i := range points {
 		start := max(0, i-windowSize/2)
 		end := min(len(points), i+windowSize/2+1)
-		
+
+		if d.TrendMethod == TrendMedian {
+			window = window[:0]
+			for j := start; j < end; j++ {
+				window = append(window, points[j].Value)
+			}
+			sort.Float64s(window)
+			trend[i] = quantile(window, 0.5)
+			continue
+		}
+
 		sum := 0.0
 		count := 0
 		for j := start; j < end; j++ {
@@ -517,7 +527,7 @@ func (d *AnomalyDetector) ensembleResults(results ...AnomalyResult) AnomalyResul
 	}
 
 	avgScore := totalScore / totalWeight
-	
+
 	// Combine ranges
 	var combinedRange Range
 	validRanges := 0
@@ -533,11 +543,44 @@ func (d *AnomalyDetector) ensembleResults(results ...AnomalyResult) AnomalyResul
 		}
 	}
 
+	isAnomaly, score := avgScore > 1.0, avgScore
+	switch d.EnsembleMode {
+	case EnsembleMajority:
+		votes := 0
+		scores := make([]float64, len(results))
+		for i, result := range results {
+			if result.IsAnomaly {
+				votes++
+			}
+			scores[i] = result.Score
+		}
+		sort.Float64s(scores)
+		isAnomaly = votes*2 > len(results)
+		score = quantile(scores, 0.5)
+	case EnsembleMax:
+		score = 0
+		for _, result := range results {
+			score = math.Max(score, result.Score)
+		}
+		isAnomaly = score > 1.0
+	case EnsembleAny:
+		isAnomaly, score = false, 0
+		for _, result := range results {
+			if result.IsAnomaly {
+				isAnomaly = true
+				score = math.Max(score, result.Score)
+			}
+		}
+		if !isAnomaly {
+			score = avgScore
+		}
+	}
+
 	return AnomalyResult{
-		IsAnomaly:       avgScore > 1.0,
-		Score:           avgScore,
+		IsAnomaly:       isAnomaly,
+		Score:           score,
 		ExpectedRange:   combinedRange,
-		DeviationFactor: avgScore,
+		DeviationFactor: score,
 	}
 }
 
@@ -545,11 +588,11 @@ func quantile(sorted []float64, q float64) float64 {
 	if len(sorted) == 0 {
 		return 0
 	}
-	
+
 	pos := q * float64(len(sorted)-1)
 	fpos := math.Floor(pos)
 	ipos := int(fpos)
-	
+
 	if ipos+1 < len(sorted) {
 		delta := pos - fpos
 		return sorted[ipos]*(1-delta) + sorted[ipos+1]*delta
@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// seasonalSeries returns four periods of a repeating six-point pattern, with
+// spike added to point spikeAt.
+func seasonalSeries(spikeAt int, spike float64) []TimeSeriesPoint {
+	pattern := []float64{10, 11, 12, 11, 10, 9}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]TimeSeriesPoint, 4*len(pattern))
+	for i := range points {
+		points[i] = TimeSeriesPoint{Timestamp: start.Add(time.Duration(i) * time.Hour), Value: pattern[i%len(pattern)]}
+	}
+	points[spikeAt].Value += spike
+	return points
+}
+
+// expectedCentres returns the centre of each point's seasonal expected
+// range.
+func expectedCentres(d *AnomalyDetector, points []TimeSeriesPoint) []float64 {
+	results := d.seasonalDecomposition(points)
+	centres := make([]float64, len(results))
+	for i, r := range results {
+		centres[i] = (r.ExpectedRange.Lower + r.ExpectedRange.Upper) / 2
+	}
+	return centres
+}
+
+func TestMedianTrendIgnoresSpike(t *testing.T) {
+	const spikeAt = 12
+	neighbours := []int{spikeAt - 2, spikeAt - 1, spikeAt + 1, spikeAt + 2}
+
+	// How far the spike moves each neighbour's expected range, with the
+	// analyzer's baseline detector configured for the trend method
+	shift := func(method string) float64 {
+		a, _ := newTestAnalyzer(t, newMemStorage(), AnalyzerConfig{SeasonalPeriod: 6, TrendMethod: method})
+		d := a.seriesDetector("app:api")
+		clean := expectedCentres(d, seasonalSeries(spikeAt, 0))
+		spiked := expectedCentres(d, seasonalSeries(spikeAt, 1000))
+		worst := 0.0
+		for _, i := range neighbours {
+			worst = math.Max(worst, math.Abs(spiked[i]-clean[i]))
+		}
+		return worst
+	}
+
+	if got := shift(TrendMovingAverage); got < 100 {
+		t.Fatalf("moving average moved the neighbours by %.1f; the spike is too small to test with", got)
+	}
+	if got := shift(TrendMedian); got > 1 {
+		t.Errorf("median trend moved the neighbours' expected ranges by %.1f, want at most 1", got)
+	}
+}
+
+func TestTrendMethodIsValidated(t *testing.T) {
+	var errs db.ValidationErrors
+	if _, err := NewAnalyzer(newMemStorage(), AnalyzerConfig{SeasonalPeriod: 6, TrendMethod: "lowess"}); !errors.As(err, &errs) || errs[0].Field != "trend_method" {
+		t.Errorf("NewAnalyzer with an unknown trend method returned %v, want a trend_method validation error", err)
+	}
+	if _, err := NewAnalyzer(newMemStorage(), AnalyzerConfig{SeasonalPeriod: -1}); !errors.As(err, &errs) || errs[0].Field != "seasonal_period" {
+		t.Errorf("NewAnalyzer with a negative seasonal period returned %v, want a seasonal_period validation error", err)
+	}
+}
@@ -0,0 +1,87 @@
+package ai
+
+import "math"
+
+// movingAverage keeps the last Window values and their mean and standard
+// deviation, updated in O(1) per value.
+type movingAverage struct {
+	Window int
+	// Alpha enables exponential weighting: each new value gets weight Alpha
+	// and older ones decay by 1-Alpha per step. 2/(Window+1) weighs roughly
+	// the window's worth of history. Zero weighs the window equally.
+	Alpha float64
+
+	values []float64 // ring buffer, oldest at next once full
+	next   int
+
+	sum, sumSq    float64
+	ewMean, ewVar float64
+	ewInitialized bool
+}
+
+func newMovingAverage(window int, alpha float64) movingAverage {
+	return movingAverage{
+		Window: window,
+		Alpha:  alpha,
+		values: make([]float64, 0, window),
+	}
+}
+
+func (m *movingAverage) add(v float64) {
+	if len(m.values) < m.Window {
+		m.values = append(m.values, v)
+		m.sum += v
+		m.sumSq += v * v
+	} else {
+		old := m.values[m.next]
+		m.values[m.next] = v
+		m.next = (m.next + 1) % m.Window
+		m.sum += v - old
+		m.sumSq += v*v - old*old
+
+		// Rebuild the running sums once per window so floating point error
+		// from repeated subtraction can't accumulate
+		if m.next == 0 {
+			m.sum, m.sumSq = 0, 0
+			for _, x := range m.values {
+				m.sum += x
+				m.sumSq += x * x
+			}
+		}
+	}
+
+	if !m.ewInitialized {
+		m.ewMean, m.ewVar, m.ewInitialized = v, 0, true
+		return
+	}
+	diff := v - m.ewMean
+	incr := m.Alpha * diff
+	m.ewMean += incr
+	m.ewVar = (1 - m.Alpha) * (m.ewVar + diff*incr)
+}
+
+// meanStdDev returns the mean and (sample) standard deviation, exponentially
+// weighted when Alpha is set.
+func (m *movingAverage) meanStdDev() (float64, float64) {
+	if m.Alpha > 0 {
+		return m.ewMean, math.Sqrt(m.ewVar)
+	}
+
+	n := float64(len(m.values))
+	if n == 0 {
+		return 0, 0
+	}
+	mean := m.sum / n
+	if n < 2 {
+		return mean, 0
+	}
+	variance := (m.sumSq - m.sum*mean) / (n - 1)
+	return mean, math.Sqrt(math.Max(variance, 0))
+}
+
+// history returns the kept values, oldest first.
+func (m *movingAverage) history() []float64 {
+	out := make([]float64, 0, len(m.values))
+	out = append(out, m.values[m.next:]...)
+	return append(out, m.values[:m.next]...)
+}
@@ -4,51 +4,98 @@ import (
 	"math"
 	"sort"
 	"strings"
-
-	"gonum.org/v1/gonum/stat"
+	"time"
+	"unicode"
 )
 
 // LogCluster represents a group of similar log messages
 type LogCluster struct {
-	Centroid    string
-	Messages    []string
-	Frequency   int
-	FirstSeen   time.Time
-	LastSeen    time.Time
-	Severity    string
-	Confidence  float64
+	Centroid   string    `json:"centroid"`
+	Messages   []string  `json:"messages"`
+	Frequency  int       `json:"frequency"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Severity   string    `json:"severity"`
+	Confidence float64   `json:"confidence"`
+}
+
+// Tokenizer splits text into the terms a TFIDFVectorizer counts.
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// TokenizerFunc adapts an ordinary function to a Tokenizer.
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// DefaultTokenizer splits on non-alphanumeric characters, lowercases, and
+// drops words of two characters or fewer and common English stop words.
+type DefaultTokenizer struct{}
+
+func (DefaultTokenizer) Tokenize(text string) []string {
+	return tokenize(text)
 }
 
 // TFIDFVectorizer converts text into TF-IDF vectors
 type TFIDFVectorizer struct {
+	tokenizer  Tokenizer
 	vocabulary map[string]int
 	idf        map[string]float64
 	documents  []string
+
+	// SublinearTF weights terms by 1+log(tf) instead of raw counts, so a
+	// term repeated many times doesn't dominate the vector
+	SublinearTF bool
+	// Normalize scales Transform's vectors to unit L2 length, so message
+	// length doesn't affect their magnitude
+	Normalize bool
 }
 
-func NewTFIDFVectorizer() *TFIDFVectorizer {
+// NewTFIDFVectorizer creates a vectorizer using tokenizer, or
+// DefaultTokenizer when it is nil.
+func NewTFIDFVectorizer(tokenizer Tokenizer) *TFIDFVectorizer {
+	if tokenizer == nil {
+		tokenizer = DefaultTokenizer{}
+	}
 	return &TFIDFVectorizer{
+		tokenizer:  tokenizer,
 		vocabulary: make(map[string]int),
 		idf:        make(map[string]float64),
 	}
 }
 
+// Fit learns the vocabulary and IDF weights of documents. New terms are
+// numbered in sorted order, so the vectors' dimensions don't depend on the
+// order of the documents.
 func (v *TFIDFVectorizer) Fit(documents []string) {
 	// Build vocabulary
 	wordDocs := make(map[string]int)
 	for _, doc := range documents {
-		words := tokenize(doc)
+		words := v.tokenizer.Tokenize(doc)
 		seenWords := make(map[string]bool)
-		
+
 		for _, word := range words {
 			if !seenWords[word] {
 				wordDocs[word]++
 				seenWords[word] = true
 			}
-			v.vocabulary[word] = len(v.vocabulary)
 		}
 	}
 
+	newWords := make([]string, 0, len(wordDocs))
+	for word := range wordDocs {
+		if _, exists := v.vocabulary[word]; !exists {
+			newWords = append(newWords, word)
+		}
+	}
+	sort.Strings(newWords)
+	for _, word := range newWords {
+		v.vocabulary[word] = len(v.vocabulary)
+	}
+
 	// Calculate IDF
 	numDocs := float64(len(documents))
 	for word, docCount := range wordDocs {
@@ -60,8 +107,8 @@ func (v *TFIDFVectorizer) Fit(documents []string) {
 
 func (v *TFIDFVectorizer) Transform(text string) []float64 {
 	vector := make([]float64, len(v.vocabulary))
-	words := tokenize(text)
-	
+	words := v.tokenizer.Tokenize(text)
+
 	// Calculate term frequency
 	tf := make(map[string]float64)
 	for _, word := range words {
@@ -71,10 +118,17 @@ func (v *TFIDFVectorizer) Transform(text string) []float64 {
 	// Calculate TF-IDF
 	for word, freq := range tf {
 		if idx, exists := v.vocabulary[word]; exists {
+			if v.SublinearTF {
+				freq = 1 + math.Log(freq)
+			}
 			vector[idx] = freq * v.idf[word]
 		}
 	}
 
+	if v.Normalize {
+		normalizeL2(vector)
+	}
+
 	return vector
 }
 
@@ -91,6 +145,11 @@ func NewDBSCAN(eps float64, minPoints int) *DBSCAN {
 	}
 }
 
+// Fit labels each vector with its cluster, numbered from 1, or 0 for
+// noise. Points are visited in a canonical order that depends only on the
+// vectors themselves, so labels are stable for a given input: the same
+// vectors in any order get the same groupings and cluster numbers, and a
+// border point reachable from two clusters always joins the same one.
 func (d *DBSCAN) Fit(vectors [][]float64) []int {
 	n := len(vectors)
 	labels := make([]int, n)
@@ -98,13 +157,15 @@ func (d *DBSCAN) Fit(vectors [][]float64) []int {
 		labels[i] = -1 // Unvisited
 	}
 
+	order, rank := canonicalOrder(vectors)
+
 	clusterID := 0
-	for i := 0; i < n; i++ {
+	for _, i := range order {
 		if labels[i] != -1 {
 			continue
 		}
 
-		neighbors := d.regionQuery(vectors, i, vectors[i])
+		neighbors := d.regionQuery(vectors, rank, vectors[i])
 		if len(neighbors) < d.MinPoints {
 			labels[i] = 0 // Noise
 			continue
@@ -112,7 +173,7 @@ func (d *DBSCAN) Fit(vectors [][]float64) []int {
 
 		clusterID++
 		labels[i] = clusterID
-		
+
 		// Expand cluster
 		seedSet := neighbors
 		for len(seedSet) > 0 {
@@ -121,7 +182,7 @@ func (d *DBSCAN) Fit(vectors [][]float64) []int {
 
 			if labels[currentPoint] == 0 || labels[currentPoint] == -1 {
 				if labels[currentPoint] == -1 {
-					newNeighbors := d.regionQuery(vectors, currentPoint, vectors[currentPoint])
+					newNeighbors := d.regionQuery(vectors, rank, vectors[currentPoint])
 					if len(newNeighbors) >= d.MinPoints {
 						seedSet = append(seedSet, newNeighbors...)
 					}
@@ -134,17 +195,62 @@ func (d *DBSCAN) Fit(vectors [][]float64) []int {
 	return labels
 }
 
-func (d *DBSCAN) regionQuery(vectors [][]float64, pointIdx int, point []float64) []int {
+// regionQuery returns the indices of the vectors within Eps of point, in
+// canonical order.
+func (d *DBSCAN) regionQuery(vectors [][]float64, rank []int, point []float64) []int {
 	neighbors := make([]int, 0)
 	for i, vector := range vectors {
 		if cosineDistance(point, vector) <= d.Eps {
 			neighbors = append(neighbors, i)
 		}
 	}
+	sort.Slice(neighbors, func(a, b int) bool { return rank[neighbors[a]] < rank[neighbors[b]] })
 	return neighbors
 }
 
+// canonicalOrder sorts vector indices lexicographically by the vectors'
+// values, returning the order and each index's position in it. Identical
+// vectors are interchangeable, so ties don't affect the clustering.
+func canonicalOrder(vectors [][]float64) (order, rank []int) {
+	order = make([]int, len(vectors))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return lessVector(vectors[order[a]], vectors[order[b]])
+	})
+
+	rank = make([]int, len(vectors))
+	for pos, i := range order {
+		rank[i] = pos
+	}
+	return order, rank
+}
+
+func lessVector(a, b []float64) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
 // Helper functions
+func normalizeL2(vector []float64) {
+	norm := 0.0
+	for _, x := range vector {
+		norm += x * x
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
 func cosineDistance(a, b []float64) float64 {
 	dotProduct := 0.0
 	normA := 0.0
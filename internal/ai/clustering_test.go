@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"context"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+var clusteringMessages = []string{
+	"connection refused by payments upstream",
+	"connection refused by payments gateway",
+	"connection refused by payments service",
+	"timeout waiting for inventory response",
+	"timeout waiting for inventory reply",
+	"timeout waiting for inventory lookup",
+	"user session expired unexpectedly",
+	"disk quota exceeded on volume data",
+	"disk quota exceeded on volume logs",
+	"disk quota exceeded on volume cache",
+}
+
+// clusterLabels fits TF-IDF and DBSCAN over messages and returns each
+// message's cluster number.
+func clusterLabels(messages []string) map[string]int {
+	vectorizer := NewTFIDFVectorizer(nil)
+	vectorizer.Normalize = true
+	vectorizer.Fit(messages)
+	vectors := make([][]float64, len(messages))
+	for i, message := range messages {
+		vectors[i] = vectorizer.Transform(message)
+	}
+
+	labels := NewDBSCAN(0.8, 2).Fit(vectors)
+	byMessage := make(map[string]int, len(messages))
+	for i, message := range messages {
+		byMessage[message] = labels[i]
+	}
+	return byMessage
+}
+
+func TestClusteringIsShuffleInvariant(t *testing.T) {
+	want := clusterLabels(clusteringMessages)
+
+	clusters := make(map[int]bool)
+	for _, label := range want {
+		clusters[label] = true
+	}
+	if len(clusters) < 3 {
+		t.Fatalf("got labels %v, want the messages to form several clusters", want)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 20; i++ {
+		shuffled := append([]string(nil), clusteringMessages...)
+		rng.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+
+		if got := clusterLabels(shuffled); !reflect.DeepEqual(got, want) {
+			t.Fatalf("shuffled input %q got labels %v, want %v", shuffled, got, want)
+		}
+	}
+}
+
+func TestSimilarErrors(t *testing.T) {
+	storage := newMemStorage()
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{ClusterEps: 0.8, ClusterMinPoints: 2})
+	log := func(service, severity, message string) *db.ApplicationLog {
+		return &db.ApplicationLog{ApplicationID: "app", ServiceName: service, Severity: severity, Message: message, Timestamp: clk.Now().Add(-time.Minute)}
+	}
+	for _, message := range clusteringMessages {
+		storage.logs = append(storage.logs, log("api", "ERROR", message))
+	}
+	storage.logs = append(storage.logs,
+		log("api", "INFO", "connection refused by payments upstream"),
+		log("worker", "ERROR", "connection refused by payments upstream"),
+	)
+
+	clusters, err := a.SimilarErrors(context.Background(), "app:api", 0)
+	if err != nil {
+		t.Fatalf("SimilarErrors: %v", err)
+	}
+	if len(clusters) != 3 {
+		t.Fatalf("got %d clusters, want 3: %+v", len(clusters), clusters)
+	}
+	for _, cluster := range clusters {
+		if cluster.Frequency != 3 || cluster.Severity != "ERROR" {
+			t.Errorf("cluster %q has %d %s logs, want 3 ERROR logs", cluster.Centroid, cluster.Frequency, cluster.Severity)
+		}
+	}
+
+	if clusters, _ := a.SimilarErrors(context.Background(), "app:api", 1); len(clusters) != 1 {
+		t.Errorf("got %d clusters with limit 1", len(clusters))
+	}
+}
+
+func TestClusterSamplingFromConfig(t *testing.T) {
+	sample := func(seed uint64) []int {
+		a, _ := newTestAnalyzer(t, newMemStorage(), AnalyzerConfig{ClusterSampleSize: 5, ClusterSeed: seed})
+		return a.clusterer.sample(100)
+	}
+
+	first := sample(1)
+	if len(first) != 5 {
+		t.Fatalf("sampled %d of 100 logs, want the configured 5", len(first))
+	}
+	if again := sample(1); !reflect.DeepEqual(again, first) {
+		t.Errorf("seed 1 sampled %v, then %v", first, again)
+	}
+	if other := sample(2); reflect.DeepEqual(other, first) {
+		t.Errorf("seeds 1 and 2 both sampled %v, want the seed to pick the sample", first)
+	}
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// fastEWMAAlpha weighs each new value in the EWMA method; older values
+// decay by 1-fastEWMAAlpha per point.
+const fastEWMAAlpha = 0.3
+
+// DetectAnomaliesFast runs only FastMethod over the series, skipping the
+// other methods and their ensemble. It trades accuracy for throughput on
+// series where the full ensemble costs too much, such as low-priority
+// metrics analyzed by the thousand. Explanations hold the single verdict.
+func (d *AnomalyDetector) DetectAnomaliesFast(points []TimeSeriesPoint) []AnomalyResult {
+	if len(points) < d.MinDataPoints {
+		return make([]AnomalyResult, len(points))
+	}
+
+	method := d.fastMethod()
+	var results []AnomalyResult
+	switch method {
+	case MethodIQR:
+		results = d.iqrDetection(points)
+	case MethodEWMA:
+		results = d.ewmaDetection(points)
+	default:
+		results = d.zScoreDetection(points)
+	}
+
+	if d.Explain {
+		for i := range results {
+			results[i].Explanation = &AnomalyExplanation{
+				Methods: []MethodVerdict{verdict(method, results[i])},
+			}
+		}
+	}
+	return results
+}
+
+// fastMethod is the method DetectAnomaliesFast runs: FastMethod when it is
+// one of the single-pass methods, z-score otherwise.
+func (d *AnomalyDetector) fastMethod() string {
+	switch d.FastMethod {
+	case MethodIQR, MethodEWMA:
+		return d.FastMethod
+	}
+	return MethodZScore
+}
+
+// ewmaDetection judges each value against the exponentially weighted mean
+// and deviation of the values before it, so unlike z-score it follows a
+// drifting level. The first value has nothing to be judged against.
+func (d *AnomalyDetector) ewmaDetection(points []TimeSeriesPoint) []AnomalyResult {
+	threshold := distuv.UnitNormal.Quantile(1 - (1-d.ConfidenceLevel)/2) // Two-tailed test
+
+	results := make([]AnomalyResult, len(points))
+	// Only the exponentially weighted moments are used, so one value is
+	// enough of a window
+	ew := newMovingAverage(1, fastEWMAAlpha)
+	for i, p := range points {
+		if i == 0 {
+			ew.add(p.Value)
+			results[i] = AnomalyResult{ExpectedRange: Range{Lower: p.Value, Upper: p.Value}}
+			continue
+		}
+
+		mean, std := ew.meanStdDev()
+		deviation := 0.0
+		if std > 0 {
+			deviation = math.Abs(p.Value-mean) / std
+		} else if p.Value != mean {
+			deviation = math.Inf(1)
+		}
+		results[i] = AnomalyResult{
+			IsAnomaly: deviation > threshold,
+			Score:     deviation / threshold,
+			ExpectedRange: Range{
+				Lower: mean - threshold*std,
+				Upper: mean + threshold*std,
+			},
+			DeviationFactor: deviation,
+		}
+		ew.add(p.Value)
+	}
+
+	return results
+}
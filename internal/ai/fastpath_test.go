@@ -0,0 +1,46 @@
+package ai
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// benchmarkSeries is a day of per-minute error rates with daily
+// seasonality, noise and a few spikes.
+func benchmarkSeries() []TimeSeriesPoint {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]TimeSeriesPoint, 24*60)
+	for i := range points {
+		v := 0.05 + 0.02*math.Sin(2*math.Pi*float64(i)/float64(len(points))) + 0.005*math.Sin(float64(i)*7.3)
+		if i%300 == 299 {
+			v += 0.3
+		}
+		points[i] = TimeSeriesPoint{Timestamp: start.Add(time.Duration(i) * time.Minute), Value: v}
+	}
+	return points
+}
+
+func BenchmarkDetectAnomalies(b *testing.B) {
+	points := benchmarkSeries()
+	detector := baselineDetector()
+	b.ResetTimer()
+	for range b.N {
+		detector.DetectAnomalies(points)
+	}
+}
+
+func BenchmarkDetectAnomaliesFast(b *testing.B) {
+	points := benchmarkSeries()
+	for _, method := range []string{MethodZScore, MethodIQR, MethodEWMA} {
+		b.Run(method, func(b *testing.B) {
+			detector := baselineDetector()
+			detector.DetectionMode = DetectionFast
+			detector.FastMethod = method
+			b.ResetTimer()
+			for range b.N {
+				detector.DetectAnomaliesFast(points)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"api-watchtower/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Analysis statuses set by analyst feedback
+const (
+	StatusConfirmed = "confirmed"
+	StatusDismissed = "dismissed"
+)
+
+// analysisFeedback counts verdicts by analysis type, so detector precision
+// is confirmed / (confirmed + dismissed) over any range.
+var analysisFeedback = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "watchtower_analysis_feedback_total",
+	Help: "Analyst verdicts on analyses, by analysis type and verdict (confirmed or dismissed).",
+}, []string{"type", "verdict"})
+
+// ErrAnalysisNotFound is returned for feedback on an unknown analysis.
+var ErrAnalysisNotFound = errors.New("analysis not found")
+
+// RecordFeedback records an analyst's verdict on an analysis: confirmed
+// (a true positive) raises its FeedbackScore by one and dismissed (a false
+// positive) lowers it, and the analysis takes the verdict as its status.
+// Verdicts from several analysts accumulate in the score.
+func (a *Analyzer) RecordFeedback(ctx context.Context, id, verdict string) (*db.AIAnalysis, error) {
+	var delta int
+	switch verdict {
+	case StatusConfirmed:
+		delta = 1
+	case StatusDismissed:
+		delta = -1
+	default:
+		return nil, &db.ValidationError{
+			Field:   "verdict",
+			Code:    db.CodeUnsupported,
+			Message: fmt.Sprintf("unsupported verdict %q; use %s or %s", verdict, StatusConfirmed, StatusDismissed),
+		}
+	}
+
+	a.feedbackMu.Lock()
+	defer a.feedbackMu.Unlock()
+
+	analysis, err := a.storage.GetAnalysis(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if analysis == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAnalysisNotFound, id)
+	}
+
+	analysis.FeedbackScore += delta
+	analysis.Status = verdict
+	if err := a.storage.UpdateAnalysis(ctx, analysis); err != nil {
+		return nil, fmt.Errorf("failed to update analysis: %v", err)
+	}
+	a.applyFeedback(analysis)
+
+	analysisFeedback.WithLabelValues(analysis.Type, verdict).Inc()
+	return analysis, nil
+}
+
+// applyFeedback carries a verdict over to the matching ongoing anomaly, so
+// its next update doesn't overwrite the verdict.
+func (a *Analyzer) applyFeedback(analysis *db.AIAnalysis) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, open := range a.openAnomalies {
+		if open.ID == analysis.ID {
+			open.FeedbackScore = analysis.FeedbackScore
+			open.Status = analysis.Status
+			return
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package ai
+
+import (
+	"math"
+	"sort"
+)
+
+// HDBSCAN is a hierarchical density-based clustering that, unlike DBSCAN,
+// needs no fixed Eps: it builds the full density hierarchy and keeps the
+// most stable clusters, so dense and sparse groups can coexist.
+type HDBSCAN struct {
+	// MinClusterSize is the smallest group considered a cluster (at least 2)
+	MinClusterSize int
+	// MinSamples sets how conservative density estimates are; defaults to
+	// MinClusterSize
+	MinSamples int
+	// Distance defaults to cosineDistance
+	Distance func(a, b []float64) float64
+}
+
+// HDBSCANResult holds per-point cluster labels and membership strengths.
+type HDBSCANResult struct {
+	// Labels uses 0 for noise and numbers clusters from 1, as DBSCAN does
+	Labels []int
+	// Probabilities is how strongly each point belongs to its cluster (0-1)
+	Probabilities []float64
+}
+
+func NewHDBSCAN(minClusterSize int) *HDBSCAN {
+	return &HDBSCAN{
+		MinClusterSize: minClusterSize,
+	}
+}
+
+type mstEdge struct {
+	a, b   int
+	weight float64
+}
+
+type dendrogramNode struct {
+	left, right int
+	distance    float64
+	size        int
+}
+
+type condensedCluster struct {
+	parent    int
+	birth     float64
+	stability float64
+	children  []int
+}
+
+func (h *HDBSCAN) Fit(vectors [][]float64) HDBSCANResult {
+	n := len(vectors)
+	result := HDBSCANResult{
+		Labels:        make([]int, n),
+		Probabilities: make([]float64, n),
+	}
+
+	minClusterSize := h.MinClusterSize
+	if minClusterSize < 2 {
+		minClusterSize = 2
+	}
+	if n < minClusterSize {
+		return result
+	}
+
+	dist := h.Distance
+	if dist == nil {
+		dist = cosineDistance
+	}
+
+	edges := h.mutualReachabilityMST(vectors, dist, minClusterSize)
+	nodes := buildDendrogram(n, edges)
+	clusters, pointCluster, pointLambda := condenseTree(n, nodes, minClusterSize)
+	selected := selectClusters(clusters)
+
+	// Number selected clusters from 1 in creation order
+	labelOf := make(map[int]int)
+	for c := range clusters {
+		if selected[c] {
+			labelOf[c] = len(labelOf) + 1
+		}
+	}
+
+	// A point belongs to the selected cluster on the path from the cluster it
+	// fell out of up to the root, if any.
+	owner := make([]int, n)
+	lambdaMax := make(map[int]float64)
+	for p := 0; p < n; p++ {
+		owner[p] = -1
+		for c := pointCluster[p]; c >= 0; c = clusters[c].parent {
+			if selected[c] {
+				owner[p] = c
+				break
+			}
+		}
+		if owner[p] >= 0 && pointLambda[p] > lambdaMax[owner[p]] {
+			lambdaMax[owner[p]] = pointLambda[p]
+		}
+	}
+
+	for p := 0; p < n; p++ {
+		c := owner[p]
+		if c < 0 {
+			continue
+		}
+		result.Labels[p] = labelOf[c]
+		if lambdaMax[c] > 0 {
+			result.Probabilities[p] = math.Min(pointLambda[p], lambdaMax[c]) / lambdaMax[c]
+		} else {
+			result.Probabilities[p] = 1
+		}
+	}
+
+	return result
+}
+
+// mutualReachabilityMST builds a minimum spanning tree over the mutual
+// reachability graph with Prim's algorithm, computing distances on the fly
+// so memory stays linear in the number of points.
+func (h *HDBSCAN) mutualReachabilityMST(vectors [][]float64, dist func(a, b []float64) float64, minClusterSize int) []mstEdge {
+	n := len(vectors)
+
+	minSamples := h.MinSamples
+	if minSamples <= 0 {
+		minSamples = minClusterSize
+	}
+	k := min(minSamples, n) - 1
+
+	// Core distance: distance to the k-th nearest neighbour, counting the
+	// point itself
+	core := make([]float64, n)
+	row := make([]float64, n)
+	for i := range vectors {
+		for j := range vectors {
+			row[j] = dist(vectors[i], vectors[j])
+		}
+		row[i] = 0
+		sort.Float64s(row)
+		core[i] = row[k]
+	}
+
+	inTree := make([]bool, n)
+	best := make([]float64, n)
+	bestFrom := make([]int, n)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+
+	edges := make([]mstEdge, 0, n-1)
+	current := 0
+	inTree[current] = true
+	for len(edges) < n-1 {
+		next := -1
+		for j := 0; j < n; j++ {
+			if inTree[j] {
+				continue
+			}
+			d := math.Max(dist(vectors[current], vectors[j]), math.Max(core[current], core[j]))
+			if d < best[j] {
+				best[j] = d
+				bestFrom[j] = current
+			}
+			if next < 0 || best[j] < best[next] {
+				next = j
+			}
+		}
+
+		inTree[next] = true
+		edges = append(edges, mstEdge{a: bestFrom[next], b: next, weight: best[next]})
+		current = next
+	}
+
+	return edges
+}
+
+// buildDendrogram turns the MST into a single-linkage hierarchy. Leaves are
+// nodes 0..n-1 and merge i creates node n+i.
+func buildDendrogram(n int, edges []mstEdge) []dendrogramNode {
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].weight < edges[j].weight })
+
+	parent := make([]int, n)
+	nodeOf := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+		nodeOf[i] = i
+	}
+	var find func(int) int
+	find = func(x int) int {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+
+	nodes := make([]dendrogramNode, 2*n-1)
+	for i := 0; i < n; i++ {
+		nodes[i] = dendrogramNode{left: -1, right: -1, size: 1}
+	}
+
+	for i, e := range edges {
+		ra, rb := find(e.a), find(e.b)
+		id := n + i
+		nodes[id] = dendrogramNode{
+			left:     nodeOf[ra],
+			right:    nodeOf[rb],
+			distance: e.weight,
+			size:     nodes[nodeOf[ra]].size + nodes[nodeOf[rb]].size,
+		}
+		parent[rb] = ra
+		nodeOf[ra] = id
+	}
+
+	return nodes
+}
+
+// condenseTree walks the hierarchy from the root, keeping only splits where
+// both sides have at least minClusterSize points. It returns the condensed
+// clusters and, for every point, the cluster it fell out of and the density
+// (lambda = 1/distance) at which it did.
+func condenseTree(n int, nodes []dendrogramNode, minClusterSize int) ([]condensedCluster, []int, []float64) {
+	clusters := []condensedCluster{{parent: -1}}
+	pointCluster := make([]int, n)
+	pointLambda := make([]float64, n)
+
+	fallOut := func(node, cluster int, lambda float64) {
+		stack := []int{node}
+		for len(stack) > 0 {
+			u := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if u < n {
+				pointCluster[u] = cluster
+				pointLambda[u] = lambda
+				clusters[cluster].stability += lambda - clusters[cluster].birth
+				continue
+			}
+			stack = append(stack, nodes[u].left, nodes[u].right)
+		}
+	}
+
+	type frame struct{ node, cluster int }
+	stack := []frame{{node: len(nodes) - 1, cluster: 0}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		u := nodes[f.node]
+		lambda := 1 / math.Max(u.distance, 1e-12)
+		left, right := nodes[u.left], nodes[u.right]
+		bigLeft, bigRight := left.size >= minClusterSize, right.size >= minClusterSize
+
+		switch {
+		case bigLeft && bigRight:
+			clusters[f.cluster].stability += (lambda - clusters[f.cluster].birth) * float64(u.size)
+			for _, child := range []int{u.left, u.right} {
+				id := len(clusters)
+				clusters = append(clusters, condensedCluster{parent: f.cluster, birth: lambda})
+				clusters[f.cluster].children = append(clusters[f.cluster].children, id)
+				stack = append(stack, frame{node: child, cluster: id})
+			}
+		case bigLeft:
+			fallOut(u.right, f.cluster, lambda)
+			stack = append(stack, frame{node: u.left, cluster: f.cluster})
+		case bigRight:
+			fallOut(u.left, f.cluster, lambda)
+			stack = append(stack, frame{node: u.right, cluster: f.cluster})
+		default:
+			fallOut(u.left, f.cluster, lambda)
+			fallOut(u.right, f.cluster, lambda)
+		}
+	}
+
+	return clusters, pointCluster, pointLambda
+}
+
+// selectClusters picks the set of non-overlapping clusters with the greatest
+// total stability (excess of mass). The root is only chosen when the data
+// never splits into two sizeable groups.
+func selectClusters(clusters []condensedCluster) []bool {
+	selected := make([]bool, len(clusters))
+	if len(clusters[0].children) == 0 {
+		selected[0] = true
+		return selected
+	}
+
+	// Children are always created after their parent, so walking backwards
+	// visits every child before its parent.
+	best := make([]float64, len(clusters))
+	for c := len(clusters) - 1; c > 0; c-- {
+		childSum := 0.0
+		for _, child := range clusters[c].children {
+			childSum += best[child]
+		}
+		if len(clusters[c].children) == 0 || clusters[c].stability >= childSum {
+			selected[c] = true
+			best[c] = clusters[c].stability
+		} else {
+			best[c] = childSum
+		}
+	}
+
+	// Drop clusters nested under a selected ancestor
+	covered := make([]bool, len(clusters))
+	for c := 1; c < len(clusters); c++ {
+		p := clusters[c].parent
+		covered[c] = covered[p] || (p != 0 && selected[p])
+		if covered[c] {
+			selected[c] = false
+		}
+	}
+
+	return selected
+}
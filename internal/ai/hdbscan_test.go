@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func euclideanDistance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// blob returns n points normally spread around center.
+func blob(rng *rand.Rand, n int, center []float64, spread float64) [][]float64 {
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, len(center))
+		for d, c := range center {
+			points[i][d] = c + rng.NormFloat64()*spread
+		}
+	}
+	return points
+}
+
+func TestHDBSCANFindsClustersAndNoise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	dense := blob(rng, 40, []float64{0, 0}, 0.1)
+	sparse := blob(rng, 40, []float64{10, 10}, 1)
+	outliers := [][]float64{{-20, 30}, {40, -15}, {25, -30}}
+
+	var vectors [][]float64
+	vectors = append(vectors, dense...)
+	vectors = append(vectors, sparse...)
+	vectors = append(vectors, outliers...)
+
+	h := NewHDBSCAN(5)
+	h.Distance = euclideanDistance
+	result := h.Fit(vectors)
+
+	// Each blob gets one label of its own
+	groups := map[string][]int{"dense": result.Labels[:40], "sparse": result.Labels[40:80]}
+	seen := map[int]string{}
+	for name, labels := range groups {
+		want := labels[0]
+		if want == 0 {
+			t.Fatalf("%s blob labelled noise", name)
+		}
+		if other, ok := seen[want]; ok {
+			t.Fatalf("%s and %s blobs share label %d", name, other, want)
+		}
+		seen[want] = name
+		for i, label := range labels {
+			if label != want {
+				t.Errorf("%s blob point %d labelled %d, want %d", name, i, label, want)
+			}
+		}
+	}
+	for i, label := range result.Labels[80:] {
+		if label != 0 {
+			t.Errorf("outlier %d labelled %d, want noise", i, label)
+		}
+		if p := result.Probabilities[80+i]; p != 0 {
+			t.Errorf("outlier %d has membership %v, want 0", i, p)
+		}
+	}
+
+	for i, p := range result.Probabilities[:80] {
+		if !(p > 0 && p <= 1) {
+			t.Errorf("clustered point %d has membership %v, want in (0, 1]", i, p)
+		}
+	}
+}
+
+func TestHDBSCANIdenticalPoints(t *testing.T) {
+	vectors := make([][]float64, 20)
+	for i := range vectors {
+		vectors[i] = []float64{0.1, 0.2, 0.3}
+	}
+
+	// Cosine distances between identical vectors can come out a rounding
+	// error below zero
+	distances := map[string]func(a, b []float64) float64{"euclidean": euclideanDistance, "cosine": nil}
+	for name, distance := range distances {
+		t.Run(name, func(t *testing.T) {
+			h := NewHDBSCAN(5)
+			h.Distance = distance
+			result := h.Fit(vectors)
+
+			for i := range vectors {
+				if result.Labels[i] != 1 {
+					t.Errorf("point %d labelled %d, want every point in cluster 1", i, result.Labels[i])
+				}
+				if p := result.Probabilities[i]; p != 1 {
+					t.Errorf("point %d has membership %v, want 1", i, p)
+				}
+			}
+		})
+	}
+}
+
+func TestHDBSCANTooFewPoints(t *testing.T) {
+	vectors := [][]float64{{0, 0}, {0, 1}, {1, 0}}
+	result := NewHDBSCAN(5).Fit(vectors)
+	for i, label := range result.Labels {
+		if label != 0 {
+			t.Errorf("point %d labelled %d with fewer points than a cluster, want noise", i, label)
+		}
+	}
+
+	if result := NewHDBSCAN(5).Fit(nil); len(result.Labels) != 0 {
+		t.Errorf("no points gave %d labels", len(result.Labels))
+	}
+}
@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Lifecycle statuses of an analysis. New analyses are active, and active or
+// confirmed ones are resolved once their condition stops recurring.
+const (
+	StatusActive   = "active"
+	StatusResolved = "resolved"
+)
+
+// DefaultResolveAfter is how long an analysis's condition can go unseen
+// before it is resolved, unless AnalyzerConfig.ResolveAfter says otherwise.
+const DefaultResolveAfter = time.Hour
+
+// resolvePageSize is how many analyses each lifecycle query fetches.
+const resolvePageSize = 500
+
+// SetStatus moves an analysis to active or resolved by hand, e.g. to close
+// one that was fixed or reopen one resolved too early. A reopened analysis
+// counts as seen now, so it gets a full ResolveAfter before it is resolved
+// again. Confirmed and dismissed are set through RecordFeedback.
+func (a *Analyzer) SetStatus(ctx context.Context, id, status string) (*db.AIAnalysis, error) {
+	if status != StatusActive && status != StatusResolved {
+		return nil, &db.ValidationError{
+			Field:   "status",
+			Code:    db.CodeUnsupported,
+			Message: fmt.Sprintf("unsupported status %q; use %s or %s, or feedback to confirm or dismiss", status, StatusActive, StatusResolved),
+		}
+	}
+
+	a.feedbackMu.Lock()
+	defer a.feedbackMu.Unlock()
+
+	analysis, err := a.storage.GetAnalysis(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if analysis == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAnalysisNotFound, id)
+	}
+	if analysis.Status == status {
+		return analysis, nil
+	}
+
+	if status == StatusActive {
+		a.mu.RLock()
+		analysis.LastSeen = a.clock.Now()
+		a.mu.RUnlock()
+	}
+	if err := a.transition(ctx, analysis, status); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// transition stores analysis with its new status. A resolved anomaly is
+// also forgotten as ongoing, so its next detection starts a new analysis.
+// Must be called with a.feedbackMu held.
+func (a *Analyzer) transition(ctx context.Context, analysis *db.AIAnalysis, status string) error {
+	from := analysis.Status
+	analysis.Status = status
+	if err := a.storage.UpdateAnalysis(ctx, analysis); err != nil {
+		analysis.Status = from
+		return fmt.Errorf("failed to update analysis: %v", err)
+	}
+
+	if status == StatusResolved {
+		a.forgetAnomaly(analysis.ID)
+	} else {
+		a.applyFeedback(analysis)
+	}
+	return nil
+}
+
+// forgetAnomaly drops the ongoing anomaly stored as id, if any.
+func (a *Analyzer) forgetAnomaly(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, open := range a.openAnomalies {
+		if open.ID == id {
+			delete(a.openAnomalies, key)
+			delete(a.recovering, key)
+			return
+		}
+	}
+}
+
+// resolveStale resolves active and confirmed analyses whose condition was
+// last seen more than resolveAfter ago.
+func (a *Analyzer) resolveStale(ctx context.Context) {
+	if a.resolveAfter <= 0 {
+		return
+	}
+
+	a.mu.RLock()
+	cutoff := a.clock.Now().Add(-a.resolveAfter)
+	a.mu.RUnlock()
+
+	for _, status := range []string{StatusActive, StatusConfirmed} {
+		// Resolved analyses drop out of the query, so only those kept
+		// advance the offset
+		offset := 0
+		for {
+			page, err := a.storage.GetAnalyses(ctx, AnalysisQuery{
+				Status:  status,
+				EndTime: cutoff,
+				Limit:   resolvePageSize,
+				Offset:  offset,
+			})
+			if err != nil {
+				log.Printf("Failed to list %s analyses for resolution: %v", status, err)
+				return
+			}
+
+			for _, analysis := range page {
+				if lastSeen(analysis).After(cutoff) || !a.resolveIfStale(ctx, analysis.ID, cutoff) {
+					offset++
+				}
+			}
+			if len(page) < resolvePageSize {
+				break
+			}
+		}
+	}
+}
+
+// resolveIfStale re-reads analysis id and resolves it if it is still
+// active or confirmed and unseen since cutoff, reporting whether it did.
+func (a *Analyzer) resolveIfStale(ctx context.Context, id string, cutoff time.Time) bool {
+	a.feedbackMu.Lock()
+	defer a.feedbackMu.Unlock()
+
+	analysis, err := a.storage.GetAnalysis(ctx, id)
+	if err != nil || analysis == nil {
+		return false
+	}
+	if analysis.Status != StatusActive && analysis.Status != StatusConfirmed {
+		return false
+	}
+	if lastSeen(analysis).After(cutoff) {
+		return false
+	}
+
+	if err := a.transition(ctx, analysis, StatusResolved); err != nil {
+		log.Printf("Failed to resolve analysis %s: %v", id, err)
+		return false
+	}
+	return true
+}
+
+// lastSeen is when an analysis's condition was last observed.
+func lastSeen(analysis *db.AIAnalysis) time.Time {
+	if analysis.LastSeen.After(analysis.DetectedAt) {
+		return analysis.LastSeen
+	}
+	return analysis.DetectedAt
+}
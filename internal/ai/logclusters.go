@@ -0,0 +1,211 @@
+package ai
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	"api-watchtower/internal/db"
+)
+
+// LogClusterer groups similar log messages by fitting TF-IDF and DBSCAN
+// over them. For large corpora it can fit on a seeded reservoir sample
+// instead, then assign every other log to the nearest resulting cluster,
+// which bounds the quadratic DBSCAN step by SampleSize.
+type LogClusterer struct {
+	// Eps and MinPoints configure DBSCAN over cosine distance
+	Eps       float64
+	MinPoints int
+	// Tokenizer splits messages into terms; nil means DefaultTokenizer
+	Tokenizer Tokenizer
+	// SampleSize caps how many logs the model is fit on; larger inputs are
+	// sampled down to it. Zero fits on every log.
+	SampleSize int
+	// Seed drives the sampling: the same logs in the same order with the
+	// same seed always give the same sample, and so the same clusters.
+	Seed uint64
+}
+
+func NewLogClusterer(eps float64, minPoints int) *LogClusterer {
+	return &LogClusterer{
+		Eps:       eps,
+		MinPoints: minPoints,
+	}
+}
+
+// Cluster returns the clusters among logs, largest first. Logs in no
+// cluster, DBSCAN's noise, are left out. Each cluster's Centroid is the
+// fitted message nearest its centre, Messages holds up to
+// maxPatternExamples distinct examples, and Confidence is the fitted
+// members' mean cosine similarity to the centre.
+func (c *LogClusterer) Cluster(logs []*db.ApplicationLog) []LogCluster {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	fitted := c.sample(len(logs))
+	docs := make([]string, len(fitted))
+	for j, i := range fitted {
+		docs[j] = logs[i].Message
+	}
+
+	vectorizer := NewTFIDFVectorizer(c.Tokenizer)
+	vectorizer.Normalize = true
+	vectorizer.Fit(docs)
+	vectors := make([][]float64, len(docs))
+	for j, doc := range docs {
+		vectors[j] = vectorizer.Transform(doc)
+	}
+	fittedLabels := NewDBSCAN(c.Eps, c.MinPoints).Fit(vectors)
+
+	// Sum each cluster's vectors into its centre; cosine distance ignores
+	// the scale, so there is no need to average
+	numClusters := 0
+	for _, label := range fittedLabels {
+		numClusters = max(numClusters, label)
+	}
+	centres := make([][]float64, numClusters+1)
+	for j, label := range fittedLabels {
+		if label == 0 {
+			continue
+		}
+		if centres[label] == nil {
+			centres[label] = make([]float64, len(vectors[j]))
+		}
+		for d, x := range vectors[j] {
+			centres[label][d] += x
+		}
+	}
+
+	// A cluster reaches as far as its furthest fitted member, and at least
+	// Eps, so unfitted logs join it on the same terms
+	radius := make([]float64, numClusters+1)
+	for label := range radius {
+		radius[label] = c.Eps
+	}
+	central := make([]int, numClusters+1)
+	centralDist := make([]float64, numClusters+1)
+	confidence := make([]float64, numClusters+1)
+	fittedSize := make([]int, numClusters+1)
+	labels := make([]int, len(logs))
+	isFitted := make([]bool, len(logs))
+	for j, label := range fittedLabels {
+		i := fitted[j]
+		labels[i] = label
+		isFitted[i] = true
+		if label == 0 {
+			continue
+		}
+		dist := cosineDistance(vectors[j], centres[label])
+		if dist > radius[label] {
+			radius[label] = dist
+		}
+		if fittedSize[label] == 0 || dist < centralDist[label] {
+			central[label], centralDist[label] = i, dist
+		}
+		confidence[label] += 1 - dist
+		fittedSize[label]++
+	}
+	for label := 1; label <= numClusters; label++ {
+		confidence[label] = math.Min(1, confidence[label]/float64(fittedSize[label]))
+	}
+
+	for i, log := range logs {
+		if isFitted[i] {
+			continue
+		}
+		vector := vectorizer.Transform(log.Message)
+		best, bestDist := 0, 0.0
+		for label := 1; label <= numClusters; label++ {
+			if dist := cosineDistance(vector, centres[label]); best == 0 || dist < bestDist {
+				best, bestDist = label, dist
+			}
+		}
+		if best != 0 && bestDist <= radius[best] {
+			labels[i] = best
+		}
+	}
+
+	return buildLogClusters(logs, labels, central, confidence)
+}
+
+// sample returns the indices of the logs to fit on, in ascending order.
+func (c *LogClusterer) sample(n int) []int {
+	if c.SampleSize <= 0 || n <= c.SampleSize {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	return reservoirSample(n, c.SampleSize, c.Seed)
+}
+
+// reservoirSample picks k of the indices 0..n-1 uniformly at random in one
+// pass, seeded so the same n, k and seed always pick the same ones. They
+// are returned in ascending order.
+func reservoirSample(n, k int, seed uint64) []int {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	sample := make([]int, k)
+	for i := range sample {
+		sample[i] = i
+	}
+	for i := k; i < n; i++ {
+		if j := rng.IntN(i + 1); j < k {
+			sample[j] = i
+		}
+	}
+	sort.Ints(sample)
+	return sample
+}
+
+// buildLogClusters summarizes each labelled cluster of logs, given the
+// index of its most central fitted log and its confidence.
+func buildLogClusters(logs []*db.ApplicationLog, labels []int, central []int, confidence []float64) []LogCluster {
+	clusters := make([]LogCluster, len(central))
+	severities := make([]map[string]int, len(central))
+	for i, label := range labels {
+		if label == 0 {
+			continue
+		}
+		cluster := &clusters[label]
+		log := logs[i]
+		if cluster.Frequency == 0 || log.Timestamp.Before(cluster.FirstSeen) {
+			cluster.FirstSeen = log.Timestamp
+		}
+		if log.Timestamp.After(cluster.LastSeen) {
+			cluster.LastSeen = log.Timestamp
+		}
+		cluster.Frequency++
+		if len(cluster.Messages) < maxPatternExamples && !slices.Contains(cluster.Messages, log.Message) {
+			cluster.Messages = append(cluster.Messages, log.Message)
+		}
+		if severities[label] == nil {
+			severities[label] = make(map[string]int)
+		}
+		severities[label][log.Severity]++
+	}
+
+	result := make([]LogCluster, 0, len(clusters)-1)
+	for label := 1; label < len(clusters); label++ {
+		cluster := clusters[label]
+		cluster.Centroid = logs[central[label]].Message
+		cluster.Confidence = confidence[label]
+		// The most common severity, alphabetically first on ties
+		for severity, n := range severities[label] {
+			if best := severities[label][cluster.Severity]; n > best || (n == best && severity < cluster.Severity) {
+				cluster.Severity = severity
+			}
+		}
+		result = append(result, cluster)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Frequency != result[j].Frequency {
+			return result[i].Frequency > result[j].Frequency
+		}
+		return result[i].Centroid < result[j].Centroid
+	})
+	return result
+}
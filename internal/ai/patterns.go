@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// decay is the weight left after age with the given half-life.
+func decay(age, halfLife time.Duration) float64 {
+	return math.Exp2(-age.Seconds() / halfLife.Seconds())
+}
+
+// decayedScore is the cluster's frequency score at now: Score decayed for
+// the time since the pattern was last seen.
+func (c *patternCluster) decayedScore(now time.Time, halfLife time.Duration) float64 {
+	age := now.Sub(c.LastSeen)
+	if age < 0 {
+		age = 0
+	}
+	return c.Score * decay(age, halfLife)
+}
+
+// certainScore is decayedScore without the part inherited on eviction.
+func (c *patternCluster) certainScore(now time.Time, halfLife time.Duration) float64 {
+	age := now.Sub(c.LastSeen)
+	if age < 0 {
+		age = 0
+	}
+	return (c.Score - c.Overscore) * decay(age, halfLife)
+}
+
+// certainCount is how many of the cluster's occurrences are its own rather
+// than inherited on eviction.
+func (c *patternCluster) certainCount() int {
+	return c.Count - c.Overcount
+}
+
+// observe adds an occurrence at ts to the score, which stays anchored at
+// LastSeen. Occurrences older than LastSeen count for less.
+func (c *patternCluster) observe(ts time.Time, halfLife time.Duration) {
+	if ts.After(c.LastSeen) {
+		weight := decay(ts.Sub(c.LastSeen), halfLife)
+		c.Score = c.Score*weight + 1
+		c.Overscore *= weight
+		c.LastSeen = ts
+		return
+	}
+	c.Score += decay(c.LastSeen.Sub(ts), halfLife)
+}
+
+// ErrorCluster is a recurring error pattern of one application/service
+// group.
+type ErrorCluster struct {
+	Key     string `json:"key"`
+	Pattern string `json:"pattern"`
+	// Count is the occurrences within the lookback window
+	Count int `json:"count"`
+	// Score is the time-decayed frequency; patterns that stopped occurring
+	// lose half of it every half-life
+	Score    float64   `json:"score"`
+	LastSeen time.Time `json:"last_seen"`
+	Severity string    `json:"severity"`
+	Examples []string  `json:"examples"`
+}
+
+// ErrorClusters returns the tracked error patterns, or only those of key
+// when it is non-empty, highest score first. A positive limit caps how many
+// are returned.
+func (a *Analyzer) ErrorClusters(key string, limit int) []ErrorCluster {
+	a.mu.RLock()
+	now := a.clock.Now()
+	clusters := make([]ErrorCluster, 0, len(a.patternClusters))
+	for clusterKey, cluster := range a.patternClusters {
+		group, _, _ := strings.Cut(clusterKey, "|")
+		if key != "" && group != key {
+			continue
+		}
+		clusters = append(clusters, ErrorCluster{
+			Key:      group,
+			Pattern:  cluster.Pattern,
+			Count:    cluster.Count,
+			Score:    cluster.decayedScore(now, a.patternHalfLife),
+			LastSeen: cluster.LastSeen,
+			Severity: cluster.Severity,
+			Examples: append([]string(nil), cluster.Examples...),
+		})
+	}
+	a.mu.RUnlock()
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Score != clusters[j].Score {
+			return clusters[i].Score > clusters[j].Score
+		}
+		return clusters[i].LastSeen.After(clusters[j].LastSeen)
+	})
+	if limit > 0 && len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+	return clusters
+}
+
+// SimilarErrors clusters the recent ERROR logs, or only those of the
+// "application:service" group key when it is non-empty, by message
+// similarity with TF-IDF and DBSCAN, largest cluster first. Unlike
+// ErrorClusters it needs no tracked state: it reads each application's
+// lookback window from storage. A positive limit caps how many clusters
+// are returned.
+func (a *Analyzer) SimilarErrors(ctx context.Context, key string, limit int) ([]LogCluster, error) {
+	lookback := a.maxLookback
+	if key != "" {
+		app, _, _ := strings.Cut(key, ":")
+		lookback = a.windowFor(app).Lookback
+	}
+	logs, err := a.storage.GetRecentLogs(ctx, lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.clock.Now()
+	var errors []*db.ApplicationLog
+	for _, log := range filterErrorLogs(logs) {
+		if key != "" && log.ApplicationID+":"+log.ServiceName != key {
+			continue
+		}
+		if log.Timestamp.Before(now.Add(-a.windowFor(log.ApplicationID).Lookback)) {
+			continue
+		}
+		errors = append(errors, log)
+	}
+
+	clusters := a.clusterer.Cluster(errors)
+	if limit > 0 && len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+	return clusters, nil
+}
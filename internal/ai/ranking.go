@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+const (
+	// rankingHalfLife is how long it takes an anomaly's recency weight to
+	// halve since it was last seen
+	rankingHalfLife = 10 * time.Minute
+	// minRankingStdDev floors the baseline deviation when scoring, so a
+	// perfectly flat baseline doesn't make any increase infinitely large
+	minRankingStdDev = 0.01
+)
+
+// severityWeights scale anomaly scores; unknown severities weigh 1
+var severityWeights = map[string]float64{
+	"critical": 4,
+	"high":     3,
+	"medium":   2,
+	"low":      1,
+}
+
+// RankedAnomaly is an ongoing anomaly with its ranking score.
+type RankedAnomaly struct {
+	// Series is the "application:service" group the anomaly belongs to
+	Series string `json:"series"`
+	// Score is Magnitude × severity weight × recency weight
+	Score float64 `json:"score"`
+	// Magnitude is how many baseline deviations the value is above the mean
+	Magnitude float64        `json:"magnitude"`
+	Analysis  *db.AIAnalysis `json:"analysis"`
+}
+
+// TopAnomalies ranks the ongoing anomalies across every group, keeping the
+// highest scoring one per series, and returns at most limit of them.
+func (a *Analyzer) TopAnomalies(limit int) []RankedAnomaly {
+	a.mu.RLock()
+	now := a.clock.Now()
+	bySeries := make(map[string]RankedAnomaly)
+	for id, open := range a.openAnomalies {
+		if now.Sub(open.LastSeen) > a.anomalyCooldown {
+			continue
+		}
+		series := id[:strings.LastIndex(id, "/")]
+		analysis := *open
+		ranked := rankAnomaly(series, &analysis, now)
+		if current, ok := bySeries[series]; !ok || ranked.Score > current.Score {
+			bySeries[series] = ranked
+		}
+	}
+	a.mu.RUnlock()
+
+	ranked := make([]RankedAnomaly, 0, len(bySeries))
+	for _, r := range bySeries {
+		ranked = append(ranked, r)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Series < ranked[j].Series
+	})
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+func rankAnomaly(series string, analysis *db.AIAnalysis, now time.Time) RankedAnomaly {
+	magnitude := anomalyMagnitude(analysis)
+
+	severity, ok := severityWeights[analysis.Severity]
+	if !ok {
+		severity = 1
+	}
+	age := now.Sub(analysis.LastSeen)
+	if age < 0 {
+		age = 0
+	}
+	recency := math.Exp2(-age.Seconds() / rankingHalfLife.Seconds())
+
+	return RankedAnomaly{
+		Series:    series,
+		Score:     magnitude * severity * recency,
+		Magnitude: magnitude,
+		Analysis:  analysis,
+	}
+}
+
+// anomalyMagnitude reads the deviation of an anomaly from its details. It
+// is 1 when the details don't carry a baseline.
+func anomalyMagnitude(analysis *db.AIAnalysis) float64 {
+	var details struct {
+		Current *float64 `json:"current_rate"`
+		Mean    float64  `json:"baseline_mean"`
+		StdDev  float64  `json:"baseline_stddev"`
+	}
+	if err := json.Unmarshal(analysis.Details, &details); err != nil || details.Current == nil {
+		return 1
+	}
+	return (*details.Current - details.Mean) / math.Max(details.StdDev, minRankingStdDev)
+}
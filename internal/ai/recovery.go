@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"api-watchtower/internal/db"
+)
+
+// TypeRecovered is the type of the analysis emitted when an anomalous
+// series has been back within its expected range for the recovery period.
+// Its details name the anomaly it ends as analysis_id.
+const TypeRecovered = "recovered"
+
+// observeRecovery follows a group's open error rate anomaly back to normal.
+// Each cycle whose latest bucket is within the baseline's expected range
+// extends the recovery; any other cycle, anomalous or without enough data
+// to tell, restarts it. Once it has lasted recoveryPeriod the anomaly is
+// resolved and the recovered analysis to save is returned. Anomalies
+// dismissed meanwhile are forgotten without one.
+func (a *Analyzer) observeRecovery(ctx context.Context, key string, latest logBucket) *db.AIAnalysis {
+	if a.recoveryPeriod <= 0 {
+		return nil
+	}
+	id := key + "/" + TypeErrorRateAnomaly
+	rate, mean, inRange := a.withinBaseline(key, latest)
+
+	a.mu.Lock()
+	now := a.clock.Now()
+	open, exists := a.openAnomalies[id]
+	if !exists || !inRange {
+		delete(a.recovering, id)
+		a.mu.Unlock()
+		return nil
+	}
+	since, recovering := a.recovering[id]
+	if !recovering {
+		a.recovering[id] = now
+	}
+	if !recovering || now.Sub(since) < a.recoveryPeriod {
+		a.mu.Unlock()
+		return nil
+	}
+	delete(a.recovering, id)
+	anomalyID := open.ID
+	a.mu.Unlock()
+
+	a.feedbackMu.Lock()
+	defer a.feedbackMu.Unlock()
+
+	anomaly, err := a.storage.GetAnalysis(ctx, anomalyID)
+	if err != nil || anomaly == nil {
+		log.Printf("Failed to load recovered analysis %s: %v", anomalyID, err)
+		return nil
+	}
+	if anomaly.Status != StatusActive && anomaly.Status != StatusConfirmed {
+		a.forgetAnomaly(anomalyID)
+		return nil
+	}
+	if err := a.transition(ctx, anomaly, StatusResolved); err != nil {
+		log.Printf("Failed to resolve recovered analysis %s: %v", anomalyID, err)
+		return nil
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"analysis_id":     anomalyID,
+		"recovered_type":  anomaly.Type,
+		"anomalous_since": anomaly.DetectedAt,
+		"normal_since":    since,
+		"current_rate":    rate,
+		"baseline_mean":   mean,
+	})
+	return &db.AIAnalysis{
+		ID:          db.NewID(),
+		Type:        TypeRecovered,
+		Severity:    "info",
+		Description: "Error rate returned to normal",
+		Details:     details,
+		DetectedAt:  now,
+		// The recovery is an event, not a condition that stays open
+		Status:      StatusResolved,
+		Occurrences: 1,
+		LastSeen:    now,
+	}
+}
+
+// withinBaseline reports whether the latest bucket's error rate is inside
+// the group's expected range, along with the rate and baseline mean. It is
+// false whenever detectAnomalies couldn't have judged the bucket.
+func (a *Analyzer) withinBaseline(key string, latest logBucket) (float64, float64, bool) {
+	if latest.logs < a.minLogs {
+		return 0, 0, false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	baseline, exists := a.baselineMetrics[key]
+	if !exists || a.clock.Now().Sub(baseline.UpdatedAt) > baselineMaxAge {
+		return 0, 0, false
+	}
+	mean, stdDev := baseline.ErrorRate.meanStdDev()
+	rate := latest.errorRate()
+	// Keep in sync with detectAnomalies
+	return rate, mean, rate <= mean+2*stdDev
+}
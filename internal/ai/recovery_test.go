@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/clock"
+	"api-watchtower/internal/db"
+)
+
+// runCycle stores a minute of 20 logs with the given number of errors,
+// runs an analysis cycle over it and moves the clock on a minute.
+func runCycle(t *testing.T, a *Analyzer, clk *clock.Fake, storage *memStorage, errors int) {
+	t.Helper()
+	runCycleOf(t, a, clk, storage, 20, errors)
+}
+
+// runCycleOf is runCycle for a minute of total logs.
+func runCycleOf(t *testing.T, a *Analyzer, clk *clock.Fake, storage *memStorage, total, errors int) {
+	t.Helper()
+	now := clk.Now()
+	logs := make([]*db.ApplicationLog, total)
+	for i := range logs {
+		severity := "INFO"
+		if i < errors {
+			severity = "ERROR"
+		}
+		logs[i] = &db.ApplicationLog{
+			ID:            db.NewID(),
+			ApplicationID: "app",
+			ServiceName:   "api",
+			Severity:      severity,
+			Message:       "request handled",
+			Timestamp:     now.Add(-time.Second),
+		}
+	}
+	storage.mu.Lock()
+	storage.logs = logs
+	storage.mu.Unlock()
+
+	a.analyze(context.Background())
+	clk.Advance(time.Minute)
+}
+
+func analysesOfType(storage *memStorage, typ string) []*db.AIAnalysis {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	var analyses []*db.AIAnalysis
+	for _, id := range storage.saved {
+		if analysis := storage.analyses[id]; analysis.Type == typ {
+			analyses = append(analyses, analysis)
+		}
+	}
+	return analyses
+}
+
+func TestAnomalyRecovery(t *testing.T) {
+	storage := newMemStorage()
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{
+		Window:         AnalysisWindow{Lookback: time.Minute, BucketSize: time.Minute},
+		RecoveryPeriod: 2 * time.Minute,
+	})
+
+	// A baseline of 1-2 errors in 20
+	for i := 0; i < 10; i++ {
+		runCycle(t, a, clk, storage, 1+i%2)
+	}
+	runCycle(t, a, clk, storage, 18)
+
+	anomalies := analysesOfType(storage, TypeErrorRateAnomaly)
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies after the spike, want 1", len(anomalies))
+	}
+	anomalyID := anomalies[0].ID
+
+	// Back to normal, but not for the recovery period yet
+	runCycle(t, a, clk, storage, 1)
+	runCycle(t, a, clk, storage, 2)
+	if got := analysesOfType(storage, TypeRecovered); len(got) != 0 {
+		t.Fatal("recovered before the recovery period")
+	}
+
+	runCycle(t, a, clk, storage, 1)
+	recovered := analysesOfType(storage, TypeRecovered)
+	if len(recovered) != 1 {
+		t.Fatalf("got %d recovered analyses, want 1", len(recovered))
+	}
+	if recovered[0].Status != StatusResolved {
+		t.Errorf("recovered analysis is %s, want %s", recovered[0].Status, StatusResolved)
+	}
+	var details struct {
+		AnalysisID string `json:"analysis_id"`
+	}
+	if err := json.Unmarshal(recovered[0].Details, &details); err != nil || details.AnalysisID != anomalyID {
+		t.Errorf("recovered analysis names %q (%v), want the anomaly %s", details.AnalysisID, err, anomalyID)
+	}
+	if anomaly, _ := storage.GetAnalysis(context.Background(), anomalyID); anomaly.Status != StatusResolved {
+		t.Errorf("anomaly is %s after recovering, want %s", anomaly.Status, StatusResolved)
+	}
+
+	// The anomaly is recovered only once
+	runCycle(t, a, clk, storage, 1)
+	if got := analysesOfType(storage, TypeRecovered); len(got) != 1 {
+		t.Errorf("got %d recovered analyses after another normal cycle, want 1", len(got))
+	}
+}
+
+func TestOngoingAnomalyKeepsStoredVerdict(t *testing.T) {
+	storage := newMemStorage()
+	a, clk := newTestAnalyzer(t, storage, AnalyzerConfig{
+		Window: AnalysisWindow{Lookback: time.Minute, BucketSize: time.Minute},
+	})
+
+	for i := 0; i < 10; i++ {
+		runCycle(t, a, clk, storage, 1+i%2)
+	}
+	runCycle(t, a, clk, storage, 18)
+	anomalies := analysesOfType(storage, TypeErrorRateAnomaly)
+	if len(anomalies) != 1 {
+		t.Fatalf("got %d anomalies after the spike, want 1", len(anomalies))
+	}
+
+	// Confirmed by another writer after the analyzer last read it
+	storage.mu.Lock()
+	storage.analyses[anomalies[0].ID].Status = StatusConfirmed
+	storage.analyses[anomalies[0].ID].FeedbackScore = 1
+	storage.mu.Unlock()
+
+	runCycle(t, a, clk, storage, 18)
+	anomaly, _ := storage.GetAnalysis(context.Background(), anomalies[0].ID)
+	if anomaly.Occurrences != 2 {
+		t.Errorf("anomaly has %d occurrences after spiking again, want 2", anomaly.Occurrences)
+	}
+	if anomaly.Status != StatusConfirmed || anomaly.FeedbackScore != 1 {
+		t.Errorf("ongoing update left the anomaly %s with score %d, want %s with 1", anomaly.Status, anomaly.FeedbackScore, StatusConfirmed)
+	}
+}
@@ -0,0 +1,46 @@
+package ai
+
+import (
+	"net/url"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// traceIDPlaceholder is replaced by the trace ID in TraceURLTemplate.
+const traceIDPlaceholder = "{traceID}"
+
+// maxTraceLinks caps the trace links attached to one analysis.
+const maxTraceLinks = 5
+
+func validateTraceURLTemplate(template string, errs *db.ValidationErrors) {
+	if template == "" {
+		return
+	}
+	if !strings.Contains(template, traceIDPlaceholder) {
+		errs.Add("trace_url_template", db.CodeInvalid, "trace_url_template must contain "+traceIDPlaceholder)
+		return
+	}
+	if _, err := url.Parse(strings.ReplaceAll(template, traceIDPlaceholder, "id")); err != nil {
+		errs.Add("trace_url_template", db.CodeInvalid, "trace_url_template is not a valid URL")
+	}
+}
+
+// traceURLs renders a link for each distinct trace ID, or nothing when
+// trace links aren't configured.
+func (a *Analyzer) traceURLs(traceIDs []string) []string {
+	if a.traceURL == "" || len(traceIDs) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(traceIDs))
+	urls := make([]string, 0, len(traceIDs))
+	for _, id := range traceIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		urls = append(urls, strings.ReplaceAll(a.traceURL, traceIDPlaceholder, url.PathEscape(id)))
+	}
+	return urls
+}
@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// AnalysisWindow sets how far back a group's logs are analyzed and the
+// bucket size error rates and latencies are aggregated over. Every bucket
+// feeds the group's baseline once, and the latest is what gets compared
+// against it.
+type AnalysisWindow struct {
+	Lookback   time.Duration
+	BucketSize time.Duration
+}
+
+// Defaults for AnalyzerConfig.Window
+const (
+	DefaultLookback   = 24 * time.Hour
+	DefaultBucketSize = time.Minute
+)
+
+// latencyPayloadKey is the payload field read as a log's latency in
+// milliseconds.
+const latencyPayloadKey = "latency_ms"
+
+// validate checks that the window is positive and divides evenly into
+// buckets.
+func (w AnalysisWindow) validate(field string, errs *db.ValidationErrors) {
+	switch {
+	case w.Lookback <= 0:
+		errs.Add(field+".lookback", db.CodeInvalid, "lookback must be positive")
+	case w.BucketSize <= 0:
+		errs.Add(field+".bucket_size", db.CodeInvalid, "bucket_size must be positive")
+	case w.Lookback%w.BucketSize != 0:
+		errs.Add(field+".lookback", db.CodeInvalid, fmt.Sprintf("lookback %s is not a multiple of bucket_size %s", w.Lookback, w.BucketSize))
+	}
+}
+
+// logBucket aggregates the logs of one bucket.
+type logBucket struct {
+	logs, errors int
+	latencySum   float64
+	latencyCount int
+	// traceIDs samples the trace IDs of the bucket's error logs
+	traceIDs []string
+}
+
+func (b logBucket) errorRate() float64 {
+	return float64(b.errors) / float64(b.logs)
+}
+
+func (b logBucket) latency() (float64, bool) {
+	if b.latencyCount == 0 {
+		return 0, false
+	}
+	return b.latencySum / float64(b.latencyCount), true
+}
+
+// budgetCheckInterval is how many logs the per-log loops of a group's
+// analysis handle between checks of its time budget.
+const budgetCheckInterval = 1024
+
+// bucketLogs aggregates logs into the window's buckets ending at now,
+// oldest first. Logs outside the lookback are ignored. It returns nil if
+// ctx ends first.
+func (w AnalysisWindow) bucketLogs(ctx context.Context, logs []*db.ApplicationLog, now time.Time) []logBucket {
+	start := now.Add(-w.Lookback)
+	buckets := make([]logBucket, int(w.Lookback/w.BucketSize))
+	for n, log := range logs {
+		if n%budgetCheckInterval == 0 && ctx.Err() != nil {
+			return nil
+		}
+		if log.Timestamp.Before(start) || log.Timestamp.After(now) {
+			continue
+		}
+		i := int(log.Timestamp.Sub(start) / w.BucketSize)
+		if i >= len(buckets) {
+			i = len(buckets) - 1
+		}
+
+		b := &buckets[i]
+		b.logs++
+		if log.Severity == "ERROR" {
+			b.errors++
+			if log.TraceID != "" && len(b.traceIDs) < maxTraceLinks {
+				b.traceIDs = append(b.traceIDs, log.TraceID)
+			}
+		}
+		if latency, ok := logLatency(log); ok {
+			b.latencySum += latency
+			b.latencyCount++
+		}
+	}
+	return buckets
+}
+
+// withinLookback returns the logs no older than the lookback.
+func (w AnalysisWindow) withinLookback(logs []*db.ApplicationLog, now time.Time) []*db.ApplicationLog {
+	start := now.Add(-w.Lookback)
+	recent := make([]*db.ApplicationLog, 0, len(logs))
+	for _, log := range logs {
+		if !log.Timestamp.Before(start) {
+			recent = append(recent, log)
+		}
+	}
+	return recent
+}
+
+func logLatency(log *db.ApplicationLog) (float64, bool) {
+	if len(log.Payload) == 0 {
+		return 0, false
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(log.Payload, &payload); err != nil {
+		return 0, false
+	}
+	var latency float64
+	if err := json.Unmarshal(payload[latencyPayloadKey], &latency); err != nil {
+		return 0, false
+	}
+	return latency, true
+}
@@ -0,0 +1,224 @@
+package alert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// SourceAlertmanager is the source of alerts received from a Prometheus
+// Alertmanager webhook. Their SourceID is the Alertmanager fingerprint,
+// which ties a resolved notification to the alert it fired.
+const SourceAlertmanager = "alertmanager"
+
+// Alertmanager alert statuses
+const (
+	alertmanagerFiring   = "firing"
+	alertmanagerResolved = "resolved"
+)
+
+// AlertmanagerWebhook is the payload of Alertmanager's webhook receiver,
+// version 4.
+type AlertmanagerWebhook struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerAlert is one alert in an AlertmanagerWebhook.
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// AlertmanagerResult counts what ReceiveAlertmanager did with a payload's
+// alerts. Unchanged counts firing alerts that are already active, which
+// Alertmanager resends every repeat interval, and resolved alerts with no
+// active alert to resolve.
+type AlertmanagerResult struct {
+	Created   int `json:"created"`
+	Resolved  int `json:"resolved"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Validate checks the payload is a version 4 webhook whose alerts are
+// firing or resolved and carry an alertname.
+func (w *AlertmanagerWebhook) Validate() error {
+	var errs db.ValidationErrors
+	if w.Version != "4" {
+		errs.Add("version", db.CodeUnsupported, fmt.Sprintf("unsupported webhook version %q, expected 4", w.Version))
+	}
+	for i, a := range w.Alerts {
+		field := fmt.Sprintf("alerts[%d]", i)
+		if a.Status != alertmanagerFiring && a.Status != alertmanagerResolved {
+			errs.Add(field+".status", db.CodeUnsupported, fmt.Sprintf("unknown status %q; expected firing or resolved", a.Status))
+		}
+		if a.Labels["alertname"] == "" {
+			errs.Add(field+".labels.alertname", db.CodeRequired, "alertname label is required")
+		}
+	}
+	return errs.Err()
+}
+
+// alertmanagerSeverities maps common severity label values onto the
+// severities alerts use; anything else, or no label, is a warning.
+var alertmanagerSeverities = map[string]string{
+	"critical":  "critical",
+	"page":      "critical",
+	"fatal":     "critical",
+	"emergency": "critical",
+	"high":      "high",
+	"error":     "high",
+	"major":     "high",
+	"warning":   "warning",
+	"warn":      "warning",
+	"medium":    "warning",
+	"minor":     "warning",
+	"info":      "info",
+	"low":       "info",
+	"none":      "info",
+	"notice":    "info",
+}
+
+// alertmanagerSeverity maps an Alertmanager severity label onto critical,
+// high, warning or info.
+func alertmanagerSeverity(label string) string {
+	if severity, ok := alertmanagerSeverities[strings.ToLower(strings.TrimSpace(label))]; ok {
+		return severity
+	}
+	return "warning"
+}
+
+// ReceiveAlertmanager takes in the alerts of an Alertmanager webhook.
+// Firing alerts become alerts of type alertname and the severity label's
+// severity mapped onto critical, high, warning or info (warning when
+// unknown or missing), with their labels as details, and go
+// through the same storm cap, inhibition, correlation and notification as
+// rule alerts. Resolved alerts resolve the active alert with their
+// fingerprint. Webhooks are taken in one at a time.
+func (m *Manager) ReceiveAlertmanager(ctx context.Context, webhook *AlertmanagerWebhook) (*AlertmanagerResult, error) {
+	if err := webhook.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.alertmanagerMu.Lock()
+	defer m.alertmanagerMu.Unlock()
+
+	active, err := m.storage.GetActiveAlerts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active alerts: %v", err)
+	}
+	byFingerprint := make(map[string]*db.Alert)
+	for _, alert := range active {
+		if alert.Source == SourceAlertmanager && alert.Status != "resolved" {
+			byFingerprint[alert.SourceID] = alert
+		}
+	}
+
+	result := &AlertmanagerResult{}
+	for _, a := range webhook.Alerts {
+		fingerprint := a.Fingerprint
+		if fingerprint == "" {
+			fingerprint = labelsFingerprint(a.Labels)
+		}
+		existing := byFingerprint[fingerprint]
+
+		switch {
+		case a.Status == alertmanagerResolved && existing != nil:
+			if err := m.ResolveAlert(ctx, existing.ID, SourceAlertmanager); err != nil {
+				return result, fmt.Errorf("failed to resolve alert %s: %v", existing.ID, err)
+			}
+			delete(byFingerprint, fingerprint)
+			result.Resolved++
+		case a.Status == alertmanagerFiring && existing == nil:
+			alert := alertmanagerAlert(webhook, a, fingerprint, m.now())
+			created, err := m.raise(ctx, alert, false)
+			if err != nil {
+				return result, err
+			}
+			if !created {
+				// Suppressed by the storm cap; Alertmanager resends it
+				result.Unchanged++
+				continue
+			}
+			byFingerprint[fingerprint] = alert
+			result.Created++
+		default:
+			result.Unchanged++
+		}
+	}
+	return result, nil
+}
+
+// alertmanagerAlert converts a firing Alertmanager alert. Its labels become
+// the details, so inhibit rules and correlation can match on them, with its
+// annotations and links alongside unless a label takes the key.
+func alertmanagerAlert(webhook *AlertmanagerWebhook, a AlertmanagerAlert, fingerprint string, now time.Time) *db.Alert {
+	details := map[string]interface{}{
+		"annotations":   a.Annotations,
+		"starts_at":     a.StartsAt,
+		"generator_url": a.GeneratorURL,
+		"external_url":  webhook.ExternalURL,
+		"receiver":      webhook.Receiver,
+	}
+	for k, v := range a.Labels {
+		details[k] = v
+	}
+	raw, _ := json.Marshal(details)
+
+	message := a.Annotations["summary"]
+	if message == "" {
+		message = a.Annotations["description"]
+	}
+	if message == "" {
+		message = a.Labels["alertname"]
+	}
+
+	return &db.Alert{
+		ID:        db.NewID(),
+		Type:      a.Labels["alertname"],
+		Source:    SourceAlertmanager,
+		SourceID:  fingerprint,
+		Severity:  alertmanagerSeverity(a.Labels["severity"]),
+		Message:   message,
+		Details:   raw,
+		Status:    "active",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// labelsFingerprint identifies an alert by its label set, for senders that
+// leave out Alertmanager's fingerprint.
+func labelsFingerprint(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\xff%s\xff", name, labels[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
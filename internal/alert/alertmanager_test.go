@@ -0,0 +1,59 @@
+package alert
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func firingWebhook(severity string) *AlertmanagerWebhook {
+	return &AlertmanagerWebhook{
+		Version: "4",
+		Alerts: []AlertmanagerAlert{{
+			Status:      alertmanagerFiring,
+			Labels:      map[string]string{"alertname": "HighLatency", "severity": severity},
+			Fingerprint: "fp-" + severity,
+		}},
+	}
+}
+
+func TestAlertmanagerSeverityMapping(t *testing.T) {
+	for label, want := range map[string]string{
+		"critical": "critical",
+		"PAGE":     "critical",
+		"error":    "high",
+		"warning":  "warning",
+		"none":     "info",
+		"":         "warning",
+		"sev2":     "warning",
+	} {
+		m, storage, _, _ := newTestManager(t)
+		if _, err := m.ReceiveAlertmanager(context.Background(), firingWebhook(label)); err != nil {
+			t.Fatalf("ReceiveAlertmanager: %v", err)
+		}
+		active := storage.active()
+		if len(active) != 1 || active[0].Severity != want {
+			t.Errorf("severity %q: got %+v, want one %s alert", label, active, want)
+		}
+	}
+}
+
+func TestConcurrentAlertmanagerWebhooksCreateOneAlert(t *testing.T) {
+	m, storage, _, _ := newTestManager(t)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.ReceiveAlertmanager(context.Background(), firingWebhook("critical")); err != nil {
+				t.Errorf("ReceiveAlertmanager: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(storage.active()); got != 1 {
+		t.Errorf("got %d active alerts for one fingerprint, want 1", got)
+	}
+}
@@ -0,0 +1,116 @@
+package alert
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/clock"
+)
+
+// ErrCircuitOpen is returned for sends to a channel whose breaker is open.
+var ErrCircuitOpen = errors.New("notification channel circuit breaker is open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerState is a snapshot of one channel's circuit breaker.
+type BreakerState struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+	// Rejected counts sends fast-failed while the breaker was open
+	Rejected uint64 `json:"rejected"`
+}
+
+// circuitBreaker stops sends to a channel after threshold consecutive
+// failures. Once cooldown has passed a single probe send is let through; its
+// outcome closes the breaker or opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     clock.Clock
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	rejected uint64
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, c clock.Clock) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     c,
+		state:     BreakerClosed,
+	}
+}
+
+// allow reports whether a send may proceed, counting it as rejected if not.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Since(b.openedAt) >= b.cooldown {
+			b.state = BreakerHalfOpen
+			return true
+		}
+	case BreakerHalfOpen:
+		// A probe is already in flight
+	default:
+		return true
+	}
+
+	b.rejected++
+	return false
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// abandon gives up an allowed send that never reached the channel. An
+// abandoned probe reopens the breaker so the next send probes again.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+func (b *circuitBreaker) snapshot() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerState{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Rejected:            b.rejected,
+	}
+	if b.state != BreakerClosed {
+		s.OpenedAt = b.openedAt
+	}
+	return s
+}
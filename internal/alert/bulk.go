@@ -0,0 +1,141 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// AlertFilter selects active alerts for bulk actions. Empty fields match
+// every alert.
+type AlertFilter struct {
+	Source   string `json:"source"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	// OlderThan matches alerts created at least this long ago
+	OlderThan time.Duration `json:"-"`
+}
+
+func (f AlertFilter) empty() bool {
+	return f.Source == "" && f.Type == "" && f.Severity == "" && f.OlderThan <= 0
+}
+
+func (f AlertFilter) matches(alert *db.Alert, now time.Time) bool {
+	if f.Source != "" && alert.Source != f.Source {
+		return false
+	}
+	if f.Type != "" && alert.Type != f.Type {
+		return false
+	}
+	if f.Severity != "" && alert.Severity != f.Severity {
+		return false
+	}
+	if f.OlderThan > 0 && now.Sub(alert.CreatedAt) < f.OlderThan {
+		return false
+	}
+	return true
+}
+
+// BulkFailure is an alert a bulk action couldn't fully apply to.
+type BulkFailure struct {
+	AlertID string `json:"alert_id"`
+	Error   string `json:"error"`
+}
+
+// BulkResult reports the outcome of a bulk action.
+type BulkResult struct {
+	Affected int           `json:"affected"`
+	Failures []BulkFailure `json:"failures"`
+}
+
+// ErrEmptyFilter is returned when a bulk action has no filter, so a
+// request can't resolve every active alert by accident.
+var ErrEmptyFilter = errors.New("at least one filter is required")
+
+// BulkResolve resolves every active alert matching the filter in one
+// storage transaction, then releases the alerts they were inhibiting.
+// Failures to release are reported per alert; the resolutions stand.
+func (m *Manager) BulkResolve(ctx context.Context, filter AlertFilter, resolvedBy string) (*BulkResult, error) {
+	now := m.now()
+	matched, err := m.matchActive(ctx, filter, now, func(alert *db.Alert) bool {
+		return alert.Status != "resolved"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]*db.Alert, len(matched))
+	for i, alert := range matched {
+		updates[i] = &db.Alert{
+			ID:         alert.ID,
+			Status:     "resolved",
+			ResolvedAt: &now,
+			ResolvedBy: resolvedBy,
+			UpdatedAt:  now,
+		}
+	}
+	if err := m.storage.UpdateAlerts(ctx, updates); err != nil {
+		return nil, fmt.Errorf("failed to resolve alerts: %v", err)
+	}
+	alertsResolved.Add(float64(len(updates)))
+
+	result := &BulkResult{Affected: len(updates), Failures: []BulkFailure{}}
+	for _, alert := range updates {
+		m.resetCooldown(alert.ID)
+		if err := m.releaseInhibited(ctx, alert.ID); err != nil {
+			result.Failures = append(result.Failures, BulkFailure{AlertID: alert.ID, Error: err.Error()})
+		}
+	}
+	return result, nil
+}
+
+// BulkAcknowledge acknowledges every active alert matching the filter in
+// one storage transaction. Alerts already acknowledged are left as they
+// are.
+func (m *Manager) BulkAcknowledge(ctx context.Context, filter AlertFilter, acknowledgedBy string) (*BulkResult, error) {
+	now := m.now()
+	matched, err := m.matchActive(ctx, filter, now, func(alert *db.Alert) bool {
+		return alert.Status != "resolved" && alert.Status != "acknowledged"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]*db.Alert, len(matched))
+	for i, alert := range matched {
+		updates[i] = &db.Alert{
+			ID:        alert.ID,
+			Status:    "acknowledged",
+			AckedAt:   &now,
+			AckedBy:   acknowledgedBy,
+			UpdatedAt: now,
+		}
+	}
+	if err := m.storage.UpdateAlerts(ctx, updates); err != nil {
+		return nil, fmt.Errorf("failed to acknowledge alerts: %v", err)
+	}
+
+	return &BulkResult{Affected: len(updates), Failures: []BulkFailure{}}, nil
+}
+
+func (m *Manager) matchActive(ctx context.Context, filter AlertFilter, now time.Time, eligible func(*db.Alert) bool) ([]*db.Alert, error) {
+	if filter.empty() {
+		return nil, ErrEmptyFilter
+	}
+
+	alerts, err := m.storage.GetActiveAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*db.Alert
+	for _, alert := range alerts {
+		if eligible(alert) && filter.matches(alert, now) {
+			matched = append(matched, alert)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,48 @@
+package alert
+
+import (
+	"fmt"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// burnRateCondition matches results whose SLO error budget burn rate is at
+// least Threshold over every one of Windows, the multi-window pattern that
+// ignores short blips: e.g. threshold 14.4 over 1h and 5m for a fast burn,
+// 6 over 6h and 30m for a slow one. Windows must be among the target's SLO
+// burn windows; a window without a burn rate never matches.
+type burnRateCondition struct {
+	Threshold float64  `json:"threshold"`
+	Windows   []string `json:"windows"`
+
+	keys []string
+}
+
+func validateBurnRateCondition(cond *burnRateCondition, errs *db.ValidationErrors) {
+	if cond.Threshold <= 0 {
+		errs.Add("burn_rate.threshold", db.CodeInvalid, "threshold must be positive")
+	}
+	if len(cond.Windows) == 0 {
+		errs.Add("burn_rate.windows", db.CodeRequired, "at least one window is required")
+	}
+	cond.keys = cond.keys[:0]
+	for i, w := range cond.Windows {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 {
+			errs.Add(fmt.Sprintf("burn_rate.windows[%d]", i), db.CodeInvalid, fmt.Sprintf("invalid window %q", w))
+			continue
+		}
+		cond.keys = append(cond.keys, db.BurnWindowKey(d))
+	}
+}
+
+func (c *burnRateCondition) matches(rates map[string]float64) bool {
+	for _, key := range c.keys {
+		rate, ok := rates[key]
+		if !ok || rate < c.Threshold {
+			return false
+		}
+	}
+	return true
+}
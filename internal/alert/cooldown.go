@@ -0,0 +1,69 @@
+package alert
+
+import (
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// cooldownEntry is the rule cooldown an alert started: the LastTriggered
+// entry its rule set for its source.
+type cooldownEntry struct {
+	ruleID    string
+	sourceID  string
+	triggered time.Time
+}
+
+// trackCooldown remembers the cooldown a new alert started, if its rule
+// resets cooldowns on resolution.
+func (m *Manager) trackCooldown(rule *Rule, alert *db.Alert) {
+	if !rule.ResetCooldownOnResolve {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneCooldowns(m.clock.Now())
+	m.cooldowns[alert.ID] = cooldownEntry{
+		ruleID:    rule.ID,
+		sourceID:  alert.SourceID,
+		triggered: rule.LastTriggered[alert.SourceID],
+	}
+}
+
+// pruneCooldowns forgets the cooldowns there is nothing left to reset
+// for: those that have run out, been restarted by a later alert, or whose
+// rule is gone or no longer resets on resolution. Otherwise alerts that
+// are never resolved would be remembered forever. m.mu must be held.
+func (m *Manager) pruneCooldowns(now time.Time) {
+	for alertID, entry := range m.cooldowns {
+		rule, exists := m.rules[entry.ruleID]
+		if !exists || !rule.ResetCooldownOnResolve ||
+			!rule.LastTriggered[entry.sourceID].Equal(entry.triggered) ||
+			now.Sub(entry.triggered) >= rule.Cooldown {
+			delete(m.cooldowns, alertID)
+		}
+	}
+}
+
+// resetCooldown ends the cooldown a resolved alert started, so a
+// recurrence alerts right away. A cooldown restarted since by a later
+// alert, or whose rule no longer resets on resolution, is left alone.
+func (m *Manager) resetCooldown(alertID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.cooldowns[alertID]
+	if !ok {
+		return
+	}
+	delete(m.cooldowns, alertID)
+
+	rule, exists := m.rules[entry.ruleID]
+	if !exists || !rule.ResetCooldownOnResolve {
+		return
+	}
+	if rule.LastTriggered[entry.sourceID].Equal(entry.triggered) {
+		delete(rule.LastTriggered, entry.sourceID)
+	}
+}
@@ -1,10 +1,17 @@
 package alert
 
 import (
-	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"api-watchtower/internal/clock"
+	"api-watchtower/internal/db"
 )
 
 // CorrelationEngine analyzes and groups related alerts
@@ -13,23 +20,49 @@ type CorrelationEngine struct {
 	activeGroups    map[string]*AlertGroup
 	groupTTL        time.Duration
 	cleanupInterval time.Duration
-	mu             sync.RWMutex
+	maxGroups       int
+	clock           clock.Clock
+	scorer          Scorer
+	mu              sync.RWMutex
 }
 
 type CorrelationRule struct {
-	ID          string
-	Name        string
-	Description string
-	Conditions  []CorrelationCondition
-	GroupBy     []string
-	MinCount    int
-	TimeWindow  time.Duration
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Conditions  []CorrelationCondition `json:"conditions"`
+	GroupBy     []string               `json:"group_by"`
+	MinCount    int                    `json:"min_count"`
+	TimeWindow  time.Duration          `json:"time_window"`
+}
+
+// MarshalJSON writes TimeWindow as a duration string.
+func (r CorrelationRule) MarshalJSON() ([]byte, error) {
+	type plain CorrelationRule
+	return json.Marshal(struct {
+		plain
+		TimeWindow duration `json:"time_window"`
+	}{plain(r), duration(r.TimeWindow)})
+}
+
+// UnmarshalJSON accepts TimeWindow as a duration string or nanoseconds.
+func (r *CorrelationRule) UnmarshalJSON(data []byte) error {
+	type plain CorrelationRule
+	aux := struct {
+		*plain
+		TimeWindow duration `json:"time_window"`
+	}{plain: (*plain)(r), TimeWindow: duration(r.TimeWindow)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.TimeWindow = time.Duration(aux.TimeWindow)
+	return nil
 }
 
 type CorrelationCondition struct {
-	Field    string
-	Operator string
-	Value    interface{}
+	Field    string      `json:"field"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
 }
 
 type AlertGroup struct {
@@ -39,7 +72,22 @@ type AlertGroup struct {
 	FirstSeen time.Time
 	LastSeen  time.Time
 	Status    string
-	Score     float64
+	// Score is the engine's Scorer's 0–1 urgency rating
+	Score float64
+	// LastNotified is when the group last sent a rolled-up notification
+	LastNotified time.Time
+}
+
+// clone returns a copy of the group that shares nothing the engine mutates,
+// so callers can read it after the engine's lock is released.
+func (g *AlertGroup) clone() *AlertGroup {
+	c := *g
+	c.Alerts = make([]*Alert, len(g.Alerts))
+	for i, alert := range g.Alerts {
+		a := *alert
+		c.Alerts[i] = &a
+	}
+	return &c
 }
 
 // alertHeap implements a min-heap of alerts by timestamp
@@ -61,18 +109,39 @@ func (h *alertHeap) Pop() interface{} {
 	return x
 }
 
+// DefaultMaxCorrelationGroups bounds the groups tracked at once.
+const DefaultMaxCorrelationGroups = 10000
+
 func NewCorrelationEngine(rules []CorrelationRule) *CorrelationEngine {
 	engine := &CorrelationEngine{
 		rules:           rules,
 		activeGroups:    make(map[string]*AlertGroup),
 		groupTTL:        24 * time.Hour,
 		cleanupInterval: time.Hour,
+		maxGroups:       DefaultMaxCorrelationGroups,
+		clock:           clock.Real{},
+		scorer:          DefaultScorer,
 	}
 
 	go engine.cleanupRoutine()
 	return engine
 }
 
+// SetMaxGroups caps the number of tracked groups. Beyond it the least
+// recently seen group is evicted, resolved groups first.
+func (ce *CorrelationEngine) SetMaxGroups(n int) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	ce.maxGroups = n
+}
+
+// SetClock replaces the time source used for time windows and group expiry.
+func (ce *CorrelationEngine) SetClock(c clock.Clock) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	ce.clock = c
+}
+
 func (ce *CorrelationEngine) ProcessAlert(alert *Alert) ([]*AlertGroup, error) {
 	ce.mu.Lock()
 	defer ce.mu.Unlock()
@@ -84,15 +153,15 @@ func (ce *CorrelationEngine) ProcessAlert(alert *Alert) ([]*AlertGroup, error) {
 		if ce.matchesRule(alert, rule) {
 			groupKey := ce.generateGroupKey(alert, rule)
 			group := ce.getOrCreateGroup(groupKey, &rule)
-			
+
 			// Add alert to group
 			group.Alerts = append(group.Alerts, alert)
 			group.LastSeen = alert.CreatedAt
-			
+
 			// Update group status
 			ce.updateGroupStatus(group)
-			
-			updatedGroups = append(updatedGroups, group)
+
+			updatedGroups = append(updatedGroups, group.clone())
 		}
 	}
 
@@ -110,7 +179,7 @@ func (ce *CorrelationEngine) matchesRule(alert *Alert, rule CorrelationRule) boo
 
 func (ce *CorrelationEngine) matchesCondition(alert *Alert, cond CorrelationCondition) bool {
 	var fieldValue interface{}
-	
+
 	// Extract field value based on field path
 	switch cond.Field {
 	case "type":
@@ -133,7 +202,7 @@ func (ce *CorrelationEngine) matchesCondition(alert *Alert, cond CorrelationCond
 	// Compare using operator
 	switch cond.Operator {
 	case "equals":
-		return fieldValue == cond.Value
+		return scalarEqual(fieldValue, cond.Value)
 	case "contains":
 		if str, ok := fieldValue.(string); ok {
 			if pattern, ok := cond.Value.(string); ok {
@@ -143,7 +212,7 @@ func (ce *CorrelationEngine) matchesCondition(alert *Alert, cond CorrelationCond
 	case "in":
 		if values, ok := cond.Value.([]interface{}); ok {
 			for _, v := range values {
-				if v == fieldValue {
+				if scalarEqual(v, fieldValue) {
 					return true
 				}
 			}
@@ -153,40 +222,59 @@ func (ce *CorrelationEngine) matchesCondition(alert *Alert, cond CorrelationCond
 	return false
 }
 
+// scalarValue returns v as a comparable string, float64 or bool, and false
+// for anything else, such as the maps and lists alert details can hold.
+func scalarValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string, bool, float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	}
+	return nil, false
+}
+
+// scalarEqual compares two condition or detail values. Values that aren't
+// scalars never match; comparing them with == could panic.
+func scalarEqual(a, b interface{}) bool {
+	x, ok := scalarValue(a)
+	if !ok {
+		return false
+	}
+	y, ok := scalarValue(b)
+	return ok && x == y
+}
+
+// generateGroupKey builds a fixed-length key from the rule and its GroupBy
+// values. Values are length-prefixed before hashing so that values
+// containing separators can't collide, and high-cardinality values don't
+// produce unbounded keys.
 func (ce *CorrelationEngine) generateGroupKey(alert *Alert, rule CorrelationRule) string {
-	var parts []string
-	parts = append(parts, rule.ID)
+	h := sha256.New()
 
 	for _, field := range rule.GroupBy {
-		var value string
-		switch field {
-		case "type":
-			value = alert.Type
-		case "source":
-			value = alert.Source
-		case "severity":
-			value = alert.Severity
-		default:
-			if details, ok := alert.Details.(map[string]interface{}); ok {
-				if v, ok := details[field].(string); ok {
-					value = v
-				}
-			}
-		}
-		parts = append(parts, value)
+		value := alertLabel(alert, field)
+		fmt.Fprintf(h, "%d:%s", len(value), value)
 	}
 
-	return strings.Join(parts, ":")
+	return rule.ID + ":" + hex.EncodeToString(h.Sum(nil))[:32]
 }
 
 func (ce *CorrelationEngine) getOrCreateGroup(key string, rule *CorrelationRule) *AlertGroup {
 	group, exists := ce.activeGroups[key]
 	if !exists {
+		if ce.maxGroups > 0 && len(ce.activeGroups) >= ce.maxGroups {
+			ce.evictGroup()
+		}
 		group = &AlertGroup{
 			ID:        key,
 			Rule:      rule,
 			Alerts:    make([]*Alert, 0),
-			FirstSeen: time.Now(),
+			FirstSeen: ce.clock.Now(),
 			Status:    "active",
 		}
 		ce.activeGroups[key] = group
@@ -194,10 +282,38 @@ func (ce *CorrelationEngine) getOrCreateGroup(key string, rule *CorrelationRule)
 	return group
 }
 
+// evictGroup drops the least recently seen resolved group, or the least
+// recently seen group if none is resolved. Callers must hold ce.mu.
+func (ce *CorrelationEngine) evictGroup() {
+	var victim string
+	var victimGroup *AlertGroup
+	for key, group := range ce.activeGroups {
+		if victimGroup == nil {
+			victim, victimGroup = key, group
+			continue
+		}
+		resolved, victimResolved := group.Status == "resolved", victimGroup.Status == "resolved"
+		if resolved != victimResolved {
+			if resolved {
+				victim, victimGroup = key, group
+			}
+			continue
+		}
+		if group.LastSeen.Before(victimGroup.LastSeen) {
+			victim, victimGroup = key, group
+		}
+	}
+
+	if victimGroup != nil {
+		delete(ce.activeGroups, victim)
+	}
+}
+
 func (ce *CorrelationEngine) updateGroupStatus(group *AlertGroup) {
 	// Remove old alerts outside the time window
-	cutoff := time.Now().Add(-group.Rule.TimeWindow)
-	
+	now := ce.clock.Now()
+	cutoff := now.Add(-group.Rule.TimeWindow)
+
 	var activeAlerts []*Alert
 	for _, alert := range group.Alerts {
 		if alert.CreatedAt.After(cutoff) {
@@ -209,11 +325,10 @@ func (ce *CorrelationEngine) updateGroupStatus(group *AlertGroup) {
 	// Update status based on alert count and time window
 	if len(group.Alerts) >= group.Rule.MinCount {
 		group.Status = "critical"
-		group.Score = float64(len(group.Alerts)) / float64(group.Rule.MinCount)
 	} else {
 		group.Status = "active"
-		group.Score = float64(len(group.Alerts)) / float64(group.Rule.MinCount)
 	}
+	group.Score = ce.scorer(group, now)
 }
 
 func (ce *CorrelationEngine) cleanupRoutine() {
@@ -229,7 +344,7 @@ func (ce *CorrelationEngine) cleanup() {
 	ce.mu.Lock()
 	defer ce.mu.Unlock()
 
-	now := time.Now()
+	now := ce.clock.Now()
 	for key, group := range ce.activeGroups {
 		if now.Sub(group.LastSeen) > ce.groupTTL {
 			delete(ce.activeGroups, key)
@@ -237,7 +352,7 @@ func (ce *CorrelationEngine) cleanup() {
 	}
 }
 
-// GetActiveGroups returns all active alert groups
+// GetActiveGroups returns copies of all active alert groups
 func (ce *CorrelationEngine) GetActiveGroups() []*AlertGroup {
 	ce.mu.RLock()
 	defer ce.mu.RUnlock()
@@ -245,18 +360,212 @@ func (ce *CorrelationEngine) GetActiveGroups() []*AlertGroup {
 	groups := make([]*AlertGroup, 0, len(ce.activeGroups))
 	for _, group := range ce.activeGroups {
 		if group.Status != "resolved" {
-			groups = append(groups, group)
+			groups = append(groups, group.clone())
 		}
 	}
 
-	// Sort by score descending
+	// Sort by score descending, most recently seen first among equals
 	sort.Slice(groups, func(i, j int) bool {
-		return groups[i].Score > groups[j].Score
+		if groups[i].Score != groups[j].Score {
+			return groups[i].Score > groups[j].Score
+		}
+		return groups[i].LastSeen.After(groups[j].LastSeen)
 	})
 
 	return groups
 }
 
+// GetGroup returns a copy of the group with the given ID.
+func (ce *CorrelationEngine) GetGroup(groupID string) (*AlertGroup, bool) {
+	ce.mu.RLock()
+	defer ce.mu.RUnlock()
+
+	group, exists := ce.activeGroups[groupID]
+	if !exists {
+		return nil, false
+	}
+	return group.clone(), true
+}
+
+// RemoveGroup forcibly drops a single group, whatever its status.
+func (ce *CorrelationEngine) RemoveGroup(groupID string) error {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	if _, exists := ce.activeGroups[groupID]; !exists {
+		return fmt.Errorf("group not found: %s", groupID)
+	}
+
+	delete(ce.activeGroups, groupID)
+	return nil
+}
+
+// ResetGroups drops every group and returns how many were removed.
+func (ce *CorrelationEngine) ResetGroups() int {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	removed := len(ce.activeGroups)
+	ce.activeGroups = make(map[string]*AlertGroup)
+	return removed
+}
+
+// claimGroupNotification reports whether a group is critical and, if its
+// cooldown has passed, records a notification and returns the rolled-up
+// alert to send, with the highest member severity.
+func (ce *CorrelationEngine) claimGroupNotification(groupID string, cooldown time.Duration) (*db.Alert, bool, bool) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	group, exists := ce.activeGroups[groupID]
+	if !exists || group.Status != "critical" {
+		return nil, false, false
+	}
+
+	now := ce.clock.Now()
+	if !group.LastNotified.IsZero() && now.Sub(group.LastNotified) < cooldown {
+		return nil, false, true
+	}
+	group.LastNotified = now
+
+	alertIDs := make([]string, 0, len(group.Alerts))
+	severity := ""
+	for _, alert := range group.Alerts {
+		alertIDs = append(alertIDs, alert.ID)
+		if severity == "" || severityScore(alert.Severity) > severityScore(severity) {
+			severity = alert.Severity
+		}
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"group_id":     group.ID,
+		"rule_id":      group.Rule.ID,
+		"member_count": len(group.Alerts),
+		"alert_ids":    alertIDs,
+		"first_seen":   group.FirstSeen,
+		"last_seen":    group.LastSeen,
+	})
+
+	return &db.Alert{
+		ID:        db.NewID(),
+		Type:      "correlation_group",
+		Source:    group.Rule.Name,
+		SourceID:  group.ID,
+		Severity:  severity,
+		Message:   fmt.Sprintf("%s: %d correlated alerts", group.Rule.Name, len(group.Alerts)),
+		Details:   details,
+		Status:    "active",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, true, true
+}
+
+// ValidateCorrelationRule checks a rule's ID, limits and conditions,
+// returning db.ValidationErrors listing every problem found.
+func ValidateCorrelationRule(rule CorrelationRule) error {
+	var errs db.ValidationErrors
+	if rule.ID == "" {
+		errs.Add("id", db.CodeRequired, "id is required")
+	}
+	if rule.MinCount < 0 {
+		errs.Add("min_count", db.CodeInvalid, "min_count must not be negative")
+	}
+	if rule.TimeWindow < 0 {
+		errs.Add("time_window", db.CodeInvalid, "time_window must not be negative")
+	}
+
+	for i, cond := range rule.Conditions {
+		field := fmt.Sprintf("conditions[%d]", i)
+		if cond.Field == "" {
+			errs.Add(field+".field", db.CodeRequired, "field is required")
+		}
+		switch cond.Operator {
+		case "equals":
+			if _, ok := scalarValue(cond.Value); !ok {
+				errs.Add(field+".value", db.CodeInvalid, "equals needs a string, number or bool value")
+			}
+		case "contains":
+			if _, ok := cond.Value.(string); !ok {
+				errs.Add(field+".value", db.CodeInvalid, "contains needs a string value")
+			}
+		case "in":
+			values, ok := cond.Value.([]interface{})
+			if !ok {
+				errs.Add(field+".value", db.CodeInvalid, "in needs a list value")
+			}
+			for j, v := range values {
+				if _, ok := scalarValue(v); !ok {
+					errs.Add(fmt.Sprintf("%s.value[%d]", field, j), db.CodeInvalid, "in values must be strings, numbers or bools")
+				}
+			}
+		case "":
+			errs.Add(field+".operator", db.CodeRequired, "operator is required")
+		default:
+			errs.Add(field+".operator", db.CodeUnsupported, fmt.Sprintf("unsupported operator %q", cond.Operator))
+		}
+	}
+	return errs.Err()
+}
+
+// AddRule validates rule and adds it, replacing any rule with the same ID.
+// Groups formed by a replaced rule are kept and follow the new definition.
+func (ce *CorrelationEngine) AddRule(rule CorrelationRule) error {
+	if err := ValidateCorrelationRule(rule); err != nil {
+		return err
+	}
+
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	for i := range ce.rules {
+		if ce.rules[i].ID == rule.ID {
+			ce.rules[i] = rule
+			for _, group := range ce.activeGroups {
+				if group.Rule.ID == rule.ID {
+					group.Rule = &rule
+				}
+			}
+			return nil
+		}
+	}
+	ce.rules = append(ce.rules, rule)
+	return nil
+}
+
+// RemoveRule deletes a rule along with the groups it formed, and returns
+// how many groups were removed.
+func (ce *CorrelationEngine) RemoveRule(ruleID string) (int, error) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+
+	index := -1
+	for i := range ce.rules {
+		if ce.rules[i].ID == ruleID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return 0, fmt.Errorf("rule not found: %s", ruleID)
+	}
+	ce.rules = append(ce.rules[:index:index], ce.rules[index+1:]...)
+
+	removed := 0
+	for key, group := range ce.activeGroups {
+		if group.Rule.ID == ruleID {
+			delete(ce.activeGroups, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// ListRules returns a copy of the current rules.
+func (ce *CorrelationEngine) ListRules() []CorrelationRule {
+	ce.mu.RLock()
+	defer ce.mu.RUnlock()
+	return append([]CorrelationRule(nil), ce.rules...)
+}
+
 // ResolveGroup marks an alert group as resolved
 func (ce *CorrelationEngine) ResolveGroup(groupID string) error {
 	ce.mu.Lock()
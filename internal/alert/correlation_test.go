@@ -0,0 +1,148 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGroupKeysDoNotCollide(t *testing.T) {
+	ce := NewCorrelationEngine([]CorrelationRule{{ID: "by-source-type", GroupBy: []string{"source", "type"}, MinCount: 1, TimeWindow: time.Hour}})
+
+	// Joined with ":" both would be "a:b:c"
+	first, err := ce.ProcessAlert(&Alert{Source: "a:b", Type: "c", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("ProcessAlert: %v", err)
+	}
+	second, err := ce.ProcessAlert(&Alert{Source: "a", Type: "b:c", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("ProcessAlert: %v", err)
+	}
+
+	if first[0].ID == second[0].ID {
+		t.Errorf("alerts with different group values share group %s", first[0].ID)
+	}
+	if len(first[0].Alerts) != 1 || len(second[0].Alerts) != 1 {
+		t.Errorf("groups hold %d and %d alerts, want 1 each", len(first[0].Alerts), len(second[0].Alerts))
+	}
+}
+
+func TestActiveGroupsAreCapped(t *testing.T) {
+	ce := NewCorrelationEngine([]CorrelationRule{{ID: "by-source", GroupBy: []string{"source"}, MinCount: 1, TimeWindow: time.Hour}})
+	ce.SetMaxGroups(10)
+
+	// A cardinality explosion in the grouped field
+	for i := range 100 {
+		if _, err := ce.ProcessAlert(&Alert{Source: fmt.Sprintf("host-%d", i), CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("ProcessAlert: %v", err)
+		}
+	}
+
+	ce.mu.RLock()
+	defer ce.mu.RUnlock()
+	if got := len(ce.activeGroups); got != 10 {
+		t.Errorf("tracking %d groups, want the cap of 10", got)
+	}
+}
+
+func TestNonScalarConditionValues(t *testing.T) {
+	for _, cond := range []CorrelationCondition{
+		{Field: "annotations", Operator: "equals", Value: map[string]interface{}{"summary": "down"}},
+		{Field: "region", Operator: "in", Value: []interface{}{"eu", []interface{}{"us"}}},
+	} {
+		if err := ValidateCorrelationRule(CorrelationRule{ID: "r", Conditions: []CorrelationCondition{cond}}); err == nil {
+			t.Errorf("accepted %s value %v", cond.Operator, cond.Value)
+		}
+	}
+
+	// Rules that bypass validation still can't panic on map-valued details
+	ce := NewCorrelationEngine([]CorrelationRule{{
+		ID:         "annotations",
+		Conditions: []CorrelationCondition{{Field: "annotations", Operator: "equals", Value: map[string]interface{}{"summary": "down"}}},
+		MinCount:   1,
+		TimeWindow: time.Hour,
+	}, {
+		ID:         "in",
+		Conditions: []CorrelationCondition{{Field: "annotations", Operator: "in", Value: []interface{}{map[string]interface{}{}}}},
+		MinCount:   1,
+		TimeWindow: time.Hour,
+	}})
+	alert := &Alert{Source: "alertmanager", Details: map[string]interface{}{"annotations": map[string]interface{}{"summary": "down"}}, CreatedAt: time.Now()}
+	groups, err := ce.ProcessAlert(alert)
+	if err != nil {
+		t.Fatalf("ProcessAlert: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("non-scalar conditions matched %d groups, want none", len(groups))
+	}
+
+	// Numbers match across JSON and Go types
+	if !scalarEqual(float64(3), 3) || scalarEqual("3", float64(3)) {
+		t.Error("scalar comparison mismatched numbers")
+	}
+}
+
+func TestGroupsAreCopies(t *testing.T) {
+	ce := NewCorrelationEngine([]CorrelationRule{{ID: "by-source", GroupBy: []string{"source"}, MinCount: 1, TimeWindow: time.Hour}})
+	if _, err := ce.ProcessAlert(&Alert{ID: "first", Source: "api", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("ProcessAlert: %v", err)
+	}
+
+	groups := ce.GetActiveGroups()
+	if len(groups) != 1 {
+		t.Fatalf("got %d active groups, want 1", len(groups))
+	}
+	group, ok := ce.GetGroup(groups[0].ID)
+	if !ok {
+		t.Fatalf("group %s not found", groups[0].ID)
+	}
+
+	// Serialized while the engine keeps correlating, as the admin API does
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			if _, err := ce.ProcessAlert(&Alert{ID: fmt.Sprintf("alert-%d", i), Source: "api", CreatedAt: time.Now()}); err != nil {
+				t.Errorf("ProcessAlert: %v", err)
+			}
+		}
+	}()
+	for range 100 {
+		if _, err := json.Marshal(ce.GetActiveGroups()); err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+	}
+	<-done
+
+	for _, g := range []*AlertGroup{groups[0], group} {
+		if len(g.Alerts) != 1 || g.Alerts[0].ID != "first" {
+			t.Errorf("returned group holds %d alerts after more were correlated, want the 1 it was read with", len(g.Alerts))
+		}
+	}
+	group.Alerts[0].Source = "changed"
+	if got, _ := ce.GetGroup(group.ID); got.Alerts[0].Source != "api" {
+		t.Errorf("editing a returned group changed the engine's alert source to %q", got.Alerts[0].Source)
+	}
+}
+
+func TestGroupNotificationTakesHighestSeverity(t *testing.T) {
+	ce := NewCorrelationEngine([]CorrelationRule{{ID: "by-source", Name: "API", GroupBy: []string{"source"}, MinCount: 3, TimeWindow: time.Hour}})
+
+	var groupID string
+	for _, severity := range []string{"warning", "CRITICAL", "info"} {
+		groups, err := ce.ProcessAlert(&Alert{ID: severity, Source: "api", Severity: severity, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("ProcessAlert: %v", err)
+		}
+		groupID = groups[0].ID
+	}
+
+	summary, due, critical := ce.claimGroupNotification(groupID, time.Minute)
+	if !critical || !due {
+		t.Fatalf("group of 3 got critical=%v due=%v, want both", critical, due)
+	}
+	if summary.Severity != "CRITICAL" {
+		t.Errorf("summary severity is %q, want the highest member's %q", summary.Severity, "CRITICAL")
+	}
+}
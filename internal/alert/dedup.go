@@ -0,0 +1,122 @@
+package alert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// defaultDedupFields are hashed when DefaultConfig.DedupFields is empty.
+var defaultDedupFields = []string{"severity", "title", "message"}
+
+// dedupFields are the alert fields deduplication can hash.
+var dedupFields = []string{"type", "severity", "title", "source", "message"}
+
+// validateDedupFields rejects unknown field names, which would otherwise
+// hash to the same value for every alert and suppress all but the first.
+func validateDedupFields(fields []string, errs *db.ValidationErrors) {
+	for i, field := range fields {
+		if !slices.Contains(dedupFields, field) {
+			errs.Add(fmt.Sprintf("defaults.dedup_fields[%d]", i), db.CodeUnsupported,
+				fmt.Sprintf("unknown dedup field %q; use %s", field, strings.Join(dedupFields, ", ")))
+		}
+	}
+}
+
+// dedupKey hashes the configured fields of alert.
+func (nm *NotificationManager) dedupKey(alert *Alert) string {
+	h := sha256.New()
+	for _, field := range nm.config.Defaults.DedupFields {
+		var value string
+		switch field {
+		case "type":
+			value = alert.Type
+		case "severity":
+			value = alert.Severity
+		case "title":
+			value = alert.Title
+		case "source":
+			value = alert.Source
+		case "message":
+			value = alert.Message
+		}
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isDuplicate reports whether an alert with the same content was sent
+// within the dedup window or is being sent, counting it as suppressed if
+// so. A condition that keeps firing is thus notified once per window.
+// Otherwise the alert's content is reserved, in the same critical section,
+// until markSent or releaseDedup.
+func (nm *NotificationManager) isDuplicate(alert *Alert) bool {
+	window := nm.config.Defaults.DedupWindow
+	if window <= 0 {
+		return false
+	}
+
+	key := nm.dedupKey(alert)
+
+	nm.mu.Lock()
+	now := nm.clock.Now()
+	if now.Sub(nm.lastSweep) >= window {
+		for k, seen := range nm.recent {
+			if now.Sub(seen) >= window {
+				delete(nm.recent, k)
+			}
+		}
+		nm.lastSweep = now
+	}
+	seen, exists := nm.recent[key]
+	_, sending := nm.sending[key]
+	duplicate := sending || exists && now.Sub(seen) < window
+	if !duplicate {
+		nm.sending[key] = struct{}{}
+	}
+	nm.mu.Unlock()
+
+	if duplicate {
+		nm.suppressed.Add(1)
+		notificationsDeduplicated.WithLabelValues(severityLabel(alert.Severity)).Inc()
+	}
+	return duplicate
+}
+
+// markSent starts the dedup window of alerts that were delivered. Alerts
+// that were rate limited or failed don't, so a retry still goes out.
+func (nm *NotificationManager) markSent(alerts ...*Alert) {
+	if nm.config.Defaults.DedupWindow <= 0 {
+		return
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	now := nm.clock.Now()
+	for _, alert := range alerts {
+		key := nm.dedupKey(alert)
+		nm.recent[key] = now
+		delete(nm.sending, key)
+	}
+}
+
+// releaseDedup drops the reservation of alerts that weren't delivered, so
+// a retry still goes out.
+func (nm *NotificationManager) releaseDedup(alerts ...*Alert) {
+	if nm.config.Defaults.DedupWindow <= 0 {
+		return
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	for _, alert := range alerts {
+		delete(nm.sending, nm.dedupKey(alert))
+	}
+}
@@ -0,0 +1,118 @@
+package alert
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slackServer counts the notifications posted to it, failing while fail
+// is set.
+func slackServer(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Bool) {
+	t.Helper()
+	var received atomic.Int32
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &received, &fail
+}
+
+func dedupManager(t *testing.T, url string) *NotificationManager {
+	t.Helper()
+	nm, err := NewNotificationManager(NotificationConfig{
+		Slack:    SlackConfig{WebhookURL: url},
+		Defaults: DefaultConfig{DedupWindow: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationManager: %v", err)
+	}
+	return nm
+}
+
+func TestDedupAcrossSources(t *testing.T) {
+	srv, received, _ := slackServer(t)
+	nm := dedupManager(t, srv.URL)
+
+	for _, source := range []string{"monitoring", "ai_analysis"} {
+		alert := &Alert{Severity: "critical", Title: "API down", Message: "checkout is failing", Source: source}
+		if err := nm.Send(context.Background(), alert, []string{"slack"}); err != nil {
+			t.Fatalf("Send from %s: %v", source, err)
+		}
+	}
+
+	if got := received.Load(); got != 1 {
+		t.Errorf("sent %d notifications, want 1", got)
+	}
+	if got := nm.Stats().Deduplicated; got != 1 {
+		t.Errorf("deduplicated %d alerts, want 1", got)
+	}
+}
+
+func TestDedupFailedSendDoesNotSuppressRetry(t *testing.T) {
+	srv, received, fail := slackServer(t)
+	nm := dedupManager(t, srv.URL)
+	alert := &Alert{Severity: "critical", Title: "API down", Message: "checkout is failing", Source: "monitoring"}
+
+	fail.Store(true)
+	if err := nm.Send(context.Background(), alert, []string{"slack"}); err == nil {
+		t.Fatal("Send to a failing channel succeeded")
+	}
+	fail.Store(false)
+	if err := nm.Send(context.Background(), alert, []string{"slack"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := received.Load(); got != 1 {
+		t.Errorf("sent %d notifications, want the retry to go out", got)
+	}
+}
+
+func TestNewNotificationManagerRejectsUnknownDedupFields(t *testing.T) {
+	_, err := NewNotificationManager(NotificationConfig{
+		Defaults: DefaultConfig{DedupWindow: time.Minute, DedupFields: []string{"severity", "mesage"}},
+	})
+	if err == nil {
+		t.Fatal("accepted unknown dedup field")
+	}
+}
+
+func TestDedupConcurrentIdenticalAlerts(t *testing.T) {
+	var received atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		<-release
+	}))
+	defer srv.Close()
+	nm := dedupManager(t, srv.URL)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			alert := &Alert{Severity: "critical", Title: "API down", Message: "checkout is failing", Source: "monitoring"}
+			if err := nm.Send(context.Background(), alert, []string{"slack"}); err != nil {
+				t.Errorf("Send: %v", err)
+			}
+		}()
+	}
+	// Let every sender reach the dedup check while the first is in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := received.Load(); got != 1 {
+		t.Errorf("sent %d notifications for concurrent identical alerts, want 1", got)
+	}
+}
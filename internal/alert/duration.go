@@ -0,0 +1,38 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// duration is a time.Duration written to JSON as a Go duration string such
+// as "5m". It is read from either that or a number of nanoseconds, so
+// existing configurations keep working.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var ns int64
+	if err := json.Unmarshal(data, &ns); err == nil {
+		*d = duration(ns)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a number of nanoseconds or a string: %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
@@ -0,0 +1,226 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	texttemplate "text/template"
+
+	"api-watchtower/internal/db"
+)
+
+// defaultMaxEmailRecipients is the default cap on recipients per shared
+// email.
+const defaultMaxEmailRecipients = 50
+
+const defaultEmailTemplate = `Alert Details:
+Severity: {{ .Severity }}
+Time: {{ .Timestamp }}
+Source: {{ .Source }}
+
+Message:
+{{ .Message }}
+
+{{ if .Details }}Additional Details:
+{{ .Details }}{{ end }}
+
+View Alert: {{ .AlertURL }}
+`
+
+// undisclosedRecipients is the To header of emails with only Bcc
+// recipients.
+const undisclosedRecipients = "undisclosed-recipients:;"
+
+// Recipient kinds
+const (
+	recipientTo  = "to"
+	recipientCc  = "cc"
+	recipientBcc = "bcc"
+)
+
+type emailRecipient struct {
+	address string
+	kind    string
+}
+
+// emailData is what email body templates are executed with.
+type emailData struct {
+	*Alert
+	// Recipient is the address the email is rendered for; empty for shared
+	// emails
+	Recipient string
+}
+
+func parseEmailTemplate(text string) (*texttemplate.Template, error) {
+	if text == "" {
+		text = defaultEmailTemplate
+	}
+	tmpl, err := texttemplate.New("email").
+		Funcs(templateFuncs()).
+		Option(templateMissingKey).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email body template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// emailRecipients lists the To, Cc and Bcc recipients in that order.
+func (nm *NotificationManager) emailRecipients() []emailRecipient {
+	var recipients []emailRecipient
+	add := func(addresses []string, kind string) {
+		for _, address := range addresses {
+			recipients = append(recipients, emailRecipient{address: address, kind: kind})
+		}
+	}
+	add(nm.config.Defaults.Recipients, recipientTo)
+	add(nm.config.Email.Cc, recipientCc)
+	add(nm.config.Email.Bcc, recipientBcc)
+	return recipients
+}
+
+// sendEmail sends the alert either as one body shared by chunks of at most
+// MaxRecipients recipients, or rendered separately for every recipient.
+func (nm *NotificationManager) sendEmail(ctx context.Context, alert *Alert) error {
+	if nm.emailBodyErr != nil {
+		return nm.emailBodyErr
+	}
+
+	recipients := nm.emailRecipients()
+	if len(recipients) == 0 {
+		return fmt.Errorf("no email recipients configured")
+	}
+
+	var batches [][]emailRecipient
+	if nm.config.Email.PerRecipient {
+		for _, r := range recipients {
+			batches = append(batches, []emailRecipient{r})
+		}
+	} else {
+		for len(recipients) > 0 {
+			n := min(nm.config.Email.MaxRecipients, len(recipients))
+			batches = append(batches, recipients[:n])
+			recipients = recipients[n:]
+		}
+	}
+
+	var errs []error
+	for _, batch := range batches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := nm.sendEmailBatch(alert, batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send %d of %d emails: %v", len(errs), len(batches), errs)
+	}
+	return nil
+}
+
+func (nm *NotificationManager) sendEmailBatch(alert *Alert, batch []emailRecipient) error {
+	data := emailData{Alert: alert}
+	if nm.config.Email.PerRecipient {
+		data.Recipient = batch[0].address
+	}
+
+	msg, err := nm.buildEmail(data, batch)
+	if err != nil {
+		return err
+	}
+
+	envelope := make([]string, len(batch))
+	for i, r := range batch {
+		envelope[i] = r.address
+	}
+
+	auth := smtp.PlainAuth("",
+		nm.config.Email.Username,
+		nm.config.Email.Password,
+		nm.config.Email.Host,
+	)
+
+	return smtp.SendMail(
+		fmt.Sprintf("%s:%d", nm.config.Email.Host, nm.config.Email.Port),
+		auth,
+		envelopeAddress(nm.config.Email.From),
+		envelope,
+		msg,
+	)
+}
+
+// buildEmail renders a complete MIME message for batch. A separately
+// rendered email is addressed to its one recipient; shared emails show the
+// To and Cc recipients in their headers.
+func (nm *NotificationManager) buildEmail(data emailData, batch []emailRecipient) ([]byte, error) {
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	if err := nm.emailBody.Execute(qp, data); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	var to, cc []string
+	if data.Recipient != "" {
+		to = []string{data.Recipient}
+	} else {
+		for _, r := range batch {
+			switch r.kind {
+			case recipientTo:
+				to = append(to, r.address)
+			case recipientCc:
+				cc = append(cc, r.address)
+			}
+		}
+	}
+	if len(to) == 0 {
+		to = []string{undisclosedRecipients}
+	}
+
+	subject := fmt.Sprintf("%s Alert - %s", data.Severity, data.Title)
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+	header("From", nm.config.Email.From)
+	header("To", strings.Join(to, ", "))
+	if len(cc) > 0 {
+		header("Cc", strings.Join(cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", nm.now().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", db.NewID(), messageIDDomain(nm.config.Email.From)))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// envelopeAddress returns the bare address of a From such as
+// "Watchtower <alerts@example.com>".
+func envelopeAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+func messageIDDomain(from string) string {
+	address := envelopeAddress(from)
+	if at := strings.LastIndex(address, "@"); at >= 0 && at < len(address)-1 {
+		return address[at+1:]
+	}
+	return "api-watchtower"
+}
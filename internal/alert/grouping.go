@@ -0,0 +1,218 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GroupingConfig batches alerts that share label values into one
+// notification per group, so a burst of related alerts pages once.
+type GroupingConfig struct {
+	// GroupBy names the labels alerts are grouped on: type, severity,
+	// source, title or a string key of the alert's Details. Grouping is
+	// off when it is empty.
+	GroupBy []string `json:"group_by"`
+	// GroupWait is how long a new group collects alerts before its first
+	// notification. Defaults to DefaultConfig.GroupingDelay, or 30s.
+	GroupWait time.Duration `json:"group_wait"`
+	// GroupInterval is the least time between two notifications of one
+	// group; alerts arriving sooner wait for the next. Defaults to 5m.
+	GroupInterval time.Duration `json:"group_interval"`
+}
+
+// MarshalJSON writes the durations as duration strings.
+func (c GroupingConfig) MarshalJSON() ([]byte, error) {
+	type plain GroupingConfig
+	return json.Marshal(struct {
+		plain
+		GroupWait     duration `json:"group_wait"`
+		GroupInterval duration `json:"group_interval"`
+	}{plain(c), duration(c.GroupWait), duration(c.GroupInterval)})
+}
+
+// UnmarshalJSON accepts the durations as duration strings or nanoseconds.
+func (c *GroupingConfig) UnmarshalJSON(data []byte) error {
+	type plain GroupingConfig
+	aux := struct {
+		*plain
+		GroupWait     duration `json:"group_wait"`
+		GroupInterval duration `json:"group_interval"`
+	}{plain: (*plain)(c), GroupWait: duration(c.GroupWait), GroupInterval: duration(c.GroupInterval)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.GroupWait, c.GroupInterval = time.Duration(aux.GroupWait), time.Duration(aux.GroupInterval)
+	return nil
+}
+
+const (
+	defaultGroupWait     = 30 * time.Second
+	defaultGroupInterval = 5 * time.Minute
+)
+
+// notificationGroup holds the alerts of one label set and channel list
+// waiting for the group's next notification.
+type notificationGroup struct {
+	// labels are the group's "name=value" pairs in GroupBy order
+	labels   []string
+	channels []string
+	pending  []*Alert
+	// timer fires the group's next flush; a flush with nothing pending
+	// retires the group
+	timer *time.Timer
+}
+
+// alertLabel returns the value of label name on alert: one of its type,
+// severity, source or title, or else a string in its Details.
+func alertLabel(alert *Alert, name string) string {
+	switch name {
+	case "type":
+		return alert.Type
+	case "severity":
+		return alert.Severity
+	case "source":
+		return alert.Source
+	case "title":
+		return alert.Title
+	}
+	if details, ok := alert.Details.(map[string]interface{}); ok {
+		if v, ok := details[name].(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// grouping reports whether alerts passed to Send are grouped.
+func (nm *NotificationManager) grouping() bool {
+	return len(nm.config.Grouping.GroupBy) > 0
+}
+
+// addToGroup adds alert to its group, starting the group and its
+// GroupWait timer if it is the first.
+func (nm *NotificationManager) addToGroup(alert *Alert, channels []string) {
+	labels := make([]string, len(nm.config.Grouping.GroupBy))
+	for i, name := range nm.config.Grouping.GroupBy {
+		labels[i] = name + "=" + alertLabel(alert, name)
+	}
+	sorted := append([]string(nil), channels...)
+	sort.Strings(sorted)
+	key := fmt.Sprintf("%q|%q", labels, sorted)
+
+	nm.groupMu.Lock()
+	defer nm.groupMu.Unlock()
+
+	g, exists := nm.groups[key]
+	if !exists {
+		g = &notificationGroup{labels: labels, channels: sorted}
+		g.timer = time.AfterFunc(nm.config.Grouping.GroupWait, func() { nm.flushGroup(key) })
+		nm.groups[key] = g
+	}
+	g.pending = append(g.pending, alert)
+}
+
+// flushGroup sends the alerts pending in group key and schedules its next
+// flush a GroupInterval later. A group with nothing pending is dropped, so
+// its next alert starts a new group with a fresh GroupWait.
+func (nm *NotificationManager) flushGroup(key string) {
+	nm.groupMu.Lock()
+	g, ok := nm.groups[key]
+	if !ok {
+		nm.groupMu.Unlock()
+		return
+	}
+	alerts := g.pending
+	g.pending = nil
+	if len(alerts) == 0 {
+		delete(nm.groups, key)
+		nm.groupMu.Unlock()
+		return
+	}
+	g.timer = time.AfterFunc(nm.config.Grouping.GroupInterval, func() { nm.flushGroup(key) })
+	nm.groupMu.Unlock()
+
+	nm.sendGroup(context.Background(), g, alerts)
+}
+
+// flushGroups stops every group's timer and sends what they hold.
+func (nm *NotificationManager) flushGroups(ctx context.Context) {
+	type flush struct {
+		group  *notificationGroup
+		alerts []*Alert
+	}
+
+	nm.groupMu.Lock()
+	flushes := make([]flush, 0, len(nm.groups))
+	for _, g := range nm.groups {
+		g.timer.Stop()
+		if len(g.pending) > 0 {
+			flushes = append(flushes, flush{g, g.pending})
+		}
+		g.pending = nil
+	}
+	nm.groups = make(map[string]*notificationGroup)
+	nm.groupMu.Unlock()
+
+	for _, f := range flushes {
+		nm.sendGroup(ctx, f.group, f.alerts)
+	}
+}
+
+// sendGroup delivers alerts as one notification to the group's channels.
+func (nm *NotificationManager) sendGroup(ctx context.Context, g *notificationGroup, alerts []*Alert) {
+	alert := alerts[0]
+	if len(alerts) > 1 {
+		nm.mu.RLock()
+		now := nm.clock.Now()
+		nm.mu.RUnlock()
+		alert = combineAlerts(g.labels, alerts, now)
+	}
+	if errs := nm.broadcast(ctx, alert, g.channels); len(errs) > 0 {
+		nm.releaseDedup(alerts...)
+		nm.queueRetries(alert, errs)
+		log.Printf("Failed to send grouped notification for %s: %v", strings.Join(g.labels, ", "), errs)
+		return
+	}
+	nm.markSent(alerts...)
+}
+
+// combineAlerts builds the notification for a group of several alerts. It
+// takes the highest member severity and, having no single alert behind it,
+// no ID; the member IDs are listed in its Details.
+func combineAlerts(labels []string, alerts []*Alert, now time.Time) *Alert {
+	combined := &Alert{
+		Type:      alerts[0].Type,
+		Severity:  alerts[0].Severity,
+		Source:    alerts[0].Source,
+		Title:     fmt.Sprintf("%d alerts for %s", len(alerts), strings.Join(labels, ", ")),
+		Timestamp: now.Format(time.RFC3339),
+		CreatedAt: now,
+	}
+
+	ids := make([]string, 0, len(alerts))
+	lines := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		if severityScores[strings.ToLower(a.Severity)] > severityScores[strings.ToLower(combined.Severity)] {
+			combined.Severity = a.Severity
+		}
+		if a.Type != combined.Type {
+			combined.Type = "grouped"
+		}
+		if a.Source != combined.Source {
+			combined.Source = "multiple"
+		}
+		ids = append(ids, a.ID)
+		lines = append(lines, fmt.Sprintf("- [%s] %s: %s", a.Severity, a.Title, a.Message))
+	}
+	combined.Message = strings.Join(lines, "\n")
+	combined.Details = map[string]interface{}{
+		"group_labels": labels,
+		"alert_ids":    ids,
+	}
+	return combined
+}
@@ -0,0 +1,47 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStopFlushesGroups(t *testing.T) {
+	srv, received, _ := slackServer(t)
+	nm, err := NewNotificationManager(NotificationConfig{
+		Slack:    SlackConfig{WebhookURL: srv.URL},
+		Grouping: GroupingConfig{GroupBy: []string{"type"}, GroupWait: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationManager: %v", err)
+	}
+
+	for i := range 3 {
+		alert := &Alert{ID: fmt.Sprint(i), Type: "monitoring", Severity: "high", Title: fmt.Sprintf("target %d down", i)}
+		if err := nm.Send(context.Background(), alert, []string{"slack"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	// Alerts still arriving while the groups are flushed
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 20 {
+			nm.Send(context.Background(), &Alert{ID: fmt.Sprint("late", i), Type: "late", Severity: "info", Title: "late"}, []string{"slack"})
+		}
+	}()
+	if err := nm.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	wg.Wait()
+
+	// One for the pending group, and one for the late alerts if they were
+	// grouped before the flush
+	if got := received.Load(); got < 1 || got > 2 {
+		t.Errorf("sent %d notifications, want the pending group flushed as one", got)
+	}
+}
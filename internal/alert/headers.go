@@ -0,0 +1,112 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// Header condition operators
+const (
+	headerExists   = "exists"
+	headerEq       = "eq"
+	headerNeq      = "neq"
+	headerGt       = "gt"
+	headerLt       = "lt"
+	headerContains = "contains"
+)
+
+// headerCondition matches one response header. gt and lt compare
+// numerically; eq and neq do so when both sides are numbers. A missing
+// header never matches, whatever the operator.
+type headerCondition struct {
+	Name     string `json:"name"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+func validateHeaderConditions(conds []headerCondition, errs *db.ValidationErrors) {
+	for i, cond := range conds {
+		field := fmt.Sprintf("headers[%d]", i)
+		if cond.Name == "" {
+			errs.Add(field+".name", db.CodeRequired, "name is required")
+		}
+		switch cond.Operator {
+		case headerExists, headerEq, headerNeq, headerContains:
+		case headerGt, headerLt:
+			if _, err := strconv.ParseFloat(cond.Value, 64); err != nil {
+				errs.Add(field+".value", db.CodeInvalid, fmt.Sprintf("%s needs a numeric value", cond.Operator))
+			}
+		case "":
+			errs.Add(field+".operator", db.CodeRequired, "operator is required")
+		default:
+			errs.Add(field+".operator", db.CodeUnsupported, fmt.Sprintf("unknown operator %q", cond.Operator))
+		}
+	}
+}
+
+// matchHeaders reports whether the stored response headers satisfy every
+// condition.
+func matchHeaders(conds []headerCondition, raw json.RawMessage) bool {
+	var headers http.Header
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &headers); err != nil {
+			return false
+		}
+	}
+
+	for _, cond := range conds {
+		value, found := headerValue(headers, cond.Name)
+		if !found || !matchHeader(cond, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerValue looks name up case-insensitively, since stored headers may
+// not be in canonical form.
+func headerValue(headers http.Header, name string) (string, bool) {
+	if values, ok := headers[http.CanonicalHeaderKey(name)]; ok && len(values) > 0 {
+		return values[0], true
+	}
+	for key, values := range headers {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0], true
+		}
+	}
+	return "", false
+}
+
+func matchHeader(cond headerCondition, value string) bool {
+	actual, actualErr := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	expected, expectedErr := strconv.ParseFloat(cond.Value, 64)
+	numeric := actualErr == nil && expectedErr == nil
+
+	switch cond.Operator {
+	case headerExists:
+		return true
+	case headerEq:
+		if numeric {
+			return actual == expected
+		}
+		return value == cond.Value
+	case headerNeq:
+		if numeric {
+			return actual != expected
+		}
+		return value != cond.Value
+	case headerGt:
+		return numeric && actual > expected
+	case headerLt:
+		return numeric && actual < expected
+	case headerContains:
+		return strings.Contains(value, cond.Value)
+	default:
+		return false
+	}
+}
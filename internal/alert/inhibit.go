@@ -0,0 +1,149 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"api-watchtower/internal/db"
+)
+
+// StatusInhibited marks an alert that was created while a matching source
+// alert was active. Inhibited alerts are stored but not notified.
+const StatusInhibited = "inhibited"
+
+// InhibitRule suppresses alerts matching TargetMatch while an unresolved
+// alert matching SourceMatch exists, e.g. "host down" suppressing "service
+// slow" on the same host.
+//
+// Matchers and Equal name alert fields: type, source, source_id, severity,
+// message, or otherwise a top-level string in the alert details.
+type InhibitRule struct {
+	ID          string
+	SourceMatch map[string]string
+	TargetMatch map[string]string
+	// Equal lists fields that must have the same value on both alerts
+	Equal []string
+}
+
+func (m *Manager) AddInhibitRule(rule *InhibitRule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inhibitRules[rule.ID] = rule
+}
+
+func (m *Manager) RemoveInhibitRule(ruleID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.inhibitRules, ruleID)
+}
+
+// findInhibitor returns the ID of an unresolved alert that inhibits alert,
+// or "" if none does.
+func (m *Manager) findInhibitor(ctx context.Context, alert *db.Alert) (string, error) {
+	m.mu.RLock()
+	rules := make([]*InhibitRule, 0, len(m.inhibitRules))
+	for _, rule := range m.inhibitRules {
+		if matchesAll(alert, rule.TargetMatch) {
+			rules = append(rules, rule)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(rules) == 0 {
+		return "", nil
+	}
+
+	active, err := m.storage.GetActiveAlerts(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load active alerts: %v", err)
+	}
+
+	for _, source := range active {
+		if source.ID == alert.ID || source.Status == "resolved" || source.Status == StatusInhibited {
+			continue
+		}
+		for _, rule := range rules {
+			if matchesAll(source, rule.SourceMatch) && equalFields(source, alert, rule.Equal) {
+				return source.ID, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// releaseInhibited re-evaluates the alerts a resolved alert was inhibiting.
+// Alerts no longer inhibited by anything become active and notify, unless
+// they were acknowledged or resolved meanwhile. Only the inhibition is
+// written, so changes made to the alerts since they were loaded stay.
+func (m *Manager) releaseInhibited(ctx context.Context, resolvedID string) error {
+	inhibited, err := m.storage.GetInhibitedAlerts(ctx, resolvedID)
+	if err != nil {
+		return fmt.Errorf("failed to load inhibited alerts: %v", err)
+	}
+
+	for _, alert := range inhibited {
+		inhibitor, err := m.findInhibitor(ctx, alert)
+		if err != nil {
+			return err
+		}
+
+		update := &db.Alert{ID: alert.ID, InhibitedBy: inhibitor, UpdatedAt: m.now()}
+		released := inhibitor == "" && alert.Status == StatusInhibited
+		if released {
+			update.Status = "active"
+		}
+		if err := m.storage.UpdateInhibition(ctx, update); err != nil {
+			return fmt.Errorf("failed to update alert %s: %v", alert.ID, err)
+		}
+
+		if released {
+			alert.Status, alert.InhibitedBy, alert.UpdatedAt = update.Status, "", update.UpdatedAt
+			if err := m.dispatch(ctx, alert); err != nil {
+				log.Printf("Failed to notify released alert %s: %v", alert.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func matchesAll(alert *db.Alert, match map[string]string) bool {
+	for field, value := range match {
+		if alertField(alert, field) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func equalFields(a, b *db.Alert, fields []string) bool {
+	for _, field := range fields {
+		if alertField(a, field) != alertField(b, field) {
+			return false
+		}
+	}
+	return true
+}
+
+func alertField(alert *db.Alert, field string) string {
+	switch field {
+	case "type":
+		return alert.Type
+	case "source":
+		return alert.Source
+	case "source_id":
+		return alert.SourceID
+	case "severity":
+		return alert.Severity
+	case "message":
+		return alert.Message
+	}
+
+	var details map[string]interface{}
+	if err := json.Unmarshal(alert.Details, &details); err != nil {
+		return ""
+	}
+	value, _ := details[field].(string)
+	return value
+}
@@ -0,0 +1,124 @@
+package alert
+
+import (
+	"context"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+// inhibitManager returns a manager where a host_down alert inhibits
+// service_slow alerts from the same source.
+func inhibitManager(t *testing.T) (*Manager, *memStorage, *recordingNotifier) {
+	t.Helper()
+	m, storage, notifier, _ := newTestManager(t)
+	m.AddInhibitRule(&InhibitRule{
+		ID:          "host-down",
+		SourceMatch: map[string]string{"type": "host_down"},
+		TargetMatch: map[string]string{"type": "service_slow"},
+		Equal:       []string{"source"},
+	})
+	return m, storage, notifier
+}
+
+func raiseAlert(t *testing.T, m *Manager, typ, source string) *db.Alert {
+	t.Helper()
+	alert := &db.Alert{ID: db.NewID(), Type: typ, Source: source, Severity: "warning", Message: typ, Status: "active"}
+	if _, err := m.raise(context.Background(), alert, false); err != nil {
+		t.Fatalf("raise %s: %v", typ, err)
+	}
+	return alert
+}
+
+func storedAlert(t *testing.T, storage *memStorage, id string) *db.Alert {
+	t.Helper()
+	alert, _ := storage.GetAlert(context.Background(), id)
+	if alert == nil {
+		t.Fatalf("alert %s not stored", id)
+	}
+	return alert
+}
+
+func TestInhibitAndRelease(t *testing.T) {
+	m, storage, notifier := inhibitManager(t)
+
+	host := raiseAlert(t, m, "host_down", "h1")
+	slow := raiseAlert(t, m, "service_slow", "h1")
+	raiseAlert(t, m, "service_slow", "h2")
+
+	if got := storedAlert(t, storage, slow.ID); got.Status != StatusInhibited || got.InhibitedBy != host.ID {
+		t.Fatalf("slow service on the down host is %s, inhibited by %q; want inhibited by %s", got.Status, got.InhibitedBy, host.ID)
+	}
+	if got := notifier.count(); got != 2 {
+		t.Fatalf("sent %d notifications, want the down host's and the other host's", got)
+	}
+
+	// Changed by someone else while inhibited
+	storage.mu.Lock()
+	storage.alerts[slow.ID].Message = "edited meanwhile"
+	storage.mu.Unlock()
+
+	if err := m.ResolveAlert(context.Background(), host.ID, "oncall"); err != nil {
+		t.Fatalf("ResolveAlert: %v", err)
+	}
+	got := storedAlert(t, storage, slow.ID)
+	if got.Status != "active" || got.InhibitedBy != "" {
+		t.Errorf("released alert is %s, inhibited by %q; want active and not inhibited", got.Status, got.InhibitedBy)
+	}
+	if got.Message != "edited meanwhile" {
+		t.Errorf("releasing rewrote the alert's message to %q", got.Message)
+	}
+	if got := notifier.count(); got != 3 {
+		t.Errorf("sent %d notifications after the release, want 3", got)
+	}
+}
+
+func TestReleaseMovesToRemainingInhibitor(t *testing.T) {
+	m, storage, notifier := inhibitManager(t)
+
+	first := raiseAlert(t, m, "host_down", "h1")
+	second := raiseAlert(t, m, "host_down", "h1")
+	slow := raiseAlert(t, m, "service_slow", "h1")
+
+	inhibitor := storedAlert(t, storage, slow.ID).InhibitedBy
+	remaining := first.ID
+	if inhibitor == first.ID {
+		remaining = second.ID
+	}
+	if err := m.ResolveAlert(context.Background(), inhibitor, "oncall"); err != nil {
+		t.Fatalf("ResolveAlert: %v", err)
+	}
+	if got := storedAlert(t, storage, slow.ID); got.Status != StatusInhibited || got.InhibitedBy != remaining {
+		t.Errorf("alert is %s, inhibited by %q; want still inhibited by %s", got.Status, got.InhibitedBy, remaining)
+	}
+	if got := notifier.count(); got != 2 {
+		t.Errorf("sent %d notifications, want only the two down hosts'", got)
+	}
+
+	if err := m.ResolveAlert(context.Background(), remaining, "oncall"); err != nil {
+		t.Fatalf("ResolveAlert: %v", err)
+	}
+	if got := storedAlert(t, storage, slow.ID); got.Status != "active" {
+		t.Errorf("alert is %s after its last inhibitor resolved, want active", got.Status)
+	}
+}
+
+func TestReleaseLeavesResolvedAlert(t *testing.T) {
+	m, storage, notifier := inhibitManager(t)
+
+	host := raiseAlert(t, m, "host_down", "h1")
+	slow := raiseAlert(t, m, "service_slow", "h1")
+	if err := m.ResolveAlert(context.Background(), slow.ID, "oncall"); err != nil {
+		t.Fatalf("ResolveAlert: %v", err)
+	}
+
+	if err := m.ResolveAlert(context.Background(), host.ID, "oncall"); err != nil {
+		t.Fatalf("ResolveAlert: %v", err)
+	}
+	if got := storedAlert(t, storage, slow.ID); got.Status != "resolved" {
+		t.Errorf("alert resolved while inhibited is %s after the release, want resolved", got.Status)
+	}
+	if got := notifier.count(); got != 1 {
+		t.Errorf("sent %d notifications, want only the down host's", got)
+	}
+}
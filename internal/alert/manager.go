@@ -1,27 +1,70 @@
 package alert
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"api-watchtower/internal/clock"
 	"api-watchtower/internal/db"
 )
 
 type Manager struct {
-	storage    Storage
-	notifiers  []Notifier
-	rules      map[string]*Rule
-	mu         sync.RWMutex
+	storage   Storage
+	notifiers map[string]Notifier
+	rules     map[string]*Rule
+	clock     clock.Clock
+	mu        sync.RWMutex
+
+	inhibitRules map[string]*InhibitRule
+
+	// correlation, when set, rolls notifications for alerts in critical
+	// groups up into one notification per group
+	correlation   *CorrelationEngine
+	groupCooldown time.Duration
+
+	// storm, when set, caps the alerts created per minute
+	storm *stormGuard
+
+	// cooldowns maps alerts of rules that reset their cooldown on
+	// resolution to the cooldown each started
+	cooldowns map[string]cooldownEntry
+
+	// alertmanagerMu serializes Alertmanager webhooks, so concurrent
+	// deliveries of one alert can't both find it inactive and create it
+	alertmanagerMu sync.Mutex
 }
 
+// DefaultGroupNotifyCooldown is the minimum time between notifications for
+// the same correlation group.
+const DefaultGroupNotifyCooldown = 15 * time.Minute
+
 type Storage interface {
 	SaveAlert(ctx context.Context, alert *db.Alert) error
 	UpdateAlert(ctx context.Context, alert *db.Alert) error
+	// UpdateAlerts applies several updates in one transaction: either all
+	// of them are stored or none is
+	UpdateAlerts(ctx context.Context, alerts []*db.Alert) error
 	GetActiveAlerts(ctx context.Context) ([]*db.Alert, error)
+	// GetAlert returns nil when no alert has the given ID
+	GetAlert(ctx context.Context, id string) (*db.Alert, error)
+	SaveComment(ctx context.Context, comment *db.AlertComment) error
+	GetComments(ctx context.Context, alertID string) ([]*db.AlertComment, error)
+	CountComments(ctx context.Context, alertIDs []string) (map[string]int, error)
+	// GetInhibitedAlerts returns the alerts currently inhibited by the given
+	// alert
+	GetInhibitedAlerts(ctx context.Context, inhibitedBy string) ([]*db.Alert, error)
+	// UpdateInhibition stores alert's InhibitedBy, even when empty, its
+	// UpdatedAt, and its Status when set, leaving every other field alone
+	UpdateInhibition(ctx context.Context, alert *db.Alert) error
 }
 
 type Notifier interface {
@@ -29,34 +72,241 @@ type Notifier interface {
 }
 
 type Rule struct {
-	ID          string
-	Type        string
-	Source      string
-	Conditions  json.RawMessage
-	Severity    string
-	Message     string
-	Cooldown    time.Duration
-	LastTriggered map[string]time.Time
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	Conditions json.RawMessage `json:"conditions"`
+	Severity   string          `json:"severity"`
+	Message    string          `json:"message"`
+	Cooldown   time.Duration   `json:"cooldown"`
+	// Channels names the notifiers the rule's alerts are sent to, e.g. a
+	// quiet channel for a low-priority rule. Empty sends to all of them.
+	Channels []string `json:"channels,omitempty"`
+	// ResetCooldownOnResolve ends the cooldown for a source when the alert
+	// that started it is resolved, so a recurrence of a just-fixed problem
+	// alerts immediately instead of waiting the cooldown out
+	ResetCooldownOnResolve bool `json:"reset_cooldown_on_resolve,omitempty"`
+	// NotifyUnsaved sends the rule's alerts even when they can't be saved,
+	// so a rule about the storage itself can still page while it is down
+	NotifyUnsaved bool `json:"notify_unsaved,omitempty"`
+	// LastTriggered is when the rule last fired, per source; it is kept
+	// across UpdateRule
+	LastTriggered map[string]time.Time `json:"-"`
+}
+
+// MarshalJSON writes Cooldown as a duration string.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type plain Rule
+	return json.Marshal(struct {
+		plain
+		Cooldown duration `json:"cooldown"`
+	}{plain(r), duration(r.Cooldown)})
 }
 
-func NewManager(storage Storage, notifiers []Notifier) *Manager {
+// UnmarshalJSON accepts Cooldown as a duration string or nanoseconds.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	aux := struct {
+		*plain
+		Cooldown duration `json:"cooldown"`
+	}{plain: (*plain)(r), Cooldown: duration(r.Cooldown)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Cooldown = time.Duration(aux.Cooldown)
+	return nil
+}
+
+// Rule mutation errors
+var (
+	ErrRuleExists   = errors.New("rule already exists")
+	ErrRuleNotFound = errors.New("rule not found")
+)
+
+// ErrAlertNotFound is returned for comments on an unknown alert.
+var ErrAlertNotFound = errors.New("alert not found")
+
+// NewManager returns a manager that notifies through notifiers, keyed by
+// the channel names rules select them with.
+func NewManager(storage Storage, notifiers map[string]Notifier) *Manager {
 	return &Manager{
 		storage:   storage,
 		notifiers: notifiers,
-		rules:    make(map[string]*Rule),
+		rules:     make(map[string]*Rule),
+		clock:     clock.Real{},
+
+		inhibitRules: make(map[string]*InhibitRule),
+		cooldowns:    make(map[string]cooldownEntry),
+	}
+}
+
+// SetClock replaces the time source used for cooldowns and timestamps.
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
+// SetCorrelation feeds new alerts through engine. Alerts that join a
+// critical group no longer notify on their own; the group notifies instead,
+// at most once per cooldown (DefaultGroupNotifyCooldown if zero).
+func (m *Manager) SetCorrelation(engine *CorrelationEngine, cooldown time.Duration) {
+	if cooldown <= 0 {
+		cooldown = DefaultGroupNotifyCooldown
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.correlation = engine
+	m.groupCooldown = cooldown
+}
+
+// AddRule registers rule, replacing any rule with the same ID. Rules that
+// fail ValidateRule or name unknown channels are rejected.
+func (m *Manager) AddRule(rule *Rule) error {
+	if err := m.validateRule(rule); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rule.LastTriggered == nil {
+		rule.LastTriggered = make(map[string]time.Time)
 	}
+	m.rules[rule.ID] = rule
+	return nil
 }
 
-func (m *Manager) AddRule(rule *Rule) {
+// CreateRule registers a new rule, failing with ErrRuleExists if its ID is
+// taken. Rules that fail ValidateRule or name unknown channels are
+// rejected.
+func (m *Manager) CreateRule(rule *Rule) error {
+	if err := m.validateRule(rule); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if _, exists := m.rules[rule.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrRuleExists, rule.ID)
+	}
+	rule.LastTriggered = make(map[string]time.Time)
 	m.rules[rule.ID] = rule
+	return nil
 }
 
-func (m *Manager) RemoveRule(ruleID string) {
+// UpdateRule replaces an existing rule, failing with ErrRuleNotFound if
+// there is none with its ID. The rule is validated before it is applied,
+// and keeps the old rule's cooldown state so an update doesn't re-fire
+// alerts that are still cooling down.
+func (m *Manager) UpdateRule(rule *Rule) error {
+	if err := m.validateRule(rule); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	old, exists := m.rules[rule.ID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, rule.ID)
+	}
+	rule.LastTriggered = old.LastTriggered
+	m.rules[rule.ID] = rule
+	return nil
+}
+
+// GetRule returns a copy of a rule, without its cooldown state.
+func (m *Manager) GetRule(ruleID string) (*Rule, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rule, exists := m.rules[ruleID]
+	if !exists {
+		return nil, false
+	}
+	copied := *rule
+	copied.LastTriggered = nil
+	return &copied, true
+}
+
+// ListRules returns copies of the rules, ordered by ID, without their
+// cooldown state.
+func (m *Manager) ListRules() []*Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rules := make([]*Rule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		copied := *rule
+		copied.LastTriggered = nil
+		rules = append(rules, &copied)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// ValidateRule checks a rule's ID, type, cooldown and conditions, returning
+// db.ValidationErrors listing every problem found.
+func ValidateRule(rule *Rule) error {
+	var errs db.ValidationErrors
+	if rule.ID == "" {
+		errs.Add("id", db.CodeRequired, "id is required")
+	}
+	if rule.Cooldown < 0 {
+		errs.Add("cooldown", db.CodeInvalid, "cooldown must not be negative")
+	}
+
+	switch rule.Type {
+	case "monitoring":
+		_, err := parseMonitoringConditions(rule.Conditions)
+		errs.Merge("conditions", err)
+	case "ai_analysis":
+		_, err := parseAIConditions(rule.Conditions)
+		errs.Merge("conditions", err)
+	case "":
+		errs.Add("type", db.CodeRequired, "type is required")
+	default:
+		errs.Add("type", db.CodeUnsupported, fmt.Sprintf("unsupported rule type %q", rule.Type))
+	}
+	return errs.Err()
+}
+
+// validateRule runs ValidateRule and checks that the rule's channels are
+// among the manager's notifiers.
+func (m *Manager) validateRule(rule *Rule) error {
+	var errs db.ValidationErrors
+	errs.Merge("", ValidateRule(rule))
+	for i, channel := range rule.Channels {
+		if _, ok := m.notifiers[channel]; !ok {
+			errs.Add(fmt.Sprintf("channels[%d]", i), db.CodeUnsupported, fmt.Sprintf("unknown channel %q; use one of %s", channel, strings.Join(m.channelNames(), ", ")))
+		}
+	}
+	return errs.Err()
+}
+
+// channelNames returns the notifiers' names in order.
+func (m *Manager) channelNames() []string {
+	names := make([]string, 0, len(m.notifiers))
+	for name := range m.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RemoveRule deletes a rule, failing with ErrRuleNotFound if there is none
+// with the ID.
+func (m *Manager) RemoveRule(ruleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.rules[ruleID]; !exists {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, ruleID)
+	}
 	delete(m.rules, ruleID)
+	for alertID, entry := range m.cooldowns {
+		if entry.ruleID == ruleID {
+			delete(m.cooldowns, alertID)
+		}
+	}
+	return nil
 }
 
 func (m *Manager) ProcessMonitoringResult(ctx context.Context, result *db.MonitoringResult) error {
@@ -69,18 +319,27 @@ func (m *Manager) ProcessMonitoringResult(ctx context.Context, result *db.Monito
 	}
 	m.mu.RUnlock()
 
+	// Every matching rule gets its chance even when one fails, so a
+	// NotifyUnsaved rule still pages while storage is down
+	var errs []error
 	for _, rule := range rules {
 		if m.shouldTriggerAlert(rule, result) {
 			if err := m.createAlert(ctx, rule, result); err != nil {
-				return err
+				errs = append(errs, err)
 			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (m *Manager) ProcessAIAnalysis(ctx context.Context, analysis *db.AIAnalysis) error {
+	// A recovery ends a condition rather than raising one, so it never goes
+	// through the rules; a catch-all rule would alert on it otherwise
+	if analysis.Type == analysisTypeRecovered {
+		return m.resolveRecovered(ctx, analysis)
+	}
+
 	m.mu.RLock()
 	rules := make([]*Rule, 0)
 	for _, rule := range m.rules {
@@ -90,51 +349,199 @@ func (m *Manager) ProcessAIAnalysis(ctx context.Context, analysis *db.AIAnalysis
 	}
 	m.mu.RUnlock()
 
+	var errs []error
 	for _, rule := range rules {
 		if m.shouldTriggerAlert(rule, analysis) {
 			if err := m.createAlert(ctx, rule, analysis); err != nil {
-				return err
+				errs = append(errs, err)
 			}
 		}
 	}
 
+	return errors.Join(errs...)
+}
+
+// resolveRecovered resolves the alerts raised from the analysis a recovered
+// analysis ends.
+func (m *Manager) resolveRecovered(ctx context.Context, recovery *db.AIAnalysis) error {
+	var details struct {
+		AnalysisID string `json:"analysis_id"`
+	}
+	if err := json.Unmarshal(recovery.Details, &details); err != nil || details.AnalysisID == "" {
+		return nil
+	}
+
+	active, err := m.storage.GetActiveAlerts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load active alerts: %v", err)
+	}
+	for _, alert := range active {
+		if alert.SourceID != details.AnalysisID || alert.Status == "resolved" {
+			continue
+		}
+		if err := m.ResolveAlert(ctx, alert.ID, recoveredBy); err != nil {
+			return fmt.Errorf("failed to resolve alert %s: %v", alert.ID, err)
+		}
+	}
 	return nil
 }
 
 func (m *Manager) shouldTriggerAlert(rule *Rule, event interface{}) bool {
-	// Check cooldown period
 	sourceID := getSourceID(event)
 	if sourceID == "" {
 		return false
 	}
 
+	var matched bool
+	switch e := event.(type) {
+	case *db.MonitoringResult:
+		matched = m.evaluateMonitoringConditions(rule.Conditions, e)
+	case *db.AIAnalysis:
+		matched = m.evaluateAIConditions(rule.Conditions, e)
+	}
+	if !matched {
+		return false
+	}
+
+	// Check cooldown period; only a match starts it, so events that don't
+	// match, such as a target's successful checks, can't hold off an alert
 	m.mu.Lock()
+	defer m.mu.Unlock()
 	lastTriggered, exists := rule.LastTriggered[sourceID]
-	if exists && time.Since(lastTriggered) < rule.Cooldown {
-		m.mu.Unlock()
+	if exists && m.clock.Since(lastTriggered) < rule.Cooldown {
 		return false
 	}
-	rule.LastTriggered[sourceID] = time.Now()
-	m.mu.Unlock()
+	rule.LastTriggered[sourceID] = m.clock.Now()
+	return true
+}
 
-	switch e := event.(type) {
-	case *db.MonitoringResult:
-		return m.evaluateMonitoringConditions(rule.Conditions, e)
-	case *db.AIAnalysis:
-		return m.evaluateAIConditions(rule.Conditions, e)
-	default:
-		return false
+type monitoringConditions struct {
+	StatusCodes []int   `json:"status_codes"`
+	MinLatency  float64 `json:"min_latency"`
+	ErrorMatch  string  `json:"error_match"`
+	// ResultSeverities matches results whose worst failed assertion has
+	// one of these severities
+	ResultSeverities []string `json:"result_severities"`
+	// Headers must all match the result's response headers
+	Headers []headerCondition `json:"headers"`
+	// BurnRate matches on the target's SLO error budget burn rates
+	BurnRate *burnRateCondition `json:"burn_rate"`
+	// BodyChanged matches results whose response body hash changed
+	BodyChanged bool `json:"body_changed"`
+}
+
+type aiConditions struct {
+	Types      []string `json:"types"`
+	Severities []string `json:"severities"`
+
+	// Pattern conditions only match error_pattern analyses. Pattern is a
+	// substring and PatternRegex a regex of the clustered pattern; MinRate
+	// is in occurrences per minute.
+	Pattern      string  `json:"pattern"`
+	PatternRegex string  `json:"pattern_regex"`
+	MinCount     int     `json:"min_count"`
+	MinRate      float64 `json:"min_rate"`
+
+	patternRegex *regexp.Regexp
+}
+
+// analysisTypeErrorPattern is the analyzer's recurring error pattern type.
+const analysisTypeErrorPattern = "error_pattern"
+
+// analysisTypeRecovered is the analyzer's type for an anomaly whose series
+// returned to normal; recoveredBy is who resolves the anomaly's alerts.
+const (
+	analysisTypeRecovered = "recovered"
+	recoveredBy           = "ai_analysis"
+)
+
+// patternStats is the part of an error_pattern analysis's details that
+// pattern conditions look at.
+type patternStats struct {
+	Pattern       string  `json:"pattern"`
+	Count         int     `json:"count"`
+	RatePerMinute float64 `json:"rate_per_minute"`
+}
+
+func (c *aiConditions) matchesPattern() bool {
+	return c.Pattern != "" || c.PatternRegex != "" || c.MinCount > 0 || c.MinRate > 0
+}
+
+// decodeConditions strictly decodes raw into cond, so misspelt keys are
+// reported rather than silently ignored.
+func decodeConditions(raw json.RawMessage, cond interface{}) error {
+	if len(raw) == 0 {
+		return &db.ValidationError{Code: db.CodeRequired, Message: "conditions are required"}
 	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cond); err != nil {
+		return &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid conditions: %v", err)}
+	}
+	return nil
 }
 
-func (m *Manager) evaluateMonitoringConditions(conditions json.RawMessage, result *db.MonitoringResult) bool {
-	var cond struct {
-		StatusCodes []int  `json:"status_codes"`
-		MinLatency  float64 `json:"min_latency"`
-		ErrorMatch  string  `json:"error_match"`
+func parseMonitoringConditions(raw json.RawMessage) (*monitoringConditions, error) {
+	var cond monitoringConditions
+	if err := decodeConditions(raw, &cond); err != nil {
+		return nil, err
+	}
+
+	var errs db.ValidationErrors
+	for i, code := range cond.StatusCodes {
+		if code < 100 || code > 599 {
+			errs.Add(fmt.Sprintf("status_codes[%d]", i), db.CodeInvalid, fmt.Sprintf("%d is not a status code", code))
+		}
+	}
+	if cond.MinLatency < 0 {
+		errs.Add("min_latency", db.CodeInvalid, "min_latency must not be negative")
+	}
+	for i, severity := range cond.ResultSeverities {
+		if db.ResultSeverityRank(severity) == 0 {
+			errs.Add(fmt.Sprintf("result_severities[%d]", i), db.CodeUnsupported, fmt.Sprintf("unknown result severity %q", severity))
+		}
+	}
+	validateHeaderConditions(cond.Headers, &errs)
+	if cond.BurnRate != nil {
+		validateBurnRateCondition(cond.BurnRate, &errs)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
+
+func parseAIConditions(raw json.RawMessage) (*aiConditions, error) {
+	var cond aiConditions
+	if err := decodeConditions(raw, &cond); err != nil {
+		return nil, err
 	}
 
-	if err := json.Unmarshal(conditions, &cond); err != nil {
+	var errs db.ValidationErrors
+	if cond.PatternRegex != "" {
+		re, err := regexp.Compile(cond.PatternRegex)
+		if err != nil {
+			errs.Add("pattern_regex", db.CodeInvalid, fmt.Sprintf("invalid regex: %v", err))
+		}
+		cond.patternRegex = re
+	}
+	if cond.MinCount < 0 {
+		errs.Add("min_count", db.CodeInvalid, "min_count must not be negative")
+	}
+	if cond.MinRate < 0 {
+		errs.Add("min_rate", db.CodeInvalid, "min_rate must not be negative")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
+
+func (m *Manager) evaluateMonitoringConditions(conditions json.RawMessage, result *db.MonitoringResult) bool {
+	// AddRule rejects conditions that don't parse, so this only fails for
+	// rules that bypassed it
+	cond, err := parseMonitoringConditions(conditions)
+	if err != nil {
 		return false
 	}
 
@@ -162,16 +569,41 @@ func (m *Manager) evaluateMonitoringConditions(conditions json.RawMessage, resul
 		return false
 	}
 
+	// Check result severity
+	if len(cond.ResultSeverities) > 0 {
+		severityMatch := false
+		for _, s := range cond.ResultSeverities {
+			if result.ResultSeverity == s {
+				severityMatch = true
+				break
+			}
+		}
+		if !severityMatch {
+			return false
+		}
+	}
+
+	// Check response headers
+	if len(cond.Headers) > 0 && !matchHeaders(cond.Headers, result.ResponseHeaders) {
+		return false
+	}
+
+	// Check SLO burn rates
+	if cond.BurnRate != nil && !cond.BurnRate.matches(result.BurnRates) {
+		return false
+	}
+
+	// Check content changes
+	if cond.BodyChanged && !result.BodyChanged {
+		return false
+	}
+
 	return true
 }
 
 func (m *Manager) evaluateAIConditions(conditions json.RawMessage, analysis *db.AIAnalysis) bool {
-	var cond struct {
-		Types      []string `json:"types"`
-		Severities []string `json:"severities"`
-	}
-
-	if err := json.Unmarshal(conditions, &cond); err != nil {
+	cond, err := parseAIConditions(conditions)
+	if err != nil {
 		return false
 	}
 
@@ -203,55 +635,352 @@ func (m *Manager) evaluateAIConditions(conditions json.RawMessage, analysis *db.
 		}
 	}
 
+	if cond.matchesPattern() && !matchPattern(cond, analysis) {
+		return false
+	}
+
 	return true
 }
 
+// matchPattern applies the pattern conditions to an error_pattern analysis.
+func matchPattern(cond *aiConditions, analysis *db.AIAnalysis) bool {
+	if analysis.Type != analysisTypeErrorPattern {
+		return false
+	}
+
+	var stats patternStats
+	if err := json.Unmarshal(analysis.Details, &stats); err != nil {
+		return false
+	}
+	if cond.Pattern != "" && !strings.Contains(stats.Pattern, cond.Pattern) {
+		return false
+	}
+	if cond.patternRegex != nil && !cond.patternRegex.MatchString(stats.Pattern) {
+		return false
+	}
+	return stats.Count >= cond.MinCount && stats.RatePerMinute >= cond.MinRate
+}
+
 func (m *Manager) createAlert(ctx context.Context, rule *Rule, event interface{}) error {
+	now := m.now()
 	alert := &db.Alert{
+		ID:        db.NewID(),
 		Type:      rule.Type,
 		Source:    rule.Source,
 		SourceID:  getSourceID(event),
 		Severity:  rule.Severity,
 		Message:   rule.Message,
 		Status:    "active",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Channels:  append([]string(nil), rule.Channels...),
 	}
 
 	// Add event-specific details
-	details, err := json.Marshal(event)
+	details, err := alertDetails(event)
 	if err == nil {
 		alert.Details = details
 	}
 
+	created, err := m.raise(ctx, alert, rule.NotifyUnsaved)
+	if created {
+		m.trackCooldown(rule, alert)
+	}
+	return err
+}
+
+// raise saves a new alert and notifies about it, unless the storm cap
+// suppresses it, in which case it reports false. With notifyUnsaved, an
+// alert that can't be saved is still notified about, directly.
+func (m *Manager) raise(ctx context.Context, alert *db.Alert, notifyUnsaved bool) (bool, error) {
+	admitted, err := m.admitAlert(ctx, alert)
+	if !admitted {
+		return false, err
+	}
+
+	// Alerts suppressed by an active higher-level alert are kept but not
+	// notified
+	inhibitor, err := m.findInhibitor(ctx, alert)
+	if err != nil {
+		if !notifyUnsaved {
+			return false, err
+		}
+		log.Printf("Failed to check inhibition for alert %s: %v", alert.ID, err)
+	}
+	if inhibitor != "" {
+		alert.Status = StatusInhibited
+		alert.InhibitedBy = inhibitor
+	}
+
 	// Save alert
 	if err := m.storage.SaveAlert(ctx, alert); err != nil {
-		return fmt.Errorf("failed to save alert: %v", err)
+		if notifyUnsaved && inhibitor == "" {
+			m.notify(ctx, alert)
+		}
+		return false, fmt.Errorf("failed to save alert: %v", err)
+	}
+	alertsCreated.WithLabelValues(severityLabel(alert.Severity)).Inc()
+
+	if inhibitor != "" {
+		return true, nil
+	}
+	return true, m.dispatch(ctx, alert)
+}
+
+// dispatch notifies about a saved alert, directly or through its
+// correlation group.
+func (m *Manager) dispatch(ctx context.Context, alert *db.Alert) error {
+	m.mu.RLock()
+	correlation, cooldown := m.correlation, m.groupCooldown
+	m.mu.RUnlock()
+
+	if correlation == nil {
+		m.notify(ctx, alert)
+		return nil
+	}
+
+	groups, err := correlation.ProcessAlert(correlationAlert(alert))
+	if err != nil {
+		return fmt.Errorf("failed to correlate alert: %v", err)
+	}
+
+	grouped := false
+	for _, group := range groups {
+		summary, due, critical := correlation.claimGroupNotification(group.ID, cooldown)
+		if !critical {
+			continue
+		}
+		grouped = true
+		if due {
+			m.notify(ctx, summary)
+		}
+	}
+	if !grouped {
+		m.notify(ctx, alert)
+	}
+
+	return nil
+}
+
+// notify sends alert to the notifiers of its channels, or to all of them
+// when it names none, as for correlation summaries and storm alerts.
+func (m *Manager) notify(ctx context.Context, alert *db.Alert) {
+	if len(alert.Channels) == 0 {
+		for _, notifier := range m.notifiers {
+			if err := notifier.Send(ctx, alert); err != nil {
+				// Log error but continue with other notifiers
+				log.Printf("Failed to send notification for alert %s: %v", alert.ID, err)
+			}
+		}
+		return
 	}
 
-	// Send notifications
-	for _, notifier := range m.notifiers {
+	for _, channel := range alert.Channels {
+		notifier, ok := m.notifiers[channel]
+		if !ok {
+			log.Printf("Failed to send notification for alert %s: unknown channel %q", alert.ID, channel)
+			continue
+		}
 		if err := notifier.Send(ctx, alert); err != nil {
 			// Log error but continue with other notifiers
-			fmt.Printf("Failed to send notification: %v\n", err)
+			log.Printf("Failed to send notification for alert %s: %v", alert.ID, err)
 		}
 	}
+}
 
-	return nil
+// correlationAlert converts a stored alert into the form the correlation
+// engine matches on.
+func correlationAlert(alert *db.Alert) *Alert {
+	var details map[string]interface{}
+	json.Unmarshal(alert.Details, &details)
+
+	return &Alert{
+		ID:        alert.ID,
+		Type:      alert.Type,
+		Severity:  alert.Severity,
+		Title:     alert.Message,
+		Source:    alert.Source,
+		Message:   alert.Message,
+		Details:   details,
+		CreatedAt: alert.CreatedAt,
+	}
 }
 
 func (m *Manager) ResolveAlert(ctx context.Context, alertID, resolvedBy string) error {
+	now := m.now()
 	alert := &db.Alert{
 		ID:         alertID,
 		Status:     "resolved",
-		ResolvedAt: func() *time.Time { t := time.Now(); return &t }(),
+		ResolvedAt: &now,
 		ResolvedBy: resolvedBy,
-		UpdatedAt:  time.Now(),
+		UpdatedAt:  now,
+	}
+
+	if err := m.storage.UpdateAlert(ctx, alert); err != nil {
+		return err
+	}
+	alertsResolved.Inc()
+	m.resetCooldown(alertID)
+	return m.releaseInhibited(ctx, alertID)
+}
+
+// AcknowledgeAlert marks an alert as being worked on without resolving it.
+func (m *Manager) AcknowledgeAlert(ctx context.Context, alertID, acknowledgedBy string) error {
+	now := m.now()
+	alert := &db.Alert{
+		ID:        alertID,
+		Status:    "acknowledged",
+		AckedAt:   &now,
+		AckedBy:   acknowledgedBy,
+		UpdatedAt: now,
 	}
 
 	return m.storage.UpdateAlert(ctx, alert)
 }
 
+func (m *Manager) now() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.clock.Now()
+}
+
+// GetActiveAlerts returns all active alerts with their comment counts.
+func (m *Manager) GetActiveAlerts(ctx context.Context) ([]*db.Alert, error) {
+	alerts, err := m.storage.GetActiveAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(alerts))
+	for i, alert := range alerts {
+		ids[i] = alert.ID
+	}
+	counts, err := m.storage.CountComments(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count comments: %v", err)
+	}
+	for _, alert := range alerts {
+		alert.CommentCount = counts[alert.ID]
+	}
+
+	return alerts, nil
+}
+
+// AddComment records a triage note on an alert. Comments can't be edited or
+// removed once added.
+func (m *Manager) AddComment(ctx context.Context, alertID, author, text string) (*db.AlertComment, error) {
+	var errs db.ValidationErrors
+	if strings.TrimSpace(author) == "" {
+		errs.Add("author", db.CodeRequired, "author is required")
+	}
+	if strings.TrimSpace(text) == "" {
+		errs.Add("text", db.CodeRequired, "text is required")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.requireAlert(ctx, alertID); err != nil {
+		return nil, err
+	}
+
+	comment := &db.AlertComment{
+		ID:        db.NewID(),
+		AlertID:   alertID,
+		Author:    author,
+		Text:      text,
+		CreatedAt: m.now(),
+	}
+	if err := m.storage.SaveComment(ctx, comment); err != nil {
+		return nil, fmt.Errorf("failed to save comment: %v", err)
+	}
+
+	return comment, nil
+}
+
+// GetComments returns the comments on an alert, oldest first.
+func (m *Manager) GetComments(ctx context.Context, alertID string) ([]*db.AlertComment, error) {
+	if err := m.requireAlert(ctx, alertID); err != nil {
+		return nil, err
+	}
+	return m.storage.GetComments(ctx, alertID)
+}
+
+// requireAlert fails with ErrAlertNotFound unless alertID is stored.
+func (m *Manager) requireAlert(ctx context.Context, alertID string) error {
+	alert, err := m.storage.GetAlert(ctx, alertID)
+	if err != nil {
+		return err
+	}
+	if alert == nil {
+		return fmt.Errorf("%w: %s", ErrAlertNotFound, alertID)
+	}
+	return nil
+}
+
+// alertDetails serializes the triggering event. For monitoring results the
+// failed assertions are lifted to the top level so responders see what
+// broke without digging through the rule results.
+func alertDetails(event interface{}) (json.RawMessage, error) {
+	if analysis, ok := event.(*db.AIAnalysis); ok && analysis.Type == analysisTypeErrorPattern {
+		return patternAlertDetails(analysis)
+	}
+
+	result, ok := event.(*db.MonitoringResult)
+	if !ok || len(result.RuleResults) == 0 {
+		return json.Marshal(event)
+	}
+
+	var ruleResults []struct {
+		Type    string `json:"type"`
+		Path    string `json:"path,omitempty"`
+		Passed  bool   `json:"passed"`
+		Message string `json:"message,omitempty"`
+	}
+	if err := json.Unmarshal(result.RuleResults, &ruleResults); err != nil {
+		return json.Marshal(event)
+	}
+
+	failed := make([]string, 0)
+	for _, rr := range ruleResults {
+		if !rr.Passed {
+			failed = append(failed, rr.Message)
+		}
+	}
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var details map[string]interface{}
+	if err := json.Unmarshal(encoded, &details); err != nil {
+		return nil, err
+	}
+	details["failed_assertions"] = failed
+
+	return json.Marshal(details)
+}
+
+// patternAlertDetails lifts an error pattern's text, count and rate to the
+// top level of the alert details.
+func patternAlertDetails(analysis *db.AIAnalysis) (json.RawMessage, error) {
+	encoded, err := json.Marshal(analysis)
+	if err != nil {
+		return nil, err
+	}
+	var details map[string]interface{}
+	if err := json.Unmarshal(encoded, &details); err != nil {
+		return nil, err
+	}
+
+	var stats patternStats
+	if err := json.Unmarshal(analysis.Details, &stats); err == nil {
+		details["pattern"] = stats.Pattern
+		details["count"] = stats.Count
+		details["rate_per_minute"] = stats.RatePerMinute
+	}
+	return json.Marshal(details)
+}
+
 func getSourceID(event interface{}) string {
 	switch e := event.(type) {
 	case *db.MonitoringResult:
@@ -0,0 +1,350 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/clock"
+	"api-watchtower/internal/db"
+)
+
+// memStorage is an in-memory Storage.
+type memStorage struct {
+	mu     sync.Mutex
+	alerts map[string]*db.Alert
+	// saveErr fails SaveAlert while set
+	saveErr error
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{alerts: make(map[string]*db.Alert)}
+}
+
+func (s *memStorage) SaveAlert(ctx context.Context, alert *db.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	copied := *alert
+	s.alerts[alert.ID] = &copied
+	return nil
+}
+
+// UpdateAlert applies the status change carried by alert, as the manager
+// only sends the fields it changes.
+func (s *memStorage) UpdateAlert(ctx context.Context, alert *db.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.alerts[alert.ID]
+	if !ok {
+		return nil
+	}
+	if alert.Status != "" {
+		stored.Status = alert.Status
+	}
+	if alert.ResolvedAt != nil {
+		stored.ResolvedAt, stored.ResolvedBy = alert.ResolvedAt, alert.ResolvedBy
+	}
+	stored.UpdatedAt = alert.UpdatedAt
+	return nil
+}
+
+func (s *memStorage) UpdateAlerts(ctx context.Context, alerts []*db.Alert) error {
+	for _, alert := range alerts {
+		s.UpdateAlert(ctx, alert)
+	}
+	return nil
+}
+
+func (s *memStorage) GetActiveAlerts(ctx context.Context) ([]*db.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var active []*db.Alert
+	for _, alert := range s.alerts {
+		if alert.Status != "resolved" {
+			copied := *alert
+			active = append(active, &copied)
+		}
+	}
+	return active, nil
+}
+
+func (s *memStorage) GetAlert(ctx context.Context, id string) (*db.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alert, ok := s.alerts[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *alert
+	return &copied, nil
+}
+
+func (s *memStorage) SaveComment(ctx context.Context, comment *db.AlertComment) error { return nil }
+
+func (s *memStorage) GetComments(ctx context.Context, alertID string) ([]*db.AlertComment, error) {
+	return nil, nil
+}
+
+func (s *memStorage) CountComments(ctx context.Context, alertIDs []string) (map[string]int, error) {
+	return nil, nil
+}
+
+func (s *memStorage) GetInhibitedAlerts(ctx context.Context, inhibitedBy string) ([]*db.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var inhibited []*db.Alert
+	for _, alert := range s.alerts {
+		if alert.InhibitedBy == inhibitedBy {
+			copied := *alert
+			inhibited = append(inhibited, &copied)
+		}
+	}
+	return inhibited, nil
+}
+
+func (s *memStorage) UpdateInhibition(ctx context.Context, alert *db.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.alerts[alert.ID]
+	if !ok {
+		return nil
+	}
+	stored.InhibitedBy = alert.InhibitedBy
+	if alert.Status != "" {
+		stored.Status = alert.Status
+	}
+	stored.UpdatedAt = alert.UpdatedAt
+	return nil
+}
+
+func (s *memStorage) active() []*db.Alert {
+	active, _ := s.GetActiveAlerts(context.Background())
+	return active
+}
+
+// recordingNotifier records the alerts sent to it.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []*db.Alert
+}
+
+func (n *recordingNotifier) Send(ctx context.Context, alert *db.Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, alert)
+	return nil
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.sent)
+}
+
+func newTestManager(t *testing.T) (*Manager, *memStorage, *recordingNotifier, *clock.Fake) {
+	t.Helper()
+	storage := newMemStorage()
+	notifier := &recordingNotifier{}
+	m := NewManager(storage, map[string]Notifier{"test": notifier})
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	m.SetClock(clk)
+	return m, storage, notifier, clk
+}
+
+func addRule(t *testing.T, m *Manager, rule *Rule) {
+	t.Helper()
+	if err := m.AddRule(rule); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+}
+
+func TestRecoveredAnalysisResolvesWithoutAlerting(t *testing.T) {
+	m, storage, notifier, _ := newTestManager(t)
+	// A catch-all rule matching every analysis
+	addRule(t, m, &Rule{
+		ID:         "all-analyses",
+		Type:       "ai_analysis",
+		Conditions: json.RawMessage(`{}`),
+		Severity:   "high",
+		Message:    "Analysis detected",
+		Cooldown:   time.Minute,
+	})
+
+	anomaly := &db.AIAnalysis{ID: db.NewID(), Type: "error_rate_anomaly", Severity: "high", Status: "active"}
+	if err := m.ProcessAIAnalysis(context.Background(), anomaly); err != nil {
+		t.Fatalf("ProcessAIAnalysis: %v", err)
+	}
+	if len(storage.active()) != 1 {
+		t.Fatalf("got %d active alerts for the anomaly, want 1", len(storage.active()))
+	}
+
+	details, _ := json.Marshal(map[string]string{"analysis_id": anomaly.ID})
+	recovered := &db.AIAnalysis{ID: db.NewID(), Type: analysisTypeRecovered, Severity: "info", Status: "resolved", Details: details}
+	if err := m.ProcessAIAnalysis(context.Background(), recovered); err != nil {
+		t.Fatalf("ProcessAIAnalysis: %v", err)
+	}
+
+	if active := storage.active(); len(active) != 0 {
+		t.Errorf("got %d active alerts after recovery, want 0: %+v", len(active), active[0])
+	}
+	if got := notifier.count(); got != 1 {
+		t.Errorf("sent %d notifications, want only the anomaly's", got)
+	}
+}
+
+func TestNotifyUnsavedWhenStorageIsDown(t *testing.T) {
+	m, storage, notifier, _ := newTestManager(t)
+	addRule(t, m, &Rule{
+		ID:            "storage-down",
+		Type:          "monitoring",
+		Conditions:    json.RawMessage(`{}`),
+		Severity:      "critical",
+		Message:       "Storage is down",
+		NotifyUnsaved: true,
+	})
+	addRule(t, m, &Rule{
+		ID:         "other",
+		Type:       "monitoring",
+		Conditions: json.RawMessage(`{}`),
+		Severity:   "high",
+		Message:    "Check failed",
+	})
+	storage.saveErr = errors.New("connection refused")
+
+	result := &db.MonitoringResult{ID: db.NewID(), TargetID: "self:storage", Success: false}
+	if err := m.ProcessMonitoringResult(context.Background(), result); err == nil {
+		t.Fatal("ProcessMonitoringResult succeeded with storage down")
+	}
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if len(notifier.sent) != 1 || notifier.sent[0].Message != "Storage is down" {
+		t.Fatalf("sent %+v, want only the storage-down alert", notifier.sent)
+	}
+}
+
+func TestResolveResetsCooldown(t *testing.T) {
+	m, storage, notifier, clk := newTestManager(t)
+	addRule(t, m, &Rule{
+		ID:                     "down",
+		Type:                   "monitoring",
+		Conditions:             json.RawMessage(`{}`),
+		Severity:               "critical",
+		Message:                "Target down",
+		Cooldown:               time.Hour,
+		ResetCooldownOnResolve: true,
+	})
+	fail := func() {
+		t.Helper()
+		result := &db.MonitoringResult{ID: db.NewID(), TargetID: "checkout", Success: false}
+		if err := m.ProcessMonitoringResult(context.Background(), result); err != nil {
+			t.Fatalf("ProcessMonitoringResult: %v", err)
+		}
+		clk.Advance(time.Minute)
+	}
+
+	fail()
+	fail()
+	active := storage.active()
+	if len(active) != 1 || notifier.count() != 1 {
+		t.Fatalf("got %d alerts and %d notifications within the cooldown, want 1", len(active), notifier.count())
+	}
+
+	if err := m.ResolveAlert(context.Background(), active[0].ID, "oncall"); err != nil {
+		t.Fatalf("ResolveAlert: %v", err)
+	}
+	fail()
+	if got := notifier.count(); got != 2 {
+		t.Errorf("sent %d notifications, want the recurrence after resolving to alert", got)
+	}
+}
+
+func TestExpiredCooldownsArePruned(t *testing.T) {
+	m, _, _, clk := newTestManager(t)
+	addRule(t, m, &Rule{
+		ID:                     "down",
+		Type:                   "monitoring",
+		Conditions:             json.RawMessage(`{}`),
+		Severity:               "critical",
+		Message:                "Target down",
+		Cooldown:               time.Minute,
+		ResetCooldownOnResolve: true,
+	})
+
+	// Alerts that are never resolved, for ever-new targets
+	for i := range 50 {
+		result := &db.MonitoringResult{ID: db.NewID(), TargetID: fmt.Sprintf("target-%d", i), Success: false}
+		if err := m.ProcessMonitoringResult(context.Background(), result); err != nil {
+			t.Fatalf("ProcessMonitoringResult: %v", err)
+		}
+		clk.Advance(10 * time.Second)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// Only the alerts of the last minute can still have their cooldown reset
+	if got := len(m.cooldowns); got > 7 {
+		t.Errorf("tracking %d cooldowns, want at most the last minute's", got)
+	}
+}
+
+func TestCommentErrors(t *testing.T) {
+	m, storage, _, _ := newTestManager(t)
+	storage.alerts["a1"] = &db.Alert{ID: "a1", Status: "active"}
+
+	if _, err := m.AddComment(context.Background(), "missing", "oncall", "looking"); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("comment on an unknown alert got %v, want ErrAlertNotFound", err)
+	}
+	if _, err := m.GetComments(context.Background(), "missing"); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("comments of an unknown alert got %v, want ErrAlertNotFound", err)
+	}
+
+	var errs db.ValidationErrors
+	if _, err := m.AddComment(context.Background(), "a1", " ", ""); !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("blank comment got %v, want a validation error per field", err)
+	}
+	if _, err := m.AddComment(context.Background(), "a1", "oncall", "looking"); err != nil {
+		t.Errorf("AddComment: %v", err)
+	}
+}
+
+func TestRuleDurationsAcceptStrings(t *testing.T) {
+	for _, cooldown := range []string{`"5m"`, `300000000000`} {
+		var rule Rule
+		if err := json.Unmarshal([]byte(`{"id":"r","severity":"high","cooldown":`+cooldown+`}`), &rule); err != nil {
+			t.Fatalf("cooldown %s: %v", cooldown, err)
+		}
+		if rule.ID != "r" || rule.Severity != "high" || rule.Cooldown != 5*time.Minute {
+			t.Errorf("cooldown %s decoded as %+v", cooldown, rule)
+		}
+	}
+
+	var corr CorrelationRule
+	if err := json.Unmarshal([]byte(`{"id":"c","min_count":3,"time_window":"10m"}`), &corr); err != nil {
+		t.Fatalf("time_window: %v", err)
+	}
+	if corr.ID != "c" || corr.MinCount != 3 || corr.TimeWindow != 10*time.Minute {
+		t.Errorf("correlation rule decoded as %+v", corr)
+	}
+
+	encoded, _ := json.Marshal(&Rule{ID: "r", Cooldown: 5 * time.Minute})
+	if !strings.Contains(string(encoded), `"cooldown":"5m0s"`) {
+		t.Errorf("rule encoded as %s, want a duration string", encoded)
+	}
+	encoded, _ = json.Marshal(corr)
+	if !strings.Contains(string(encoded), `"time_window":"10m0s"`) {
+		t.Errorf("correlation rule encoded as %s, want a duration string", encoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"cooldown":"soon"}`), &Rule{}); err == nil {
+		t.Error("accepted an invalid cooldown")
+	}
+}
@@ -0,0 +1,131 @@
+package alert
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Pipeline counters. Labels are limited to channel and severity, folded
+// onto a fixed set of values, so a noisy source can't blow up cardinality.
+var (
+	alertsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_alerts_created_total",
+		Help: "Alerts created by rules, by severity.",
+	}, []string{"severity"})
+	alertsResolved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "watchtower_alerts_resolved_total",
+		Help: "Alerts resolved.",
+	})
+	alertsSuppressed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "watchtower_alerts_storm_suppressed_total",
+		Help: "Alerts dropped by the global alert storm cap.",
+	})
+	notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_notifications_sent_total",
+		Help: "Notifications delivered, by channel.",
+	}, []string{"channel"})
+	notificationsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_notifications_failed_total",
+		Help: "Notifications that failed, were fast-failed by a circuit breaker or couldn't get a send slot, by channel.",
+	}, []string{"channel"})
+	notificationsRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_notifications_rate_limited_total",
+		Help: "Alerts dropped by the notification rate limit, by severity.",
+	}, []string{"severity"})
+	notificationsDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_notifications_deduplicated_total",
+		Help: "Alerts suppressed as duplicates of a recently sent one, by severity.",
+	}, []string{"severity"})
+	notificationsRetryQueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_notifications_retry_queued_total",
+		Help: "Failed deliveries added to the persistent retry queue, by channel.",
+	}, []string{"channel"})
+	notificationsDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watchtower_notifications_dead_lettered_total",
+		Help: "Queued deliveries given up on after their max age or dropped by a full retry queue, by channel.",
+	}, []string{"channel"})
+)
+
+var (
+	activeGroupsDesc = prometheus.NewDesc(
+		"watchtower_correlation_active_groups",
+		"Correlation groups that aren't resolved.",
+		nil, nil,
+	)
+	breakerStateDesc = prometheus.NewDesc(
+		"watchtower_notification_breaker_state",
+		"Circuit breaker state per channel; 1 for the current state, 0 otherwise. Channels folded onto other count the channels in each state.",
+		[]string{"channel", "state"}, nil,
+	)
+)
+
+var breakerStates = []string{BreakerClosed, BreakerOpen, BreakerHalfOpen}
+
+// channelLabel folds unknown channel names onto "other".
+func channelLabel(channel string) string {
+	switch channel {
+	case "email", "slack", "webhook":
+		return channel
+	default:
+		return "other"
+	}
+}
+
+// severityLabel folds unknown severities onto "other".
+func severityLabel(severity string) string {
+	switch severity {
+	case "critical", "high", "error", "warning", "medium", "low", "info":
+		return severity
+	default:
+		return "other"
+	}
+}
+
+// PipelineCollector reports the gauges of the alerting pipeline: active
+// correlation groups and each channel's circuit breaker state. Either
+// source may be nil.
+type PipelineCollector struct {
+	notifications *NotificationManager
+	correlation   *CorrelationEngine
+}
+
+// NewPipelineCollector creates a collector reading from notifications and
+// correlation.
+func NewPipelineCollector(notifications *NotificationManager, correlation *CorrelationEngine) *PipelineCollector {
+	return &PipelineCollector{
+		notifications: notifications,
+		correlation:   correlation,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (pc *PipelineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeGroupsDesc
+	ch <- breakerStateDesc
+}
+
+// Collect implements prometheus.Collector.
+func (pc *PipelineCollector) Collect(ch chan<- prometheus.Metric) {
+	if pc.correlation != nil {
+		groups := len(pc.correlation.GetActiveGroups())
+		ch <- prometheus.MustNewConstMetric(activeGroupsDesc, prometheus.GaugeValue, float64(groups))
+	}
+
+	if pc.notifications != nil {
+		// Sum per label first, since several channels can fold onto other
+		// and a series may only be sent once
+		states := make(map[string]map[string]float64)
+		for channel, breaker := range pc.notifications.Stats().Breakers {
+			label := channelLabel(channel)
+			if states[label] == nil {
+				states[label] = make(map[string]float64, len(breakerStates))
+			}
+			states[label][breaker.State]++
+		}
+		for label, counts := range states {
+			for _, state := range breakerStates {
+				ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue, counts[state], label, state)
+			}
+		}
+	}
+}
@@ -4,39 +4,103 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"math"
 	"net/http"
-	"net/smtp"
+	"strings"
 	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
 	"time"
+
+	"api-watchtower/internal/clock"
+	"api-watchtower/internal/db"
 )
 
 // NotificationManager handles the delivery of alerts through various channels
 type NotificationManager struct {
-	config     NotificationConfig
-	templates  map[string]*template.Template
-	rateLimit  map[string]*RateLimiter
-	mu         sync.RWMutex
+	config    NotificationConfig
+	templates map[string]*template.Template
+	rateLimit map[string]*RateLimiter
+	breakers  map[string]*circuitBreaker
+	clock     clock.Clock
+	mu        sync.RWMutex
+
+	// sendSlots bounds concurrent deliveries across all alerts; nil means
+	// unlimited
+	sendSlots       chan struct{}
+	enqueueFailures atomic.Uint64
+	// tierDeliveries counts SendWithFallback deliveries by the tier that
+	// succeeded
+	tierDeliveries map[int]uint64
+
+	// emailBody renders email bodies; emailBodyErr is set instead when the
+	// configured template doesn't parse
+	emailBody    *texttemplate.Template
+	emailBodyErr error
+
+	// recent maps the content hash of recently sent alerts to when they
+	// were last seen
+	recent map[string]time.Time
+	// sending holds the content hash of alerts being sent, so a concurrent
+	// identical alert is deduplicated against them too
+	sending    map[string]struct{}
+	lastSweep  time.Time
+	suppressed atomic.Uint64
+
+	// retries holds failed deliveries while the retry queue runs; nil
+	// otherwise
+	retries *retryQueue
+
+	// groups holds the alerts waiting for their group's notification, by
+	// label values and channels
+	groups  map[string]*notificationGroup
+	groupMu sync.Mutex
+}
+
+// NotificationStats reports counters maintained by the NotificationManager.
+type NotificationStats struct {
+	EnqueueFailures uint64
+	// Breakers holds each used channel's circuit breaker state
+	Breakers map[string]BreakerState
+	// TierDeliveries counts fallback deliveries by the tier that succeeded;
+	// anything beyond tier 0 means a primary channel failed
+	TierDeliveries map[int]uint64
+	// Deduplicated counts alerts suppressed as duplicates of one sent
+	// within DefaultConfig.DedupWindow
+	Deduplicated uint64
+	// RetryQueued is how many failed deliveries wait in the retry queue
+	RetryQueued int
 }
 
+// ErrEnqueueTimeout is returned for a delivery that couldn't get a send slot
+// within DefaultConfig.EnqueueTimeout.
+var ErrEnqueueTimeout = errors.New("timed out waiting for a notification send slot")
+
 // Alert represents the structure of an alert to be sent via notifications
 type Alert struct {
+	ID        string
+	Type      string
 	Severity  string
 	Title     string
 	Timestamp string
 	Source    string
 	Message   string
-	Details   string
+	Details   interface{}
 	AlertURL  string
+	CreatedAt time.Time
 }
 
 type NotificationConfig struct {
-	Email    EmailConfig    `json:"email"`
-	Slack    SlackConfig    `json:"slack"`
-	Webhook  WebhookConfig  `json:"webhook"`
-	Defaults DefaultConfig  `json:"defaults"`
+	Email    EmailConfig   `json:"email"`
+	Slack    SlackConfig   `json:"slack"`
+	Webhook  WebhookConfig `json:"webhook"`
+	Defaults DefaultConfig `json:"defaults"`
+
+	RetryQueue RetryQueueConfig `json:"retry_queue"`
+	Grouping   GroupingConfig   `json:"grouping"`
 }
 
 type EmailConfig struct {
@@ -45,6 +109,21 @@ type EmailConfig struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	From     string `json:"from"`
+	// Cc and Bcc are copied on every email alongside the To recipients in
+	// DefaultConfig.Recipients. Bcc addresses never appear in headers.
+	Cc  []string `json:"cc"`
+	Bcc []string `json:"bcc"`
+	// PerRecipient renders and sends a separate email to each recipient,
+	// so the body can use {{ .Recipient }}. By default one body goes to
+	// everyone.
+	PerRecipient bool `json:"per_recipient"`
+	// MaxRecipients caps the recipients of a single shared email; larger
+	// lists are split across several. Defaults to 50.
+	MaxRecipients int `json:"max_recipients"`
+	// BodyTemplate replaces the default plain-text body. It is a
+	// text/template executed with the alert's fields and Recipient, with
+	// the helpers listed at templateFuncs.
+	BodyTemplate string `json:"body_template"`
 }
 
 type SlackConfig struct {
@@ -57,52 +136,126 @@ type WebhookConfig struct {
 }
 
 type DefaultConfig struct {
-	MinInterval    time.Duration `json:"min_interval"`
+	// MinInterval is the sustained time between notifications for one
+	// source and severity. Zero disables rate limiting.
+	MinInterval   time.Duration `json:"min_interval"`
 	GroupingDelay time.Duration `json:"grouping_delay"`
 	Recipients    []string      `json:"recipients"`
+	// MaxConcurrentSends caps deliveries in flight across all alerts and
+	// channels. Zero means unlimited.
+	MaxConcurrentSends int `json:"max_concurrent_sends"`
+	// EnqueueTimeout is how long a delivery waits for a free slot before it
+	// is recorded as failed to enqueue. Defaults to 30s.
+	EnqueueTimeout time.Duration `json:"enqueue_timeout"`
+	// BreakerThreshold is how many consecutive failures open a channel's
+	// circuit breaker. Defaults to 5.
+	BreakerThreshold int `json:"breaker_threshold"`
+	// BreakerCooldown is how long an open breaker fast-fails sends before
+	// probing the channel again. Defaults to 30s.
+	BreakerCooldown time.Duration `json:"breaker_cooldown"`
+	// SeverityLimits overrides MinInterval and the burst per alert
+	// severity, matched case-insensitively. Each severity of a source is
+	// limited separately, so noisy low-severity alerts can't crowd out a
+	// critical one.
+	SeverityLimits map[string]SeverityLimit `json:"severity_limits"`
+	// DedupWindow suppresses an alert whose DedupFields match one seen
+	// within the window, whatever its source. Zero disables it.
+	DedupWindow time.Duration `json:"dedup_window"`
+	// DedupFields are the alert fields hashed for deduplication: type,
+	// severity, title, source or message; NewNotificationManager rejects
+	// any other. Defaults to severity, title and message.
+	DedupFields []string `json:"dedup_fields"`
+}
+
+// SeverityLimit is the rate limit for one alert severity.
+type SeverityLimit struct {
+	// MinInterval is the sustained time between notifications; zero
+	// disables rate limiting for the severity
+	MinInterval time.Duration `json:"min_interval"`
+	// Burst is how many notifications may go out back to back. Defaults
+	// to 3.
+	Burst int `json:"burst"`
 }
 
+// defaultRateBurst is the burst of severities without a SeverityLimit.
+const defaultRateBurst = 3
+
 // RateLimiter implements a token bucket algorithm
 type RateLimiter struct {
 	tokens     float64
 	rate       float64
 	burst      float64
 	lastUpdate time.Time
+	clock      clock.Clock
 	mu         sync.Mutex
 }
 
-func NewNotificationManager(config NotificationConfig) *NotificationManager {
+// NewNotificationManager validates config and returns a manager sending
+// through its channels.
+func NewNotificationManager(config NotificationConfig) (*NotificationManager, error) {
+	var errs db.ValidationErrors
+	validateDedupFields(config.Defaults.DedupFields, &errs)
+	config.Defaults.SeverityLimits = normalizeSeverityLimits(config.Defaults.SeverityLimits, &errs)
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
 	nm := &NotificationManager{
 		config:    config,
 		templates: make(map[string]*template.Template),
 		rateLimit: make(map[string]*RateLimiter),
+		breakers:  make(map[string]*circuitBreaker),
+		clock:     clock.Real{},
+
+		tierDeliveries: make(map[int]uint64),
+		recent:         make(map[string]time.Time),
+		sending:        make(map[string]struct{}),
+		groups:         make(map[string]*notificationGroup),
+	}
+	if config.Defaults.MaxConcurrentSends > 0 {
+		nm.sendSlots = make(chan struct{}, config.Defaults.MaxConcurrentSends)
+	}
+	if nm.config.Defaults.EnqueueTimeout <= 0 {
+		nm.config.Defaults.EnqueueTimeout = 30 * time.Second
+	}
+	if nm.config.Defaults.BreakerThreshold <= 0 {
+		nm.config.Defaults.BreakerThreshold = 5
+	}
+	if nm.config.Defaults.BreakerCooldown <= 0 {
+		nm.config.Defaults.BreakerCooldown = 30 * time.Second
+	}
+	if len(nm.config.Defaults.DedupFields) == 0 {
+		nm.config.Defaults.DedupFields = defaultDedupFields
+	}
+	if nm.config.Grouping.GroupWait <= 0 {
+		nm.config.Grouping.GroupWait = nm.config.Defaults.GroupingDelay
+		if nm.config.Grouping.GroupWait <= 0 {
+			nm.config.Grouping.GroupWait = defaultGroupWait
+		}
+	}
+	if nm.config.Grouping.GroupInterval <= 0 {
+		nm.config.Grouping.GroupInterval = defaultGroupInterval
+	}
+	if nm.config.Email.MaxRecipients <= 0 {
+		nm.config.Email.MaxRecipients = defaultMaxEmailRecipients
 	}
 
 	// Initialize templates
 	nm.loadTemplates()
 
-	return nm
+	return nm, nil
 }
 
-func (nm *NotificationManager) loadTemplates() {
-	// Email template
-	emailTmpl := `
-Subject: {{ .Severity }} Alert - {{ .Title }}
-
-Alert Details:
-Severity: {{ .Severity }}
-Time: {{ .Timestamp }}
-Source: {{ .Source }}
-
-Message:
-{{ .Message }}
-
-{{ if .Details }}Additional Details:
-{{ .Details }}{{ end }}
+// SetClock replaces the time source used by the rate limiters and circuit
+// breakers. It only affects those created afterwards.
+func (nm *NotificationManager) SetClock(c clock.Clock) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.clock = c
+}
 
-View Alert: {{ .AlertURL }}
-	`
-	nm.templates["email"] = template.Must(template.New("email").Parse(emailTmpl))
+func (nm *NotificationManager) loadTemplates() {
+	nm.emailBody, nm.emailBodyErr = parseEmailTemplate(nm.config.Email.BodyTemplate)
 
 	// Slack template
 	slackTmpl := `{
@@ -133,17 +286,110 @@ View Alert: {{ .AlertURL }}
 					"type": "mrkdwn",
 					"text": "{{ .Message }}"
 				}
-			}
+			}{{ if .ID }},
+			{
+				"type": "actions",
+				"elements": [
+					{
+						"type": "button",
+						"action_id": "acknowledge_alert",
+						"text": {"type": "plain_text", "text": "Acknowledge"},
+						"value": "{{ .ID }}"
+					},
+					{
+						"type": "button",
+						"action_id": "resolve_alert",
+						"style": "primary",
+						"text": {"type": "plain_text", "text": "Resolve"},
+						"value": "{{ .ID }}"
+					}
+				]
+			}{{ end }}
 		]
 	}`
-	nm.templates["slack"] = template.Must(template.New("slack").Parse(slackTmpl))
+	nm.templates["slack"] = template.Must(template.New("slack").
+		Funcs(templateFuncs()).
+		Option(templateMissingKey).
+		Parse(slackTmpl))
 }
 
+// Send delivers alert to every channel in parallel. With grouping
+// configured it instead adds alert to its group and returns nil; the
+// group's notification goes out after GroupWait and skips rate limiting,
+// which GroupInterval takes the place of.
 func (nm *NotificationManager) Send(ctx context.Context, alert *Alert, channels []string) error {
+	if nm.isDuplicate(alert) {
+		return nil
+	}
+	if nm.grouping() {
+		nm.addToGroup(alert, channels)
+		return nil
+	}
 	if !nm.shouldSend(alert) {
+		nm.releaseDedup(alert)
+		notificationsRateLimited.WithLabelValues(severityLabel(alert.Severity)).Inc()
 		return nil
 	}
 
+	if errs := nm.broadcast(ctx, alert, channels); len(errs) > 0 {
+		nm.releaseDedup(alert)
+		nm.queueRetries(alert, errs)
+		return fmt.Errorf("notification errors: %v", errs)
+	}
+	nm.markSent(alert)
+	return nil
+}
+
+// SendWithFallback tries each tier of channels in order, moving on to the
+// next only when a delivery in the current tier fails. Channels within a
+// tier are sent to in parallel. It returns the index of the tier that fully
+// succeeded, or -1 when every tier failed or the alert was deduplicated or
+// rate limited. When every tier fails, the first tier's failed deliveries
+// go to the retry queue.
+func (nm *NotificationManager) SendWithFallback(ctx context.Context, alert *Alert, tiers [][]string) (int, error) {
+	if nm.isDuplicate(alert) {
+		return -1, nil
+	}
+	if !nm.shouldSend(alert) {
+		nm.releaseDedup(alert)
+		notificationsRateLimited.WithLabelValues(severityLabel(alert.Severity)).Inc()
+		return -1, nil
+	}
+
+	var failures []error
+	var primary []error
+	for i, channels := range tiers {
+		errs := nm.broadcast(ctx, alert, channels)
+		if len(errs) == 0 {
+			nm.mu.Lock()
+			nm.tierDeliveries[i]++
+			nm.mu.Unlock()
+			nm.markSent(alert)
+			return i, nil
+		}
+		if i == 0 {
+			primary = errs
+		}
+		failures = append(failures, fmt.Errorf("tier %d: %v", i, errs))
+	}
+	nm.releaseDedup(alert)
+	nm.queueRetries(alert, primary)
+	return -1, fmt.Errorf("notification errors: %v", failures)
+}
+
+// deliveryError is a failed delivery to one channel.
+type deliveryError struct {
+	channel string
+	err     error
+}
+
+func (e *deliveryError) Error() string { return e.err.Error() }
+
+func (e *deliveryError) Unwrap() error { return e.err }
+
+// broadcast delivers alert to channels in parallel and returns a
+// *deliveryError for each that failed.
+func (nm *NotificationManager) broadcast(ctx context.Context, alert *Alert, channels []string) []error {
 	var wg sync.WaitGroup
 	errors := make(chan error, len(channels))
 
@@ -151,8 +397,8 @@ func (nm *NotificationManager) Send(ctx context.Context, alert *Alert, channels
 		wg.Add(1)
 		go func(ch string) {
 			defer wg.Done()
-			if err := nm.sendToChannel(ctx, alert, ch); err != nil {
-				errors <- fmt.Errorf("failed to send to %s: %v", ch, err)
+			if err := nm.deliverWithRetries(ctx, alert, ch); err != nil {
+				errors <- &deliveryError{channel: ch, err: err}
 			}
 		}(channel)
 	}
@@ -166,32 +412,177 @@ func (nm *NotificationManager) Send(ctx context.Context, alert *Alert, channels
 	for err := range errors {
 		errs = append(errs, err)
 	}
+	return errs
+}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("notification errors: %v", errs)
+// Stats returns a snapshot of the notification counters.
+func (nm *NotificationManager) Stats() NotificationStats {
+	nm.mu.RLock()
+	breakers := make(map[string]BreakerState, len(nm.breakers))
+	for ch, b := range nm.breakers {
+		breakers[ch] = b.snapshot()
 	}
-	return nil
+	tiers := make(map[int]uint64, len(nm.tierDeliveries))
+	for tier, n := range nm.tierDeliveries {
+		tiers[tier] = n
+	}
+	retries := nm.retries
+	nm.mu.RUnlock()
+
+	return NotificationStats{
+		EnqueueFailures: nm.enqueueFailures.Load(),
+		Breakers:        breakers,
+		TierDeliveries:  tiers,
+		Deduplicated:    nm.suppressed.Load(),
+		RetryQueued:     retries.len(),
+	}
+}
+
+// breaker returns the circuit breaker for a channel, creating it on first
+// use.
+func (nm *NotificationManager) breaker(channel string) *circuitBreaker {
+	nm.mu.RLock()
+	b, exists := nm.breakers[channel]
+	nm.mu.RUnlock()
+	if exists {
+		return b
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if b, exists = nm.breakers[channel]; !exists {
+		b = newCircuitBreaker(nm.config.Defaults.BreakerThreshold, nm.config.Defaults.BreakerCooldown, nm.clock)
+		nm.breakers[channel] = b
+	}
+	return b
+}
+
+// acquireSlot waits for a global send slot, giving up after the configured
+// enqueue timeout.
+func (nm *NotificationManager) acquireSlot(ctx context.Context) error {
+	if nm.sendSlots == nil {
+		return nil
+	}
+
+	select {
+	case nm.sendSlots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(nm.config.Defaults.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case nm.sendSlots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrEnqueueTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (nm *NotificationManager) releaseSlot() {
+	if nm.sendSlots != nil {
+		<-nm.sendSlots
+	}
+}
+
+// normalizeSeverityLimits returns limits keyed by lower-case severity,
+// rejecting severities that are only told apart by case.
+func normalizeSeverityLimits(limits map[string]SeverityLimit, errs *db.ValidationErrors) map[string]SeverityLimit {
+	if limits == nil {
+		return nil
+	}
+	normalized := make(map[string]SeverityLimit, len(limits))
+	for severity, limit := range limits {
+		key := strings.ToLower(severity)
+		if _, dup := normalized[key]; dup {
+			errs.Add("defaults.severity_limits", db.CodeInvalid, fmt.Sprintf("severity %q is configured more than once", key))
+			continue
+		}
+		normalized[key] = limit
+	}
+	return normalized
 }
 
+// shouldSend applies the rate limit for the alert's source and severity,
+// whatever the severity's case.
 func (nm *NotificationManager) shouldSend(alert *Alert) bool {
+	key := alert.Source + "/" + strings.ToLower(alert.Severity)
 	nm.mu.RLock()
-	limiter, exists := nm.rateLimit[alert.Source]
+	limiter, exists := nm.rateLimit[key]
 	nm.mu.RUnlock()
 
 	if !exists {
 		nm.mu.Lock()
-		limiter = &RateLimiter{
-			rate:       1.0 / nm.config.Defaults.MinInterval.Seconds(),
-			burst:      3.0,
-			lastUpdate: time.Now(),
+		if limiter, exists = nm.rateLimit[key]; !exists {
+			limiter = nm.newRateLimiter(alert.Severity)
+			nm.rateLimit[key] = limiter
 		}
-		nm.rateLimit[alert.Source] = limiter
 		nm.mu.Unlock()
 	}
 
+	if limiter == nil {
+		return true
+	}
 	return limiter.Allow()
 }
 
+// newRateLimiter returns a full token bucket for severity, or nil when the
+// severity isn't rate limited. Must be called with nm.mu held.
+func (nm *NotificationManager) newRateLimiter(severity string) *RateLimiter {
+	interval := nm.config.Defaults.MinInterval
+	burst := defaultRateBurst
+	if limit, ok := nm.config.Defaults.SeverityLimits[strings.ToLower(severity)]; ok {
+		interval = limit.MinInterval
+		if limit.Burst > 0 {
+			burst = limit.Burst
+		}
+	}
+	if interval <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{
+		tokens:     float64(burst),
+		rate:       1.0 / interval.Seconds(),
+		burst:      float64(burst),
+		lastUpdate: nm.clock.Now(),
+		clock:      nm.clock,
+	}
+}
+
+// deliver sends alert to one channel through its circuit breaker and a send
+// slot.
+func (nm *NotificationManager) deliver(ctx context.Context, alert *Alert, ch string) error {
+	// Fast-fail a channel that keeps failing rather than letting it hold a
+	// send slot for its full timeout
+	breaker := nm.breaker(ch)
+	if !breaker.allow() {
+		notificationsFailed.WithLabelValues(channelLabel(ch)).Inc()
+		return fmt.Errorf("failed to send to %s: %v", ch, ErrCircuitOpen)
+	}
+
+	if err := nm.acquireSlot(ctx); err != nil {
+		breaker.abandon()
+		nm.enqueueFailures.Add(1)
+		notificationsFailed.WithLabelValues(channelLabel(ch)).Inc()
+		return fmt.Errorf("failed to enqueue %s: %v", ch, err)
+	}
+	defer nm.releaseSlot()
+
+	err := nm.sendToChannel(ctx, alert, ch)
+	breaker.record(err)
+	if err != nil {
+		notificationsFailed.WithLabelValues(channelLabel(ch)).Inc()
+		return fmt.Errorf("failed to send to %s: %v", ch, err)
+	}
+	notificationsSent.WithLabelValues(channelLabel(ch)).Inc()
+	return nil
+}
+
 func (nm *NotificationManager) sendToChannel(ctx context.Context, alert *Alert, channel string) error {
 	switch channel {
 	case "email":
@@ -205,27 +596,6 @@ func (nm *NotificationManager) sendToChannel(ctx context.Context, alert *Alert,
 	}
 }
 
-func (nm *NotificationManager) sendEmail(ctx context.Context, alert *Alert) error {
-	var body bytes.Buffer
-	if err := nm.templates["email"].Execute(&body, alert); err != nil {
-		return err
-	}
-
-	auth := smtp.PlainAuth("",
-		nm.config.Email.Username,
-		nm.config.Email.Password,
-		nm.config.Email.Host,
-	)
-
-	return smtp.SendMail(
-		fmt.Sprintf("%s:%d", nm.config.Email.Host, nm.config.Email.Port),
-		auth,
-		nm.config.Email.From,
-		nm.config.Defaults.Recipients,
-		body.Bytes(),
-	)
-}
-
 func (nm *NotificationManager) sendSlack(ctx context.Context, alert *Alert) error {
 	var payload bytes.Buffer
 	if err := nm.templates["slack"].Execute(&payload, alert); err != nil {
@@ -283,7 +653,7 @@ func (rl *RateLimiter) Allow() bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	now := time.Now()
+	now := rl.clock.Now()
 	elapsed := now.Sub(rl.lastUpdate).Seconds()
 	rl.tokens = math.Min(rl.burst, rl.tokens+elapsed*rl.rate)
 	rl.lastUpdate = now
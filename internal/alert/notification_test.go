@@ -0,0 +1,93 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+func TestInfoSpamDoesNotRateLimitCritical(t *testing.T) {
+	srv, received, _ := slackServer(t)
+	nm, err := NewNotificationManager(NotificationConfig{
+		Slack:    SlackConfig{WebhookURL: srv.URL},
+		Defaults: DefaultConfig{MinInterval: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationManager: %v", err)
+	}
+
+	for i := range 20 {
+		alert := &Alert{Severity: "info", Title: "Cache miss", Message: fmt.Sprintf("miss %d", i), Source: "checkout"}
+		if err := nm.Send(context.Background(), alert, []string{"slack"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if got := received.Load(); got != defaultRateBurst {
+		t.Fatalf("sent %d info notifications, want the burst of %d", got, defaultRateBurst)
+	}
+
+	critical := &Alert{Severity: "critical", Title: "API down", Message: "checkout is failing", Source: "checkout"}
+	if err := nm.Send(context.Background(), critical, []string{"slack"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := received.Load(); got != defaultRateBurst+1 {
+		t.Errorf("critical alert after info spam was not sent")
+	}
+}
+
+func TestConfigDurationsAcceptStrings(t *testing.T) {
+	var cfg NotificationConfig
+	data := `{
+		"retry_queue": {"dir": "/tmp/q", "initial_backoff": "30s", "max_backoff": 900000000000, "max_age": "24h"},
+		"grouping": {"group_by": ["type"], "group_wait": "10s", "group_interval": "5m"}
+	}`
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := RetryQueueConfig{Dir: "/tmp/q", InitialBackoff: 30 * time.Second, MaxBackoff: 15 * time.Minute, MaxAge: 24 * time.Hour}
+	if cfg.RetryQueue != want {
+		t.Errorf("retry queue decoded as %+v, want %+v", cfg.RetryQueue, want)
+	}
+	if g := cfg.Grouping; len(g.GroupBy) != 1 || g.GroupWait != 10*time.Second || g.GroupInterval != 5*time.Minute {
+		t.Errorf("grouping decoded as %+v", g)
+	}
+
+	encoded, _ := json.Marshal(cfg.Grouping)
+	if want := `{"group_by":["type"],"group_wait":"10s","group_interval":"5m0s"}`; string(encoded) != want {
+		t.Errorf("grouping encoded as %s, want %s", encoded, want)
+	}
+}
+
+func TestSeverityLimitsIgnoreCase(t *testing.T) {
+	srv, received, _ := slackServer(t)
+	nm, err := NewNotificationManager(NotificationConfig{
+		Slack:    SlackConfig{WebhookURL: srv.URL},
+		Defaults: DefaultConfig{SeverityLimits: map[string]SeverityLimit{"Info": {MinInterval: time.Minute, Burst: 1}}},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationManager: %v", err)
+	}
+
+	for i, severity := range []string{"info", "INFO", "Info"} {
+		alert := &Alert{Severity: severity, Title: "Cache miss", Message: fmt.Sprintf("miss %d", i), Source: "checkout"}
+		if err := nm.Send(context.Background(), alert, []string{"slack"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if got := received.Load(); got != 1 {
+		t.Errorf("sent %d info notifications in any case, want the burst of 1", got)
+	}
+
+	_, err = NewNotificationManager(NotificationConfig{
+		Defaults: DefaultConfig{SeverityLimits: map[string]SeverityLimit{"info": {}, "INFO": {}}},
+	})
+	var errs db.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Errorf("limits for info and INFO got %v, want a validation error", err)
+	}
+}
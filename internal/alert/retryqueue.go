@@ -0,0 +1,457 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Overflow policies of a full retry queue
+const (
+	// OverflowDropOldest dead-letters the oldest queued delivery to make
+	// room; it is the default
+	OverflowDropOldest = "drop_oldest"
+	// OverflowDropNewest dead-letters the delivery being queued
+	OverflowDropNewest = "drop_newest"
+)
+
+// retryPollInterval is how often the retry worker looks for due deliveries.
+const retryPollInterval = time.Second
+
+// ErrRetryQueueRunning is returned by StartRetryQueue when it was already
+// started.
+var ErrRetryQueueRunning = errors.New("notification retry queue is already running")
+
+// RetryQueueConfig configures the persistent queue that failed deliveries
+// wait in until a later attempt succeeds or they get too old.
+type RetryQueueConfig struct {
+	// Dir holds one file per queued delivery, and dead letters under
+	// Dir/dead. The queue is off when Dir is empty.
+	Dir string `json:"dir"`
+	// MaxSize bounds the queued deliveries. Defaults to 1000.
+	MaxSize int `json:"max_size"`
+	// Overflow picks the delivery a full queue dead-letters: drop_oldest
+	// or drop_newest. Defaults to drop_oldest.
+	Overflow string `json:"overflow"`
+	// InitialBackoff is the wait before the first retry; it doubles after
+	// each failure up to MaxBackoff. They default to 30s and 15m.
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+	// MaxAge is how long after its first failure a delivery is retried
+	// before it is dead-lettered. Defaults to 24h.
+	MaxAge time.Duration `json:"max_age"`
+	// Attempts is how many times a delivery is tried in memory, RetryDelay
+	// apart, before it is queued. They default to 3 and 1s.
+	Attempts   int           `json:"attempts"`
+	RetryDelay time.Duration `json:"retry_delay"`
+}
+
+// MarshalJSON writes the durations as duration strings.
+func (c RetryQueueConfig) MarshalJSON() ([]byte, error) {
+	type plain RetryQueueConfig
+	return json.Marshal(struct {
+		plain
+		InitialBackoff duration `json:"initial_backoff"`
+		MaxBackoff     duration `json:"max_backoff"`
+		MaxAge         duration `json:"max_age"`
+		RetryDelay     duration `json:"retry_delay"`
+	}{plain(c), duration(c.InitialBackoff), duration(c.MaxBackoff), duration(c.MaxAge), duration(c.RetryDelay)})
+}
+
+// UnmarshalJSON accepts the durations as duration strings or nanoseconds.
+func (c *RetryQueueConfig) UnmarshalJSON(data []byte) error {
+	type plain RetryQueueConfig
+	aux := struct {
+		*plain
+		InitialBackoff duration `json:"initial_backoff"`
+		MaxBackoff     duration `json:"max_backoff"`
+		MaxAge         duration `json:"max_age"`
+		RetryDelay     duration `json:"retry_delay"`
+	}{plain: (*plain)(c), InitialBackoff: duration(c.InitialBackoff), MaxBackoff: duration(c.MaxBackoff), MaxAge: duration(c.MaxAge), RetryDelay: duration(c.RetryDelay)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	c.InitialBackoff, c.MaxBackoff, c.MaxAge = time.Duration(aux.InitialBackoff), time.Duration(aux.MaxBackoff), time.Duration(aux.MaxAge)
+	c.RetryDelay = time.Duration(aux.RetryDelay)
+	return nil
+}
+
+// queuedDelivery is a failed delivery of an alert to one channel, as
+// persisted in the retry queue.
+type queuedDelivery struct {
+	ID          string    `json:"id"`
+	Channel     string    `json:"channel"`
+	Alert       *Alert    `json:"alert"`
+	Attempts    int       `json:"attempts"`
+	FirstFailed time.Time `json:"first_failed"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+	// DeadReason says why a dead letter was given up on
+	DeadReason string `json:"dead_reason,omitempty"`
+}
+
+// retryQueue keeps failed deliveries in memory, oldest first, and mirrors
+// each to a file in cfg.Dir so they survive a restart.
+type retryQueue struct {
+	cfg RetryQueueConfig
+
+	mu      sync.Mutex
+	entries []*queuedDelivery
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// openRetryQueue applies cfg's defaults and loads the deliveries persisted
+// in cfg.Dir. Files that can't be read are logged and left in place.
+func openRetryQueue(cfg RetryQueueConfig) (*retryQueue, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 1000
+	}
+	switch cfg.Overflow {
+	case "":
+		cfg.Overflow = OverflowDropOldest
+	case OverflowDropOldest, OverflowDropNewest:
+	default:
+		return nil, fmt.Errorf("unknown retry queue overflow policy %q", cfg.Overflow)
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 30 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 15 * time.Minute
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 24 * time.Hour
+	}
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = 3
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, "dead"), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create retry queue directory: %v", err)
+	}
+	files, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry queue directory: %v", err)
+	}
+
+	q := &retryQueue{cfg: cfg}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.Dir, file.Name()))
+		if err != nil {
+			log.Printf("Failed to read queued notification %s: %v", file.Name(), err)
+			continue
+		}
+		var entry queuedDelivery
+		if err := json.Unmarshal(data, &entry); err != nil || entry.Alert == nil {
+			log.Printf("Skipping malformed queued notification %s", file.Name())
+			continue
+		}
+		q.entries = append(q.entries, &entry)
+	}
+	sort.SliceStable(q.entries, func(i, j int) bool {
+		return q.entries[i].FirstFailed.Before(q.entries[j].FirstFailed)
+	})
+	return q, nil
+}
+
+// len returns the number of queued deliveries; a nil queue is empty.
+func (q *retryQueue) len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// add queues a delivery, dead-lettering one per the overflow policy when
+// the queue is full.
+func (q *retryQueue) add(entry *queuedDelivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) >= q.cfg.MaxSize {
+		if q.cfg.Overflow == OverflowDropNewest {
+			q.deadLetter(entry, "retry queue full")
+			return
+		}
+		oldest := q.entries[0]
+		q.entries = q.entries[1:]
+		q.deadLetter(oldest, "retry queue full")
+	}
+
+	if err := q.write(q.cfg.Dir, entry); err != nil {
+		log.Printf("Failed to persist queued notification %s: %v", entry.ID, err)
+	}
+	q.entries = append(q.entries, entry)
+	notificationsRetryQueued.WithLabelValues(channelLabel(entry.Channel)).Inc()
+}
+
+// due returns the deliveries whose next attempt is at or before now.
+func (q *retryQueue) due(now time.Time) []*queuedDelivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []*queuedDelivery
+	for _, entry := range q.entries {
+		if !entry.NextAttempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	return due
+}
+
+// complete removes a delivery that succeeded.
+func (q *retryQueue) complete(entry *queuedDelivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.take(entry) {
+		q.removeFile(entry)
+	}
+}
+
+// fail records a failed retry and schedules the next one, or dead-letters
+// the delivery once it is older than the max age.
+func (q *retryQueue) fail(entry *queuedDelivery, err error, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.present(entry) {
+		// Dropped by an overflow while it was being retried
+		return
+	}
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if now.Sub(entry.FirstFailed) >= q.cfg.MaxAge {
+		q.take(entry)
+		q.deadLetter(entry, fmt.Sprintf("gave up after %d attempts", entry.Attempts))
+		return
+	}
+
+	entry.NextAttempt = now.Add(q.backoff(entry.Attempts))
+	if err := q.write(q.cfg.Dir, entry); err != nil {
+		log.Printf("Failed to persist queued notification %s: %v", entry.ID, err)
+	}
+}
+
+// backoff returns the wait after the given number of failed retries.
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	wait := q.cfg.InitialBackoff
+	for i := 1; i < attempts && wait < q.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > q.cfg.MaxBackoff {
+		wait = q.cfg.MaxBackoff
+	}
+	return wait
+}
+
+// present reports whether entry is still queued. Must be called with q.mu
+// held.
+func (q *retryQueue) present(entry *queuedDelivery) bool {
+	for _, e := range q.entries {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// take removes entry from the queue, reporting whether it was there. Must
+// be called with q.mu held.
+func (q *retryQueue) take(entry *queuedDelivery) bool {
+	for i, e := range q.entries {
+		if e == entry {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// deadLetter moves entry's file to Dir/dead. Must be called with q.mu held
+// and entry already out of q.entries.
+func (q *retryQueue) deadLetter(entry *queuedDelivery, reason string) {
+	entry.DeadReason = reason
+	if err := q.write(filepath.Join(q.cfg.Dir, "dead"), entry); err != nil {
+		log.Printf("Failed to dead-letter notification %s: %v", entry.ID, err)
+	}
+	q.removeFile(entry)
+	notificationsDeadLettered.WithLabelValues(channelLabel(entry.Channel)).Inc()
+	log.Printf("Dead-lettered %s notification for alert %s: %s; last error: %s",
+		entry.Channel, entry.Alert.ID, reason, entry.LastError)
+}
+
+// write persists entry in dir, replacing any earlier copy atomically.
+func (q *retryQueue) write(dir string, entry *queuedDelivery) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, entry.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (q *retryQueue) removeFile(entry *queuedDelivery) {
+	path := filepath.Join(q.cfg.Dir, entry.ID+".json")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove queued notification %s: %v", entry.ID, err)
+	}
+}
+
+// StartRetryQueue loads the deliveries persisted in RetryQueue.Dir and
+// starts retrying them in the background. From then on, deliveries that
+// fail in Send and SendWithFallback are queued rather than lost. It does
+// nothing when RetryQueue.Dir is empty.
+func (nm *NotificationManager) StartRetryQueue() error {
+	if nm.config.RetryQueue.Dir == "" {
+		return nil
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if nm.retries != nil {
+		return ErrRetryQueueRunning
+	}
+	q, err := openRetryQueue(nm.config.RetryQueue)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+	nm.retries = q
+	go nm.runRetries(ctx, q)
+	return nil
+}
+
+// Stop sends the alerts still waiting in groups, then stops the retry
+// worker and waits for an in-flight retry to finish. Queued deliveries stay
+// on disk for the next StartRetryQueue. If ctx ends first it returns ctx's
+// error.
+func (nm *NotificationManager) Stop(ctx context.Context) error {
+	nm.flushGroups(ctx)
+
+	nm.mu.Lock()
+	q := nm.retries
+	nm.retries = nil
+	nm.mu.Unlock()
+	if q == nil {
+		return nil
+	}
+
+	q.cancel()
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notification retry still running: %v", ctx.Err())
+	}
+}
+
+// deliverWithRetries delivers alert to ch. While the retry queue runs, a
+// failed delivery is first retried in memory, so only those that keep
+// failing are queued.
+func (nm *NotificationManager) deliverWithRetries(ctx context.Context, alert *Alert, ch string) error {
+	nm.mu.RLock()
+	q := nm.retries
+	nm.mu.RUnlock()
+
+	err := nm.deliver(ctx, alert, ch)
+	if q == nil {
+		return err
+	}
+	for attempt := 1; err != nil && attempt < q.cfg.Attempts; attempt++ {
+		timer := time.NewTimer(q.cfg.RetryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = nm.deliver(ctx, alert, ch)
+	}
+	return err
+}
+
+// queueRetries adds the failed deliveries in errs to the retry queue, if
+// it is running.
+func (nm *NotificationManager) queueRetries(alert *Alert, errs []error) {
+	nm.mu.RLock()
+	q := nm.retries
+	nm.mu.RUnlock()
+	if q == nil {
+		return
+	}
+
+	now := nm.now()
+	for _, err := range errs {
+		var failed *deliveryError
+		if !errors.As(err, &failed) {
+			continue
+		}
+		q.add(&queuedDelivery{
+			ID:          db.NewID(),
+			Channel:     failed.channel,
+			Alert:       alert,
+			FirstFailed: now,
+			NextAttempt: now.Add(q.cfg.InitialBackoff),
+			LastError:   failed.err.Error(),
+		})
+	}
+}
+
+// runRetries re-attempts due deliveries until ctx is cancelled.
+func (nm *NotificationManager) runRetries(ctx context.Context, q *retryQueue) {
+	defer close(q.done)
+
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, entry := range q.due(nm.now()) {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := nm.deliver(ctx, entry.Alert, entry.Channel); err != nil {
+				if ctx.Err() != nil {
+					// Interrupted by Stop rather than failed: the entry
+					// stays as it was for the next start
+					return
+				}
+				q.fail(entry, err, nm.now())
+				continue
+			}
+			q.complete(entry)
+		}
+	}
+}
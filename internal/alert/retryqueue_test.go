@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailedDeliveryRetriesInMemoryFirst(t *testing.T) {
+	var received, failures atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	nm, err := NewNotificationManager(NotificationConfig{
+		Slack:      SlackConfig{WebhookURL: srv.URL},
+		RetryQueue: RetryQueueConfig{Dir: t.TempDir(), Attempts: 3, RetryDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationManager: %v", err)
+	}
+	if err := nm.StartRetryQueue(); err != nil {
+		t.Fatalf("StartRetryQueue: %v", err)
+	}
+	t.Cleanup(func() { nm.Stop(context.Background()) })
+
+	// A blip shorter than the in-memory attempts
+	failures.Store(2)
+	if err := nm.Send(context.Background(), &Alert{Severity: "critical", Title: "API down", Message: "blip"}, []string{"slack"}); err != nil {
+		t.Fatalf("Send through a blip: %v", err)
+	}
+	if got := received.Load(); got != 3 {
+		t.Errorf("slack got %d attempts through a blip, want 3", got)
+	}
+	if got := nm.Stats().RetryQueued; got != 0 {
+		t.Errorf("queued %d deliveries that succeeded in memory, want 0", got)
+	}
+
+	// An outage outlasting them
+	received.Store(0)
+	failures.Store(1 << 20)
+	if err := nm.Send(context.Background(), &Alert{Severity: "critical", Title: "API down", Message: "outage"}, []string{"slack"}); err == nil {
+		t.Fatal("Send through an outage succeeded")
+	}
+	if got := received.Load(); got != 3 {
+		t.Errorf("slack got %d attempts through an outage, want 3", got)
+	}
+	if got := nm.Stats().RetryQueued; got != 1 {
+		t.Errorf("queued %d deliveries after the in-memory attempts failed, want 1", got)
+	}
+}
+
+func TestStopLeavesInterruptedRetryQueued(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body
+		// is read
+		io.Copy(io.Discard, r.Body)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	nm, err := NewNotificationManager(NotificationConfig{
+		Slack:      SlackConfig{WebhookURL: srv.URL},
+		RetryQueue: RetryQueueConfig{Dir: dir},
+	})
+	if err != nil {
+		t.Fatalf("NewNotificationManager: %v", err)
+	}
+	if err := nm.StartRetryQueue(); err != nil {
+		t.Fatalf("StartRetryQueue: %v", err)
+	}
+	now := time.Now()
+	nm.retries.add(&queuedDelivery{
+		ID:          "d1",
+		Channel:     "slack",
+		Alert:       &Alert{ID: "a1", Severity: "critical", Title: "API down"},
+		FirstFailed: now,
+		NextAttempt: now,
+		LastError:   "slack webhook returned status: 502",
+	})
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued delivery was never retried")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := nm.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	q, err := openRetryQueue(RetryQueueConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("openRetryQueue: %v", err)
+	}
+	if len(q.entries) != 1 {
+		t.Fatalf("%d deliveries queued after Stop, want the interrupted one", len(q.entries))
+	}
+	if entry := q.entries[0]; entry.Attempts != 0 || entry.LastError != "slack webhook returned status: 502" {
+		t.Errorf("interrupted delivery stored with %d attempts and last error %q, want it unchanged", entry.Attempts, entry.LastError)
+	}
+}
@@ -0,0 +1,94 @@
+package alert
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Scorer rates a correlation group from 0 to 1, higher meaning more urgent.
+// It is called with the engine lock held, after the group's alerts have
+// been trimmed to its rule's time window, and must not call back into the
+// engine.
+type Scorer func(group *AlertGroup, now time.Time) float64
+
+// Weights of the default score's components; they sum to 1
+const (
+	scoreSeverityWeight   = 0.45
+	scoreCountWeight      = 0.35
+	scoreClusteringWeight = 0.2
+)
+
+// severityScores map member severities onto 0–1; unknown severities score
+// like low
+var severityScores = map[string]float64{
+	"critical": 1,
+	"error":    0.8,
+	"high":     0.8,
+	"warning":  0.5,
+	"medium":   0.5,
+	"low":      0.25,
+	"info":     0.1,
+}
+
+// severityScore looks severity up in severityScores, whatever its case.
+func severityScore(severity string) float64 {
+	if s, ok := severityScores[strings.ToLower(severity)]; ok {
+		return s
+	}
+	return severityScores["low"]
+}
+
+// DefaultScorer combines three components:
+//
+//   - severity: the mean of the group's highest and average member
+//     severity, so one critical alert counts but a crowd of them counts more
+//   - count: 1 - 2^(-count/min_count), which is 0.5 at the rule's
+//     min_count and approaches 1 as alerts keep arriving
+//   - clustering: 1 minus the members' spread in time as a fraction of the
+//     rule's time window, so a sudden burst outranks a slow trickle
+func DefaultScorer(group *AlertGroup, now time.Time) float64 {
+	if len(group.Alerts) == 0 {
+		return 0
+	}
+
+	var highest, total float64
+	first, last := group.Alerts[0].CreatedAt, group.Alerts[0].CreatedAt
+	for _, alert := range group.Alerts {
+		s := severityScore(alert.Severity)
+		highest = math.Max(highest, s)
+		total += s
+
+		if alert.CreatedAt.Before(first) {
+			first = alert.CreatedAt
+		}
+		if alert.CreatedAt.After(last) {
+			last = alert.CreatedAt
+		}
+	}
+	severity := (highest + total/float64(len(group.Alerts))) / 2
+
+	count := 1.0
+	if group.Rule.MinCount > 0 {
+		count = 1 - math.Exp2(-float64(len(group.Alerts))/float64(group.Rule.MinCount))
+	}
+
+	clustering := 1.0
+	if window := group.Rule.TimeWindow; window > 0 {
+		clustering = 1 - math.Min(1, float64(last.Sub(first))/float64(window))
+	}
+
+	return scoreSeverityWeight*severity + scoreCountWeight*count + scoreClusteringWeight*clustering
+}
+
+// SetScorer replaces the function that scores groups for ordering in
+// GetActiveGroups; nil restores DefaultScorer. Existing groups are rescored
+// as their next alert arrives.
+func (ce *CorrelationEngine) SetScorer(s Scorer) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	if s == nil {
+		s = DefaultScorer
+	}
+	ce.scorer = s
+}
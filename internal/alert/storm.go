@@ -0,0 +1,296 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// TypeAlertStorm is the type of the summary alert raised while the storm
+// cap suppresses alerts.
+const TypeAlertStorm = "alert_storm"
+
+// stormWindow is the period the storm cap counts alerts over.
+const stormWindow = time.Minute
+
+// StormStatus reports the state of the global alert cap.
+type StormStatus struct {
+	Enabled        bool       `json:"enabled"`
+	LimitPerMinute int        `json:"limit_per_minute"`
+	Active         bool       `json:"active"`
+	Since          *time.Time `json:"since,omitempty"`
+	SummaryID      string     `json:"summary_alert_id,omitempty"`
+	// Suppressed counts the current storm's alerts; SuppressedAll counts
+	// every storm's since startup
+	Suppressed    int `json:"suppressed"`
+	SuppressedAll int `json:"suppressed_total"`
+}
+
+// stormGuard counts alerts in fixed one-minute windows. A storm starts when
+// a window exceeds the limit and ends once a full window stays within it.
+type stormGuard struct {
+	mu    sync.Mutex
+	limit int
+
+	windowStart time.Time
+	count       int
+	prevCount   int
+
+	active     bool
+	since      time.Time
+	summaryID  string
+	suppressed int
+	// suppressedAll counts suppressed alerts across every storm
+	suppressedAll int
+	// timer checks every stormWindow whether an active storm has ended
+	// without further alerts to end it; nil when no storm is active
+	timer *time.Timer
+}
+
+type stormAction int
+
+const (
+	stormAllow stormAction = iota
+	stormSuppress
+	// stormStart suppresses the alert and raises the summary alert
+	stormStart
+	// stormEnd lets the alert through and closes the summary alert
+	stormEnd
+)
+
+// roll moves the counting window up to now.
+func (g *stormGuard) roll(now time.Time) {
+	if elapsed := now.Sub(g.windowStart); elapsed >= stormWindow {
+		g.prevCount = g.count
+		if elapsed >= 2*stormWindow {
+			g.prevCount = 0
+		}
+		g.windowStart = now.Truncate(stormWindow)
+		g.count = 0
+	}
+}
+
+func (g *stormGuard) storming() bool {
+	return g.count > g.limit || g.prevCount > g.limit
+}
+
+// end closes the active storm, returning its summary alert and
+// suppressed count.
+func (g *stormGuard) end() (summaryID string, suppressed int) {
+	g.active = false
+	summaryID, suppressed = g.summaryID, g.suppressed
+	g.summaryID, g.suppressed = "", 0
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	return summaryID, suppressed
+}
+
+// admit counts an alert created at now and decides what happens to it.
+// For stormEnd it also returns the storm's summary alert and suppressed
+// count.
+func (g *stormGuard) admit(now time.Time) (action stormAction, summaryID string, suppressed int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.roll(now)
+	g.count++
+
+	storming := g.storming()
+	switch {
+	case storming && !g.active:
+		g.active = true
+		g.since = now
+		g.summaryID = db.NewID()
+		g.suppressed = 1
+		g.suppressedAll++
+		return stormStart, g.summaryID, 0
+	case storming:
+		g.suppressed++
+		g.suppressedAll++
+		return stormSuppress, "", 0
+	case g.active:
+		summaryID, suppressed = g.end()
+		return stormEnd, summaryID, suppressed
+	default:
+		return stormAllow, "", 0
+	}
+}
+
+// expire ends the active storm if the alert rate has subsided by now
+// without an alert arriving to notice. It reports whether a storm ended,
+// and whether one is still active.
+func (g *stormGuard) expire(now time.Time) (summaryID string, suppressed int, ended, active bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.active {
+		return "", 0, false, false
+	}
+	g.roll(now)
+	if g.storming() {
+		return "", 0, false, true
+	}
+	summaryID, suppressed = g.end()
+	return summaryID, suppressed, true, false
+}
+
+// watchStorm checks the storm guarded by g every stormWindow until it ends,
+// so its summary alert is resolved even if alerts simply stop.
+func (m *Manager) watchStorm(g *stormGuard) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.active {
+		return
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.timer = time.AfterFunc(stormWindow, func() { m.sweepStorm(g) })
+}
+
+// sweepStorm ends the storm guarded by g if the rate has subsided, and
+// keeps watching it otherwise.
+func (m *Manager) sweepStorm(g *stormGuard) {
+	now := m.now()
+	summaryID, suppressed, ended, active := g.expire(now)
+	if ended {
+		if err := m.closeStormAlert(context.Background(), summaryID, suppressed, now); err != nil {
+			log.Printf("Failed to resolve alert storm %s: %v", summaryID, err)
+		}
+		return
+	}
+	if active {
+		m.watchStorm(g)
+	}
+}
+
+// SetStormCap caps the alerts created per minute across all rules. Beyond
+// the cap, alerts are dropped and collapsed into a single alert_storm
+// summary alert, which is resolved with the final suppressed count once a
+// minute passes within the cap, whether or not alerts keep arriving. A
+// limit of zero or less removes the cap.
+//
+// It is a last-resort safety valve above notification rate limits, for
+// outages that would otherwise create thousands of alerts.
+func (m *Manager) SetStormCap(limitPerMinute int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.storm != nil {
+		m.storm.mu.Lock()
+		if m.storm.timer != nil {
+			m.storm.timer.Stop()
+		}
+		m.storm.mu.Unlock()
+	}
+	if limitPerMinute <= 0 {
+		m.storm = nil
+		return
+	}
+	m.storm = &stormGuard{limit: limitPerMinute}
+}
+
+// StormStatus returns whether an alert storm is being suppressed and how
+// many alerts were suppressed.
+func (m *Manager) StormStatus() StormStatus {
+	m.mu.RLock()
+	g := m.storm
+	m.mu.RUnlock()
+	if g == nil {
+		return StormStatus{}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	status := StormStatus{
+		Enabled:        true,
+		LimitPerMinute: g.limit,
+		Active:         g.active,
+		SummaryID:      g.summaryID,
+		Suppressed:     g.suppressed,
+		SuppressedAll:  g.suppressedAll,
+	}
+	if g.active {
+		since := g.since
+		status.Since = &since
+	}
+	return status
+}
+
+// admitAlert applies the storm cap to a new alert and reports whether it
+// should be created.
+func (m *Manager) admitAlert(ctx context.Context, alert *db.Alert) (bool, error) {
+	m.mu.RLock()
+	g := m.storm
+	m.mu.RUnlock()
+	if g == nil {
+		return true, nil
+	}
+
+	action, summaryID, suppressed := g.admit(alert.CreatedAt)
+	switch action {
+	case stormStart:
+		alertsSuppressed.Inc()
+		m.watchStorm(g)
+		return false, m.raiseStormAlert(ctx, summaryID, g.limit, alert.CreatedAt)
+	case stormSuppress:
+		alertsSuppressed.Inc()
+		return false, nil
+	case stormEnd:
+		if err := m.closeStormAlert(ctx, summaryID, suppressed, alert.CreatedAt); err != nil {
+			log.Printf("Failed to resolve alert storm %s: %v", summaryID, err)
+		}
+	}
+	return true, nil
+}
+
+func (m *Manager) raiseStormAlert(ctx context.Context, id string, limit int, now time.Time) error {
+	details, _ := json.Marshal(map[string]interface{}{
+		"limit_per_minute": limit,
+	})
+	alert := &db.Alert{
+		ID:        id,
+		Type:      TypeAlertStorm,
+		Source:    "alert_manager",
+		Severity:  "critical",
+		Message:   fmt.Sprintf("Alert storm: more than %d alerts in a minute; further alerts are suppressed until the rate subsides", limit),
+		Details:   details,
+		Status:    "active",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.storage.SaveAlert(ctx, alert); err != nil {
+		return fmt.Errorf("failed to save alert storm: %v", err)
+	}
+	alertsCreated.WithLabelValues(severityLabel(alert.Severity)).Inc()
+	m.notify(ctx, alert)
+	return nil
+}
+
+// closeStormAlert records the final suppressed count on the storm's
+// summary alert and resolves it.
+func (m *Manager) closeStormAlert(ctx context.Context, id string, suppressed int, now time.Time) error {
+	details, _ := json.Marshal(map[string]interface{}{
+		"suppressed": suppressed,
+	})
+	alert := &db.Alert{
+		ID:         id,
+		Message:    fmt.Sprintf("Alert storm ended; %d alerts were suppressed", suppressed),
+		Details:    details,
+		Status:     "resolved",
+		ResolvedAt: &now,
+		ResolvedBy: "alert_manager",
+		UpdatedAt:  now,
+	}
+	if err := m.storage.UpdateAlert(ctx, alert); err != nil {
+		return err
+	}
+	alertsResolved.Inc()
+	return nil
+}
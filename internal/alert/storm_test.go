@@ -0,0 +1,54 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+func TestStormEndsWhenAlertsStop(t *testing.T) {
+	m, storage, _, clk := newTestManager(t)
+	m.SetStormCap(2)
+	addRule(t, m, &Rule{
+		ID:         "errors",
+		Type:       "monitoring",
+		Conditions: json.RawMessage(`{"status_codes":[500]}`),
+		Severity:   "warning",
+		Message:    "Server error",
+	})
+
+	for i := 0; i < 5; i++ {
+		result := &db.MonitoringResult{ID: db.NewID(), TargetID: db.NewID(), StatusCode: 500}
+		if err := m.ProcessMonitoringResult(context.Background(), result); err != nil {
+			t.Fatalf("ProcessMonitoringResult: %v", err)
+		}
+	}
+	status := m.StormStatus()
+	if !status.Active {
+		t.Fatal("no storm after exceeding the cap")
+	}
+
+	// No more alerts; the next sweeps find the rate has subsided
+	m.mu.RLock()
+	g := m.storm
+	m.mu.RUnlock()
+	clk.Advance(stormWindow)
+	m.sweepStorm(g)
+	if !m.StormStatus().Active {
+		t.Fatal("storm ended while the last window was over the cap")
+	}
+	clk.Advance(stormWindow)
+	m.sweepStorm(g)
+
+	if m.StormStatus().Active {
+		t.Fatal("storm still active after a quiet window")
+	}
+	storage.mu.Lock()
+	summary := storage.alerts[status.SummaryID]
+	storage.mu.Unlock()
+	if summary == nil || summary.Status != "resolved" {
+		t.Errorf("storm summary is %+v, want resolved", summary)
+	}
+}
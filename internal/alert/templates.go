@@ -0,0 +1,103 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// templateFuncs are the helpers available to every notification template:
+//
+//   - formatTime LAYOUT TIME formats a time.Time, or an RFC 3339 string such
+//     as .Timestamp, with a Go layout or one of RFC3339, RFC1123, Kitchen,
+//     DateTime, DateOnly or TimeOnly: {{ .CreatedAt | formatTime "Kitchen" }}
+//   - truncate N STRING shortens a string to N characters, ending it with
+//     "…" when cut: {{ .Message | truncate 200 }}
+//   - upper STRING upper-cases a string
+//   - severityColor SEVERITY gives a hex color for a severity, for Slack
+//     attachments and HTML email: {{ severityColor .Severity }}
+//   - json VALUE encodes a value as JSON, e.g. {{ json .Details }}
+//
+// Templates run with missingkey=error, so a misspelt map key fails the
+// notification rather than rendering "<no value>".
+func templateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"formatTime":    formatTime,
+		"truncate":      truncate,
+		"upper":         strings.ToUpper,
+		"severityColor": severityColor,
+		"json":          toJSON,
+	}
+}
+
+// templateMissingKey makes templates fail on missing map keys.
+const templateMissingKey = "missingkey=error"
+
+var namedLayouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+	"Kitchen":  time.Kitchen,
+	"DateTime": time.DateTime,
+	"DateOnly": time.DateOnly,
+	"TimeOnly": time.TimeOnly,
+}
+
+func formatTime(layout string, value interface{}) (string, error) {
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	}
+
+	switch t := value.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case *time.Time:
+		if t == nil {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return "", fmt.Errorf("formatTime: %q is not an RFC 3339 time", t)
+		}
+		return parsed.Format(layout), nil
+	default:
+		return "", fmt.Errorf("formatTime: can't format %T", value)
+	}
+}
+
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n == 0 {
+		return ""
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+func severityColor(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "error":
+		return "#D00000"
+	case "high":
+		return "#E8590C"
+	case "warning", "medium":
+		return "#F2C744"
+	case "low", "info":
+		return "#439FE0"
+	default:
+		return "#808080"
+	}
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,85 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// ErrChannelNotConfigured is returned by SendTest for a channel that is
+// unknown or has no delivery settings.
+var ErrChannelNotConfigured = errors.New("notification channel is not configured")
+
+// DeliveryResult is the outcome of a test send to one channel.
+type DeliveryResult struct {
+	Channel   string `json:"channel"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+	// DurationMs is how long the delivery took, in milliseconds
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// SendTest delivers a synthetic alert to channel so its configuration can
+// be checked without waiting for a real alert. It goes straight to the
+// channel: rate limits, send slots and the circuit breaker are bypassed, and
+// the outcome isn't recorded against the breaker. A failed delivery is
+// reported in the result; the error is only for channels that can't be
+// tried at all.
+func (nm *NotificationManager) SendTest(ctx context.Context, channel string) (*DeliveryResult, error) {
+	if err := nm.channelConfigured(channel); err != nil {
+		return nil, err
+	}
+
+	now := nm.now()
+	alert := &Alert{
+		ID:        db.NewID(),
+		Type:      "test",
+		Severity:  "info",
+		Title:     "Test notification",
+		Timestamp: now.Format(time.RFC3339),
+		Source:    "api-watchtower",
+		Message:   fmt.Sprintf("This is a test notification for the %s channel.", channel),
+		CreatedAt: now,
+	}
+
+	start := time.Now()
+	err := nm.sendToChannel(ctx, alert, channel)
+	result := &DeliveryResult{
+		Channel:    channel,
+		Delivered:  err == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+// channelConfigured checks that channel is supported and has the settings
+// it needs to deliver.
+func (nm *NotificationManager) channelConfigured(channel string) error {
+	var configured bool
+	switch channel {
+	case "email":
+		configured = nm.config.Email.Host != "" && nm.config.Email.From != "" && len(nm.emailRecipients()) > 0 && nm.emailBodyErr == nil
+	case "slack":
+		configured = nm.config.Slack.WebhookURL != ""
+	case "webhook":
+		configured = len(nm.config.Webhook.URLs) > 0
+	default:
+		return fmt.Errorf("%w: unknown channel %q", ErrChannelNotConfigured, channel)
+	}
+	if !configured {
+		return fmt.Errorf("%w: %s", ErrChannelNotConfigured, channel)
+	}
+	return nil
+}
+
+func (nm *NotificationManager) now() time.Time {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	return nm.clock.Now()
+}
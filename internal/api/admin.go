@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"api-watchtower/internal/alert"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) requireCorrelation(c *gin.Context) {
+	if s.services.Correlation == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "alert correlation is not configured"})
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) listCorrelationGroups(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"groups": s.services.Correlation.GetActiveGroups()})
+}
+
+func (s *Server) getCorrelationGroup(c *gin.Context) {
+	group, exists := s.services.Correlation.GetGroup(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+func (s *Server) removeCorrelationGroup(c *gin.Context) {
+	if err := s.services.Correlation.RemoveGroup(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) resetCorrelationGroups(c *gin.Context) {
+	removed := s.services.Correlation.ResetGroups()
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
+func (s *Server) listCorrelationRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rules": s.services.Correlation.ListRules()})
+}
+
+// addCorrelationRule adds a rule, or replaces the rule with the same ID.
+func (s *Server) addCorrelationRule(c *gin.Context) {
+	var rule alert.CorrelationRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.services.Correlation.AddRule(rule); err != nil {
+		if !renderValidation(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// removeCorrelationRule deletes a rule and the groups it formed.
+func (s *Server) removeCorrelationRule(c *gin.Context) {
+	removed, err := s.services.Correlation.RemoveRule(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed_groups": removed})
+}
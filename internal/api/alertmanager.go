@@ -0,0 +1,51 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"api-watchtower/internal/alert"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receiveAlertmanager takes in a Prometheus Alertmanager webhook (version 4),
+// so Alertmanager alerts are correlated and notified alongside this
+// system's own. Alertmanager should be configured to send the token as
+// bearer credentials.
+func (s *Server) receiveAlertmanager(c *gin.Context) {
+	if err := verifyBearerToken(s.cfg.Alertmanager.BearerToken, c.GetHeader("Authorization")); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var webhook alert.AlertmanagerWebhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := s.services.Alerts.ReceiveAlertmanager(c.Request.Context(), &webhook)
+	if renderValidation(c, err) {
+		return
+	}
+	if err != nil {
+		// Alertmanager retries on 5xx
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func verifyBearerToken(token, header string) error {
+	if token == "" {
+		return fmt.Errorf("alertmanager bearer token is not configured")
+	}
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		return fmt.Errorf("invalid bearer token")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"api-watchtower/internal/alert"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) requireAlerts(c *gin.Context) {
+	if s.services.Alerts == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "alerting is not configured"})
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) listAlerts(c *gin.Context) {
+	alerts, err := s.services.Alerts.GetActiveAlerts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	render(c, http.StatusOK, alertList{Alerts: alerts})
+}
+
+func (s *Server) listAlertComments(c *gin.Context) {
+	comments, err := s.services.Alerts.GetComments(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, alert.ErrAlertNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comments": comments})
+}
+
+func (s *Server) addAlertComment(c *gin.Context) {
+	var req struct {
+		Author string `json:"author" binding:"required"`
+		Text   string `json:"text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := s.services.Alerts.AddComment(c.Request.Context(), c.Param("id"), req.Author, req.Text)
+	if err != nil {
+		switch {
+		case errors.Is(err, alert.ErrAlertNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case !renderValidation(c, err):
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// getAlertStorm reports whether the global alert cap is suppressing an
+// alert storm, and how many alerts it has suppressed.
+func (s *Server) getAlertStorm(c *gin.Context) {
+	c.JSON(http.StatusOK, s.services.Alerts.StormStatus())
+}
+
+type bulkAlertRequest struct {
+	Actor     string `json:"actor" binding:"required"`
+	Source    string `json:"source"`
+	Type      string `json:"type"`
+	Severity  string `json:"severity"`
+	OlderThan string `json:"older_than"`
+}
+
+func (r *bulkAlertRequest) filter() (alert.AlertFilter, error) {
+	filter := alert.AlertFilter{Source: r.Source, Type: r.Type, Severity: r.Severity}
+	if r.OlderThan != "" {
+		d, err := time.ParseDuration(r.OlderThan)
+		if err != nil || d <= 0 {
+			return filter, fmt.Errorf("older_than must be a positive duration, got %q", r.OlderThan)
+		}
+		filter.OlderThan = d
+	}
+	return filter, nil
+}
+
+func (s *Server) bulkResolveAlerts(c *gin.Context) {
+	s.bulkAlertAction(c, s.services.Alerts.BulkResolve)
+}
+
+func (s *Server) bulkAcknowledgeAlerts(c *gin.Context) {
+	s.bulkAlertAction(c, s.services.Alerts.BulkAcknowledge)
+}
+
+func (s *Server) bulkAlertAction(c *gin.Context, action func(context.Context, alert.AlertFilter, string) (*alert.BulkResult, error)) {
+	var req bulkAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := req.filter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := action(c.Request.Context(), filter, req.Actor)
+	if errors.Is(err, alert.ErrEmptyFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
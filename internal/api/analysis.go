@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"api-watchtower/internal/ai"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) requireAnalyzer(c *gin.Context) {
+	if s.services.Analyzer == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "AI analysis is not configured"})
+		return
+	}
+	c.Next()
+}
+
+// getAnomalies lists detected anomalies, or returns a single analysis with
+// its explanation when analysis_id is given.
+func (s *Server) getAnomalies(c *gin.Context) {
+	if id := c.Query("analysis_id"); id != "" {
+		analysis, err := s.services.Analyzer.GetAnalysis(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if analysis == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "analysis not found"})
+			return
+		}
+		render(c, http.StatusOK, analysis)
+		return
+	}
+
+	start, end, err := timeRange(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, offset, err := pagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	anomalies, err := s.services.Analyzer.GetAnomalies(c.Request.Context(), ai.AnalysisQuery{
+		Status:    c.Query("status"),
+		StartTime: start,
+		EndTime:   end,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	render(c, http.StatusOK, anomalyList{Anomalies: anomalies})
+}
+
+// getThresholds shows, per application/service group, the limits the
+// analyzer currently applies. key narrows it to one "application:service"
+// group.
+func (s *Server) getThresholds(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"thresholds": s.services.Analyzer.Thresholds(c.Query("key"))})
+}
+
+const (
+	defaultTopAnomalies = 10
+	maxTopAnomalies     = 100
+)
+
+// getTopAnomalies ranks the ongoing anomalies across all groups by
+// magnitude, severity and recency, one per group. limit defaults to 10.
+func (s *Server) getTopAnomalies(c *gin.Context) {
+	limit := defaultTopAnomalies
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTopAnomalies {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxTopAnomalies)})
+			return
+		}
+		limit = n
+	}
+
+	c.JSON(http.StatusOK, gin.H{"anomalies": s.services.Analyzer.TopAnomalies(limit)})
+}
+
+// getErrorClusters lists recurring error patterns, currently recurring ones
+// first. key narrows it to one "application:service" group. method=similarity
+// clusters the recent error logs by message similarity instead, largest
+// cluster first.
+func (s *Server) getErrorClusters(c *gin.Context) {
+	limit, _, err := pagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.Query("method") {
+	case "", "pattern":
+		c.JSON(http.StatusOK, gin.H{"clusters": s.services.Analyzer.ErrorClusters(c.Query("key"), limit)})
+	case "similarity":
+		clusters, err := s.services.Analyzer.SimilarErrors(c.Request.Context(), c.Query("key"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"clusters": clusters})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be pattern or similarity"})
+	}
+}
+
+// patchAnalysisStatus resolves or reopens an analysis by hand.
+func (s *Server) patchAnalysisStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	analysis, err := s.services.Analyzer.SetStatus(c.Request.Context(), c.Param("id"), req.Status)
+	switch {
+	case errors.Is(err, ai.ErrAnalysisNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		if !renderValidation(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	default:
+		render(c, http.StatusOK, analysis)
+	}
+}
+
+// postAnalysisFeedback records an analyst's verdict on an analysis:
+// confirmed for a true positive, dismissed for a false positive.
+func (s *Server) postAnalysisFeedback(c *gin.Context) {
+	var req struct {
+		Verdict string `json:"verdict" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	analysis, err := s.services.Analyzer.RecordFeedback(c.Request.Context(), c.Param("id"), req.Verdict)
+	switch {
+	case errors.Is(err, ai.ErrAnalysisNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		if !renderValidation(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	default:
+		render(c, http.StatusOK, analysis)
+	}
+}
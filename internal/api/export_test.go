@@ -0,0 +1,34 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEmptyCSVExportHasHeader(t *testing.T) {
+	srv := limitedServer(t, time.Second, func(c *gin.Context) {
+		newExportWriter(c, formatCSV, "logs", logExportHeader)
+	})
+
+	resp, err := http.Get(srv.URL + "/test")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+
+	if want := strings.Join(logExportHeader, ",") + "\n"; string(body) != want {
+		t.Errorf("got body %q, want the header row %q", body, want)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("got Content-Type %q, want CSV", got)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeLimits overrides the server-wide body cap or timeout for one route.
+// Zero fields keep the server-wide value.
+type routeLimits struct {
+	maxBodyBytes int64
+	timeout      time.Duration
+	// streaming routes run until the client disconnects, with no timeout
+	streaming bool
+}
+
+// exportTimeout lets streamed exports run past the normal request timeout.
+const exportTimeout = 10 * time.Minute
+
+// routeOverrides returns the per-route limits, keyed by method and route
+// path.
+func (s *Server) routeOverrides() map[string]routeLimits {
+	return map[string]routeLimits{
+		"POST /api/v1/app-logs":                                     {maxBodyBytes: s.cfg.Server.IngestMaxBodyBytes},
+		"POST /api/v1/app-logs/stream":                              {maxBodyBytes: s.cfg.Server.IngestMaxBodyBytes, timeout: exportTimeout},
+		"GET /api/v1/app-logs":                                      {timeout: exportTimeout},
+		"GET /api/v1/external-monitoring/targets/:targetId/results": {timeout: exportTimeout},
+		"GET /api/v1/external-monitoring/results/stream":            {streaming: true},
+	}
+}
+
+func (s *Server) limitsFor(c *gin.Context) routeLimits {
+	limits := routeLimits{
+		maxBodyBytes: s.cfg.Server.MaxBodyBytes,
+		timeout:      s.cfg.Server.RequestTimeout,
+	}
+	if override, ok := s.limits[c.Request.Method+" "+c.FullPath()]; ok {
+		if override.maxBodyBytes > 0 {
+			limits.maxBodyBytes = override.maxBodyBytes
+		}
+		if override.timeout > 0 {
+			limits.timeout = override.timeout
+		}
+		if override.streaming {
+			limits.timeout = 0
+		}
+	}
+	return limits
+}
+
+// limitRequests caps the request body and bounds the handler's run time.
+// Bodies declared too large are refused with 413 up front; bodies that turn
+// out too large fail when read. A handler still running at the deadline
+// sees its context cancelled, and if it hasn't started its response the
+// client gets a 504 right away; whatever the handler writes afterwards is
+// discarded. The handler runs on its own goroutine, which is waited for
+// before the request completes, since the gin.Context can't outlive it.
+func (s *Server) limitRequests(c *gin.Context) {
+	limits := s.limitsFor(c)
+
+	if c.Request.ContentLength > limits.maxBodyBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.maxBodyBytes)
+
+	if limits.timeout <= 0 {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), limits.timeout)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+
+	tw := &timeoutWriter{ResponseWriter: c.Writer, header: c.Writer.Header().Clone()}
+	c.Writer = tw
+	done := make(chan struct{})
+	var panicked any
+	go func() {
+		defer func() {
+			panicked = recover()
+			close(done)
+		}()
+		c.Next()
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		tw.timeout()
+	}
+	<-done
+
+	// A response without a body is committed by gin on the underlying
+	// writer, so the handler's headers have to be there by now
+	tw.finish()
+	c.Writer = tw.ResponseWriter
+	if panicked != nil {
+		// Re-raised here for the recovery middleware
+		panic(panicked)
+	}
+}
+
+// timeoutResponse is the body of a 504 written by timeoutWriter.
+var timeoutResponse = []byte(`{"error":"request timed out"}`)
+
+// timeoutWriter passes a handler's response through until timeout is
+// called. If the handler hasn't started its response by then, timeout
+// sends a 504 and later writes fail with http.ErrHandlerTimeout. Headers
+// are kept apart until the response starts, so the handler can't change
+// them underneath the 504.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// sendHeader copies the handler's headers to the response until its
+// header has been written. gin sets some headers, such as a render's
+// Content-Type, after WriteHeader, so they are copied again on every call.
+// Must be called with w.mu held.
+func (w *timeoutWriter) sendHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.sendHeader()
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// finish copies the headers of a handler that has returned, unless the
+// 504 went out instead.
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.sendHeader()
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.sendHeader()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.sendHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.sendHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.sendHeader()
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
+
+// timeout sends the 504 unless the handler has started its response. The
+// response has a length and is flushed, so the client has all of it while
+// the handler is still winding down.
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.ResponseWriter.Written() {
+		return
+	}
+	w.timedOut = true
+
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(timeoutResponse)))
+	h.Set("Connection", "close")
+	w.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	w.ResponseWriter.Write(timeoutResponse)
+	w.ResponseWriter.Flush()
+}
+
+// bodyTooLarge reports whether err came from reading past the body cap.
+func bodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
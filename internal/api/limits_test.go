@@ -0,0 +1,119 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedServer serves handler at /test behind limitRequests with the
+// given request timeout.
+func limitedServer(t *testing.T, timeout time.Duration, handler gin.HandlerFunc) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := &Server{cfg: &config.Config{Server: config.ServerConfig{MaxBodyBytes: 1 << 20, RequestTimeout: timeout}}}
+	router := gin.New()
+	router.Use(gin.RecoveryWithWriter(io.Discard), s.limitRequests)
+	router.GET("/test", handler)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLimitRequestsTimesOutUncooperativeHandler(t *testing.T) {
+	release := make(chan struct{})
+	srv := limitedServer(t, 20*time.Millisecond, func(c *gin.Context) {
+		// Ignores the request context
+		<-release
+		c.Header("X-Late", "true")
+		c.JSON(http.StatusOK, gin.H{"status": "late"})
+	})
+	defer close(release)
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/test")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("got the response after %s, want it at the deadline", elapsed)
+	}
+	if resp.StatusCode != http.StatusGatewayTimeout || string(body) != string(timeoutResponse) {
+		t.Errorf("got %d %s, want 504 %s", resp.StatusCode, body, timeoutResponse)
+	}
+	if resp.Header.Get("X-Late") != "" {
+		t.Error("504 carries a header the handler set after the deadline")
+	}
+}
+
+func TestLimitRequestsPassesResponseThrough(t *testing.T) {
+	srv := limitedServer(t, time.Second, func(c *gin.Context) {
+		c.Header("X-Handled", "true")
+		c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+	})
+
+	resp, err := http.Get(srv.URL + "/test")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || string(body) != `{"status":"ok"}` {
+		t.Errorf("got %d %s, want 201 {\"status\":\"ok\"}", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Handled") != "true" || resp.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("got headers %v, want the handler's", resp.Header)
+	}
+}
+
+func TestLimitRequestsKeepsHeadersWithoutBody(t *testing.T) {
+	for name, handler := range map[string]gin.HandlerFunc{
+		"status only": func(c *gin.Context) {
+			c.Header("Content-Disposition", `attachment; filename="empty.csv"`)
+			c.Status(http.StatusNoContent)
+		},
+		"header committed": func(c *gin.Context) {
+			c.Header("Content-Disposition", `attachment; filename="empty.csv"`)
+			c.Status(http.StatusNoContent)
+			c.Writer.WriteHeaderNow()
+		},
+	} {
+		srv := limitedServer(t, time.Second, handler)
+		resp, err := http.Get(srv.URL + "/test")
+		if err != nil {
+			t.Fatalf("%s: GET: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Content-Disposition") == "" {
+			t.Errorf("%s: got %d with headers %v, want 204 with the handler's", name, resp.StatusCode, resp.Header)
+		}
+	}
+}
+
+func TestLimitRequestsRecoversHandlerPanic(t *testing.T) {
+	srv := limitedServer(t, time.Second, func(c *gin.Context) {
+		panic("handler bug")
+	})
+
+	resp, err := http.Get(srv.URL + "/test")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got %d for a panicking handler, want 500", resp.StatusCode)
+	}
+}
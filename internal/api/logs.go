@@ -0,0 +1,218 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/db"
+	applog "api-watchtower/internal/log"
+
+	"github.com/gin-gonic/gin"
+)
+
+var logExportHeader = []string{
+	"id", "event_id", "timestamp", "application_id", "service_name", "severity",
+	"message", "instance_id", "trace_id", "user_id", "source",
+}
+
+func (s *Server) requireIngester(c *gin.Context) {
+	if s.services.Ingester == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "log storage is not configured"})
+		return
+	}
+	c.Next()
+}
+
+// ingestLogs accepts a single JSON log or plain-text line, or an
+// ApplicationLog protobuf message, optionally gzip-compressed, sent as
+// application/x-protobuf. Invalid
+// logs get a 400 listing each offending field, and logs shed by a full buffer a 429
+// with Retry-After.
+func (s *Server) ingestLogs(c *gin.Context) {
+	body, err := c.GetRawData()
+	if bodyTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
+	if c.ContentType() == mimeProtobuf {
+		err = s.services.Ingester.IngestProto(c.Request.Context(), body)
+	} else {
+		err = s.services.Ingester.IngestLog(c.Request.Context(), body)
+	}
+	switch {
+	case err == nil:
+		c.Status(http.StatusAccepted)
+	case renderValidation(c, err):
+	case errors.Is(err, applog.ErrLogTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, applog.ErrBufferFull):
+		retryAfter := int(math.Ceil(s.services.Ingester.RetryAfter().Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// streamLogs accepts a stream of length-delimited ApplicationLog protobuf
+// messages, optionally gzip-compressed, and reports how many were
+// accepted, invalid or rejected by a full buffer. Rejected logs can be
+// resent after Retry-After; a stream none of whose logs got in is a 429.
+func (s *Server) streamLogs(c *gin.Context) {
+	result, err := s.services.Ingester.IngestProtoStream(c.Request.Context(), c.Request.Body)
+	switch {
+	case bodyTooLarge(err):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large", "result": result})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "result": result})
+		return
+	}
+
+	code := http.StatusAccepted
+	if result.Rejected > 0 {
+		retryAfter := int(math.Ceil(s.services.Ingester.RetryAfter().Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		if result.Accepted == 0 {
+			code = http.StatusTooManyRequests
+		}
+	}
+	c.JSON(code, result)
+}
+
+// queryLogs returns logs as JSON, or streams them as CSV or JSON lines when
+// format=csv or format=ndjson is given. Exports use the same filters but
+// require a bounded time range.
+func (s *Server) queryLogs(c *gin.Context) {
+	format, err := exportFormat(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, end, err := timeRange(c, format != formatJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, offset, err := pagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := applog.QueryOptions{
+		ApplicationID: c.Query("application_id"),
+		ServiceName:   c.Query("service_name"),
+		Severity:      c.Query("severity"),
+		StartTime:     start,
+		EndTime:       end,
+		Limit:         limit,
+		Offset:        offset,
+
+		PayloadFilters: payloadFilters(c),
+	}
+	// Checked up front so a bad filter fails an export before its headers
+	if err := s.services.Ingester.ValidateQuery(opts); err != nil {
+		renderValidation(c, err)
+		return
+	}
+
+	if format == formatJSON {
+		result, err := s.services.Ingester.QueryLogs(c.Request.Context(), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		render(c, http.StatusOK, logList{
+			Logs:       result.Logs,
+			TotalCount: result.TotalCount,
+			HasMore:    result.HasMore,
+		})
+		return
+	}
+
+	w := newExportWriter(c, format, "logs", logExportHeader)
+	err = s.services.Ingester.StreamLogs(c.Request.Context(), opts, func(l *db.ApplicationLog) error {
+		return w.write(l, []string{
+			l.ID, l.EventID, formatTimestamp(l.Timestamp), l.ApplicationID, l.ServiceName, l.Severity,
+			l.Message, l.InstanceID, l.TraceID, l.UserID, l.Source,
+		})
+	})
+	if err != nil {
+		// Headers are already sent, so the error can only be logged
+		log.Printf("Log export failed: %v", err)
+	}
+}
+
+// payloadFilters reads the payload.<path> query parameters, e.g.
+// payload.http.status=500 or payload.latency_ms[gte]=250, with the operator
+// in brackets defaulting to eq. They are sorted so identical queries
+// coalesce whatever the parameter order.
+func payloadFilters(c *gin.Context) []applog.PayloadFilter {
+	var filters []applog.PayloadFilter
+	for param, values := range c.Request.URL.Query() {
+		path, ok := strings.CutPrefix(param, "payload.")
+		if !ok {
+			continue
+		}
+		op := applog.FilterEq
+		if base, suffix, ok := strings.Cut(path, "["); ok && strings.HasSuffix(suffix, "]") {
+			path, op = base, strings.TrimSuffix(suffix, "]")
+		}
+		for _, v := range values {
+			filters = append(filters, applog.PayloadFilter{Path: path, Op: op, Value: v})
+		}
+	}
+	sort.Slice(filters, func(i, j int) bool {
+		a, b := filters[i], filters[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Op != b.Op {
+			return a.Op < b.Op
+		}
+		return a.Value < b.Value
+	})
+	return filters
+}
+
+// queryLogStats returns pre-aggregated per-minute log counts. Without a
+// start it covers the last hour.
+func (s *Server) queryLogStats(c *gin.Context) {
+	start, end, err := timeRange(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if start.IsZero() {
+		start = time.Now().Add(-time.Hour)
+	}
+
+	stats, err := s.services.Ingester.QueryLogStats(c.Request.Context(), applog.LogStatsQuery{
+		ApplicationID: c.Query("application_id"),
+		ServiceName:   c.Query("service_name"),
+		Severity:      c.Query("severity"),
+		StartTime:     start,
+		EndTime:       end,
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"stats": stats})
+	case errors.Is(err, applog.ErrStatsDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"api-watchtower/internal/db"
+	"api-watchtower/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+var resultExportHeader = []string{
+	"id", "target_id", "timestamp", "status_code", "response_time", "success", "error",
+	"result_severity",
+}
+
+func (s *Server) requireMonitoring(c *gin.Context) {
+	if s.services.Monitoring == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "monitoring is not configured"})
+		return
+	}
+	c.Next()
+}
+
+// getMonitoringResults returns a target's results as JSON, or streams them
+// as CSV or JSON lines when format=csv or format=ndjson is given.
+func (s *Server) getMonitoringResults(c *gin.Context) {
+	format, err := exportFormat(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, end, err := timeRange(c, format != formatJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, offset, err := pagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := monitoring.ResultQuery{
+		TargetID:  c.Param("targetId"),
+		StartTime: start,
+		EndTime:   end,
+		Limit:     limit,
+		Offset:    offset,
+	}
+
+	if format == formatJSON {
+		results, err := s.services.Monitoring.GetResults(c.Request.Context(), query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		render(c, http.StatusOK, resultList{Results: results})
+		return
+	}
+
+	w := newExportWriter(c, format, "results-"+query.TargetID, resultExportHeader)
+	err = s.services.Monitoring.StreamResults(c.Request.Context(), query, func(r *db.MonitoringResult) error {
+		return w.write(r, []string{
+			r.ID, r.TargetID, formatTimestamp(r.Timestamp), strconv.Itoa(r.StatusCode),
+			strconv.FormatFloat(r.ResponseTime, 'f', -1, 64), strconv.FormatBool(r.Success), r.Error,
+			r.ResultSeverity,
+		})
+	})
+	if err != nil {
+		// Headers are already sent, so the error can only be logged
+		log.Printf("Result export failed: %v", err)
+	}
+}
+
+// validateMonitoringTarget runs one check of the posted target without
+// saving it, so URL, auth and assertion mistakes show up before the target
+// is scheduled.
+func (s *Server) validateMonitoringTarget(c *gin.Context) {
+	var target db.MonitoringTarget
+	if err := c.ShouldBindJSON(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := s.services.Monitoring.ValidateTarget(&target)
+	if err != nil {
+		if !renderValidation(c, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// The captured body need not be JSON, so it is returned as a string
+	c.JSON(http.StatusOK, struct {
+		*db.MonitoringResult
+		ResponseBody string `json:"response_body"`
+	}{result, string(result.ResponseBody)})
+}
+
+const (
+	defaultHistoryBuckets = 60
+	maxHistoryBuckets     = 500
+	defaultHistoryWindow  = 24 * time.Hour
+	maxHistoryWindow      = 30 * 24 * time.Hour
+)
+
+// getMonitoringHistory returns a target's uptime and latency in evenly
+// spaced buckets for sparklines.
+func (s *Server) getMonitoringHistory(c *gin.Context) {
+	buckets := defaultHistoryBuckets
+	if v := c.Query("buckets"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryBuckets {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("buckets must be between 1 and %d", maxHistoryBuckets)})
+			return
+		}
+		buckets = n
+	}
+
+	window := defaultHistoryWindow
+	if v := c.Query("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxHistoryWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("window must be a duration up to %s", maxHistoryWindow)})
+			return
+		}
+		window = d
+	}
+	if window < time.Duration(buckets)*time.Second {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "buckets must be at least one second wide"})
+		return
+	}
+
+	history, err := s.services.Monitoring.History(c.Request.Context(), c.Param("targetId"), time.Now(), window, buckets)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"window":  window.String(),
+		"buckets": history,
+	})
+}
+
+// getMonitoringSummary returns a target's latency percentiles. Without a
+// time range they come from the target's running digest; with start (and
+// optionally end) they are computed exactly from stored results.
+func (s *Server) getMonitoringSummary(c *gin.Context) {
+	targetID := c.Param("targetId")
+
+	if c.Query("start") == "" && c.Query("end") == "" {
+		summary, err := s.services.Monitoring.Summary(c.Request.Context(), targetID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+
+	start, end, err := timeRange(c, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	summary, err := s.services.Monitoring.ExactSummary(c.Request.Context(), targetID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// getMonitoringMetric returns the values of a metric extracted from a
+// target's responses over the window, with anomalies flagged.
+func (s *Server) getMonitoringMetric(c *gin.Context) {
+	window := defaultHistoryWindow
+	if v := c.Query("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxHistoryWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("window must be a duration up to %s", maxHistoryWindow)})
+			return
+		}
+		window = d
+	}
+
+	end := time.Now()
+	series, err := s.services.Monitoring.MetricSeries(c.Request.Context(), c.Param("targetId"), c.Param("name"), end.Add(-window), end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"metric": c.Param("name"),
+		"window": window.String(),
+		"points": series,
+	})
+}
+
+// listMonitoringTargets returns the registered targets with whether each is
+// paused.
+func (s *Server) listMonitoringTargets(c *gin.Context) {
+	targets := s.services.Monitoring.Targets()
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ID < targets[j].ID })
+	c.JSON(http.StatusOK, gin.H{"targets": targets})
+}
+
+// pauseMonitoringTarget stops a target's checks. The optional body sets when
+// they resume, either at resume_at or after duration.
+func (s *Server) pauseMonitoringTarget(c *gin.Context) {
+	var req struct {
+		ResumeAt *time.Time `json:"resume_at"`
+		Duration string     `json:"duration"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var resumeAt time.Time
+	switch {
+	case req.ResumeAt != nil && req.Duration != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set resume_at or duration, not both"})
+		return
+	case req.ResumeAt != nil:
+		if !req.ResumeAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resume_at must be in the future"})
+			return
+		}
+		resumeAt = *req.ResumeAt
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("duration must be a positive duration, got %q", req.Duration)})
+			return
+		}
+		resumeAt = time.Now().Add(d)
+	}
+
+	if err := s.services.Monitoring.PauseTargetUntil(c.Param("targetId"), resumeAt); err != nil {
+		renderTargetError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) resumeMonitoringTarget(c *gin.Context) {
+	if err := s.services.Monitoring.ResumeTarget(c.Param("targetId")); err != nil {
+		renderTargetError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func renderTargetError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, monitoring.ErrTargetNotFound) || errors.Is(err, monitoring.ErrNoSLO) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+const defaultHealthWindow = time.Hour
+
+// healthWindow parses the window query parameter for health scores.
+func healthWindow(c *gin.Context) (time.Duration, error) {
+	v := c.Query("window")
+	if v == "" {
+		return defaultHealthWindow, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 || d > maxHistoryWindow {
+		return 0, fmt.Errorf("window must be a duration up to %s", maxHistoryWindow)
+	}
+	return d, nil
+}
+
+// getMonitoringHealth returns a target's 0-100 health score over the window
+// (default 1h) with the components it was computed from.
+func (s *Server) getMonitoringHealth(c *gin.Context) {
+	window, err := healthWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	health, err := s.services.Monitoring.TargetHealthScore(c.Request.Context(), c.Param("targetId"), window)
+	if err != nil {
+		renderTargetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, health)
+}
+
+// getMonitoringDashboard lists every target with whether it is paused and
+// its health over the window (default 1h).
+func (s *Server) getMonitoringDashboard(c *gin.Context) {
+	window, err := healthWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	type dashboardTarget struct {
+		db.MonitoringTarget
+		Health *monitoring.HealthScore `json:"health"`
+	}
+
+	targets := s.services.Monitoring.Targets()
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ID < targets[j].ID })
+	entries := make([]dashboardTarget, 0, len(targets))
+	for _, target := range targets {
+		health, err := s.services.Monitoring.TargetHealthScore(c.Request.Context(), target.ID, window)
+		if errors.Is(err, monitoring.ErrTargetNotFound) {
+			// Removed since Targets was called
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		entries = append(entries, dashboardTarget{MonitoringTarget: target, Health: health})
+	}
+	c.JSON(http.StatusOK, gin.H{"targets": entries})
+}
+
+// getMonitoringSLO returns a target's remaining error budget and burn rates.
+func (s *Server) getMonitoringSLO(c *gin.Context) {
+	status, err := s.services.Monitoring.SLOStatus(c.Request.Context(), c.Param("targetId"), time.Now())
+	if err != nil {
+		renderTargetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"api-watchtower/internal/alert"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) requireNotifications(c *gin.Context) {
+	if s.services.Notifications == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "notifications are not configured"})
+		return
+	}
+	c.Next()
+}
+
+// testNotification sends a synthetic alert through one channel and reports
+// whether it was delivered. A failed delivery is still a 200; the outcome
+// is in the body.
+func (s *Server) testNotification(c *gin.Context) {
+	var req struct {
+		Channel string `json:"channel" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := s.services.Notifications.SendTest(c.Request.Context(), req.Channel)
+	if errors.Is(err, alert.ErrChannelNotConfigured) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"api-watchtower/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const mimeProtobuf = "application/x-protobuf"
+
+// render writes body as protobuf when the client asks for it in Accept and
+// body supports it, and as JSON otherwise, so handlers stay agnostic of the
+// wire format.
+func render(c *gin.Context, code int, body interface{}) {
+	if msg, ok := body.(db.ProtoMessage); ok && c.NegotiateFormat(binding.MIMEJSON, mimeProtobuf) == mimeProtobuf {
+		c.Data(code, mimeProtobuf, msg.AppendProto(nil))
+		return
+	}
+	c.JSON(code, body)
+}
+
+// renderValidation writes a 400 listing every field error when err is a
+// validation failure, and reports whether it did.
+func renderValidation(c *gin.Context, err error) bool {
+	var errs db.ValidationErrors
+	var single *db.ValidationError
+	switch {
+	case errors.As(err, &errs):
+	case errors.As(err, &single):
+		errs = db.ValidationErrors{single}
+	default:
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": errs})
+	return true
+}
+
+// List responses, encoded as the *List messages in db/models.proto
+
+type logList struct {
+	Logs       []*db.ApplicationLog `json:"logs"`
+	TotalCount int                  `json:"total_count"`
+	HasMore    bool                 `json:"has_more"`
+}
+
+func (l logList) AppendProto(b []byte) []byte {
+	for _, log := range l.Logs {
+		b = db.AppendProtoMessage(b, 1, log)
+	}
+	b = db.AppendProtoInt(b, 2, int64(l.TotalCount))
+	return db.AppendProtoBool(b, 3, l.HasMore)
+}
+
+type resultList struct {
+	Results []*db.MonitoringResult `json:"results"`
+}
+
+func (l resultList) AppendProto(b []byte) []byte {
+	for _, result := range l.Results {
+		b = db.AppendProtoMessage(b, 1, result)
+	}
+	return b
+}
+
+type anomalyList struct {
+	Anomalies []*db.AIAnalysis `json:"anomalies"`
+}
+
+func (l anomalyList) AppendProto(b []byte) []byte {
+	for _, analysis := range l.Anomalies {
+		b = db.AppendProtoMessage(b, 1, analysis)
+	}
+	return b
+}
+
+type alertList struct {
+	Alerts []*db.Alert `json:"alerts"`
+}
+
+func (l alertList) AppendProto(b []byte) []byte {
+	for _, alert := range l.Alerts {
+		b = db.AppendProtoMessage(b, 1, alert)
+	}
+	return b
+}
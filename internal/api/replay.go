@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// replayMaxSkew is how far a signed request timestamp may drift from now
+// before the request is treated as a replay.
+const replayMaxSkew = 5 * time.Minute
+
+var (
+	errStaleRequest    = errors.New("stale request")
+	errReplayedRequest = errors.New("request already processed")
+)
+
+// replayGuard rejects inbound webhook requests that are stale or that repeat
+// a nonce seen within the skew window. It is shared by every inbound
+// handler, so nonces should be prefixed with their source. Nonces only need
+// remembering while their timestamp is still acceptable, so entries expire
+// after twice the skew.
+type replayGuard struct {
+	maxSkew time.Duration
+	seen    map[string]time.Time
+	order   []replayEntry
+	mu      sync.Mutex
+}
+
+type replayEntry struct {
+	nonce  string
+	seenAt time.Time
+}
+
+func newReplayGuard(maxSkew time.Duration) *replayGuard {
+	return &replayGuard{
+		maxSkew: maxSkew,
+		seen:    make(map[string]time.Time),
+	}
+}
+
+// check validates a request signed at signedAt and records its nonce. Call
+// it only after the signature has been verified, so forged requests can't
+// fill the cache.
+func (g *replayGuard) check(nonce string, signedAt, now time.Time) error {
+	if skew := now.Sub(signedAt); skew > g.maxSkew || skew < -g.maxSkew {
+		return errStaleRequest
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Entries are appended in arrival order, so expiry only ever has to look
+	// at the front of the queue.
+	cutoff := now.Add(-2 * g.maxSkew)
+	expired := 0
+	for _, entry := range g.order {
+		if entry.seenAt.After(cutoff) {
+			break
+		}
+		delete(g.seen, entry.nonce)
+		expired++
+	}
+	g.order = g.order[expired:]
+
+	if _, exists := g.seen[nonce]; exists {
+		return errReplayedRequest
+	}
+
+	g.seen[nonce] = now
+	g.order = append(g.order, replayEntry{nonce: nonce, seenAt: now})
+	return nil
+}
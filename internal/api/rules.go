@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"api-watchtower/internal/alert"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) listAlertRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rules": s.services.Alerts.ListRules()})
+}
+
+func (s *Server) getAlertRule(c *gin.Context) {
+	rule, exists := s.services.Alerts.GetRule(c.Param("ruleId"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// createAlertRule adds a rule; a rule with the same ID must not exist.
+func (s *Server) createAlertRule(c *gin.Context) {
+	var rule alert.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.services.Alerts.CreateRule(&rule); err != nil {
+		renderRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, &rule)
+}
+
+// replaceAlertRule replaces a rule with the posted one (PUT).
+func (s *Server) replaceAlertRule(c *gin.Context) {
+	var rule alert.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = c.Param("ruleId")
+
+	if err := s.services.Alerts.UpdateRule(&rule); err != nil {
+		renderRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, &rule)
+}
+
+// patchAlertRule changes only the fields present in the body (PATCH). The
+// result is validated as a whole before it is applied.
+func (s *Server) patchAlertRule(c *gin.Context) {
+	rule, exists := s.services.Alerts.GetRule(c.Param("ruleId"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+
+	// Decoding onto the current rule keeps the fields the body leaves out
+	if err := c.ShouldBindJSON(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = c.Param("ruleId")
+
+	if err := s.services.Alerts.UpdateRule(rule); err != nil {
+		renderRuleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *Server) removeAlertRule(c *gin.Context) {
+	if err := s.services.Alerts.RemoveRule(c.Param("ruleId")); err != nil {
+		renderRuleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func renderRuleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, alert.ErrRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, alert.ErrRuleExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case !renderValidation(c, err):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
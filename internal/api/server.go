@@ -5,41 +5,69 @@ import (
 	"fmt"
 	"net/http"
 
+	"api-watchtower/internal/ai"
+	"api-watchtower/internal/alert"
 	"api-watchtower/internal/config"
+	applog "api-watchtower/internal/log"
+	"api-watchtower/internal/monitoring"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Server struct {
-	cfg    *config.Config
-	router *gin.Engine
-	srv    *http.Server
+	cfg      *config.Config
+	router   *gin.Engine
+	srv      *http.Server
+	services Services
+	// replay guards the inbound webhook endpoints
+	replay *replayGuard
+	// limits holds per-route overrides of the body cap and timeout
+	limits map[string]routeLimits
 }
 
-func NewServer(cfg *config.Config) (*Server, error) {
+// Services holds the components the API handlers delegate to. Routes backed
+// by a nil service respond with 503.
+type Services struct {
+	Alerts        *alert.Manager
+	Correlation   *alert.CorrelationEngine
+	Notifications *alert.NotificationManager
+	Ingester      *applog.Ingester
+	Monitoring    *monitoring.Engine
+	Analyzer      *ai.Analyzer
+}
+
+func NewServer(cfg *config.Config, services Services) (*Server, error) {
 	router := gin.Default()
 
 	// Setup basic middleware
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
 
+	s := &Server{
+		cfg:      cfg,
+		router:   router,
+		services: services,
+		replay:   newReplayGuard(replayMaxSkew),
+	}
+	s.limits = s.routeOverrides()
+
 	// Setup routes
-	setupRoutes(router)
+	s.setupRoutes()
 
 	// Setup Prometheus metrics endpoint
+	if err := prometheus.Register(alert.NewPipelineCollector(services.Notifications, services.Correlation)); err != nil {
+		return nil, fmt.Errorf("failed to register alert pipeline metrics: %v", err)
+	}
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	srv := &http.Server{
+	s.srv = &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
 		Handler: router,
 	}
 
-	return &Server{
-		cfg:    cfg,
-		router: router,
-		srv:    srv,
-	}, nil
+	return s, nil
 }
 
 func (s *Server) Start() error {
@@ -50,48 +78,101 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.srv.Shutdown(ctx)
 }
 
-func setupRoutes(r *gin.Engine) {
+func (s *Server) setupRoutes() {
+	r := s.router
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
 	// API v1 group
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", s.limitRequests)
 	{
 		// External API Monitoring
 		monitoring := v1.Group("/external-monitoring")
 		{
-			monitoring.GET("/targets", listMonitoringTargets)
-			monitoring.GET("/targets/:targetId/results", getMonitoringResults)
-			monitoring.GET("/targets/:targetId/summary", getMonitoringSummary)
-			monitoring.GET("/dashboard", getMonitoringDashboard)
+			monitoring.GET("/targets", s.requireMonitoring, s.listMonitoringTargets)
+			monitoring.POST("/targets/validate", s.requireMonitoring, s.validateMonitoringTarget)
+			monitoring.GET("/targets/:targetId/results", s.requireMonitoring, s.getMonitoringResults)
+			monitoring.GET("/targets/:targetId/history", s.requireMonitoring, s.getMonitoringHistory)
+			monitoring.GET("/targets/:targetId/summary", s.requireMonitoring, s.getMonitoringSummary)
+			monitoring.GET("/targets/:targetId/metrics/:name", s.requireMonitoring, s.getMonitoringMetric)
+			monitoring.POST("/targets/:targetId/pause", s.requireMonitoring, s.pauseMonitoringTarget)
+			monitoring.POST("/targets/:targetId/resume", s.requireMonitoring, s.resumeMonitoringTarget)
+			monitoring.GET("/results/stream", s.requireMonitoring, s.streamMonitoringResults)
+			monitoring.GET("/targets/:targetId/health", s.requireMonitoring, s.getMonitoringHealth)
+			monitoring.GET("/targets/:targetId/slo", s.requireMonitoring, s.getMonitoringSLO)
+			monitoring.GET("/dashboard", s.requireMonitoring, s.getMonitoringDashboard)
 		}
 
 		// Application Logs
 		logs := v1.Group("/app-logs")
 		{
-			logs.POST("", ingestLogs)
-			logs.GET("", queryLogs)
+			logs.POST("", s.requireIngester, s.ingestLogs)
+			logs.POST("/stream", s.requireIngester, s.streamLogs)
+			logs.GET("", s.requireIngester, s.queryLogs)
+			logs.GET("/stats", s.requireIngester, s.queryLogStats)
 		}
 
 		// AI Analysis
 		ai := v1.Group("/ai-analysis")
 		{
-			ai.GET("/anomalies", getAnomalies)
-			ai.GET("/error-clusters", getErrorClusters)
+			ai.GET("/anomalies", s.requireAnalyzer, s.getAnomalies)
+			ai.GET("/error-clusters", s.requireAnalyzer, s.getErrorClusters)
 			ai.GET("/trends", getTrends)
+			ai.GET("/thresholds", s.requireAnalyzer, s.getThresholds)
+			ai.GET("/top-anomalies", s.requireAnalyzer, s.getTopAnomalies)
+			ai.POST("/:id/feedback", s.requireAnalyzer, s.postAnalysisFeedback)
+			ai.PATCH("/:id/status", s.requireAnalyzer, s.patchAnalysisStatus)
+		}
+
+		// Alerts
+		alerts := v1.Group("/alerts", s.requireAlerts)
+		{
+			alerts.GET("", s.listAlerts)
+			alerts.POST("/bulk-resolve", s.bulkResolveAlerts)
+			alerts.POST("/bulk-acknowledge", s.bulkAcknowledgeAlerts)
+			alerts.GET("/storm", s.getAlertStorm)
+			alerts.GET("/rules", s.listAlertRules)
+			alerts.POST("/rules", s.createAlertRule)
+			alerts.GET("/rules/:ruleId", s.getAlertRule)
+			alerts.PUT("/rules/:ruleId", s.replaceAlertRule)
+			alerts.PATCH("/rules/:ruleId", s.patchAlertRule)
+			alerts.DELETE("/rules/:ruleId", s.removeAlertRule)
+			alerts.GET("/:id/comments", s.listAlertComments)
+			alerts.POST("/:id/comments", s.addAlertComment)
+		}
+
+		// Notification channels
+		notifications := v1.Group("/notifications", s.requireNotifications)
+		{
+			notifications.POST("/test", s.testNotification)
+		}
+
+		// Operational overrides
+		admin := v1.Group("/admin")
+		{
+			groups := admin.Group("/correlation/groups", s.requireCorrelation)
+			groups.GET("", s.listCorrelationGroups)
+			groups.DELETE("", s.resetCorrelationGroups)
+			groups.GET("/:id", s.getCorrelationGroup)
+			groups.DELETE("/:id", s.removeCorrelationGroup)
+
+			rules := admin.Group("/correlation/rules", s.requireCorrelation)
+			rules.GET("", s.listCorrelationRules)
+			rules.POST("", s.addCorrelationRule)
+			rules.DELETE("/:id", s.removeCorrelationRule)
+		}
+
+		// Inbound integrations
+		integrations := v1.Group("/integrations")
+		{
+			integrations.POST("/slack/actions", s.requireAlerts, s.handleSlackAction)
+			integrations.POST("/alertmanager", s.requireAlerts, s.receiveAlertmanager)
 		}
 	}
 }
 
 // Route handlers (to be implemented)
-func listMonitoringTargets(c *gin.Context)    { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func getMonitoringResults(c *gin.Context)     { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func getMonitoringSummary(c *gin.Context)     { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func getMonitoringDashboard(c *gin.Context)   { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func ingestLogs(c *gin.Context)               { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func queryLogs(c *gin.Context)                { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func getAnomalies(c *gin.Context)            { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func getErrorClusters(c *gin.Context)        { c.JSON(http.StatusNotImplemented, gin.H{}) }
-func getTrends(c *gin.Context)               { c.JSON(http.StatusNotImplemented, gin.H{}) }
+func getTrends(c *gin.Context) { c.JSON(http.StatusNotImplemented, gin.H{}) }
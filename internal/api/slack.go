@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slackActionTimeout bounds the work done after Slack has been acknowledged.
+const slackActionTimeout = 30 * time.Second
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// handleSlackAction resolves or acknowledges alerts from Slack interactive
+// message buttons. Slack expects an answer within three seconds, so the
+// request is acknowledged right away and the original message is updated
+// through its response_url once the action completes.
+func (s *Server) handleSlackAction(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if bodyTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+
+	signedAt, err := verifySlackSignature(s.cfg.Slack.SigningSecret, c.Request.Header, body)
+	if err == nil {
+		// The signature covers the timestamp and body, so it identifies the
+		// request
+		err = s.replay.check("slack:"+c.GetHeader("X-Slack-Signature"), signedAt, time.Now())
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid form body"})
+		return
+	}
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	actor := "slack:" + interaction.User.Username
+	if interaction.User.Username == "" {
+		actor = "slack:" + interaction.User.ID
+	}
+
+	c.Status(http.StatusOK)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), slackActionTimeout)
+		defer cancel()
+
+		for _, action := range interaction.Actions {
+			text := s.applySlackAction(ctx, action.ActionID, action.Value, actor)
+			if err := respondToSlack(ctx, interaction.ResponseURL, text); err != nil {
+				log.Printf("Failed to update Slack message: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *Server) applySlackAction(ctx context.Context, actionID, alertID, actor string) string {
+	var err error
+	var verb string
+	switch actionID {
+	case "resolve_alert":
+		verb = "resolved"
+		err = s.services.Alerts.ResolveAlert(ctx, alertID, actor)
+	case "acknowledge_alert":
+		verb = "acknowledged"
+		err = s.services.Alerts.AcknowledgeAlert(ctx, alertID, actor)
+	default:
+		return fmt.Sprintf("Unsupported action: %s", actionID)
+	}
+
+	if err != nil {
+		return fmt.Sprintf("Failed to update alert %s: %v", alertID, err)
+	}
+	return fmt.Sprintf("Alert %s %s by %s", alertID, verb, actor)
+}
+
+func respondToSlack(ctx context.Context, responseURL, text string) error {
+	if responseURL == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"replace_original": true,
+		"text":             text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", responseURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack response_url returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// verifySlackSignature checks the v0 request signature Slack computes over
+// the timestamp and raw body with the app's signing secret, and returns the
+// signed timestamp.
+func verifySlackSignature(secret string, header http.Header, body []byte) (time.Time, error) {
+	if secret == "" {
+		return time.Time{}, fmt.Errorf("slack signing secret is not configured")
+	}
+
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return time.Time{}, fmt.Errorf("missing slack signature headers")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid slack timestamp")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return time.Time{}, fmt.Errorf("invalid slack signature")
+	}
+	return time.Unix(ts, 0), nil
+}
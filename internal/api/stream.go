@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"api-watchtower/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamKeepAlive is how often an idle stream sends a comment, so proxies
+// don't close it.
+const streamKeepAlive = 15 * time.Second
+
+// streamMonitoringResults pushes check results to the client as server-sent
+// events as they are recorded, optionally filtered by target_id and by
+// status (success or failure). Response bodies and headers are left out.
+// A client that can't keep up is sent a "dropped" event and disconnected.
+func (s *Server) streamMonitoringResults(c *gin.Context) {
+	targetID := c.Query("target_id")
+	status := c.Query("status")
+	if status != "" && status != "success" && status != "failure" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("status must be success or failure, got %q", status)})
+		return
+	}
+
+	sub := s.services.Monitoring.SubscribeResults(func(r *db.MonitoringResult) bool {
+		if targetID != "" && r.TargetID != targetID {
+			return false
+		}
+		return status == "" || r.Success == (status == "success")
+	})
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok := <-sub.C():
+			if !ok {
+				c.SSEvent("dropped", gin.H{"error": "client fell too far behind"})
+				c.Writer.Flush()
+				return
+			}
+			c.SSEvent("result", result)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package coalesce lets concurrent identical read queries share a single
+// call to storage.
+package coalesce
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds shared calls of a Group without a Timeout.
+const DefaultTimeout = 30 * time.Second
+
+type call[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// Group coalesces calls by key: while a call for a key is in flight, later
+// callers with the same key wait for it and get its result instead of
+// making their own. The zero value is ready to use.
+//
+// Every caller receives the same value, so it must be treated as
+// read-only.
+type Group[T any] struct {
+	// Timeout bounds each shared call. Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which
+// case it waits for that call's result. fn runs with the first caller's
+// context values but not its cancellation, since other callers share the
+// result, and ends with the group's Timeout instead. A caller whose own
+// ctx ends stops waiting with its error. A panic in fn is returned to
+// every caller as an error.
+func (g *Group[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call[T]{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(ctx, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// run makes the shared call for key and hands its result to the callers.
+func (g *Group[T]) run(ctx context.Context, key string, c *call[T], fn func(ctx context.Context) (T, error)) {
+	timeout := g.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+
+	defer func() {
+		if r := recover(); r != nil {
+			var zero T
+			c.val, c.err = zero, fmt.Errorf("coalesced call for %s panicked: %v", key, r)
+		}
+		cancel()
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn(ctx)
+}
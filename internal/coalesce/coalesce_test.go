@@ -0,0 +1,116 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoSharesOneCall(t *testing.T) {
+	var g Group[int]
+	var hits atomic.Int32
+	release := make(chan struct{})
+	query := func(ctx context.Context) (int, error) {
+		hits.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = g.Do(context.Background(), "logs?app=checkout", query)
+		}()
+	}
+	// Let every caller join the call before it returns
+	for hits.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("storage was queried %d times, want 1", got)
+	}
+	for i, v := range results {
+		if v != 42 {
+			t.Errorf("caller %d got %d, want 42", i, v)
+		}
+	}
+}
+
+func TestDoSurvivesLeaderCancel(t *testing.T) {
+	var g Group[int]
+	started := make(chan struct{})
+	release := make(chan struct{})
+	query := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 7, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := g.Do(leaderCtx, "k", query)
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan int, 1)
+	go func() {
+		v, err := g.Do(context.Background(), "k", query)
+		if err != nil {
+			t.Errorf("waiter got %v", err)
+		}
+		waiter <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-leader; err != context.Canceled {
+		t.Errorf("leader got %v, want its own cancellation", err)
+	}
+	close(release)
+	if v := <-waiter; v != 7 {
+		t.Errorf("waiter got %d, want 7", v)
+	}
+}
+
+func TestDoReturnsPanicAsError(t *testing.T) {
+	var g Group[int]
+	_, err := g.Do(context.Background(), "k", func(ctx context.Context) (int, error) {
+		panic("storage driver bug")
+	})
+	if err == nil {
+		t.Fatal("panicking call returned no error")
+	}
+
+	// The key is free again afterwards
+	v, err := g.Do(context.Background(), "k", func(ctx context.Context) (int, error) { return 1, nil })
+	if v != 1 || err != nil {
+		t.Errorf("got %d, %v after the panic, want 1, nil", v, err)
+	}
+}
+
+func TestDoTimesOutSharedCall(t *testing.T) {
+	g := Group[int]{Timeout: 10 * time.Millisecond}
+	_, err := g.Do(context.Background(), "k", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, want the group's timeout", err)
+	}
+}
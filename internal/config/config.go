@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,11 +13,21 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Slack    SlackConfig
+	Secrets  SecretsConfig
+
+	Alertmanager AlertmanagerConfig
 }
 
 type ServerConfig struct {
 	Port int
 	Host string
+	// MaxBodyBytes caps request bodies on API routes; IngestMaxBodyBytes
+	// replaces it on log ingestion
+	MaxBodyBytes       int64
+	IngestMaxBodyBytes int64
+	// RequestTimeout bounds how long an API handler may run
+	RequestTimeout time.Duration
 }
 
 type DatabaseConfig struct {
@@ -26,12 +37,35 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	// IDFormat selects generated record IDs: "uuid" or "ulid"
+	IDFormat string
 }
 
 type JWTConfig struct {
 	Secret string
 }
 
+type SlackConfig struct {
+	// SigningSecret verifies inbound interactive-message requests
+	SigningSecret string
+}
+
+type SecretsConfig struct {
+	// Provider resolves ${secret:NAME} references in monitoring targets:
+	// "env", "file", or empty for none
+	Provider string
+	// EnvPrefix is prepended to NAME to find the env provider's variable
+	EnvPrefix string
+	// Dir holds one file per secret for the file provider
+	Dir string
+}
+
+type AlertmanagerConfig struct {
+	// BearerToken authenticates inbound Alertmanager webhooks, sent with
+	// the receiver's http_config authorization credentials
+	BearerToken string
+}
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if it exists
@@ -41,6 +75,10 @@ func Load() (*Config, error) {
 		Server: ServerConfig{
 			Port: getEnvAsInt("SERVER_PORT", 8080),
 			Host: getEnv("SERVER_HOST", "0.0.0.0"),
+
+			MaxBodyBytes:       int64(getEnvAsInt("SERVER_MAX_BODY_BYTES", 1<<20)),
+			IngestMaxBodyBytes: int64(getEnvAsInt("SERVER_INGEST_MAX_BODY_BYTES", 10<<20)),
+			RequestTimeout:     getEnvAsDuration("SERVER_REQUEST_TIMEOUT", 30*time.Second),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -49,15 +87,39 @@ func Load() (*Config, error) {
 			Password: getEnv("DB_PASSWORD", ""),
 			DBName:   getEnv("DB_NAME", "api_watchtower"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			IDFormat: getEnv("DB_ID_FORMAT", "uuid"),
 		},
 		JWT: JWTConfig{
 			Secret: getEnv("JWT_SECRET", ""),
 		},
+		Slack: SlackConfig{
+			SigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+		},
+		Secrets: SecretsConfig{
+			Provider:  getEnv("SECRETS_PROVIDER", ""),
+			EnvPrefix: getEnv("SECRETS_ENV_PREFIX", "WATCHTOWER_SECRET_"),
+			Dir:       getEnv("SECRETS_DIR", "/run/secrets"),
+		},
+
+		Alertmanager: AlertmanagerConfig{
+			BearerToken: getEnv("ALERTMANAGER_BEARER_TOKEN", ""),
+		},
 	}
 
 	if cfg.JWT.Secret == "" {
 		return nil, fmt.Errorf("JWT_SECRET is required")
 	}
+	if cfg.Server.MaxBodyBytes <= 0 || cfg.Server.IngestMaxBodyBytes <= 0 {
+		return nil, fmt.Errorf("SERVER_MAX_BODY_BYTES and SERVER_INGEST_MAX_BODY_BYTES must be positive")
+	}
+	if cfg.Database.IDFormat != "uuid" && cfg.Database.IDFormat != "ulid" {
+		return nil, fmt.Errorf("DB_ID_FORMAT must be uuid or ulid, got %q", cfg.Database.IDFormat)
+	}
+	switch cfg.Secrets.Provider {
+	case "", "env", "file":
+	default:
+		return nil, fmt.Errorf("SECRETS_PROVIDER must be env, file or empty, got %q", cfg.Secrets.Provider)
+	}
 
 	return cfg, nil
 }
@@ -69,6 +131,15 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
 		if intVal, err := strconv.Atoi(value); err == nil {
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDGenerator produces model IDs at creation time, so records can be
+// referenced before they are stored.
+type IDGenerator interface {
+	NewID() string
+}
+
+var idGenerator atomic.Value
+
+func init() {
+	idGenerator.Store(IDGenerator(UUIDGenerator{}))
+}
+
+// SetIDGenerator replaces the generator used by NewID. The default is
+// UUIDGenerator.
+func SetIDGenerator(g IDGenerator) {
+	idGenerator.Store(g)
+}
+
+// NewID returns a fresh ID from the configured generator.
+func NewID() string {
+	return idGenerator.Load().(IDGenerator).NewID()
+}
+
+// UUIDGenerator generates random (version 4) UUIDs.
+type UUIDGenerator struct{}
+
+func (UUIDGenerator) NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+// ULIDGenerator generates ULIDs: 26 character IDs whose lexical order
+// follows their creation time. IDs from the same millisecond are kept in
+// order by incrementing the random part.
+type ULIDGenerator struct {
+	mu       sync.Mutex
+	lastMs   uint64
+	lastRand [10]byte
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ULIDGenerator) NewID() string {
+	ms := uint64(time.Now().UnixMilli())
+
+	g.mu.Lock()
+	if ms <= g.lastMs {
+		// Same (or an earlier, after a clock step) millisecond: stay
+		// monotonic
+		ms = g.lastMs
+		for i := len(g.lastRand) - 1; i >= 0; i-- {
+			g.lastRand[i]++
+			if g.lastRand[i] != 0 {
+				break
+			}
+		}
+	} else {
+		g.lastMs = ms
+		rand.Read(g.lastRand[:])
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], g.lastRand[:])
+	g.mu.Unlock()
+
+	// Encode the 128 bits as 26 base32 digits, most significant first
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
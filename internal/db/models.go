@@ -2,6 +2,9 @@ package db
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,12 +17,78 @@ type MonitoringTarget struct {
 	Body            json.RawMessage `json:"body,omitempty" db:"body"`
 	Frequency       string          `json:"frequency" db:"frequency"`
 	Timeout         string          `json:"timeout" db:"timeout"`
-	ExpectedStatus  []int          `json:"expected_status" db:"expected_status"`
+	ExpectedStatus  StatusList      `json:"expected_status" db:"expected_status"`
 	ResponseRules   json.RawMessage `json:"response_rules" db:"response_rules"`
 	AuthConfig      json.RawMessage `json:"auth_config" db:"auth_config"`
+	Redaction       json.RawMessage `json:"redaction,omitempty" db:"redaction"`
+	Metrics         json.RawMessage `json:"metrics,omitempty" db:"metrics"`
+	SLO             json.RawMessage `json:"slo,omitempty" db:"slo"`
+	BodyHash        json.RawMessage `json:"body_hash,omitempty" db:"body_hash"`
 	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time       `json:"updated_at" db:"updated_at"`
 	LastCheckStatus string          `json:"last_check_status" db:"last_check_status"`
+
+	// Paused targets are registered but not checked, e.g. during a planned
+	// deployment; ResumeAt, when set, is when checks resume automatically
+	Paused   bool       `json:"paused" db:"paused"`
+	ResumeAt *time.Time `json:"resume_at,omitempty" db:"resume_at"`
+
+	// SuccessExpression, when set, decides whether a check succeeded in
+	// place of the expected status and response rules
+	SuccessExpression json.RawMessage `json:"success_expression,omitempty" db:"success_expression"`
+	// Adaptive, when set, lets the check interval stretch while the target
+	// is healthy and shrink when it fails, within configured bounds
+	Adaptive json.RawMessage `json:"adaptive,omitempty" db:"adaptive"`
+	// DialAddress connects checks to this host or IP, with an optional
+	// port, instead of the URL's host, which is still sent as Host and TLS
+	// SNI; e.g. "10.0.3.17:8443" or "[2001:db8::7]" to reach one backend
+	// behind a load balancer
+	DialAddress string `json:"dial_address,omitempty" db:"dial_address"`
+	// BodyGenerator streams a generated body in place of Body, for
+	// uploads too large to hold in memory: a size and repeated pattern, or
+	// a file under the engine's body directory
+	BodyGenerator json.RawMessage `json:"body_generator,omitempty" db:"body_generator"`
+
+	// StoreOnChange keeps a successful result's headers and body only when
+	// the body or a content-describing header such as Content-Type differs
+	// from the last stored ones; other results record UnchangedSince
+	// instead. Failed results always keep them.
+	StoreOnChange bool `json:"store_on_change,omitempty" db:"store_on_change"`
+}
+
+// Severities of failed monitoring assertions, from least to most severe
+const (
+	ResultSeverityInfo     = "info"
+	ResultSeverityWarning  = "warning"
+	ResultSeverityCritical = "critical"
+)
+
+// ResultSeverityRank orders result severities; unknown ones rank 0.
+func ResultSeverityRank(severity string) int {
+	switch severity {
+	case ResultSeverityInfo:
+		return 1
+	case ResultSeverityWarning:
+		return 2
+	case ResultSeverityCritical:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// BurnWindowKey names a burn rate window in MonitoringResult.BurnRates:
+// time.Duration's format without zero trailing units, e.g. "1h", "1h30m"
+// or "5m".
+func BurnWindowKey(window time.Duration) string {
+	key := window.String()
+	if strings.HasSuffix(key, "m0s") {
+		key = strings.TrimSuffix(key, "0s")
+	}
+	if strings.HasSuffix(key, "h0m") {
+		key = strings.TrimSuffix(key, "0m")
+	}
+	return key
 }
 
 type MonitoringResult struct {
@@ -33,20 +102,65 @@ type MonitoringResult struct {
 	ResponseBody    json.RawMessage `json:"response_body" db:"response_body"`
 	RuleResults     json.RawMessage `json:"rule_results" db:"rule_results"`
 	Timestamp       time.Time       `json:"timestamp" db:"timestamp"`
+	// ExtractedMetrics holds the numeric values pulled from the response
+	// body by the target's metrics config; missing or non-numeric values
+	// are absent rather than zero
+	ExtractedMetrics map[string]float64 `json:"extracted_metrics,omitempty" db:"extracted_metrics"`
+	// ResultSeverity is the worst severity among the failed assertions, or
+	// empty when the check passed
+	ResultSeverity string `json:"result_severity,omitempty" db:"result_severity"`
+	// BurnRates is the target's SLO error budget burn rate over each of its
+	// burn windows as of this check, keyed by BurnWindowKey. Windows with
+	// too few checks are absent.
+	BurnRates map[string]float64 `json:"burn_rates,omitempty" db:"burn_rates"`
+	// BodyHash is the SHA-256 of the normalized response body, set for
+	// targets with body hashing; BodyChanged flags that it differs from the
+	// previous check that got an expected status
+	BodyHash    string `json:"body_hash,omitempty" db:"body_hash"`
+	BodyChanged bool   `json:"body_changed,omitempty" db:"body_changed"`
+	// EffectiveInterval is the seconds until an adaptive target's next
+	// check, as adjusted by this one; zero for fixed schedules
+	EffectiveInterval float64 `json:"effective_interval,omitempty" db:"effective_interval"`
+	// UnchangedSince is the ID of the earlier result holding this one's
+	// headers and body, which were left out because they hadn't changed;
+	// empty when they are stored with the result
+	UnchangedSince string `json:"unchanged_since,omitempty" db:"unchanged_since"`
+	// Encoding records how the stored headers and body are compressed.
+	// Compressed results carry them in CompressedHeaders and CompressedBody
+	// instead of ResponseHeaders and ResponseBody, which must hold JSON.
+	// Storage decodes them on read, so callers always see these empty.
+	Encoding          string `json:"-" db:"encoding"`
+	CompressedHeaders []byte `json:"-" db:"compressed_headers"`
+	CompressedBody    []byte `json:"-" db:"compressed_body"`
 }
 
 type ApplicationLog struct {
-	ID           string          `json:"id" db:"id"`
-	ApplicationID string         `json:"application_id" db:"application_id"`
-	ServiceName  string          `json:"service_name" db:"service_name"`
-	Severity     string          `json:"severity" db:"severity"`
-	Message      string          `json:"message" db:"message"`
-	Timestamp    time.Time       `json:"timestamp" db:"timestamp"`
-	InstanceID   string          `json:"instance_id,omitempty" db:"instance_id"`
-	TraceID      string          `json:"trace_id,omitempty" db:"trace_id"`
-	UserID       string          `json:"user_id,omitempty" db:"user_id"`
-	Source       string          `json:"source,omitempty" db:"source"`
-	Payload      json.RawMessage `json:"payload,omitempty" db:"payload"`
+	ID            string          `json:"id" db:"id"`
+	EventID       string          `json:"event_id,omitempty" db:"event_id"`
+	ApplicationID string          `json:"application_id" db:"application_id"`
+	ServiceName   string          `json:"service_name" db:"service_name"`
+	Severity      string          `json:"severity" db:"severity"`
+	Message       string          `json:"message" db:"message"`
+	Timestamp     time.Time       `json:"timestamp" db:"timestamp"`
+	InstanceID    string          `json:"instance_id,omitempty" db:"instance_id"`
+	TraceID       string          `json:"trace_id,omitempty" db:"trace_id"`
+	UserID        string          `json:"user_id,omitempty" db:"user_id"`
+	Source        string          `json:"source,omitempty" db:"source"`
+	Payload       json.RawMessage `json:"payload,omitempty" db:"payload"`
+
+	// Fields holds the payload values at the ingester's indexed paths.
+	// Storage keeps them in a key/value side-table that payload filters
+	// query, so they are never part of the log itself.
+	Fields []LogField `json:"-" db:"-"`
+}
+
+// LogField is one indexed payload value of a log. Value is its text, which
+// equality filters compare; Number is also set for numeric values, which
+// range filters compare.
+type LogField struct {
+	Path   string   `json:"path" db:"path"`
+	Value  string   `json:"value" db:"value"`
+	Number *float64 `json:"number,omitempty" db:"number"`
 }
 
 type AIAnalysis struct {
@@ -58,20 +172,90 @@ type AIAnalysis struct {
 	RelatedLogs   []string        `json:"related_logs" db:"related_logs"`
 	DetectedAt    time.Time       `json:"detected_at" db:"detected_at"`
 	Status        string          `json:"status" db:"status"`
-	FeedbackScore int            `json:"feedback_score" db:"feedback_score"`
+	FeedbackScore int             `json:"feedback_score" db:"feedback_score"`
+	// Occurrences counts the cycles an ongoing condition was detected in;
+	// LastSeen is the most recent of them
+	Occurrences int       `json:"occurrences" db:"occurrences"`
+	LastSeen    time.Time `json:"last_seen" db:"last_seen"`
 }
 
 type Alert struct {
-	ID          string          `json:"id" db:"id"`
-	Type        string          `json:"type" db:"type"`
-	Source      string          `json:"source" db:"source"`
-	SourceID    string          `json:"source_id" db:"source_id"`
-	Severity    string          `json:"severity" db:"severity"`
-	Message     string          `json:"message" db:"message"`
-	Details     json.RawMessage `json:"details" db:"details"`
-	Status      string          `json:"status" db:"status"`
-	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
-	ResolvedAt  *time.Time      `json:"resolved_at,omitempty" db:"resolved_at"`
-	ResolvedBy  string          `json:"resolved_by,omitempty" db:"resolved_by"`
+	ID           string          `json:"id" db:"id"`
+	Type         string          `json:"type" db:"type"`
+	Source       string          `json:"source" db:"source"`
+	SourceID     string          `json:"source_id" db:"source_id"`
+	Severity     string          `json:"severity" db:"severity"`
+	Message      string          `json:"message" db:"message"`
+	Details      json.RawMessage `json:"details" db:"details"`
+	Status       string          `json:"status" db:"status"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at" db:"updated_at"`
+	ResolvedAt   *time.Time      `json:"resolved_at,omitempty" db:"resolved_at"`
+	ResolvedBy   string          `json:"resolved_by,omitempty" db:"resolved_by"`
+	AckedAt      *time.Time      `json:"acknowledged_at,omitempty" db:"acknowledged_at"`
+	AckedBy      string          `json:"acknowledged_by,omitempty" db:"acknowledged_by"`
+	InhibitedBy  string          `json:"inhibited_by,omitempty" db:"inhibited_by"`
+	CommentCount int             `json:"comment_count" db:"-"`
+
+	// Channels names the notifiers the alert goes to, as set by its rule;
+	// empty means all of them
+	Channels []string `json:"channels,omitempty" db:"channels"`
+}
+
+// AlertComment is an immutable note left on an alert during triage.
+type AlertComment struct {
+	ID        string    `json:"id" db:"id"`
+	AlertID   string    `json:"alert_id" db:"alert_id"`
+	Author    string    `json:"author" db:"author"`
+	Text      string    `json:"text" db:"text"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// LogStat is the number of logs one application service ingested at one
+// severity within one minute.
+type LogStat struct {
+	ApplicationID string    `json:"application_id" db:"application_id"`
+	ServiceName   string    `json:"service_name" db:"service_name"`
+	Severity      string    `json:"severity" db:"severity"`
+	Minute        time.Time `json:"minute" db:"minute"`
+	Count         int64     `json:"count" db:"count"`
+}
+
+// StatusList holds expected status expressions: exact codes ("200"),
+// wildcards ("2xx") or inclusive ranges ("200-204"). In JSON, plain codes may
+// be written as numbers, so existing integer lists keep working.
+type StatusList []string
+
+func (l *StatusList) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	list := make(StatusList, len(raw))
+	for i, item := range raw {
+		var code int
+		if err := json.Unmarshal(item, &code); err == nil {
+			list[i] = strconv.Itoa(code)
+			continue
+		}
+		if err := json.Unmarshal(item, &list[i]); err != nil {
+			return fmt.Errorf("expected status must be a number or string: %s", item)
+		}
+	}
+
+	*l = list
+	return nil
+}
+
+func (l StatusList) MarshalJSON() ([]byte, error) {
+	items := make([]interface{}, len(l))
+	for i, expr := range l {
+		if code, err := strconv.Atoi(expr); err == nil {
+			items[i] = code
+		} else {
+			items[i] = expr
+		}
+	}
+	return json.Marshal(items)
 }
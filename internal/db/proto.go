@@ -0,0 +1,292 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// AppendProto methods encode models as the messages in models.proto. Zero
+// values are omitted, as proto3 does. Logs, which shippers may send as
+// protobuf, also decode with UnmarshalProto.
+
+func (l *ApplicationLog) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, l.ID)
+	b = appendString(b, 2, l.EventID)
+	b = appendString(b, 3, l.ApplicationID)
+	b = appendString(b, 4, l.ServiceName)
+	b = appendString(b, 5, l.Severity)
+	b = appendString(b, 6, l.Message)
+	b = appendTime(b, 7, l.Timestamp)
+	b = appendString(b, 8, l.InstanceID)
+	b = appendString(b, 9, l.TraceID)
+	b = appendString(b, 10, l.UserID)
+	b = appendString(b, 11, l.Source)
+	b = appendBytes(b, 12, l.Payload)
+	return b
+}
+
+func (r *MonitoringResult) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, r.ID)
+	b = appendString(b, 2, r.TargetID)
+	b = appendInt(b, 3, int64(r.StatusCode))
+	b = appendDouble(b, 4, r.ResponseTime)
+	b = appendBool(b, 5, r.Success)
+	b = appendString(b, 6, r.Error)
+	b = appendBytes(b, 7, r.ResponseHeaders)
+	b = appendBytes(b, 8, r.ResponseBody)
+	b = appendBytes(b, 9, r.RuleResults)
+	b = appendTime(b, 10, r.Timestamp)
+	for _, name := range sortedKeys(r.ExtractedMetrics) {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendDouble(entry, 2, r.ExtractedMetrics[name])
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	b = appendString(b, 12, r.ResultSeverity)
+	for _, window := range sortedKeys(r.BurnRates) {
+		var entry []byte
+		entry = appendString(entry, 1, window)
+		entry = appendDouble(entry, 2, r.BurnRates[window])
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	b = appendString(b, 14, r.BodyHash)
+	b = appendBool(b, 15, r.BodyChanged)
+	b = appendDouble(b, 16, r.EffectiveInterval)
+	b = appendString(b, 17, r.UnchangedSince)
+	return b
+}
+
+func (a *AIAnalysis) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, a.ID)
+	b = appendString(b, 2, a.Type)
+	b = appendString(b, 3, a.Severity)
+	b = appendString(b, 4, a.Description)
+	b = appendBytes(b, 5, a.Details)
+	for _, id := range a.RelatedLogs {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	b = appendTime(b, 7, a.DetectedAt)
+	b = appendString(b, 8, a.Status)
+	b = appendInt(b, 9, int64(a.FeedbackScore))
+	b = appendInt(b, 10, int64(a.Occurrences))
+	b = appendTime(b, 11, a.LastSeen)
+	return b
+}
+
+func (a *Alert) AppendProto(b []byte) []byte {
+	b = appendString(b, 1, a.ID)
+	b = appendString(b, 2, a.Type)
+	b = appendString(b, 3, a.Source)
+	b = appendString(b, 4, a.SourceID)
+	b = appendString(b, 5, a.Severity)
+	b = appendString(b, 6, a.Message)
+	b = appendBytes(b, 7, a.Details)
+	b = appendString(b, 8, a.Status)
+	b = appendTime(b, 9, a.CreatedAt)
+	b = appendTime(b, 10, a.UpdatedAt)
+	if a.ResolvedAt != nil {
+		b = appendTime(b, 11, *a.ResolvedAt)
+	}
+	b = appendString(b, 12, a.ResolvedBy)
+	if a.AckedAt != nil {
+		b = appendTime(b, 13, *a.AckedAt)
+	}
+	b = appendString(b, 14, a.AckedBy)
+	b = appendString(b, 15, a.InhibitedBy)
+	b = appendInt(b, 16, int64(a.CommentCount))
+	return b
+}
+
+// ProtoMessage is a model that can be encoded as a protobuf message.
+type ProtoMessage interface {
+	AppendProto(b []byte) []byte
+}
+
+// AppendProtoMessage appends m as a length-delimited embedded message field.
+func AppendProtoMessage(b []byte, num protowire.Number, m ProtoMessage) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.AppendProto(nil))
+}
+
+// AppendProtoInt appends a non-zero int64 field.
+func AppendProtoInt(b []byte, num protowire.Number, v int64) []byte {
+	return appendInt(b, num, v)
+}
+
+// AppendProtoBool appends a true bool field.
+func AppendProtoBool(b []byte, num protowire.Number, v bool) []byte {
+	return appendBool(b, num, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+// sortedKeys orders map fields so encoding is deterministic.
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendTime encodes t as a google.protobuf.Timestamp.
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var ts []byte
+	ts = appendInt(ts, 1, t.Unix())
+	ts = appendInt(ts, 2, int64(t.Nanosecond()))
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
+
+// UnmarshalProto decodes an ApplicationLog message, replacing l's fields.
+// Unknown fields are skipped, as proto3 does; a payload must be JSON.
+func (l *ApplicationLog) UnmarshalProto(b []byte) error {
+	*l = ApplicationLog{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ != protowire.BytesType || num < 1 || num > 12 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch num {
+		case 1:
+			l.ID = string(v)
+		case 2:
+			l.EventID = string(v)
+		case 3:
+			l.ApplicationID = string(v)
+		case 4:
+			l.ServiceName = string(v)
+		case 5:
+			l.Severity = string(v)
+		case 6:
+			l.Message = string(v)
+		case 7:
+			t, err := consumeTime(v)
+			if err != nil {
+				return fmt.Errorf("timestamp: %v", err)
+			}
+			l.Timestamp = t
+		case 8:
+			l.InstanceID = string(v)
+		case 9:
+			l.TraceID = string(v)
+		case 10:
+			l.UserID = string(v)
+		case 11:
+			l.Source = string(v)
+		case 12:
+			if !json.Valid(v) {
+				return errors.New("payload is not valid JSON")
+			}
+			l.Payload = append(json.RawMessage(nil), v...)
+		}
+	}
+	return nil
+}
+
+// consumeTime decodes a google.protobuf.Timestamp message.
+func consumeTime(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ == protowire.VarintType && (num == 1 || num == 2) {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return time.Time{}, protowire.ParseError(n)
+			}
+			b = b[n:]
+			if num == 1 {
+				seconds = int64(v)
+			} else {
+				nanos = int64(int32(v))
+			}
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	if nanos < 0 || nanos >= int64(time.Second) {
+		return time.Time{}, fmt.Errorf("nanos %d out of range", nanos)
+	}
+	if seconds == 0 && nanos == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import "strings"
+
+// Validation error codes
+const (
+	// CodeRequired marks a missing field
+	CodeRequired = "required"
+	// CodeInvalid marks a field that is present but malformed
+	CodeInvalid = "invalid"
+	// CodeUnsupported marks a value outside the set the field accepts
+	CodeUnsupported = "unsupported"
+)
+
+// ValidationError describes one problem with user-supplied input. Field is
+// the JSON path of the offending value, e.g. "response_rules[1].mode"; it
+// is empty when the input as a whole couldn't be parsed.
+type ValidationError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors collects every problem found in one input so callers can
+// report them together instead of stopping at the first.
+type ValidationErrors []*ValidationError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Add records a problem with field.
+func (v *ValidationErrors) Add(field, code, message string) {
+	*v = append(*v, &ValidationError{Field: field, Code: code, Message: message})
+}
+
+// Merge records errs under prefix, which is joined to each field with a
+// dot. Errors that aren't validation errors are recorded as invalid.
+func (v *ValidationErrors) Merge(prefix string, err error) {
+	switch e := err.(type) {
+	case nil:
+	case ValidationErrors:
+		for _, ve := range e {
+			v.Add(joinField(prefix, ve.Field), ve.Code, ve.Message)
+		}
+	case *ValidationError:
+		v.Add(joinField(prefix, e.Field), e.Code, e.Message)
+	default:
+		v.Add(prefix, CodeInvalid, err.Error())
+	}
+}
+
+// Err returns v as an error, or nil when nothing was recorded.
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+func joinField(prefix, field string) string {
+	switch {
+	case prefix == "":
+		return field
+	case field == "":
+		return prefix
+	case strings.HasPrefix(field, "["):
+		return prefix + field
+	default:
+		return prefix + "." + field
+	}
+}
@@ -0,0 +1,90 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// ErrBufferFull is returned for a log that arrives while the buffer holds
+// MaxBuffered logs and there is nothing less severe to drop for it. Callers
+// should back off for RetryAfter and resend.
+var ErrBufferFull = errors.New("log buffer is full")
+
+// defaultMaxBufferedFactor sets MaxBuffered, when unset, as a multiple of
+// BufferSize.
+const defaultMaxBufferedFactor = 10
+
+// severeLevels are the severities kept when the buffer sheds load.
+var severeLevels = map[string]bool{
+	"ERROR":     true,
+	"FATAL":     true,
+	"CRITICAL":  true,
+	"CRIT":      true,
+	"ALERT":     true,
+	"EMERG":     true,
+	"EMERGENCY": true,
+	"PANIC":     true,
+}
+
+func isSevere(log *db.ApplicationLog) bool {
+	return severeLevels[strings.ToUpper(log.Severity)]
+}
+
+// Pressure reports how full the buffer is, from 0 when empty to 1 at
+// MaxBuffered. It is always 0 when the buffer is unbounded.
+func (i *Ingester) Pressure() float64 {
+	if i.maxBuffered <= 0 {
+		return 0
+	}
+	i.mu.Lock()
+	n := len(i.buffer)
+	i.mu.Unlock()
+
+	if n >= i.maxBuffered {
+		return 1
+	}
+	return float64(n) / float64(i.maxBuffered)
+}
+
+// Full reports whether the buffer holds MaxBuffered logs, so that only
+// ERROR and more severe logs are still accepted.
+func (i *Ingester) Full() bool {
+	return i.Pressure() >= 1
+}
+
+// RetryAfter is how long a caller turned away with ErrBufferFull should
+// wait: at most one flush interval, by which time a batch has been written.
+func (i *Ingester) RetryAfter() time.Duration {
+	return i.flushEvery
+}
+
+// admit makes room for log in a full buffer. Logs below ERROR are turned
+// away; an ERROR or worse log replaces the oldest buffered log below ERROR,
+// and is turned away only when there is none. MaxBuffered is a soft cap:
+// concurrent ingests admitted together can briefly exceed it.
+func (i *Ingester) admit(log *db.ApplicationLog) error {
+	if i.maxBuffered <= 0 {
+		return nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.buffer) < i.maxBuffered {
+		return nil
+	}
+
+	if isSevere(log) {
+		for n, buffered := range i.buffer {
+			if !isSevere(buffered) {
+				i.buffer = append(i.buffer[:n], i.buffer[n+1:]...)
+				i.evicted.Add(1)
+				return nil
+			}
+		}
+	}
+	i.rejected.Add(1)
+	return ErrBufferFull
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// dedupCache remembers recently seen event keys for a fixed window so that
+// retried batches from log shippers can be dropped before they are buffered.
+type dedupCache struct {
+	window time.Duration
+	seen   map[string]time.Time
+	order  []dedupEntry
+	mu     sync.Mutex
+}
+
+type dedupEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// seenBefore reports whether key was already recorded within the window and
+// records it otherwise.
+func (c *dedupCache) seenBefore(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Entries are appended in arrival order, so expiry only ever has to look
+	// at the front of the queue.
+	cutoff := now.Add(-c.window)
+	expired := 0
+	for _, entry := range c.order {
+		if entry.seenAt.After(cutoff) {
+			break
+		}
+		// A forgotten key may have been recorded again since
+		if seenAt, ok := c.seen[entry.key]; ok && !seenAt.After(entry.seenAt) {
+			delete(c.seen, entry.key)
+		}
+		expired++
+	}
+	c.order = c.order[expired:]
+
+	if _, exists := c.seen[key]; exists {
+		return true
+	}
+
+	c.seen[key] = now
+	c.order = append(c.order, dedupEntry{key: key, seenAt: now})
+	return false
+}
+
+// forget removes key, so a log that was recorded but then turned away is
+// not treated as a duplicate when it is resent.
+func (c *dedupCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, key)
+}
+
+// eventKey returns the identity used for deduplication. An explicit event ID
+// wins; otherwise the key is a hash of the fields a retry would reproduce.
+func eventKey(log *db.ApplicationLog) string {
+	if log.EventID != "" {
+		return log.ApplicationID + "\x00" + log.EventID
+	}
+
+	h := sha256.New()
+	for _, field := range []string{
+		log.ApplicationID,
+		log.ServiceName,
+		log.Severity,
+		log.Message,
+		log.Timestamp.Format(time.RFC3339Nano),
+		log.InstanceID,
+		log.TraceID,
+		log.UserID,
+		log.Source,
+		string(log.Payload),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
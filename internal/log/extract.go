@@ -0,0 +1,167 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// FieldExtraction selects which embedded key/value formats are promoted from
+// a log's message into its payload.
+type FieldExtraction struct {
+	// Logfmt extracts key=value and key="quoted value" pairs.
+	Logfmt bool
+	// JSON extracts the fields of the first JSON object embedded in the message.
+	JSON bool
+}
+
+// defaultExtractionKey selects the extraction used for applications without
+// an entry of their own.
+const defaultExtractionKey = "*"
+
+func (i *Ingester) extractionFor(applicationID string) (FieldExtraction, bool) {
+	if fe, ok := i.extraction[applicationID]; ok {
+		return fe, true
+	}
+	fe, ok := i.extraction[defaultExtractionKey]
+	return fe, ok
+}
+
+// extractFields promotes key/values found in the message into the payload.
+// Keys already present in the payload are never overwritten.
+func (i *Ingester) extractFields(log *db.ApplicationLog) {
+	fe, ok := i.extractionFor(log.ApplicationID)
+	if !ok || (!fe.Logfmt && !fe.JSON) {
+		return
+	}
+
+	extracted := make(map[string]interface{})
+	if fe.JSON {
+		for k, v := range extractJSONFields(log.Message) {
+			extracted[k] = v
+		}
+	}
+	if fe.Logfmt {
+		for k, v := range extractLogfmtFields(log.Message) {
+			if _, exists := extracted[k]; !exists {
+				extracted[k] = v
+			}
+		}
+	}
+	if len(extracted) == 0 {
+		return
+	}
+
+	payload := make(map[string]interface{})
+	if len(log.Payload) > 0 && string(log.Payload) != "null" {
+		// Only object payloads can take extra fields
+		if err := json.Unmarshal(log.Payload, &payload); err != nil {
+			return
+		}
+	}
+
+	added := false
+	for k, v := range extracted {
+		if _, exists := payload[k]; !exists {
+			payload[k] = v
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	if merged, err := json.Marshal(payload); err == nil {
+		log.Payload = merged
+	}
+}
+
+// extractLogfmtFields parses key=value pairs out of free text. Numeric and
+// boolean values are typed so they compare naturally in filters.
+func extractLogfmtFields(message string) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	s := message
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+
+		// The key is the run of non-space characters right before '='
+		key := s[:eq]
+		if sp := strings.LastIndexAny(key, " \t"); sp >= 0 {
+			key = key[sp+1:]
+		}
+		s = s[eq+1:]
+		if key == "" || strings.ContainsAny(key, `"{}[]`) {
+			continue
+		}
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			unquoted, rest, ok := readQuoted(s)
+			if !ok {
+				break
+			}
+			value, s = unquoted, rest
+			fields[key] = value
+			continue
+		}
+
+		end := strings.IndexAny(s, " \t")
+		if end < 0 {
+			end = len(s)
+		}
+		value, s = s[:end], s[end:]
+		fields[key] = typedValue(value)
+	}
+
+	return fields
+}
+
+func readQuoted(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			unquoted, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return s[1:i], s[i+1:], true
+			}
+			return unquoted, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func typedValue(v string) interface{} {
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		return n
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+	return v
+}
+
+// extractJSONFields returns the fields of the first JSON object embedded in
+// the message, if any.
+func extractJSONFields(message string) map[string]interface{} {
+	start := strings.IndexByte(message, '{')
+	if start < 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(message[start:])))
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil
+	}
+	return fields
+}
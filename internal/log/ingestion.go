@@ -3,47 +3,279 @@ package log
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"api-watchtower/internal/coalesce"
 	"api-watchtower/internal/db"
 )
 
 type Ingester struct {
-	buffer     []*db.ApplicationLog
-	bufferSize int
-	batchSize  int
-	mu         sync.Mutex
-	flushCh    chan struct{}
-	storage    Storage
+	buffer       []*db.ApplicationLog
+	bufferSize   int
+	batchSize    int
+	mu           sync.Mutex
+	flushCh      chan struct{}
+	storage      Storage
+	flushEvery   time.Duration
+	flushTimeout time.Duration
+	dedup        *dedupCache
+	duplicates   atomic.Uint64
+
+	// maxBatchLatency bounds how long a full batch waits for a flush;
+	// latencyTimer is armed while one is waiting
+	maxBatchLatency time.Duration
+	latencyTimer    *time.Timer
+
+	// maxBuffered bounds the buffer while storage catches up; zero means
+	// unbounded
+	maxBuffered int
+	rejected    atomic.Uint64
+	evicted     atomic.Uint64
+
+	maxMessageSize int
+	maxPayloadSize int
+	oversizePolicy OversizePolicy
+	oversized      atomic.Uint64
+
+	// invalidFrames counts protobuf stream frames skipped as undecodable
+	// or invalid
+	invalidFrames atomic.Uint64
+
+	extraction map[string]FieldExtraction
+	parser     ParserConfig
+
+	// indexedPaths are the payload paths kept in the side-table
+	indexedPaths []string
+
+	// sinks forward stored batches
+	sinks []*sinkWorker
+
+	// stats is nil unless per-minute counts are kept
+	stats *statsAggregator
+
+	// queries coalesces identical concurrent QueryLogs calls
+	queries coalesce.Group[*QueryResult]
+}
+
+// IngesterConfig controls buffering, deduplication and size limits in the
+// Ingester.
+type IngesterConfig struct {
+	BufferSize int
+	BatchSize  int
+
+	// FlushInterval is how often buffered logs are flushed regardless of
+	// buffer size. Defaults to DefaultFlushInterval.
+	FlushInterval time.Duration
+	// FlushTimeout bounds each storage write. Defaults to DefaultFlushTimeout.
+	FlushTimeout time.Duration
+	// MaxBatchLatency flushes once BatchSize logs have been buffered for
+	// this long, without waiting for BufferSize or the next FlushInterval.
+	// Lower values favour freshness over larger writes. Zero disables it.
+	MaxBatchLatency time.Duration
+	// MaxBuffered is how many logs may wait in the buffer, e.g. while
+	// storage is slow or down. Beyond it logs below ERROR are rejected with
+	// ErrBufferFull and ERROR or worse logs displace them. Defaults to ten
+	// times BufferSize.
+	MaxBuffered int
+
+	// DedupWindow is how long an event is remembered for duplicate detection.
+	// Logs carrying an event_id are keyed by it; others by a hash of their
+	// fields. A longer window catches retries that arrive late but keeps one
+	// key per ingested log in memory for the whole window, and may drop
+	// genuinely repeated lines that share a timestamp. Zero disables it.
+	DedupWindow time.Duration
+
+	// MaxMessageSize and MaxPayloadSize cap the size in bytes of a single
+	// log's message and payload. Zero means unlimited. When truncating they
+	// must leave room for the truncation markers.
+	MaxMessageSize int
+	MaxPayloadSize int
+	// OversizePolicy selects truncation or rejection of oversized logs.
+	// Defaults to OversizeTruncate.
+	OversizePolicy OversizePolicy
+
+	// FieldExtraction promotes key/values embedded in messages into the
+	// payload, keyed by application ID. The "*" entry applies to
+	// applications without their own.
+	FieldExtraction map[string]FieldExtraction
+
+	// Parser selects JSON or plain-text input and maps alternate field
+	// names onto the log's own.
+	Parser ParserConfig
+
+	// IndexedPaths lists the dotted payload paths, e.g. "http.status",
+	// whose values are copied into each log's Fields at ingestion so
+	// queries can filter on them with QueryOptions.PayloadFilters. Other
+	// paths can't be filtered on.
+	IndexedPaths []string
+
+	// Sinks receive the logs of every batch stored, filtered per sink, in
+	// addition to the primary storage
+	Sinks []SinkConfig
+
+	// StatsStorage, when set, receives per-minute log counts by
+	// application, service and severity, flushed with the logs.
+	StatsStorage StatsStorage
+}
+
+const (
+	DefaultFlushInterval = 5 * time.Second
+	DefaultFlushTimeout  = 10 * time.Second
+)
+
+// IngesterStats reports counters maintained by the Ingester.
+type IngesterStats struct {
+	Duplicates uint64
+	Oversized  uint64
+	// Rejected counts logs turned away with ErrBufferFull; Evicted counts
+	// buffered logs dropped to make room for ERROR or worse ones
+	Rejected uint64
+	Evicted  uint64
+	// InvalidFrames counts IngestProtoStream frames skipped because they
+	// didn't decode, failed validation or were too large
+	InvalidFrames uint64
+	// Sinks holds each sink's counters by name
+	Sinks map[string]SinkStats
 }
 
 type Storage interface {
+	// BatchInsertLogs stores logs along with their Fields, which go to the
+	// key/value side-table that payload filters are resolved against.
 	BatchInsertLogs(ctx context.Context, logs []*db.ApplicationLog) error
+	QueryLogs(ctx context.Context, opts QueryOptions) (*QueryResult, error)
+	// StreamLogs calls fn for every log matching opts, in timestamp order,
+	// without loading the whole result set into memory.
+	StreamLogs(ctx context.Context, opts QueryOptions, fn func(*db.ApplicationLog) error) error
 }
 
-func NewIngester(storage Storage, bufferSize, batchSize int) *Ingester {
+func NewIngester(storage Storage, cfg IngesterConfig) (*Ingester, error) {
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.FlushTimeout == 0 {
+		cfg.FlushTimeout = DefaultFlushTimeout
+	}
+	if cfg.FlushInterval < 0 {
+		return nil, fmt.Errorf("flush interval must be positive, got %s", cfg.FlushInterval)
+	}
+	if cfg.FlushTimeout < 0 {
+		return nil, fmt.Errorf("flush timeout must be positive, got %s", cfg.FlushTimeout)
+	}
+	if cfg.MaxBatchLatency < 0 {
+		return nil, fmt.Errorf("max batch latency must not be negative, got %s", cfg.MaxBatchLatency)
+	}
+	if cfg.MaxBuffered < 0 {
+		return nil, fmt.Errorf("max buffered must not be negative, got %d", cfg.MaxBuffered)
+	}
+	if cfg.MaxBuffered == 0 {
+		cfg.MaxBuffered = defaultMaxBufferedFactor * cfg.BufferSize
+	}
+	switch cfg.OversizePolicy {
+	case "":
+		cfg.OversizePolicy = OversizeTruncate
+	case OversizeTruncate, OversizeReject:
+	default:
+		return nil, fmt.Errorf("unknown oversize policy: %s", cfg.OversizePolicy)
+	}
+	if err := validateSizeLimits(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Parser.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateIndexedPaths(cfg.IndexedPaths); err != nil {
+		return nil, err
+	}
+	sinks, err := newSinkWorkers(cfg.Sinks, cfg.FlushTimeout)
+	if err != nil {
+		return nil, err
+	}
+
 	i := &Ingester{
-		buffer:     make([]*db.ApplicationLog, 0, bufferSize),
-		bufferSize: bufferSize,
-		batchSize:  batchSize,
-		flushCh:    make(chan struct{}),
-		storage:    storage,
+		buffer:       make([]*db.ApplicationLog, 0, cfg.BufferSize),
+		bufferSize:   cfg.BufferSize,
+		batchSize:    cfg.BatchSize,
+		flushCh:      make(chan struct{}, 1),
+		storage:      storage,
+		flushEvery:   cfg.FlushInterval,
+		flushTimeout: cfg.FlushTimeout,
+
+		maxBatchLatency: cfg.MaxBatchLatency,
+		maxBuffered:     cfg.MaxBuffered,
+
+		maxMessageSize: cfg.MaxMessageSize,
+		maxPayloadSize: cfg.MaxPayloadSize,
+		oversizePolicy: cfg.OversizePolicy,
+
+		extraction: cfg.FieldExtraction,
+		parser:     cfg.Parser,
+
+		indexedPaths: slices.Clone(cfg.IndexedPaths),
+		sinks:        sinks,
+	}
+	if cfg.DedupWindow > 0 {
+		i.dedup = newDedupCache(cfg.DedupWindow)
+	}
+	if cfg.StatsStorage != nil {
+		i.stats = newStatsAggregator(cfg.StatsStorage)
 	}
 
 	go i.flushLoop()
-	return i
+	return i, nil
 }
 
+// IngestLog parses a single JSON log or plain-text line, as configured by
+// IngesterConfig.Parser, and buffers it.
 func (i *Ingester) IngestLog(ctx context.Context, rawLog json.RawMessage) error {
-	var log db.ApplicationLog
-	if err := json.Unmarshal(rawLog, &log); err != nil {
+	log, err := i.parseLog(rawLog)
+	if err != nil {
 		return err
 	}
 
+	return i.ingest(ctx, log)
+}
+
+// ingest validates an already decoded log and adds it to the buffer. It is
+// shared by every input format.
+func (i *Ingester) ingest(ctx context.Context, log *db.ApplicationLog) error {
 	// Validate required fields
-	if err := i.validateLog(&log); err != nil {
+	if err := i.validateLog(log); err != nil {
+		return err
+	}
+
+	// Fields are extracted from the whole message, before truncation can
+	// cut them off, and the payload they grow is then held to its limit
+	i.extractFields(log)
+
+	oversized, err := i.enforceSizeLimits(log)
+	if oversized {
+		i.oversized.Add(1)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Drop retried duplicates before they reach the buffer, and before admit
+	// can evict a buffered log to make room for one. The key is taken before
+	// the timestamp is defaulted so resent logs without one still match.
+	var key string
+	if i.dedup != nil {
+		key = eventKey(log)
+		if i.dedup.seenBefore(key, time.Now()) {
+			i.duplicates.Add(1)
+			return nil
+		}
+	}
+
+	// A log turned away under load is forgotten again, so it can be resent
+	if err := i.admit(log); err != nil {
+		if i.dedup != nil {
+			i.dedup.forget(key)
+		}
 		return err
 	}
 
@@ -51,10 +283,16 @@ func (i *Ingester) IngestLog(ctx context.Context, rawLog json.RawMessage) error
 	if log.Timestamp.IsZero() {
 		log.Timestamp = time.Now()
 	}
+	if log.ID == "" {
+		log.ID = db.NewID()
+	}
+
+	i.indexFields(log)
 
 	i.mu.Lock()
-	i.buffer = append(i.buffer, &log)
+	i.buffer = append(i.buffer, log)
 	shouldFlush := len(i.buffer) >= i.bufferSize
+	i.armLatencyFlush()
 	i.mu.Unlock()
 
 	if shouldFlush {
@@ -64,20 +302,42 @@ func (i *Ingester) IngestLog(ctx context.Context, rawLog json.RawMessage) error
 	return nil
 }
 
+// Stats returns a snapshot of the ingestion counters.
+func (i *Ingester) Stats() IngesterStats {
+	stats := IngesterStats{
+		Duplicates: i.duplicates.Load(),
+		Oversized:  i.oversized.Load(),
+		Rejected:   i.rejected.Load(),
+		Evicted:    i.evicted.Load(),
+
+		InvalidFrames: i.invalidFrames.Load(),
+	}
+	if len(i.sinks) > 0 {
+		stats.Sinks = make(map[string]SinkStats, len(i.sinks))
+		for _, w := range i.sinks {
+			stats.Sinks[w.name] = w.stats()
+		}
+	}
+	return stats
+}
+
+// validateLog checks the required fields, returning db.ValidationErrors
+// listing every one that is missing.
 func (i *Ingester) validateLog(log *db.ApplicationLog) error {
+	var errs db.ValidationErrors
 	if log.ApplicationID == "" {
-		return errors.New("application_id is required")
+		errs.Add("application_id", db.CodeRequired, "application_id is required")
 	}
 	if log.ServiceName == "" {
-		return errors.New("service_name is required")
+		errs.Add("service_name", db.CodeRequired, "service_name is required")
 	}
 	if log.Severity == "" {
-		return errors.New("severity is required")
+		errs.Add("severity", db.CodeRequired, "severity is required")
 	}
 	if log.Message == "" {
-		return errors.New("message is required")
+		errs.Add("message", db.CodeRequired, "message is required")
 	}
-	return nil
+	return errs.Err()
 }
 
 func (i *Ingester) triggerFlush() {
@@ -88,14 +348,25 @@ func (i *Ingester) triggerFlush() {
 	}
 }
 
+// armLatencyFlush schedules a flush MaxBatchLatency from now once a full
+// batch is buffered, unless one is already scheduled. Must be called with
+// i.mu held.
+func (i *Ingester) armLatencyFlush() {
+	if i.maxBatchLatency <= 0 || i.batchSize <= 0 || i.latencyTimer != nil || len(i.buffer) < i.batchSize {
+		return
+	}
+	i.latencyTimer = time.AfterFunc(i.maxBatchLatency, i.triggerFlush)
+}
+
 func (i *Ingester) flushLoop() {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(i.flushEvery)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			i.flush()
+			i.flushStats()
 		case <-i.flushCh:
 			i.flush()
 		}
@@ -117,13 +388,18 @@ func (i *Ingester) flush() {
 
 	batch := make([]*db.ApplicationLog, batchSize)
 	copy(batch, i.buffer[:batchSize])
-	
+
 	// Remove the taken batch from buffer
 	i.buffer = append(i.buffer[:0], i.buffer[batchSize:]...)
+	if i.latencyTimer != nil {
+		i.latencyTimer.Stop()
+		i.latencyTimer = nil
+	}
+	i.armLatencyFlush()
 	i.mu.Unlock()
 
 	// Store the batch
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), i.flushTimeout)
 	defer cancel()
 
 	if err := i.storage.BatchInsertLogs(ctx, batch); err != nil {
@@ -131,18 +407,32 @@ func (i *Ingester) flush() {
 		i.mu.Lock()
 		// Prepend failed batch back to buffer
 		i.buffer = append(batch, i.buffer...)
+		i.armLatencyFlush()
 		i.mu.Unlock()
+		return
 	}
+
+	// Count and forward only once stored, so logs evicted under load aren't
+	// counted and a requeued batch isn't counted or forwarded twice
+	if i.stats != nil {
+		for _, log := range batch {
+			i.stats.count(log)
+		}
+	}
+	i.forward(batch)
 }
 
 type QueryOptions struct {
 	ApplicationID string
-	ServiceName  string
-	Severity     string
-	StartTime    time.Time
-	EndTime      time.Time
-	Limit        int
-	Offset       int
+	ServiceName   string
+	Severity      string
+	StartTime     time.Time
+	EndTime       time.Time
+	Limit         int
+	Offset        int
+
+	// PayloadFilters must all match; see PayloadFilter
+	PayloadFilters []PayloadFilter
 }
 
 type QueryResult struct {
@@ -151,7 +441,41 @@ type QueryResult struct {
 	HasMore    bool
 }
 
+// QueryLogs returns the logs matching opts. Identical queries made while
+// one is in flight share its result, which must not be modified.
 func (i *Ingester) QueryLogs(ctx context.Context, opts QueryOptions) (*QueryResult, error) {
-	// This would be implemented by the storage layer
-	return nil, errors.New("not implemented")
+	if err := i.ValidateQuery(opts); err != nil {
+		return nil, err
+	}
+	return i.queries.Do(ctx, opts.key(), func(ctx context.Context) (*QueryResult, error) {
+		return i.storage.QueryLogs(ctx, opts)
+	})
+}
+
+// key identifies the query for coalescing; equal instants give equal keys
+// whatever their location.
+func (o QueryOptions) key() string {
+	key := fmt.Sprintf("%q|%q|%q|%d|%d|%d|%d",
+		o.ApplicationID, o.ServiceName, o.Severity,
+		unixNano(o.StartTime), unixNano(o.EndTime), o.Limit, o.Offset)
+	for _, f := range o.PayloadFilters {
+		key += fmt.Sprintf("|%q %s %q", f.Path, f.Op, f.Value)
+	}
+	return key
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// StreamLogs streams every log matching opts to fn. It is meant for exports,
+// so Limit and Offset are ignored.
+func (i *Ingester) StreamLogs(ctx context.Context, opts QueryOptions, fn func(*db.ApplicationLog) error) error {
+	if err := i.ValidateQuery(opts); err != nil {
+		return err
+	}
+	return i.storage.StreamLogs(ctx, opts, fn)
 }
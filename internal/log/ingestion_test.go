@@ -0,0 +1,136 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// memStorage is an in-memory Storage recording the batches stored.
+type memStorage struct {
+	mu      sync.Mutex
+	batches [][]*db.ApplicationLog
+}
+
+func (s *memStorage) BatchInsertLogs(ctx context.Context, logs []*db.ApplicationLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, logs)
+	return nil
+}
+
+func (s *memStorage) QueryLogs(ctx context.Context, opts QueryOptions) (*QueryResult, error) {
+	return &QueryResult{}, nil
+}
+
+func (s *memStorage) StreamLogs(ctx context.Context, opts QueryOptions, fn func(*db.ApplicationLog) error) error {
+	return nil
+}
+
+// stored returns how many logs have been stored.
+func (s *memStorage) stored() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, batch := range s.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func newTestIngester(t *testing.T, cfg IngesterConfig) (*Ingester, *memStorage) {
+	t.Helper()
+	storage := &memStorage{}
+	i, err := NewIngester(storage, cfg)
+	if err != nil {
+		t.Fatalf("NewIngester: %v", err)
+	}
+	return i, storage
+}
+
+func ingestLogs(t *testing.T, i *Ingester, n int) {
+	t.Helper()
+	for range n {
+		log := &db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "INFO", Message: "request handled"}
+		if err := i.ingest(context.Background(), log); err != nil {
+			t.Fatalf("ingest: %v", err)
+		}
+	}
+}
+
+// waitStored waits up to a second for want logs to be stored.
+func waitStored(t *testing.T, storage *memStorage, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for storage.stored() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("stored %d logs, want %d", storage.stored(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushIntervalFlushesSmallBuffer(t *testing.T) {
+	i, storage := newTestIngester(t, IngesterConfig{BufferSize: 100, BatchSize: 100, FlushInterval: 20 * time.Millisecond})
+
+	ingestLogs(t, i, 3)
+	waitStored(t, storage, 3)
+}
+
+func TestNewIngesterRejectsNegativeFlushSettings(t *testing.T) {
+	for _, cfg := range []IngesterConfig{
+		{FlushInterval: -time.Second},
+		{FlushTimeout: -time.Second},
+		{MaxBatchLatency: -time.Second},
+	} {
+		if _, err := NewIngester(&memStorage{}, cfg); err == nil {
+			t.Errorf("NewIngester accepted %+v", cfg)
+		}
+	}
+}
+
+func TestFlushTriggers(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cfg    IngesterConfig
+		ingest int
+	}{
+		{"buffer size", IngesterConfig{BufferSize: 5, BatchSize: 5}, 5},
+		{"batch latency", IngesterConfig{BufferSize: 100, BatchSize: 3, MaxBatchLatency: 20 * time.Millisecond}, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The ticker never fires during the test
+			tc.cfg.FlushInterval = time.Hour
+			i, storage := newTestIngester(t, tc.cfg)
+
+			// One log short of the trigger stays buffered
+			ingestLogs(t, i, tc.ingest-1)
+			time.Sleep(50 * time.Millisecond)
+			if got := storage.stored(); got != 0 {
+				t.Fatalf("stored %d logs before the trigger", got)
+			}
+
+			ingestLogs(t, i, 1)
+			waitStored(t, storage, tc.ingest)
+		})
+	}
+}
+
+func TestBatchLatencyWaitsForLatency(t *testing.T) {
+	i, storage := newTestIngester(t, IngesterConfig{
+		BufferSize:      100,
+		BatchSize:       3,
+		MaxBatchLatency: 200 * time.Millisecond,
+		FlushInterval:   time.Hour,
+	})
+
+	start := time.Now()
+	ingestLogs(t, i, 3)
+	waitStored(t, storage, 3)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("flushed a full batch after %s, want after the max latency", elapsed)
+	}
+}
@@ -0,0 +1,91 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"api-watchtower/internal/db"
+)
+
+// OversizePolicy decides what happens to a log whose message or payload
+// exceeds the configured limits.
+type OversizePolicy string
+
+const (
+	// OversizeTruncate shortens the offending fields and keeps the log.
+	OversizeTruncate OversizePolicy = "truncate"
+	// OversizeReject refuses the log with ErrLogTooLarge.
+	OversizeReject OversizePolicy = "reject"
+)
+
+const truncatedMarker = "...[truncated]"
+
+var ErrLogTooLarge = errors.New("log exceeds maximum size")
+
+// minTruncatedPayloadSize is the size of the largest marker a truncated
+// payload is replaced with, so a smaller MaxPayloadSize can't be honoured.
+var minTruncatedPayloadSize = len(truncatedPayload(math.MaxInt))
+
+// validateSizeLimits checks that truncation can keep logs within cfg's
+// limits: its markers must fit.
+func validateSizeLimits(cfg IngesterConfig) error {
+	if cfg.MaxMessageSize < 0 || cfg.MaxPayloadSize < 0 {
+		return fmt.Errorf("max message and payload sizes must not be negative, got %d and %d", cfg.MaxMessageSize, cfg.MaxPayloadSize)
+	}
+	if cfg.OversizePolicy != OversizeTruncate {
+		return nil
+	}
+	if cfg.MaxMessageSize > 0 && cfg.MaxMessageSize < len(truncatedMarker) {
+		return fmt.Errorf("max message size must be at least %d bytes to truncate, got %d", len(truncatedMarker), cfg.MaxMessageSize)
+	}
+	if cfg.MaxPayloadSize > 0 && cfg.MaxPayloadSize < minTruncatedPayloadSize {
+		return fmt.Errorf("max payload size must be at least %d bytes to truncate, got %d", minTruncatedPayloadSize, cfg.MaxPayloadSize)
+	}
+	return nil
+}
+
+// enforceSizeLimits applies the ingester's size policy to log in place. It
+// reports whether the log was oversized.
+func (i *Ingester) enforceSizeLimits(log *db.ApplicationLog) (bool, error) {
+	messageTooLarge := i.maxMessageSize > 0 && len(log.Message) > i.maxMessageSize
+	payloadTooLarge := i.maxPayloadSize > 0 && len(log.Payload) > i.maxPayloadSize
+	if !messageTooLarge && !payloadTooLarge {
+		return false, nil
+	}
+
+	if i.oversizePolicy == OversizeReject {
+		return true, fmt.Errorf("%w: message %d bytes, payload %d bytes", ErrLogTooLarge, len(log.Message), len(log.Payload))
+	}
+
+	if messageTooLarge {
+		log.Message = truncateString(log.Message, i.maxMessageSize)
+	}
+	if payloadTooLarge {
+		// A JSON document can't be cut at an arbitrary byte and stay valid,
+		// so the payload is replaced with a marker describing what was dropped.
+		log.Payload = truncatedPayload(len(log.Payload))
+	}
+	return true, nil
+}
+
+// truncateString shortens s to at most limit bytes including the marker,
+// without splitting a multi-byte character. limit must leave room for the
+// marker.
+func truncateString(s string, limit int) string {
+	cut := limit - len(truncatedMarker)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + truncatedMarker
+}
+
+func truncatedPayload(originalSize int) json.RawMessage {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"_truncated":     true,
+		"_original_size": originalSize,
+	})
+	return payload
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+func TestNewIngesterRejectsLimitsBelowMarkers(t *testing.T) {
+	for _, cfg := range []IngesterConfig{
+		{MaxMessageSize: len(truncatedMarker) - 1},
+		{MaxPayloadSize: 16},
+		{MaxPayloadSize: -1},
+	} {
+		if _, err := NewIngester(&memStorage{}, cfg); err == nil {
+			t.Errorf("accepted message size %d, payload size %d", cfg.MaxMessageSize, cfg.MaxPayloadSize)
+		}
+	}
+
+	// Rejecting oversized logs needs no markers
+	if _, err := NewIngester(&memStorage{}, IngesterConfig{MaxPayloadSize: 16, OversizePolicy: OversizeReject}); err != nil {
+		t.Errorf("NewIngester: %v", err)
+	}
+}
+
+func TestTruncatedLogFitsLimits(t *testing.T) {
+	i, _ := newTestIngester(t, IngesterConfig{MaxMessageSize: len(truncatedMarker), MaxPayloadSize: minTruncatedPayloadSize})
+
+	payload, _ := json.Marshal(map[string]string{"body": strings.Repeat("x", 1<<20)})
+	log := &db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "INFO", Message: strings.Repeat("é", 100), Payload: payload}
+	if err := i.ingest(context.Background(), log); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if len(log.Message) > len(truncatedMarker) || len(log.Payload) > minTruncatedPayloadSize {
+		t.Errorf("truncated to a %d byte message and %d byte payload, over the limits", len(log.Message), len(log.Payload))
+	}
+}
+
+func TestFieldsAreExtractedBeforeTruncation(t *testing.T) {
+	i, _ := newTestIngester(t, IngesterConfig{
+		MaxMessageSize:  64,
+		FieldExtraction: map[string]FieldExtraction{defaultExtractionKey: {Logfmt: true}},
+	})
+
+	message := "request failed " + strings.Repeat("detail ", 20) + "status=503"
+	log := &db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "ERROR", Message: message}
+	if err := i.ingest(context.Background(), log); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if !strings.HasSuffix(log.Message, truncatedMarker) {
+		t.Errorf("message %q wasn't truncated", log.Message)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(log.Payload, &payload); err != nil || payload["status"] == nil {
+		t.Errorf("payload %s lacks the status cut from the message", log.Payload)
+	}
+}
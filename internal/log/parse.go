@@ -0,0 +1,130 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"api-watchtower/internal/db"
+)
+
+// InputFormat selects how IngestLog reads its input.
+type InputFormat string
+
+const (
+	// FormatAuto treats input starting with '{' as JSON and anything else as
+	// a plain-text line.
+	FormatAuto InputFormat = "auto"
+	FormatJSON InputFormat = "json"
+	FormatText InputFormat = "text"
+)
+
+// ParserConfig controls how raw input is turned into a log.
+type ParserConfig struct {
+	// Format defaults to FormatAuto.
+	Format InputFormat
+	// FieldMapping lists, per log field, the alternate names a shipper may
+	// use for it, e.g. "message": {"msg", "log"}. The log's own name always
+	// wins; otherwise the first alternate present is used.
+	FieldMapping map[string][]string
+	// TextDefaults fills the fields a plain-text line can't carry. Required
+	// fields left empty make text logs fail validation.
+	TextDefaults TextDefaults
+}
+
+// TextDefaults are the field values given to plain-text logs.
+type TextDefaults struct {
+	ApplicationID string
+	ServiceName   string
+	Severity      string
+}
+
+// logFields are the JSON names of db.ApplicationLog's fields.
+var logFields = map[string]bool{
+	"id": true, "event_id": true, "application_id": true, "service_name": true,
+	"severity": true, "message": true, "timestamp": true, "instance_id": true,
+	"trace_id": true, "user_id": true, "source": true, "payload": true,
+}
+
+func (pc *ParserConfig) validate() error {
+	switch pc.Format {
+	case "":
+		pc.Format = FormatAuto
+	case FormatAuto, FormatJSON, FormatText:
+	default:
+		return fmt.Errorf("unknown input format: %s", pc.Format)
+	}
+	for field := range pc.FieldMapping {
+		if !logFields[field] {
+			return fmt.Errorf("field mapping targets unknown log field %q", field)
+		}
+	}
+	return nil
+}
+
+// parseLog decodes one raw input into a log according to the parser
+// configuration.
+func (i *Ingester) parseLog(raw []byte) (*db.ApplicationLog, error) {
+	trimmed := bytes.TrimSpace(raw)
+
+	format := i.parser.Format
+	if format == FormatAuto {
+		format = FormatText
+		if len(trimmed) > 0 && trimmed[0] == '{' {
+			format = FormatJSON
+		}
+	}
+
+	if format == FormatText {
+		return i.parseText(trimmed), nil
+	}
+	return i.parseJSON(trimmed)
+}
+
+// parseJSON decodes a JSON log, renaming alternate field names first.
+func (i *Ingester) parseJSON(raw []byte) (*db.ApplicationLog, error) {
+	if len(i.parser.FieldMapping) > 0 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, invalidLog(err)
+		}
+		for field, aliases := range i.parser.FieldMapping {
+			if _, ok := fields[field]; ok {
+				continue
+			}
+			for _, alias := range aliases {
+				if value, ok := fields[alias]; ok {
+					fields[field] = value
+					delete(fields, alias)
+					break
+				}
+			}
+		}
+		mapped, err := json.Marshal(fields)
+		if err != nil {
+			return nil, invalidLog(err)
+		}
+		raw = mapped
+	}
+
+	var log db.ApplicationLog
+	if err := json.Unmarshal(raw, &log); err != nil {
+		return nil, invalidLog(err)
+	}
+	return &log, nil
+}
+
+// parseText turns a plain-text line into a log carrying it as the message.
+func (i *Ingester) parseText(line []byte) *db.ApplicationLog {
+	defaults := i.parser.TextDefaults
+	return &db.ApplicationLog{
+		ApplicationID: defaults.ApplicationID,
+		ServiceName:   defaults.ServiceName,
+		Severity:      defaults.Severity,
+		Message:       string(line),
+	}
+}
+
+func invalidLog(err error) error {
+	return &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid log: %v", err)}
+}
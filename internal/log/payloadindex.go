@@ -0,0 +1,150 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// Payload filter operators
+const (
+	FilterEq  = "eq"
+	FilterGt  = "gt"
+	FilterGte = "gte"
+	FilterLt  = "lt"
+	FilterLte = "lte"
+)
+
+// PayloadFilter restricts a query to logs whose payload value at Path, a
+// dotted path such as "http.status", compares to Value under Op. Only
+// paths listed in IngesterConfig.IndexedPaths can be filtered on. Range
+// operators compare numerically and need a numeric Value; equality
+// compares numerically when both sides are numbers and as text otherwise.
+type PayloadFilter struct {
+	Path  string
+	Op    string
+	Value string
+}
+
+// Matches reports whether fields, a log's indexed values, satisfy f. It
+// states the semantics storage implements against its side-table.
+func (f PayloadFilter) Matches(fields []db.LogField) bool {
+	want, numErr := strconv.ParseFloat(f.Value, 64)
+	for _, field := range fields {
+		if field.Path != f.Path {
+			continue
+		}
+		if f.Op == FilterEq {
+			if field.Number != nil && numErr == nil {
+				return *field.Number == want
+			}
+			return field.Value == f.Value
+		}
+		if field.Number == nil || numErr != nil {
+			return false
+		}
+		switch got := *field.Number; f.Op {
+		case FilterGt:
+			return got > want
+		case FilterGte:
+			return got >= want
+		case FilterLt:
+			return got < want
+		case FilterLte:
+			return got <= want
+		}
+		return false
+	}
+	return false
+}
+
+// validateIndexedPaths checks the configured paths are dotted paths with
+// no empty segments.
+func validateIndexedPaths(paths []string) error {
+	for _, path := range paths {
+		if slices.Contains(strings.Split(path, "."), "") {
+			return fmt.Errorf("invalid indexed path: %q", path)
+		}
+	}
+	return nil
+}
+
+// ValidateQuery checks opts' payload filters, returning db.ValidationErrors
+// for filters on paths that aren't indexed, unknown operators and
+// non-numeric range bounds. QueryLogs and StreamLogs run it too; callers
+// that stream results can run it first to fail before writing anything.
+func (i *Ingester) ValidateQuery(opts QueryOptions) error {
+	var errs db.ValidationErrors
+	for _, f := range opts.PayloadFilters {
+		field := "payload." + f.Path
+		if !slices.Contains(i.indexedPaths, f.Path) {
+			msg := fmt.Sprintf("%s is not filterable; no payload paths are indexed", field)
+			if len(i.indexedPaths) > 0 {
+				msg = fmt.Sprintf("%s is not filterable; indexed paths are %s", field, strings.Join(i.indexedPaths, ", "))
+			}
+			errs.Add(field, db.CodeUnsupported, msg)
+			continue
+		}
+		switch f.Op {
+		case FilterEq:
+		case FilterGt, FilterGte, FilterLt, FilterLte:
+			if _, err := strconv.ParseFloat(f.Value, 64); err != nil {
+				errs.Add(field, db.CodeInvalid, fmt.Sprintf("%s %s needs a number, got %q", field, f.Op, f.Value))
+			}
+		default:
+			errs.Add(field, db.CodeUnsupported, fmt.Sprintf("unknown operator %q; use eq, gt, gte, lt or lte", f.Op))
+		}
+	}
+	return errs.Err()
+}
+
+// indexFields records the log's payload values at the indexed paths in its
+// Fields. Objects, arrays and nulls aren't indexed.
+func (i *Ingester) indexFields(log *db.ApplicationLog) {
+	if len(i.indexedPaths) == 0 || len(log.Payload) == 0 {
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(log.Payload))
+	dec.UseNumber()
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return
+	}
+
+	log.Fields = log.Fields[:0]
+	for _, path := range i.indexedPaths {
+		v := payload
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+			v = obj[key]
+		}
+
+		field := db.LogField{Path: path}
+		switch v := v.(type) {
+		case string:
+			field.Value = v
+		case bool:
+			field.Value = strconv.FormatBool(v)
+		case json.Number:
+			n, err := v.Float64()
+			if err != nil {
+				continue
+			}
+			field.Value = v.String()
+			field.Number = &n
+		default:
+			continue
+		}
+		log.Fields = append(log.Fields, field)
+	}
+}
@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"api-watchtower/internal/db"
+)
+
+// maxProtoFrameSize bounds a single length-delimited log frame. Larger
+// frames are skipped unread.
+const maxProtoFrameSize = 4 << 20
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IngestProto decodes a single ApplicationLog message, as in
+// db/models.proto, and buffers it with the same validation and limits as
+// IngestLog. A gzip-compressed message is decompressed first.
+func (i *Ingester) IngestProto(ctx context.Context, b []byte) error {
+	if bytes.HasPrefix(b, gzipMagic) {
+		var err error
+		if b, err = gunzip(b); err != nil {
+			return invalidLog(err)
+		}
+	}
+
+	var log db.ApplicationLog
+	if err := log.UnmarshalProto(b); err != nil {
+		return invalidLog(err)
+	}
+	return i.ingest(ctx, &log)
+}
+
+// gunzip decompresses a single gzip-compressed message of at most
+// maxProtoFrameSize bytes.
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxProtoFrameSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxProtoFrameSize {
+		return nil, fmt.Errorf("decompressed message exceeds %d bytes", maxProtoFrameSize)
+	}
+	return out, nil
+}
+
+// StreamResult counts what became of the frames of a protobuf log stream.
+type StreamResult struct {
+	// Accepted logs were buffered, or dropped as duplicates
+	Accepted int `json:"accepted"`
+	// Invalid frames didn't decode, failed validation or were too large
+	Invalid int `json:"invalid"`
+	// Rejected logs were turned away with ErrBufferFull and can be resent
+	Rejected int `json:"rejected"`
+}
+
+// IngestProtoStream reads ApplicationLog messages from r, each prefixed by
+// its length as a varint, the framing of protobuf's writeDelimitedTo, until
+// r is exhausted. A gzip-compressed stream is decompressed. Frames that
+// don't decode or fail validation are counted in IngesterStats and
+// skipped, and logs the buffer sheds are counted as rejected; the stream
+// goes on either way. It returns what became of the frames read, and an
+// error only if reading failed or the framing was lost.
+func (i *Ingester) IngestProtoStream(ctx context.Context, r io.Reader) (StreamResult, error) {
+	var result StreamResult
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return result, fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	var frame []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("invalid frame length: %w", err)
+		}
+		if size > math.MaxInt64 {
+			// Too long to skip, so the next frame can't be found
+			return result, fmt.Errorf("invalid frame length %d", size)
+		}
+		if size > maxProtoFrameSize {
+			i.invalidFrames.Add(1)
+			result.Invalid++
+			if _, err := io.CopyN(io.Discard, br, int64(size)); err != nil {
+				return result, fmt.Errorf("truncated frame: %w", err)
+			}
+			continue
+		}
+
+		if cap(frame) < int(size) {
+			frame = make([]byte, size)
+		}
+		frame = frame[:size]
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return result, fmt.Errorf("truncated frame: %w", err)
+		}
+
+		err = i.IngestProto(ctx, frame)
+		var single *db.ValidationError
+		var errs db.ValidationErrors
+		switch {
+		case err == nil:
+			result.Accepted++
+		case errors.Is(err, ErrBufferFull):
+			result.Rejected++
+		case errors.As(err, &single), errors.As(err, &errs), errors.Is(err, ErrLogTooLarge):
+			i.invalidFrames.Add(1)
+			result.Invalid++
+		default:
+			return result, err
+		}
+	}
+}
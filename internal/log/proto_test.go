@@ -0,0 +1,72 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+func appendFrame(b []byte, log *db.ApplicationLog) []byte {
+	msg := log.AppendProto(nil)
+	b = binary.AppendUvarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+func TestIngestProtoStreamCountsRejectedFrames(t *testing.T) {
+	i, _ := newTestIngester(t, IngesterConfig{BufferSize: 100, BatchSize: 100, FlushInterval: time.Hour, MaxBuffered: 2})
+
+	var stream []byte
+	for range 5 {
+		stream = appendFrame(stream, &db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "INFO", Message: "request handled"})
+	}
+	stream = appendFrame(stream, &db.ApplicationLog{ServiceName: "api", Message: "no application"})
+
+	result, err := i.IngestProtoStream(context.Background(), bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("IngestProtoStream: %v", err)
+	}
+	if want := (StreamResult{Accepted: 2, Invalid: 1, Rejected: 3}); result != want {
+		t.Errorf("got %+v, want %+v", result, want)
+	}
+}
+
+func TestIngestProtoAcceptsGzip(t *testing.T) {
+	i, _ := newTestIngester(t, IngesterConfig{BufferSize: 100, BatchSize: 100, FlushInterval: time.Hour})
+
+	log := &db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "INFO", Message: "request handled"}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(log.AppendProto(nil))
+	zw.Close()
+
+	if err := i.IngestProto(context.Background(), buf.Bytes()); err != nil {
+		t.Fatalf("IngestProto: %v", err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.buffer) != 1 || i.buffer[0].Message != log.Message {
+		t.Errorf("buffered %+v, want the decompressed log", i.buffer)
+	}
+}
+
+func TestIngestProtoStreamRejectsOverflowingLength(t *testing.T) {
+	i, _ := newTestIngester(t, IngesterConfig{BufferSize: 100, BatchSize: 100, FlushInterval: time.Hour})
+
+	log := &db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "INFO", Message: "request handled"}
+	stream := appendFrame(nil, log)
+	stream = binary.AppendUvarint(stream, 1<<63)
+	stream = appendFrame(stream, log)
+
+	result, err := i.IngestProtoStream(context.Background(), bytes.NewReader(stream))
+	if err == nil {
+		t.Fatal("a frame length beyond int64 was skipped, want a framing error")
+	}
+	if want := (StreamResult{Accepted: 1}); result != want {
+		t.Errorf("got %+v, want %+v from the frame before it", result, want)
+	}
+}
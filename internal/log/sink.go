@@ -0,0 +1,172 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Sink receives copies of stored logs, e.g. to forward them to Kafka, S3 or
+// another HTTP endpoint for archival. Logs are shared with the storage and
+// other sinks, so a sink must not modify them.
+type Sink interface {
+	WriteLogs(ctx context.Context, logs []*db.ApplicationLog) error
+}
+
+// SinkConfig forwards the stored logs that pass its filter to Sink. Each
+// sink writes from its own queue, so a slow or failing sink delays neither
+// primary storage nor the other sinks.
+type SinkConfig struct {
+	// Name identifies the sink in IngesterStats and logs
+	Name string
+	Sink Sink
+
+	// ApplicationIDs and Severities restrict the forwarded logs; empty
+	// forwards all. Severities match case-insensitively.
+	ApplicationIDs []string
+	Severities     []string
+
+	// QueueSize is how many batches may wait for the sink. Once it is full
+	// further batches are dropped, and counted, rather than held back.
+	// Defaults to 16.
+	QueueSize int
+	// Timeout bounds each write. Defaults to the ingester's FlushTimeout.
+	Timeout time.Duration
+}
+
+// SinkStats counts a sink's logs: Forwarded were written, Failed were
+// handed to a write that returned an error, and Dropped never reached the
+// sink because its queue was full.
+type SinkStats struct {
+	Forwarded uint64
+	Failed    uint64
+	Dropped   uint64
+}
+
+const defaultSinkQueueSize = 16
+
+// sinkWorker feeds one sink from its queue.
+type sinkWorker struct {
+	name    string
+	sink    Sink
+	timeout time.Duration
+	queue   chan []*db.ApplicationLog
+
+	applications map[string]bool
+	severities   map[string]bool
+
+	forwarded atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// newSinkWorkers validates the sinks' configs and starts a worker for
+// each.
+func newSinkWorkers(configs []SinkConfig, flushTimeout time.Duration) ([]*sinkWorker, error) {
+	workers := make([]*sinkWorker, 0, len(configs))
+	for n, cfg := range configs {
+		switch {
+		case cfg.Name == "":
+			return nil, fmt.Errorf("sink %d has no name", n)
+		case cfg.Sink == nil:
+			return nil, fmt.Errorf("sink %s has no Sink", cfg.Name)
+		case cfg.QueueSize < 0 || cfg.Timeout < 0:
+			return nil, fmt.Errorf("sink %s: queue size and timeout must not be negative", cfg.Name)
+		}
+		if slices.ContainsFunc(workers, func(w *sinkWorker) bool { return w.name == cfg.Name }) {
+			return nil, fmt.Errorf("duplicate sink name: %s", cfg.Name)
+		}
+
+		w := &sinkWorker{
+			name:    cfg.Name,
+			sink:    cfg.Sink,
+			timeout: cfg.Timeout,
+		}
+		queueSize := cfg.QueueSize
+		if queueSize == 0 {
+			queueSize = defaultSinkQueueSize
+		}
+		w.queue = make(chan []*db.ApplicationLog, queueSize)
+		if w.timeout == 0 {
+			w.timeout = flushTimeout
+		}
+		if len(cfg.ApplicationIDs) > 0 {
+			w.applications = make(map[string]bool, len(cfg.ApplicationIDs))
+			for _, id := range cfg.ApplicationIDs {
+				w.applications[id] = true
+			}
+		}
+		if len(cfg.Severities) > 0 {
+			w.severities = make(map[string]bool, len(cfg.Severities))
+			for _, severity := range cfg.Severities {
+				w.severities[strings.ToUpper(severity)] = true
+			}
+		}
+		workers = append(workers, w)
+	}
+
+	for _, w := range workers {
+		go w.run()
+	}
+	return workers, nil
+}
+
+func (w *sinkWorker) matches(log *db.ApplicationLog) bool {
+	return (w.applications == nil || w.applications[log.ApplicationID]) &&
+		(w.severities == nil || w.severities[strings.ToUpper(log.Severity)])
+}
+
+// enqueue queues the batch's matching logs without blocking.
+func (w *sinkWorker) enqueue(batch []*db.ApplicationLog) {
+	var logs []*db.ApplicationLog
+	for _, log := range batch {
+		if w.matches(log) {
+			logs = append(logs, log)
+		}
+	}
+	if len(logs) == 0 {
+		return
+	}
+
+	select {
+	case w.queue <- logs:
+	default:
+		w.dropped.Add(uint64(len(logs)))
+	}
+}
+
+func (w *sinkWorker) run() {
+	for logs := range w.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+		err := w.sink.WriteLogs(ctx, logs)
+		cancel()
+
+		if err != nil {
+			w.failed.Add(uint64(len(logs)))
+			log.Printf("Failed to forward %d logs to sink %s: %v", len(logs), w.name, err)
+			continue
+		}
+		w.forwarded.Add(uint64(len(logs)))
+	}
+}
+
+func (w *sinkWorker) stats() SinkStats {
+	return SinkStats{
+		Forwarded: w.forwarded.Load(),
+		Failed:    w.failed.Load(),
+		Dropped:   w.dropped.Load(),
+	}
+}
+
+// forward hands a stored batch to every sink.
+func (i *Ingester) forward(batch []*db.ApplicationLog) {
+	for _, w := range i.sinks {
+		w.enqueue(batch)
+	}
+}
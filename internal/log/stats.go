@@ -0,0 +1,182 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// ErrStatsDisabled is returned by QueryLogStats when the Ingester has no
+// StatsStorage.
+var ErrStatsDisabled = errors.New("log stats aggregation is not enabled")
+
+// StatsStorage keeps the pre-aggregated per-minute log counts.
+type StatsStorage interface {
+	// AddLogStats adds each stat's count to the stored row for its
+	// application, service, severity and minute, creating it if needed
+	AddLogStats(ctx context.Context, stats []*db.LogStat) error
+	// QueryLogStats returns the stored rows matching query, ordered by
+	// minute
+	QueryLogStats(ctx context.Context, query LogStatsQuery) ([]*db.LogStat, error)
+}
+
+// LogStatsQuery selects per-minute counts. Empty fields match everything.
+type LogStatsQuery struct {
+	ApplicationID string
+	ServiceName   string
+	Severity      string
+	StartTime     time.Time
+	EndTime       time.Time
+}
+
+func (q LogStatsQuery) matches(key statKey) bool {
+	return (q.ApplicationID == "" || q.ApplicationID == key.applicationID) &&
+		(q.ServiceName == "" || q.ServiceName == key.serviceName) &&
+		(q.Severity == "" || q.Severity == key.severity) &&
+		(q.StartTime.IsZero() || !key.minute.Before(q.StartTime)) &&
+		(q.EndTime.IsZero() || key.minute.Before(q.EndTime))
+}
+
+type statKey struct {
+	applicationID string
+	serviceName   string
+	severity      string
+	minute        time.Time
+}
+
+// statsAggregator counts stored logs per minute until they are flushed.
+type statsAggregator struct {
+	storage StatsStorage
+
+	mu      sync.Mutex
+	pending map[statKey]int64
+
+	// flushMu is held by a flush while its counts are being stored, and
+	// by queries while they read the stored and pending counts, so a query
+	// sees each count exactly once
+	flushMu sync.RWMutex
+}
+
+func newStatsAggregator(storage StatsStorage) *statsAggregator {
+	return &statsAggregator{
+		storage: storage,
+		pending: make(map[statKey]int64),
+	}
+}
+
+func (s *statsAggregator) count(log *db.ApplicationLog) {
+	key := statKey{
+		applicationID: log.ApplicationID,
+		serviceName:   log.ServiceName,
+		severity:      log.Severity,
+		minute:        log.Timestamp.UTC().Truncate(time.Minute),
+	}
+
+	s.mu.Lock()
+	s.pending[key]++
+	s.mu.Unlock()
+}
+
+// flush writes the pending counts. They stay pending until they are
+// stored, and are kept for the next flush if that fails.
+func (s *statsAggregator) flush(ctx context.Context) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	stats := make([]*db.LogStat, 0, len(s.pending))
+	for key, n := range s.pending {
+		stats = append(stats, key.stat(n))
+	}
+	s.mu.Unlock()
+
+	if len(stats) == 0 {
+		return
+	}
+	if err := s.storage.AddLogStats(ctx, stats); err != nil {
+		return
+	}
+
+	// Counted meanwhile stays pending
+	s.mu.Lock()
+	for _, stat := range stats {
+		key := statKey{stat.ApplicationID, stat.ServiceName, stat.Severity, stat.Minute}
+		s.pending[key] -= stat.Count
+		if s.pending[key] == 0 {
+			delete(s.pending, key)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (key statKey) stat(count int64) *db.LogStat {
+	return &db.LogStat{
+		ApplicationID: key.applicationID,
+		ServiceName:   key.serviceName,
+		Severity:      key.severity,
+		Minute:        key.minute,
+		Count:         count,
+	}
+}
+
+func (i *Ingester) flushStats() {
+	if i.stats == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), i.flushTimeout)
+	defer cancel()
+	i.stats.flush(ctx)
+}
+
+// QueryLogStats returns the per-minute counts matching query, including
+// those not flushed yet, ordered by minute, application, service and
+// severity.
+func (i *Ingester) QueryLogStats(ctx context.Context, query LogStatsQuery) ([]*db.LogStat, error) {
+	if i.stats == nil {
+		return nil, ErrStatsDisabled
+	}
+
+	i.stats.flushMu.RLock()
+	defer i.stats.flushMu.RUnlock()
+	stored, err := i.stats.storage.QueryLogStats(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[statKey]int64, len(stored))
+	for _, stat := range stored {
+		key := statKey{stat.ApplicationID, stat.ServiceName, stat.Severity, stat.Minute.UTC()}
+		merged[key] += stat.Count
+	}
+	i.stats.mu.Lock()
+	for key, n := range i.stats.pending {
+		if query.matches(key) {
+			merged[key] += n
+		}
+	}
+	i.stats.mu.Unlock()
+
+	stats := make([]*db.LogStat, 0, len(merged))
+	for key, n := range merged {
+		stats = append(stats, key.stat(n))
+	}
+	sort.Slice(stats, func(a, b int) bool {
+		x, y := stats[a], stats[b]
+		if !x.Minute.Equal(y.Minute) {
+			return x.Minute.Before(y.Minute)
+		}
+		if x.ApplicationID != y.ApplicationID {
+			return x.ApplicationID < y.ApplicationID
+		}
+		if x.ServiceName != y.ServiceName {
+			return x.ServiceName < y.ServiceName
+		}
+		return x.Severity < y.Severity
+	})
+	return stats, nil
+}
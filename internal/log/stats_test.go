@@ -0,0 +1,83 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// slowStatsStorage keeps stats in memory, holding each AddLogStats until
+// release is closed.
+type slowStatsStorage struct {
+	adding  chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	stats []*db.LogStat
+}
+
+func (s *slowStatsStorage) AddLogStats(ctx context.Context, stats []*db.LogStat) error {
+	close(s.adding)
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = append(s.stats, stats...)
+	return nil
+}
+
+func (s *slowStatsStorage) QueryLogStats(ctx context.Context, query LogStatsQuery) ([]*db.LogStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*db.LogStat(nil), s.stats...), nil
+}
+
+func TestQueryLogStatsDuringFlush(t *testing.T) {
+	storage := &slowStatsStorage{adding: make(chan struct{}), release: make(chan struct{})}
+	i, _ := newTestIngester(t, IngesterConfig{BufferSize: 100, BatchSize: 100, FlushInterval: time.Hour, StatsStorage: storage})
+	minute := time.Now().UTC().Truncate(time.Minute)
+	for range 5 {
+		i.stats.count(&db.ApplicationLog{ApplicationID: "app", ServiceName: "api", Severity: "INFO", Timestamp: minute})
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		i.stats.flush(context.Background())
+	}()
+	<-storage.adding
+
+	total := func(stats []*db.LogStat) int64 {
+		var n int64
+		for _, stat := range stats {
+			n += stat.Count
+		}
+		return n
+	}
+	queried := make(chan int64, 1)
+	go func() {
+		stats, err := i.QueryLogStats(context.Background(), LogStatsQuery{})
+		if err != nil {
+			t.Errorf("QueryLogStats: %v", err)
+		}
+		queried <- total(stats)
+	}()
+
+	// Give the query time to run against the half-written flush
+	time.Sleep(50 * time.Millisecond)
+	close(storage.release)
+	<-flushed
+	if got := <-queried; got != 5 {
+		t.Errorf("query during a flush counted %d logs, want 5", got)
+	}
+
+	stats, err := i.QueryLogStats(context.Background(), LogStatsQuery{})
+	if err != nil {
+		t.Fatalf("QueryLogStats: %v", err)
+	}
+	if got := total(stats); got != 5 {
+		t.Errorf("query after the flush counted %d logs, want 5", got)
+	}
+}
@@ -0,0 +1,429 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// SyslogConfig configures a syslog listener.
+type SyslogConfig struct {
+	// Address to listen on, e.g. ":5514".
+	Address string
+	// Protocol is "udp" or "tcp". Defaults to "udp".
+	Protocol string
+	// ApplicationID is used for frames that carry no APP-NAME.
+	ApplicationID string
+}
+
+// SyslogListener accepts RFC5424 and RFC3164 frames over UDP or TCP and feeds
+// them through an Ingester.
+type SyslogListener struct {
+	cfg       SyslogConfig
+	ingester  *Ingester
+	packet    net.PacketConn
+	listener  net.Listener
+	wg        sync.WaitGroup
+	malformed atomic.Uint64
+	closed    atomic.Bool
+}
+
+var errMalformedFrame = errors.New("malformed syslog frame")
+
+// syslog severities mapped onto the severities used by the rest of the system
+var syslogSeverities = [8]string{"ERROR", "ERROR", "ERROR", "ERROR", "WARN", "INFO", "INFO", "DEBUG"}
+
+var syslogSeverityNames = [8]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+func NewSyslogListener(ingester *Ingester, cfg SyslogConfig) (*SyslogListener, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("syslog address is required")
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = "udp"
+	}
+	if cfg.Protocol != "udp" && cfg.Protocol != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog protocol: %s", cfg.Protocol)
+	}
+
+	return &SyslogListener{
+		cfg:      cfg,
+		ingester: ingester,
+	}, nil
+}
+
+// Start binds the listen address and begins accepting frames in the
+// background.
+func (l *SyslogListener) Start() error {
+	switch l.cfg.Protocol {
+	case "udp":
+		conn, err := net.ListenPacket("udp", l.cfg.Address)
+		if err != nil {
+			return err
+		}
+		l.packet = conn
+		l.wg.Add(1)
+		go l.serveUDP()
+	case "tcp":
+		ln, err := net.Listen("tcp", l.cfg.Address)
+		if err != nil {
+			return err
+		}
+		l.listener = ln
+		l.wg.Add(1)
+		go l.serveTCP()
+	}
+	return nil
+}
+
+// Close stops the listener and waits for in-flight connections to finish.
+func (l *SyslogListener) Close() error {
+	l.closed.Store(true)
+
+	var err error
+	if l.packet != nil {
+		err = l.packet.Close()
+	}
+	if l.listener != nil {
+		err = l.listener.Close()
+	}
+	l.wg.Wait()
+	return err
+}
+
+// Addr returns the bound listen address.
+func (l *SyslogListener) Addr() net.Addr {
+	if l.packet != nil {
+		return l.packet.LocalAddr()
+	}
+	if l.listener != nil {
+		return l.listener.Addr()
+	}
+	return nil
+}
+
+// Malformed returns the number of frames that were dropped because they
+// could not be parsed or failed validation.
+func (l *SyslogListener) Malformed() uint64 {
+	return l.malformed.Load()
+}
+
+func (l *SyslogListener) serveUDP() {
+	defer l.wg.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := l.packet.ReadFrom(buf)
+		if err != nil {
+			if l.closed.Load() {
+				return
+			}
+			continue
+		}
+		l.handleFrame(buf[:n])
+	}
+}
+
+func (l *SyslogListener) serveTCP() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if l.closed.Load() {
+				return
+			}
+			continue
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer conn.Close()
+			l.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn reads frames from a stream, supporting both octet-counted
+// (RFC6587 "LEN SP MSG") and newline-delimited framing.
+func (l *SyslogListener) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		if l.closed.Load() {
+			return
+		}
+
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var frame []byte
+		if first[0] >= '0' && first[0] <= '9' {
+			lenStr, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, err := strconv.Atoi(strings.TrimSpace(lenStr))
+			if err != nil || size <= 0 || size > 1024*1024 {
+				// The stream is out of sync and can't be recovered
+				l.malformed.Add(1)
+				return
+			}
+			frame = make([]byte, size)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return
+			}
+		} else {
+			line, err := r.ReadBytes('\n')
+			if err != nil && len(line) == 0 {
+				return
+			}
+			frame = bytes.TrimRight(line, "\r\n")
+			if len(frame) == 0 {
+				continue
+			}
+		}
+
+		l.handleFrame(frame)
+	}
+}
+
+func (l *SyslogListener) handleFrame(frame []byte) {
+	log, err := parseSyslog(frame, time.Now())
+	if err != nil {
+		l.malformed.Add(1)
+		return
+	}
+	if log.ApplicationID == "" {
+		log.ApplicationID = l.cfg.ApplicationID
+	}
+
+	if err := l.ingester.ingest(context.Background(), log); err != nil {
+		l.malformed.Add(1)
+	}
+}
+
+// parseSyslog parses an RFC5424 frame, falling back to RFC3164.
+func parseSyslog(frame []byte, now time.Time) (*db.ApplicationLog, error) {
+	pri, rest, err := parsePriority(string(frame))
+	if err != nil {
+		return nil, err
+	}
+
+	var log *db.ApplicationLog
+	var fields map[string]interface{}
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		log, fields, err = parseRFC5424(rest[2:])
+	} else {
+		log, fields, err = parseRFC3164(rest, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	facility, severity := pri/8, pri%8
+	log.Severity = syslogSeverities[severity]
+	log.Source = "syslog"
+	fields["facility"] = facility
+	fields["severity"] = syslogSeverityNames[severity]
+
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	log.Payload = payload
+
+	return log, nil
+}
+
+func parsePriority(s string) (int, string, error) {
+	if len(s) < 3 || s[0] != '<' {
+		return 0, "", errMalformedFrame
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errMalformedFrame
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, "", errMalformedFrame
+	}
+	return pri, s[end+1:], nil
+}
+
+// parseRFC5424 parses everything after "<PRI>VERSION ".
+func parseRFC5424(s string) (*db.ApplicationLog, map[string]interface{}, error) {
+	header := make([]string, 5)
+	for i := range header {
+		idx := strings.IndexByte(s, ' ')
+		if idx <= 0 {
+			return nil, nil, errMalformedFrame
+		}
+		header[i], s = s[:idx], s[idx+1:]
+	}
+	timestamp, hostname, appName, procID, msgID := header[0], header[1], header[2], header[3], header[4]
+
+	log := &db.ApplicationLog{
+		ServiceName:   nilValue(hostname),
+		ApplicationID: nilValue(appName),
+		InstanceID:    nilValue(procID),
+	}
+	if timestamp != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, nil, errMalformedFrame
+		}
+		log.Timestamp = ts
+	}
+
+	fields := map[string]interface{}{}
+	if appName != "-" {
+		fields["app_name"] = appName
+	}
+	if msgID != "-" {
+		fields["msg_id"] = msgID
+	}
+
+	sd, msg, err := parseStructuredData(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sd) > 0 {
+		fields["structured_data"] = sd
+	}
+
+	msg = strings.TrimPrefix(msg, "\ufeff")
+	log.Message = strings.TrimSpace(msg)
+	return log, fields, nil
+}
+
+// parseStructuredData parses the STRUCTURED-DATA section and returns the
+// remaining message.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if strings.HasPrefix(s, "-") {
+		return nil, strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 2 {
+			return nil, "", errMalformedFrame
+		}
+		id := s[1:end]
+		params := make(map[string]string)
+		s = s[end:]
+
+		for {
+			s = strings.TrimLeft(s, " ")
+			if s == "" {
+				return nil, "", errMalformedFrame
+			}
+			if s[0] == ']' {
+				s = s[1:]
+				break
+			}
+
+			eq := strings.IndexByte(s, '=')
+			if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+				return nil, "", errMalformedFrame
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, "", errMalformedFrame
+			}
+			params[name] = value.String()
+		}
+		sd[id] = params
+	}
+
+	return sd, strings.TrimPrefix(s, " "), nil
+}
+
+// parseRFC3164 parses a BSD syslog frame after the priority:
+// "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG".
+func parseRFC3164(s string, now time.Time) (*db.ApplicationLog, map[string]interface{}, error) {
+	if len(s) < 16 || s[15] != ' ' {
+		return nil, nil, errMalformedFrame
+	}
+	ts, err := time.ParseInLocation(time.Stamp, s[:15], now.Location())
+	if err != nil {
+		return nil, nil, errMalformedFrame
+	}
+	// BSD timestamps carry no year; assume the most recent year the date
+	// exists in that isn't more than a day ahead of now, allowing for a
+	// sender's clock running slightly fast.
+	latest := now.Add(24 * time.Hour)
+	for year := latest.Year(); ; year-- {
+		dated := time.Date(year, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), 0, now.Location())
+		if dated.Day() == ts.Day() && !dated.After(latest) {
+			ts = dated
+			break
+		}
+	}
+	s = s[16:]
+
+	idx := strings.IndexByte(s, ' ')
+	if idx <= 0 {
+		return nil, nil, errMalformedFrame
+	}
+	log := &db.ApplicationLog{
+		ServiceName: s[:idx],
+		Timestamp:   ts,
+	}
+	s = s[idx+1:]
+
+	fields := map[string]interface{}{}
+	if colon := strings.Index(s, ": "); colon > 0 && !strings.ContainsAny(s[:colon], " ") {
+		tag := s[:colon]
+		s = s[colon+2:]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			log.InstanceID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		log.ApplicationID = tag
+		fields["app_name"] = tag
+	}
+
+	log.Message = strings.TrimSpace(s)
+	return log, fields, nil
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseRFC5424(t *testing.T) {
+	frame := `<165>1 2026-10-11T22:14:15.003Z web-1 checkout 8710 ID47 [exampleSDID@32473 iut="3" eventSource="App \"lication\" \]"][meta seq="1"] ` + "\ufeff" + `order failed`
+	log, err := parseSyslog([]byte(frame), time.Now())
+	if err != nil {
+		t.Fatalf("parseSyslog: %v", err)
+	}
+
+	if want := time.Date(2026, 10, 11, 22, 14, 15, 3e6, time.UTC); !log.Timestamp.Equal(want) {
+		t.Errorf("timestamp %v, want %v", log.Timestamp, want)
+	}
+	if log.ServiceName != "web-1" || log.ApplicationID != "checkout" || log.InstanceID != "8710" {
+		t.Errorf("host %q, app %q, proc %q; want web-1, checkout, 8710", log.ServiceName, log.ApplicationID, log.InstanceID)
+	}
+	if log.Message != "order failed" {
+		t.Errorf("message %q, want the BOM dropped", log.Message)
+	}
+	// <165> is facility 20 (local4), severity 5 (notice)
+	if log.Severity != "INFO" || log.Source != "syslog" {
+		t.Errorf("severity %q from %q, want INFO from syslog", log.Severity, log.Source)
+	}
+
+	var payload struct {
+		Facility       int                          `json:"facility"`
+		Severity       string                       `json:"severity"`
+		MsgID          string                       `json:"msg_id"`
+		StructuredData map[string]map[string]string `json:"structured_data"`
+	}
+	if err := json.Unmarshal(log.Payload, &payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if payload.Facility != 20 || payload.Severity != "notice" || payload.MsgID != "ID47" {
+		t.Errorf("payload facility %d, severity %q, msg id %q; want 20, notice, ID47", payload.Facility, payload.Severity, payload.MsgID)
+	}
+	sd := payload.StructuredData["exampleSDID@32473"]
+	if sd["iut"] != "3" || sd["eventSource"] != `App "lication" ]` || payload.StructuredData["meta"]["seq"] != "1" {
+		t.Errorf("structured data %v, want unescaped params from both elements", payload.StructuredData)
+	}
+}
+
+func TestParseRFC5424NilValues(t *testing.T) {
+	log, err := parseSyslog([]byte("<11>1 - - - - - - disk full"), time.Now())
+	if err != nil {
+		t.Fatalf("parseSyslog: %v", err)
+	}
+	if !log.Timestamp.IsZero() || log.ServiceName != "" || log.ApplicationID != "" || log.InstanceID != "" {
+		t.Errorf("nil values parsed as timestamp %v, host %q, app %q, proc %q", log.Timestamp, log.ServiceName, log.ApplicationID, log.InstanceID)
+	}
+	if log.Message != "disk full" || log.Severity != "ERROR" {
+		t.Errorf("message %q at %q, want disk full at ERROR", log.Message, log.Severity)
+	}
+}
+
+func TestParseRFC3164(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	log, err := parseSyslog([]byte("<12>Oct  7 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8"), now)
+	if err != nil {
+		t.Fatalf("parseSyslog: %v", err)
+	}
+	if want := time.Date(2026, 10, 7, 22, 14, 15, 0, time.UTC); !log.Timestamp.Equal(want) {
+		t.Errorf("timestamp %v, want %v", log.Timestamp, want)
+	}
+	if log.ServiceName != "mymachine" || log.ApplicationID != "su" || log.InstanceID != "230" {
+		t.Errorf("host %q, tag %q, pid %q; want mymachine, su, 230", log.ServiceName, log.ApplicationID, log.InstanceID)
+	}
+	if log.Message != "'su root' failed for lonvick on /dev/pts/8" || log.Severity != "WARN" {
+		t.Errorf("message %q at %q", log.Message, log.Severity)
+	}
+
+	// No tag
+	log, err = parseSyslog([]byte("<13>Oct 17 11:00:00 host just a message"), now)
+	if err != nil {
+		t.Fatalf("parseSyslog: %v", err)
+	}
+	if log.ApplicationID != "" || log.Message != "just a message" {
+		t.Errorf("untagged frame gave tag %q, message %q", log.ApplicationID, log.Message)
+	}
+}
+
+func TestParseRFC3164Year(t *testing.T) {
+	tests := []struct {
+		name  string
+		now   time.Time
+		stamp string
+		want  time.Time
+	}{
+		{"same year", time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), "Oct 17 11:59:00", time.Date(2026, 10, 17, 11, 59, 0, 0, time.UTC)},
+		{"sender clock slightly ahead", time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC), "Jan  1 00:30:00", time.Date(2027, 1, 1, 0, 30, 0, 0, time.UTC)},
+		{"last year's frame after new year", time.Date(2027, 1, 1, 0, 5, 0, 0, time.UTC), "Dec 31 23:59:59", time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{"more than a day ahead", time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), "Oct 19 12:00:00", time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)},
+		{"leap day outside a leap year", time.Date(2027, 3, 1, 12, 0, 0, 0, time.UTC), "Feb 29 12:00:00", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := parseSyslog([]byte("<14>"+tt.stamp+" host app: message"), tt.now)
+			if err != nil {
+				t.Fatalf("parseSyslog: %v", err)
+			}
+			if !log.Timestamp.Equal(tt.want) {
+				t.Errorf("%q at %v parsed as %v, want %v", tt.stamp, tt.now, log.Timestamp, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyslogRejectsMalformed(t *testing.T) {
+	for _, frame := range []string{
+		"",
+		"no priority",
+		"<192>1 - - - - - - priority out of range",
+		"<1x>Oct 17 11:00:00 host msg",
+		"<14>1 not-a-time host app - - - msg",
+		"<14>1 - host app",
+		`<14>1 - host app - - [id k="unterminated] msg`,
+		"<14>Foo 17 11:00:00 host msg",
+		"<14>Oct 17 11:00:00",
+	} {
+		if _, err := parseSyslog([]byte(frame), time.Now()); err == nil {
+			t.Errorf("parsed malformed frame %q", frame)
+		}
+	}
+}
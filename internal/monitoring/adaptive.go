@@ -0,0 +1,142 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/db"
+
+	"github.com/robfig/cron/v3"
+)
+
+// defaultStableChecks is how many consecutive successes lengthen an
+// adaptive target's interval, unless its config says otherwise.
+const defaultStableChecks = 5
+
+// adaptiveSpec is a target's adaptive scheduling config, e.g.
+//
+//	{"min_interval": "10s", "max_interval": "10m", "stable_checks": 5}
+type adaptiveSpec struct {
+	MinInterval  string `json:"min_interval"`
+	MaxInterval  string `json:"max_interval"`
+	StableChecks int    `json:"stable_checks"`
+}
+
+// adaptiveSchedule is a cron schedule whose interval follows the target's
+// results. It starts at the interval of the target's frequency, doubles
+// after every stable_checks consecutive successes and halves on each
+// failure, staying within min_interval and max_interval. A flapping
+// target, whose successes never add up to a stable run, keeps shortening.
+type adaptiveSchedule struct {
+	min, max     time.Duration
+	stableChecks int
+
+	mu       sync.Mutex
+	interval time.Duration
+	streak   int
+}
+
+// compileAdaptive parses a target's adaptive config; it returns nil when
+// there is none. schedule is the target's own frequency, whose interval
+// the adaptive one starts from.
+func compileAdaptive(raw json.RawMessage, schedule cron.Schedule) (*adaptiveSchedule, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var spec adaptiveSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid adaptive config: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	parse := func(field, value string) time.Duration {
+		if value == "" {
+			errs.Add(field, db.CodeRequired, fmt.Sprintf("%s is required", field))
+			return 0
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second {
+			errs.Add(field, db.CodeInvalid, fmt.Sprintf("%s must be a duration of at least 1s", field))
+			return 0
+		}
+		return d
+	}
+	s := &adaptiveSchedule{
+		min:          parse("min_interval", spec.MinInterval),
+		max:          parse("max_interval", spec.MaxInterval),
+		stableChecks: spec.StableChecks,
+	}
+	if s.min > 0 && s.max > 0 && s.max < s.min {
+		errs.Add("max_interval", db.CodeInvalid, "max_interval must not be below min_interval")
+	}
+	if spec.StableChecks < 0 {
+		errs.Add("stable_checks", db.CodeInvalid, "stable_checks must not be negative")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.stableChecks == 0 {
+		s.stableChecks = defaultStableChecks
+	}
+	first := schedule.Next(time.Now())
+	s.interval = min(max(schedule.Next(first).Sub(first), s.min), s.max)
+	return s, nil
+}
+
+// Next implements cron.Schedule.
+func (s *adaptiveSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.current())
+}
+
+func (s *adaptiveSchedule) current() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+// observe folds in a check's outcome, returning the interval until the
+// next check and whether it changed.
+func (s *adaptiveSchedule) observe(success bool) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.interval
+	if success {
+		s.streak++
+		if s.streak >= s.stableChecks {
+			s.streak = 0
+			s.interval = min(s.interval*2, s.max)
+		}
+	} else {
+		s.streak = 0
+		s.interval = max(s.interval/2, s.min)
+	}
+	return s.interval, s.interval != old
+}
+
+// adapt records a scheduled result on an adaptive target and, when the
+// interval changed, reschedules it so the next check comes after the new
+// interval rather than the old one.
+func (e *Engine) adapt(state *targetState, result *db.MonitoringResult) {
+	interval, changed := state.adaptive.observe(result.Success)
+	result.EffectiveInterval = interval.Seconds()
+	if !changed {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// A pause, update or removal since the check took the entry over
+	if e.targets[state.target.ID] != state || state.target.Paused {
+		return
+	}
+	e.cron.Remove(state.entryID)
+	if err := e.schedule(state); err != nil {
+		log.Printf("Failed to reschedule target %s: %v", state.target.ID, err)
+	}
+}
@@ -0,0 +1,254 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Aggregates a json_path rule can wrap its path in, such as
+// "all($.items[*].status)" or "count($.jobs[?(@.state=='failed')])". The
+// path may then select many values through [*] and [?(...)] steps.
+const (
+	// AggregateCount is the number of selected values; it is 0, not a
+	// failure, for an empty selection
+	AggregateCount = "count"
+	// AggregateAny passes when the operator holds for some selected value
+	AggregateAny = "any"
+	// AggregateAll passes when the operator holds for every selected value
+	AggregateAll = "all"
+	// AggregateMin, AggregateMax and AggregateAvg reduce the selected
+	// values, which must all be numbers
+	AggregateMin = "min"
+	AggregateMax = "max"
+	AggregateAvg = "avg"
+)
+
+var aggregates = []string{AggregateCount, AggregateAny, AggregateAll, AggregateMin, AggregateMax, AggregateAvg}
+
+// pathFilter keeps the array elements whose field at path equals value, or
+// with negate, those whose field doesn't. Elements missing the field never
+// equal it.
+type pathFilter struct {
+	path   []pathStep
+	value  interface{}
+	negate bool
+}
+
+func (f *pathFilter) matches(element interface{}) bool {
+	v, found := lookupPath(element, f.path)
+	equal := found && equalJSON(v, f.value)
+	return equal != f.negate
+}
+
+// splitAggregate splits "name(path)" into the aggregate and its path,
+// reporting whether path is wrapped in a known aggregate.
+func splitAggregate(path string) (string, string, bool) {
+	for _, name := range aggregates {
+		if strings.HasPrefix(path, name+"(") && strings.HasSuffix(path, ")") {
+			return name, path[len(name)+1 : len(path)-1], true
+		}
+	}
+	return "", "", false
+}
+
+// numericAggregate reports whether the aggregate reduces the selection to a
+// number compared against expected.
+func numericAggregate(name string) bool {
+	return name == AggregateCount || name == AggregateMin || name == AggregateMax || name == AggregateAvg
+}
+
+// parseMultiStep parses the wildcard or filter step at the start of rest,
+// returning it and the number of bytes it took.
+func parseMultiStep(path, rest string) (pathStep, int, error) {
+	if strings.HasPrefix(rest, "[*]") {
+		return pathStep{wildcard: true}, 3, nil
+	}
+	if !strings.HasPrefix(rest, "[?(") {
+		return pathStep{}, 0, fmt.Errorf("path %q is malformed at %q", path, rest)
+	}
+	end := strings.Index(rest, ")]")
+	if end < 0 {
+		return pathStep{}, 0, fmt.Errorf("path %q has an unclosed filter", path)
+	}
+	filter, err := parseFilter(path, rest[3:end])
+	if err != nil {
+		return pathStep{}, 0, err
+	}
+	return pathStep{filter: filter}, end + 2, nil
+}
+
+// parseFilter parses a filter expression "@.field==value" or
+// "@.field!=value". The value is JSON or a single-quoted string, and a bare
+// "@" compares the element itself.
+func parseFilter(path, expr string) (*pathFilter, error) {
+	i := strings.Index(expr, "==")
+	if j := strings.Index(expr, "!="); j >= 0 && (i < 0 || j < i) {
+		i = j
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("path %q has a filter without == or !=", path)
+	}
+	left := strings.TrimSpace(expr[:i])
+	right := strings.TrimSpace(expr[i+2:])
+
+	filter := &pathFilter{negate: expr[i] == '!'}
+	if !strings.HasPrefix(left, "@") {
+		return nil, fmt.Errorf("path %q has a filter that doesn't start with @", path)
+	}
+	if left != "@" {
+		fieldPath, err := parsePath(left[1:])
+		if err != nil {
+			return nil, fmt.Errorf("path %q has an invalid filter field: %v", path, err)
+		}
+		filter.path = fieldPath
+	}
+
+	if len(right) >= 2 && right[0] == '\'' && right[len(right)-1] == '\'' {
+		filter.value = right[1 : len(right)-1]
+		return filter, nil
+	}
+	value, err := decodeJSON([]byte(right))
+	if err != nil {
+		return nil, fmt.Errorf("path %q has an invalid filter value %q", path, right)
+	}
+	filter.value = value
+	return filter, nil
+}
+
+// selectPath follows path through doc, expanding wildcard and filter steps
+// into every matching value. It reports false when a key or index is
+// missing from any node along the way; a wildcard over an empty array or a
+// filter matching nothing is an empty selection, not a missing path.
+func selectPath(doc interface{}, path []pathStep) ([]interface{}, bool) {
+	if doc == nil {
+		return nil, false
+	}
+
+	nodes := []interface{}{doc}
+	for _, step := range path {
+		var next []interface{}
+		for _, node := range nodes {
+			switch {
+			case step.wildcard:
+				switch n := node.(type) {
+				case []interface{}:
+					next = append(next, n...)
+				case map[string]interface{}:
+					keys := make([]string, 0, len(n))
+					for k := range n {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, n[k])
+					}
+				default:
+					return nil, false
+				}
+			case step.filter != nil:
+				elements, ok := node.([]interface{})
+				if !ok {
+					return nil, false
+				}
+				for _, element := range elements {
+					if step.filter.matches(element) {
+						next = append(next, element)
+					}
+				}
+			default:
+				value, found := lookupPath(node, []pathStep{step})
+				if !found {
+					return nil, false
+				}
+				next = append(next, value)
+			}
+		}
+		nodes = next
+	}
+	return nodes, true
+}
+
+// evaluateAggregate applies a json_path rule with an aggregate to the
+// decoded body, returning the actual value as JSON, the reason for a
+// failure and whether it passed. Apart from count, an empty selection
+// fails, as does any value min, max or avg can't use as a number.
+func evaluateAggregate(rule responseRule, doc interface{}) (string, string, bool) {
+	if doc == nil {
+		return "", "response body is not JSON", false
+	}
+	values, found := selectPath(doc, rule.path)
+	if !found {
+		return "", fmt.Sprintf("%s: path not found", rule.Path), false
+	}
+	if values == nil {
+		values = []interface{}{}
+	}
+	encoded, _ := json.Marshal(values)
+
+	fail := func(actual, reason string) (string, string, bool) {
+		return actual, fmt.Sprintf("%s %s %s: %s", rule.Path, rule.Operator, rule.Expected, reason), false
+	}
+
+	if rule.aggregate == AggregateCount {
+		actual := json.Number(strconv.Itoa(len(values)))
+		if passed, reason := compare(rule.Operator, actual, rule.expected); !passed {
+			return fail(string(actual), reason)
+		}
+		return string(actual), "", true
+	}
+	if len(values) == 0 {
+		return string(encoded), fmt.Sprintf("%s selected no values", rule.Path), false
+	}
+
+	switch rule.aggregate {
+	case AggregateAny:
+		var first string
+		for i, v := range values {
+			passed, reason := compare(rule.Operator, v, rule.expected)
+			if passed {
+				return string(encoded), "", true
+			}
+			if i == 0 {
+				first = reason
+			}
+		}
+		return fail(string(encoded), fmt.Sprintf("no value matched; value 0: %s", first))
+	case AggregateAll:
+		for i, v := range values {
+			if passed, reason := compare(rule.Operator, v, rule.expected); !passed {
+				return fail(string(encoded), fmt.Sprintf("value %d: %s", i, reason))
+			}
+		}
+		return string(encoded), "", true
+	}
+
+	var result float64
+	for i, v := range values {
+		f, ok := toFloat(v)
+		if !ok {
+			return fail(string(encoded), fmt.Sprintf("value %d is %s, not a number", i, jsonType(v)))
+		}
+		switch {
+		case i == 0:
+			result = f
+		case rule.aggregate == AggregateMin && f < result:
+			result = f
+		case rule.aggregate == AggregateMax && f > result:
+			result = f
+		case rule.aggregate == AggregateAvg:
+			result += f
+		}
+	}
+	if rule.aggregate == AggregateAvg {
+		result /= float64(len(values))
+	}
+
+	actual := json.Number(strconv.FormatFloat(result, 'f', -1, 64))
+	if passed, reason := compare(rule.Operator, actual, rule.expected); !passed {
+		return fail(string(actual), reason)
+	}
+	return string(actual), "", true
+}
@@ -0,0 +1,366 @@
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Body matching modes for contains and equals rules
+const (
+	// MatchString compares raw bytes; it is the default
+	MatchString = "string"
+	// MatchJSON parses both sides and compares structurally, falling back to
+	// byte matching when either side isn't JSON
+	MatchJSON = "json"
+)
+
+// RuleResult records the outcome of a single assertion against a response.
+type RuleResult struct {
+	Type     string `json:"type"`
+	Path     string `json:"path,omitempty"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Passed   bool   `json:"passed"`
+	Message  string `json:"message,omitempty"`
+	// Severity is the assertion's severity, reported when it failed
+	Severity string `json:"severity,omitempty"`
+}
+
+// responseRule is one entry of a target's response_rules.
+type responseRule struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	Value string `json:"value"`
+	Mode  string `json:"mode"`
+	// Severity is reported when the rule fails: info, warning or critical.
+	// Defaults to critical.
+	Severity string `json:"severity"`
+	// Operator and Expected make up a json_path rule's comparison; see
+	// compare
+	Operator string          `json:"operator"`
+	Expected json.RawMessage `json:"expected"`
+
+	// maxResponseTime is the parsed value of a max_response_time rule
+	maxResponseTime time.Duration
+	// status is the parsed value of a status rule
+	status *statusMatcher
+	// path and expected are the parsed Path and Expected of json_path
+	// rules
+	path     []pathStep
+	expected interface{}
+	// aggregate is the function a json_path rule's Path is wrapped in, if
+	// any
+	aggregate string
+}
+
+// compileRules parses a target's response rules, reporting every rule with
+// an unknown type, mode, operator or severity, an invalid regex, path or
+// response time, or an expected value the operator can't use.
+func compileRules(raw json.RawMessage) ([]responseRule, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var rules []responseRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid response rules: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	for i := range rules {
+		compileRule(&rules[i], fmt.Sprintf("[%d]", i), &errs)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// compileRule checks one rule, reporting its problems under field and
+// storing parsed values on rule.
+func compileRule(rule *responseRule, field string, errs *db.ValidationErrors) {
+	switch rule.Type {
+	case "json_path_exists":
+		if rule.Path == "" {
+			errs.Add(field+".path", db.CodeRequired, "path is required")
+			break
+		}
+		path, err := parsePath(rule.Path)
+		if err != nil {
+			errs.Add(field+".path", db.CodeInvalid, err.Error())
+		}
+		rule.path = path
+	case "json_path":
+		compileJSONPathRule(rule, field, errs)
+	case "contains", "equals", "body_changed":
+	case "status":
+		status, err := compileStatus(strings.Split(rule.Value, ","))
+		errs.Merge(field+".value", err)
+		rule.status = status
+	case "header_exists":
+		if rule.Value == "" {
+			errs.Add(field+".value", db.CodeRequired, "value must name a header")
+		}
+	case "regex":
+		if _, err := regexp.Compile(rule.Value); err != nil {
+			errs.Add(field+".value", db.CodeInvalid, fmt.Sprintf("invalid regex: %v", err))
+		}
+	case "max_response_time":
+		d, err := time.ParseDuration(rule.Value)
+		if err != nil || d <= 0 {
+			errs.Add(field+".value", db.CodeInvalid, "value must be a positive duration such as 500ms")
+		}
+		rule.maxResponseTime = d
+	case "":
+		errs.Add(field+".type", db.CodeRequired, "type is required")
+	default:
+		errs.Add(field+".type", db.CodeUnsupported, fmt.Sprintf("unknown rule type %q", rule.Type))
+	}
+
+	switch rule.Mode {
+	case "", MatchString, MatchJSON:
+	default:
+		errs.Add(field+".mode", db.CodeUnsupported, fmt.Sprintf("unknown match mode %q", rule.Mode))
+	}
+
+	if rule.Severity == "" {
+		rule.Severity = db.ResultSeverityCritical
+	} else if db.ResultSeverityRank(rule.Severity) == 0 {
+		errs.Add(field+".severity", db.CodeUnsupported, fmt.Sprintf("unknown severity %q", rule.Severity))
+	}
+}
+
+// checkAssertions evaluates the expected status and every response rule,
+// recording each outcome in result.RuleResults. It reports whether all of
+// them passed, and otherwise the worst severity among those that failed. A
+// wrong status is always critical. A target's success expression, when set,
+// decides instead; its failure is critical.
+func (e *Engine) checkAssertions(state *targetState, result *db.MonitoringResult, header http.Header) (bool, string) {
+	target := state.target
+	var ruleResults []RuleResult
+	success := true
+	severity := ""
+
+	// The body is decoded once, on first use by a JSON path rule
+	var doc interface{}
+	decoded := false
+	body := func() interface{} {
+		if !decoded {
+			doc, _ = decodeJSON(result.ResponseBody)
+			decoded = true
+		}
+		return doc
+	}
+
+	fail := func(rr *RuleResult, s string) {
+		rr.Passed = false
+		rr.Severity = s
+		success = false
+		if db.ResultSeverityRank(s) > db.ResultSeverityRank(severity) {
+			severity = s
+		}
+	}
+
+	// Check status code
+	statusValid := state.status.matches(result.StatusCode)
+	statusResult := RuleResult{
+		Type:     "status",
+		Expected: fmt.Sprint(target.ExpectedStatus),
+		Actual:   strconv.Itoa(result.StatusCode),
+		Passed:   statusValid,
+	}
+	if !statusValid {
+		statusResult.Message = fmt.Sprintf("status %d not in %v", result.StatusCode, target.ExpectedStatus)
+		fail(&statusResult, db.ResultSeverityCritical)
+	}
+	ruleResults = append(ruleResults, statusResult)
+
+	// Check response rules
+	for _, rule := range state.rules {
+		rr := evaluateRule(rule, result, header, body)
+		if !rr.Passed {
+			fail(&rr, rule.Severity)
+		}
+		ruleResults = append(ruleResults, rr)
+	}
+
+	if state.success != nil {
+		passed, reason := state.success.eval(result, header, body)
+		rr := RuleResult{
+			Type:     "success_expression",
+			Expected: "true",
+			Actual:   strconv.FormatBool(passed),
+			Passed:   passed,
+			Message:  reason,
+		}
+		if !passed {
+			rr.Severity = db.ResultSeverityCritical
+		}
+		ruleResults = append(ruleResults, rr)
+		success, severity = passed, rr.Severity
+	}
+
+	if encoded, err := json.Marshal(ruleResults); err == nil {
+		result.RuleResults = encoded
+	}
+
+	return success, severity
+}
+
+// evaluateRule applies one response rule to a check's result and response
+// headers. body returns the decoded response body.
+func evaluateRule(rule responseRule, result *db.MonitoringResult, header http.Header, body func() interface{}) RuleResult {
+	rr := RuleResult{
+		Type:     rule.Type,
+		Path:     rule.Path,
+		Expected: rule.Value,
+		Passed:   true,
+	}
+
+	switch rule.Type {
+	case "json_path_exists":
+		if _, found := lookupPath(body(), rule.path); !found {
+			rr.Passed = false
+			rr.Message = fmt.Sprintf("path %s not found", rule.Path)
+		}
+	case "json_path":
+		rr.Expected = string(rule.Expected)
+		rr.Actual, rr.Message, rr.Passed = evaluateJSONPath(rule, body())
+	case "contains", "equals":
+		matched, err := matchBody(rule.Type, rule.Mode, result.ResponseBody, []byte(rule.Value))
+		switch {
+		case err != nil:
+			rr.Passed = false
+			rr.Message = err.Error()
+		case !matched && rule.Type == "contains":
+			rr.Passed = false
+			rr.Message = fmt.Sprintf("body did not contain %q", rule.Value)
+		case !matched:
+			rr.Passed = false
+			rr.Message = fmt.Sprintf("body did not equal %q", rule.Value)
+		}
+	case "regex":
+		// Implementation for regex matching
+		rr.Message = "not evaluated"
+	case "body_changed":
+		rr.Expected = "unchanged"
+		rr.Actual = result.BodyHash
+		if result.BodyChanged {
+			rr.Passed = false
+			rr.Message = "body changed since the previous check"
+		}
+	case "max_response_time":
+		rr.Actual = fmt.Sprintf("%dms", int64(result.ResponseTime*1000))
+		if result.ResponseTime > rule.maxResponseTime.Seconds() {
+			rr.Passed = false
+			rr.Message = fmt.Sprintf("response took longer than %s", rule.maxResponseTime)
+		}
+	case "status":
+		rr.Actual = strconv.Itoa(result.StatusCode)
+		if !rule.status.matches(result.StatusCode) {
+			rr.Passed = false
+			rr.Message = fmt.Sprintf("status %d not in %s", result.StatusCode, rule.Value)
+		}
+	case "header_exists":
+		if header.Get(rule.Value) == "" {
+			rr.Passed = false
+			rr.Message = fmt.Sprintf("header %s not present", rule.Value)
+		}
+	}
+
+	return rr
+}
+
+// matchBody applies a contains or equals rule to body in the given mode.
+func matchBody(ruleType, mode string, body, expected []byte) (bool, error) {
+	switch mode {
+	case "", MatchString:
+	case MatchJSON:
+		var actualValue, expectedValue interface{}
+		if json.Unmarshal(body, &actualValue) == nil && json.Unmarshal(expected, &expectedValue) == nil {
+			if ruleType == "equals" {
+				return reflect.DeepEqual(actualValue, expectedValue), nil
+			}
+			return jsonContains(actualValue, expectedValue), nil
+		}
+	default:
+		return false, fmt.Errorf("unknown match mode %q", mode)
+	}
+
+	if ruleType == "equals" {
+		return bytes.Equal(body, expected), nil
+	}
+	return bytes.Contains(body, expected), nil
+}
+
+// jsonContains reports whether expected is a structural subset of actual:
+// every expected object key is present with a matching value, and every
+// expected array element matches some actual element. Expected values are
+// also searched for anywhere inside actual.
+func jsonContains(actual, expected interface{}) bool {
+	if jsonSubset(actual, expected) {
+		return true
+	}
+
+	switch a := actual.(type) {
+	case map[string]interface{}:
+		for _, v := range a {
+			if jsonContains(v, expected) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range a {
+			if jsonContains(v, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonSubset(actual, expected interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, ev := range e {
+			av, exists := a[k]
+			if !exists || !jsonSubset(av, ev) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, ev := range e {
+			found := false
+			for _, av := range a {
+				if jsonSubset(av, ev) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(actual, expected)
+	}
+}
@@ -0,0 +1,139 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"api-watchtower/internal/db"
+)
+
+// bodyGenerator streams a generated request body, so large uploads never
+// sit in memory: either size bytes of a repeated pattern, or a file under
+// the engine's body directory. A target configures it as JSON such as
+//
+//	{"size": 104857600, "pattern": "0123456789abcdef"}
+//	{"file": "uploads/sample.bin", "content_type": "image/png"}
+type bodyGenerator struct {
+	Size        int64  `json:"size"`
+	Pattern     string `json:"pattern"`
+	File        string `json:"file"`
+	ContentType string `json:"content_type"`
+}
+
+// defaultBodyPattern fills generated bodies without a pattern.
+const defaultBodyPattern = "\x00"
+
+// compileBodyGenerator parses a target's body generator, returning nil for
+// none.
+func compileBodyGenerator(raw json.RawMessage) (*bodyGenerator, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var gen bodyGenerator
+	if err := json.Unmarshal(raw, &gen); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid body generator: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	switch {
+	case gen.File != "" && (gen.Size != 0 || gen.Pattern != ""):
+		errs.Add("file", db.CodeInvalid, "file can't be combined with size or pattern")
+	case gen.File != "":
+		if !filepath.IsLocal(gen.File) {
+			errs.Add("file", db.CodeInvalid, fmt.Sprintf("file %q must be a relative path within the body directory", gen.File))
+		}
+	case gen.Size <= 0:
+		errs.Add("size", db.CodeRequired, "size must be positive, or set file instead")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	if gen.File == "" && gen.Pattern == "" {
+		gen.Pattern = defaultBodyPattern
+	}
+	if gen.ContentType == "" {
+		gen.ContentType = "application/octet-stream"
+	}
+	return &gen, nil
+}
+
+// open returns a fresh reader over the body and its length. dir is the
+// engine's body directory, which file bodies can't escape.
+func (g *bodyGenerator) open(dir string) (io.ReadCloser, int64, error) {
+	if g.File == "" {
+		return io.NopCloser(&patternReader{pattern: []byte(g.Pattern), remaining: g.Size}), g.Size, nil
+	}
+
+	if dir == "" {
+		return nil, 0, fmt.Errorf("file body %q needs a body directory", g.File)
+	}
+	f, err := os.OpenInRoot(dir, g.File)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, fmt.Errorf("file body %q is not a regular file", g.File)
+	}
+	return f, info.Size(), nil
+}
+
+// setBody streams the generated body as req's body. Redirects that resend
+// it reopen the generator.
+func (g *bodyGenerator) setBody(req *http.Request, dir string) error {
+	body, size, err := g.open(dir)
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	req.ContentLength = size
+	req.GetBody = func() (io.ReadCloser, error) {
+		body, _, err := g.open(dir)
+		return body, err
+	}
+	if size == 0 {
+		// A zero ContentLength with a non-nil Body means unknown length
+		req.Body.Close()
+		req.Body = http.NoBody
+	}
+	return nil
+}
+
+// patternReader yields remaining bytes of pattern repeated.
+type patternReader struct {
+	pattern   []byte
+	offset    int
+	remaining int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.pattern[r.offset:])
+		n += c
+		r.offset = (r.offset + c) % len(r.pattern)
+	}
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// SetBodyDir sets the directory that body generators' files are read from.
+// Without one, checks of targets with a file body fail.
+func (e *Engine) SetBodyDir(dir string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bodyDir = dir
+}
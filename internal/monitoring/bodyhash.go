@@ -0,0 +1,122 @@
+package monitoring
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"api-watchtower/internal/db"
+)
+
+// Body hash normalizations
+const (
+	// NormalizeNone hashes the raw body bytes; it is the default
+	NormalizeNone = "none"
+	// NormalizeJSON hashes a canonical encoding of JSON bodies, so key
+	// order and whitespace don't count as changes. Bodies that aren't JSON
+	// are hashed raw.
+	NormalizeJSON = "json"
+)
+
+// BodyHashConfig makes the engine hash each response body so content
+// changes can be detected between checks.
+type BodyHashConfig struct {
+	Normalize string `json:"normalize"`
+	// IgnorePaths lists object fields dropped before hashing a JSON body,
+	// e.g. "$.generated_at", so volatile values don't count as changes.
+	// They imply json normalization.
+	IgnorePaths []string `json:"ignore_paths"`
+}
+
+type bodyHasher struct {
+	normalizeJSON bool
+	ignore        [][]pathStep
+}
+
+// compileBodyHash parses a target's body hash config. Without one, hashing
+// is only enabled, with the defaults, when a body_changed rule needs it.
+func compileBodyHash(raw json.RawMessage, rules []responseRule) (*bodyHasher, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		for _, rule := range rules {
+			if rule.Type == "body_changed" {
+				return &bodyHasher{}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	var cfg BodyHashConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid body hash config: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	h := &bodyHasher{normalizeJSON: cfg.Normalize == NormalizeJSON || len(cfg.IgnorePaths) > 0}
+	switch cfg.Normalize {
+	case "", NormalizeNone, NormalizeJSON:
+	default:
+		errs.Add("normalize", db.CodeUnsupported, fmt.Sprintf("unknown normalization %q; use none or json", cfg.Normalize))
+	}
+	for i, p := range cfg.IgnorePaths {
+		path, err := parsePath(p)
+		if err == nil && path[len(path)-1].key == "" {
+			err = fmt.Errorf("path %q must end in an object field", p)
+		}
+		if err != nil {
+			errs.Add(fmt.Sprintf("ignore_paths[%d]", i), db.CodeInvalid, err.Error())
+			continue
+		}
+		h.ignore = append(h.ignore, path)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// hash returns the hex SHA-256 of the normalized body.
+func (h *bodyHasher) hash(body []byte) string {
+	if h.normalizeJSON {
+		if doc, err := decodeJSON(body); err == nil {
+			for _, path := range h.ignore {
+				removePath(doc, path)
+			}
+			// encoding/json writes object keys in sorted order
+			if canonical, err := json.Marshal(doc); err == nil {
+				body = canonical
+			}
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// removePath deletes the object field path ends in, if it exists.
+func removePath(doc interface{}, path []pathStep) {
+	parent, found := lookupPath(doc, path[:len(path)-1])
+	if !found {
+		return
+	}
+	if obj, ok := parent.(map[string]interface{}); ok {
+		delete(obj, path[len(path)-1].key)
+	}
+}
+
+// observeBody hashes the response body into result and flags whether it
+// differs from the last check that got an expected status. Only such checks
+// move the baseline, so an error page doesn't become the reference.
+func (state *targetState) observeBody(result *db.MonitoringResult, body []byte, statusOK bool) {
+	if state.bodyHash == nil {
+		return
+	}
+
+	result.BodyHash = state.bodyHash.hash(body)
+
+	state.bodyMu.Lock()
+	defer state.bodyMu.Unlock()
+	if statusOK {
+		result.BodyChanged = state.lastBodyHash != "" && state.lastBodyHash != result.BodyHash
+		state.lastBodyHash = result.BodyHash
+	}
+}
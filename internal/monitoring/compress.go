@@ -0,0 +1,140 @@
+package monitoring
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"api-watchtower/internal/db"
+)
+
+// EncodingGzip marks results whose headers and body are gzip compressed.
+const EncodingGzip = "gzip"
+
+// defaultCompressMinSize is the smallest body worth compressing; below it
+// the gzip header outweighs the savings.
+const defaultCompressMinSize = 256
+
+// compressedStorage gzips response headers and bodies on the way into the
+// wrapped storage and restores them on the way out. The compressed bytes
+// go in the results' binary CompressedHeaders and CompressedBody, since the
+// response fields are stored as JSON.
+type compressedStorage struct {
+	Storage
+	minSize int
+}
+
+// NewCompressedStorage wraps storage so result headers and bodies are stored
+// gzip compressed. Results whose body is smaller than minSize bytes (256 if
+// zero), or that don't shrink, are stored as is. Results are always returned
+// decompressed, so callers are unaffected.
+func NewCompressedStorage(storage Storage, minSize int) Storage {
+	if minSize <= 0 {
+		minSize = defaultCompressMinSize
+	}
+	return &compressedStorage{Storage: storage, minSize: minSize}
+}
+
+func (s *compressedStorage) SaveResult(ctx context.Context, result *db.MonitoringResult) error {
+	if result.Encoding != "" || len(result.ResponseBody) < s.minSize {
+		return s.Storage.SaveResult(ctx, result)
+	}
+
+	body, err := gzipBytes(result.ResponseBody)
+	if err != nil {
+		return fmt.Errorf("failed to compress response body: %v", err)
+	}
+	if len(body) >= len(result.ResponseBody) {
+		return s.Storage.SaveResult(ctx, result)
+	}
+	headers, err := gzipBytes(result.ResponseHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to compress response headers: %v", err)
+	}
+
+	// The caller keeps using its result, so a copy is compressed
+	stored := *result
+	stored.ResponseBody = nil
+	stored.ResponseHeaders = nil
+	stored.CompressedBody = body
+	stored.CompressedHeaders = headers
+	stored.Encoding = EncodingGzip
+	return s.Storage.SaveResult(ctx, &stored)
+}
+
+func (s *compressedStorage) GetResults(ctx context.Context, query ResultQuery) ([]*db.MonitoringResult, error) {
+	results, err := s.Storage.GetResults(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if err := decompressResult(r); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (s *compressedStorage) StreamResults(ctx context.Context, query ResultQuery, fn func(*db.MonitoringResult) error) error {
+	return s.Storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		if err := decompressResult(r); err != nil {
+			return err
+		}
+		return fn(r)
+	})
+}
+
+// decompressResult decodes a stored result's headers and body in place.
+func decompressResult(r *db.MonitoringResult) error {
+	switch r.Encoding {
+	case "":
+		return nil
+	case EncodingGzip:
+	default:
+		return fmt.Errorf("result %s has unknown encoding %q", r.ID, r.Encoding)
+	}
+
+	body, err := gunzipBytes(r.CompressedBody)
+	if err != nil {
+		return fmt.Errorf("failed to decompress body of result %s: %v", r.ID, err)
+	}
+	headers, err := gunzipBytes(r.CompressedHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to decompress headers of result %s: %v", r.ID, err)
+	}
+	r.ResponseBody = body
+	r.ResponseHeaders = headers
+	r.Encoding = ""
+	r.CompressedBody = nil
+	r.CompressedHeaders = nil
+	return nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,119 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+// memStorage is an in-memory Storage that keeps results as stored.
+type memStorage struct {
+	mu      sync.Mutex
+	results []*db.MonitoringResult
+	digests map[string][]byte
+	// saveErr fails SaveResult while set
+	saveErr error
+}
+
+func (s *memStorage) SaveResult(ctx context.Context, result *db.MonitoringResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	copied := *result
+	s.results = append(s.results, &copied)
+	return nil
+}
+
+func (s *memStorage) GetResults(ctx context.Context, query ResultQuery) ([]*db.MonitoringResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*db.MonitoringResult
+	for _, r := range s.results {
+		if query.TargetID == "" || r.TargetID == query.TargetID {
+			copied := *r
+			results = append(results, &copied)
+		}
+	}
+	return results, nil
+}
+
+func (s *memStorage) StreamResults(ctx context.Context, query ResultQuery, fn func(*db.MonitoringResult) error) error {
+	results, _ := s.GetResults(ctx, query)
+	for _, r := range results {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStorage) SaveDigest(ctx context.Context, targetID string, digest []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.digests == nil {
+		s.digests = make(map[string][]byte)
+	}
+	s.digests[targetID] = digest
+	return nil
+}
+
+func (s *memStorage) LoadDigest(ctx context.Context, targetID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.digests[targetID], nil
+}
+
+func TestCompressedStorageShrinksBodies(t *testing.T) {
+	inner := &memStorage{}
+	storage := NewCompressedStorage(inner, 0)
+
+	body := json.RawMessage(`{"items":[` + strings.Repeat(`{"status":"ok","region":"eu-west-1"},`, 200) + `{}]}`)
+	headers := json.RawMessage(`{"Content-Type":["application/json"]}`)
+	result := &db.MonitoringResult{ID: "r1", TargetID: "t1", ResponseHeaders: headers, ResponseBody: body}
+	if err := storage.SaveResult(context.Background(), result); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+
+	stored := inner.results[0]
+	if stored.Encoding != EncodingGzip {
+		t.Fatalf("stored encoding %q, want %q", stored.Encoding, EncodingGzip)
+	}
+	if stored.ResponseBody != nil || stored.ResponseHeaders != nil {
+		t.Error("compressed result still carries the JSON response fields")
+	}
+	if len(stored.CompressedBody)*5 > len(body) {
+		t.Errorf("stored %d compressed bytes for a %d byte body, want at least 5x smaller", len(stored.CompressedBody), len(body))
+	}
+	if !bytes.Equal(result.ResponseBody, body) {
+		t.Error("SaveResult modified the caller's result")
+	}
+
+	results, err := storage.GetResults(context.Background(), ResultQuery{TargetID: "t1"})
+	if err != nil {
+		t.Fatalf("GetResults: %v", err)
+	}
+	got := results[0]
+	if !bytes.Equal(got.ResponseBody, body) || !bytes.Equal(got.ResponseHeaders, headers) || got.Encoding != "" {
+		t.Errorf("read back body %q, headers %q, encoding %q", got.ResponseBody, got.ResponseHeaders, got.Encoding)
+	}
+}
+
+func TestCompressedStorageKeepsSmallBodies(t *testing.T) {
+	inner := &memStorage{}
+	storage := NewCompressedStorage(inner, 0)
+
+	body := json.RawMessage(`{"status":"ok"}`)
+	if err := storage.SaveResult(context.Background(), &db.MonitoringResult{ID: "r1", ResponseBody: body}); err != nil {
+		t.Fatalf("SaveResult: %v", err)
+	}
+	if stored := inner.results[0]; stored.Encoding != "" || !bytes.Equal(stored.ResponseBody, body) {
+		t.Errorf("small body stored with encoding %q as %q", stored.Encoding, stored.ResponseBody)
+	}
+}
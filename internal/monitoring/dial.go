@@ -0,0 +1,90 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialTimeout and dialKeepAlive match http.DefaultTransport's dialer.
+const (
+	dialTimeout   = 30 * time.Second
+	dialKeepAlive = 30 * time.Second
+)
+
+// compileDialAddress checks a target's dial address override against its
+// URL and returns both as host:port: the address to connect to and the
+// URL's own, which requests still name in the Host header and TLS SNI. The
+// override may be a host name, an IPv4 address or an IPv6 literal, bare or
+// in brackets, with or without a port; a missing port is the URL's.
+func compileDialAddress(dialAddress, rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid url %q", rawURL)
+	}
+	urlPort := u.Port()
+	if urlPort == "" {
+		urlPort = "80"
+		if u.Scheme == "https" {
+			urlPort = "443"
+		}
+	}
+	origin := net.JoinHostPort(u.Hostname(), urlPort)
+
+	var host, port string
+	switch {
+	case strings.HasPrefix(dialAddress, "[") && strings.HasSuffix(dialAddress, "]"):
+		host = dialAddress[1 : len(dialAddress)-1]
+	case strings.HasPrefix(dialAddress, "["):
+		if host, port, err = net.SplitHostPort(dialAddress); err != nil {
+			return "", "", fmt.Errorf("invalid dial address %q: %v", dialAddress, err)
+		}
+	case strings.Count(dialAddress, ":") > 1:
+		// A bare IPv6 literal; a port needs brackets
+		host = dialAddress
+	case strings.Contains(dialAddress, ":"):
+		if host, port, err = net.SplitHostPort(dialAddress); err != nil {
+			return "", "", fmt.Errorf("invalid dial address %q: %v", dialAddress, err)
+		}
+	default:
+		host = dialAddress
+	}
+
+	if host == "" {
+		return "", "", fmt.Errorf("dial address %q has no host", dialAddress)
+	}
+	if strings.Contains(host, ":") {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return "", "", fmt.Errorf("dial address %q is not a valid IPv6 address", dialAddress)
+		}
+	}
+	if port == "" {
+		port = urlPort
+	} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("dial address %q has an invalid port", dialAddress)
+	}
+	return net.JoinHostPort(host, port), origin, nil
+}
+
+// newDialClient returns a client that connects to dialAddr whenever a
+// request is for origin, leaving the Host header, TLS SNI and certificate
+// checks on origin's host. Redirects elsewhere are dialed normally.
+// Proxies are bypassed, since the point is to reach one backend directly.
+func newDialClient(dialAddr, origin string) *http.Client {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: dialKeepAlive}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == origin {
+			addr = dialAddr
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &http.Client{Transport: transport}
+}
@@ -6,66 +6,388 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
+	"api-watchtower/internal/coalesce"
 	"api-watchtower/internal/db"
+	"api-watchtower/internal/pubsub"
 
 	"github.com/robfig/cron/v3"
 )
 
+// scheduleParser parses target frequencies, which include a seconds field.
+var scheduleParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 type Engine struct {
 	client  *http.Client
 	cron    *cron.Cron
-	targets map[string]*db.MonitoringTarget
+	storage Storage
+	targets map[string]*targetState
 	mu      sync.RWMutex
+
+	// summaries coalesces identical concurrent ExactSummary calls
+	summaries coalesce.Group[*Summary]
+	// live fans recorded results out to SubscribeResults subscribers
+	live pubsub.Broker[*db.MonitoringResult]
+	// healthWeights weighs the components of TargetHealthScore
+	healthWeights HealthWeights
+	// secrets resolves ${secret:NAME} references in headers and auth
+	secrets SecretProvider
+	// bodyDir holds the files body generators may stream
+	bodyDir string
+}
+
+// targetState is what the engine keeps for a registered target: its
+// schedule and everything compiled from its configuration.
+type targetState struct {
+	target   *db.MonitoringTarget
+	entryID  cron.EntryID
+	redactor *redactor
+	status   *statusMatcher
+	rules    []responseRule
+	metrics  []metricExtractor
+	// latency tracks response times of scheduled checks for percentile
+	// summaries
+	latency *tdigest
+	// resumeTimer resumes a paused target at its ResumeAt
+	resumeTimer *time.Timer
+	// slo is nil for targets without an SLO
+	slo *sloSpec
+	// bodyHash is nil for targets without body hashing; lastBodyHash is
+	// the baseline body_changed compares against
+	bodyHash     *bodyHasher
+	bodyMu       sync.Mutex
+	lastBodyHash string
+	// success overrides the status and rules in deciding result.Success;
+	// nil for targets without a success expression
+	success *successExpr
+	// client dials the target's DialAddress; nil for targets without one,
+	// which use the engine's client
+	client *http.Client
+	// bodyGen streams the request body; nil for targets without a body
+	// generator
+	bodyGen *bodyGenerator
+	// adaptive schedules the checks in place of the frequency; nil for
+	// targets without adaptive scheduling
+	adaptive *adaptiveSchedule
+	// detail is the baseline of a store-on-change target, empty until its
+	// first stored result
+	detailMu sync.Mutex
+	detail   detailBaseline
+	// trend is the cached latency trend Summary reports, refreshed every
+	// trendRefreshInterval; trendCached tells a nil trend from none yet
+	trendMu     sync.Mutex
+	trend       *LatencyTrend
+	trendCached bool
 }
 
-func NewEngine() *Engine {
-	return &Engine{
-		client: &http.Client{},
-		cron:   cron.New(cron.WithSeconds()),
-		targets: make(map[string]*db.MonitoringTarget),
+// allowedMethods are the HTTP methods a target may use; an empty method
+// means GET.
+var allowedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// digestPersistEvery is how many checks pass between saves of a target's
+// latency digest. Stop saves every digest, so only a crash loses checks.
+const digestPersistEvery = 20
+
+// NewEngine returns an engine recording results to storage. Response
+// headers and bodies are stored compressed, as by NewCompressedStorage.
+func NewEngine(storage Storage) *Engine {
+	e := &Engine{
+		client:  &http.Client{},
+		cron:    cron.New(cron.WithParser(scheduleParser)),
+		storage: NewCompressedStorage(storage, 0),
+		targets: make(map[string]*targetState),
+
+		healthWeights: DefaultHealthWeights,
 	}
+	e.cron.Schedule(cron.Every(trendRefreshInterval), cron.FuncJob(e.refreshTrends))
+	return e
 }
 
 func (e *Engine) Start() {
 	e.cron.Start()
 }
 
-func (e *Engine) Stop() {
-	e.cron.Stop()
+// Stop stops scheduling checks, waits for running ones to finish and be
+// recorded, then saves every target's latency digest. If ctx ends first it
+// returns ctx's error; those checks carry on in the background and the
+// digests aren't saved.
+func (e *Engine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	for _, state := range e.targets {
+		if state.resumeTimer != nil {
+			state.resumeTimer.Stop()
+		}
+	}
+	e.mu.Unlock()
+
+	running := e.cron.Stop()
+	select {
+	case <-running.Done():
+	case <-ctx.Done():
+		return fmt.Errorf("monitoring checks still running: %v", ctx.Err())
+	}
+
+	e.mu.RLock()
+	states := make([]*targetState, 0, len(e.targets))
+	for _, state := range e.targets {
+		states = append(states, state)
+	}
+	e.mu.RUnlock()
+	for _, state := range states {
+		if state.latency.Count() > 0 {
+			e.persistDigest(ctx, state)
+		}
+	}
+	return nil
 }
 
 func (e *Engine) AddTarget(target *db.MonitoringTarget) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	state, err := e.compileTarget(target)
+	if err != nil {
+		return err
+	}
+
 	if _, exists := e.targets[target.ID]; exists {
 		e.removeTarget(target.ID)
 	}
 
-	e.targets[target.ID] = target
+	e.restoreDigest(state)
+
+	// A target registered as paused stays paused until its ResumeAt
+	if target.Paused {
+		resumeAt := time.Time{}
+		if target.ResumeAt != nil {
+			resumeAt = *target.ResumeAt
+		}
+		e.scheduleResume(state, resumeAt)
+	} else if err := e.schedule(state); err != nil {
+		return err
+	}
+
+	e.targets[target.ID] = state
+	return nil
+}
+
+// compileTarget validates a target's configuration and prepares the parts
+// that are reused on every check. Problems are returned together as
+// db.ValidationErrors.
+func (e *Engine) compileTarget(target *db.MonitoringTarget) (*targetState, error) {
+	var errs db.ValidationErrors
+
+	if target.URL == "" {
+		errs.Add("url", db.CodeRequired, "url is required")
+	} else if u, err := url.Parse(target.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", db.CodeInvalid, fmt.Sprintf("invalid url %q", target.URL))
+	}
+	switch {
+	case target.Method != "" && !allowedMethods[target.Method]:
+		errs.Add("method", db.CodeUnsupported, fmt.Sprintf("unsupported method %q; use GET, HEAD, POST, PUT, PATCH, DELETE or OPTIONS", target.Method))
+	case hasBody(target) && (target.Method == "" || target.Method == http.MethodGet || target.Method == http.MethodHead):
+		errs.Add("body", db.CodeInvalid, fmt.Sprintf("%s requests can't have a body", methodOrGet(target.Method)))
+	case hasBody(target) && len(target.BodyGenerator) > 0 && string(target.BodyGenerator) != "null":
+		errs.Add("body_generator", db.CodeInvalid, "body and body_generator can't both be set")
+	}
+	if len(target.Headers) > 0 {
+		var headers map[string]string
+		if err := json.Unmarshal(target.Headers, &headers); err != nil {
+			errs.Add("headers", db.CodeInvalid, "headers must be an object of strings")
+		}
+	}
+	var adaptive *adaptiveSchedule
+	if target.Frequency == "" {
+		errs.Add("frequency", db.CodeRequired, "frequency is required")
+	} else if schedule, err := scheduleParser.Parse(target.Frequency); err != nil {
+		errs.Add("frequency", db.CodeInvalid, fmt.Sprintf("invalid frequency: %v", err))
+	} else {
+		adaptive, err = compileAdaptive(target.Adaptive, schedule)
+		errs.Merge("adaptive", err)
+	}
+	if target.Timeout == "" {
+		errs.Add("timeout", db.CodeRequired, "timeout is required")
+	} else if timeout, err := time.ParseDuration(target.Timeout); err != nil || timeout <= 0 {
+		errs.Add("timeout", db.CodeInvalid, fmt.Sprintf("invalid timeout %q", target.Timeout))
+	}
+
+	redactor, err := newRedactor(target.Redaction)
+	errs.Merge("redaction", err)
+
+	status, err := compileStatus(target.ExpectedStatus)
+	errs.Merge("expected_status", err)
 
-	_, err := e.cron.AddFunc(target.Frequency, func() {
-		e.checkTarget(target)
-	})
+	rules, err := compileRules(target.ResponseRules)
+	errs.Merge("response_rules", err)
 
-	return err
+	metrics, err := compileMetrics(target.Metrics)
+	errs.Merge("metrics", err)
+
+	slo, err := compileSLO(target.SLO)
+	errs.Merge("slo", err)
+
+	bodyHash, err := compileBodyHash(target.BodyHash, rules)
+	errs.Merge("body_hash", err)
+
+	success, err := compileSuccessExpr(target.SuccessExpression)
+	errs.Merge("success_expression", err)
+
+	bodyGen, err := compileBodyGenerator(target.BodyGenerator)
+	errs.Merge("body_generator", err)
+	if bodyGen != nil && (target.Method == "" || target.Method == http.MethodGet || target.Method == http.MethodHead) {
+		errs.Add("body_generator", db.CodeInvalid, fmt.Sprintf("%s requests can't have a body", methodOrGet(target.Method)))
+	}
+
+	var client *http.Client
+	if target.DialAddress != "" && target.URL != "" {
+		if dialAddr, origin, err := compileDialAddress(target.DialAddress, target.URL); err != nil {
+			errs.Add("dial_address", db.CodeInvalid, err.Error())
+		} else {
+			client = newDialClient(dialAddr, origin)
+		}
+	}
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	return &targetState{
+		target:   target,
+		redactor: redactor,
+		status:   status,
+		rules:    rules,
+		metrics:  metrics,
+		latency:  newTDigest(defaultCompression),
+		slo:      slo,
+		bodyHash: bodyHash,
+		success:  success,
+		client:   client,
+		bodyGen:  bodyGen,
+		adaptive: adaptive,
+	}, nil
+}
+
+// ValidateTarget runs a single check of target exactly as a scheduled check
+// would, without registering the target or storing the result. Errors are
+// configuration problems; request and assertion failures are reported in
+// the returned result.
+func (e *Engine) ValidateTarget(target *db.MonitoringTarget) (*db.MonitoringResult, error) {
+	state, err := e.compileTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if state.client != nil {
+		defer state.client.CloseIdleConnections()
+	}
+	return e.checkTarget(state), nil
+}
+
+// recordResult persists the outcome of a scheduled check and folds its
+// response time into the target's digest.
+func (e *Engine) recordResult(state *targetState, result *db.MonitoringResult) {
+	if e.paused(state) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if state.slo != nil && len(state.slo.burnWindows) > 0 {
+		rates, err := e.burnRates(ctx, state.slo, result)
+		if err != nil {
+			log.Printf("Failed to compute burn rates for target %s: %v", result.TargetID, err)
+		}
+		result.BurnRates = rates
+	}
+	if state.adaptive != nil {
+		e.adapt(state, result)
+	}
+	var baseline *detailBaseline
+	if state.target.StoreOnChange {
+		baseline = state.dropUnchangedDetail(result)
+	}
+
+	if err := e.storage.SaveResult(ctx, result); err != nil {
+		log.Printf("Failed to save result for target %s: %v", result.TargetID, err)
+	} else if baseline != nil {
+		state.setDetail(*baseline)
+	}
+	e.live.Publish(liveResult(result))
+
+	if result.ResponseTime <= 0 {
+		return
+	}
+	state.latency.Add(result.ResponseTime)
+	if state.latency.Count()%digestPersistEvery == 0 {
+		e.persistDigest(ctx, state)
+	}
+}
+
+func (e *Engine) persistDigest(ctx context.Context, state *targetState) {
+	data, err := json.Marshal(state.latency)
+	if err == nil {
+		err = e.storage.SaveDigest(ctx, state.target.ID, data)
+	}
+	if err != nil {
+		log.Printf("Failed to save latency digest for target %s: %v", state.target.ID, err)
+	}
+}
+
+// restoreDigest loads a target's saved latency digest, if any.
+func (e *Engine) restoreDigest(state *targetState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data, err := e.storage.LoadDigest(ctx, state.target.ID)
+	if err == nil && data != nil {
+		err = json.Unmarshal(data, state.latency)
+	}
+	if err != nil {
+		log.Printf("Failed to restore latency digest for target %s: %v", state.target.ID, err)
+	}
+}
+
+// GetResults returns stored results matching query.
+func (e *Engine) GetResults(ctx context.Context, query ResultQuery) ([]*db.MonitoringResult, error) {
+	return e.storage.GetResults(ctx, query)
+}
+
+// StreamResults streams every stored result matching query to fn. It is
+// meant for exports, so Limit and Offset are ignored.
+func (e *Engine) StreamResults(ctx context.Context, query ResultQuery, fn func(*db.MonitoringResult) error) error {
+	return e.storage.StreamResults(ctx, query, fn)
 }
 
 func (e *Engine) removeTarget(id string) {
-	if target, exists := e.targets[id]; exists {
+	if state, exists := e.targets[id]; exists {
 		// Find and remove the cron entry
-		e.cron.Remove(cron.EntryID(target.ID))
+		e.cron.Remove(state.entryID)
+		e.scheduleResume(state, time.Time{})
+		if state.client != nil {
+			state.client.CloseIdleConnections()
+		}
 		delete(e.targets, id)
 	}
 }
 
-func (e *Engine) checkTarget(target *db.MonitoringTarget) *db.MonitoringResult {
+func (e *Engine) checkTarget(state *targetState) *db.MonitoringResult {
+	target := state.target
 	start := time.Now()
 	result := &db.MonitoringResult{
+		ID:        db.NewID(),
 		TargetID:  target.ID,
 		Timestamp: start,
 	}
@@ -76,19 +398,25 @@ func (e *Engine) checkTarget(target *db.MonitoringTarget) *db.MonitoringResult {
 	defer cancel()
 
 	// Prepare request
-	req, err := e.prepareRequest(ctx, target)
+	req, err := e.prepareRequest(ctx, state)
 	if err != nil {
 		result.Success = false
+		result.ResultSeverity = db.ResultSeverityCritical
 		result.Error = fmt.Sprintf("Failed to prepare request: %v", err)
 		return result
 	}
 
 	// Execute request
-	resp, err := e.client.Do(req)
+	client := e.client
+	if state.client != nil {
+		client = state.client
+	}
+	resp, err := client.Do(req)
 	result.ResponseTime = time.Since(start).Seconds()
 
 	if err != nil {
 		result.Success = false
+		result.ResultSeverity = db.ResultSeverityCritical
 		result.Error = fmt.Sprintf("Request failed: %v", err)
 		return result
 	}
@@ -96,28 +424,29 @@ func (e *Engine) checkTarget(target *db.MonitoringTarget) *db.MonitoringResult {
 
 	// Record response
 	result.StatusCode = resp.StatusCode
-	
-	// Store headers
-	headers := make(map[string][]string)
-	for k, v := range resp.Header {
-		headers[k] = v
-	}
-	headerBytes, _ := json.Marshal(headers)
-	result.ResponseHeaders = headerBytes
 
-	// Store body (limited size)
+	// Read body (limited size)
 	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024*1024)) // 1MB limit
 	result.ResponseBody = body
 
-	// Check assertions
-	result.Success = e.checkAssertions(target, result)
+	// Hash the original body, then check assertions against the original
+	// response
+	state.observeBody(result, body, state.status.matches(resp.StatusCode))
+	result.Success, result.ResultSeverity = e.checkAssertions(state, result, resp.Header)
+	result.ExtractedMetrics = extractMetrics(state.metrics, body)
+
+	// Only redacted headers and body are stored
+	headerBytes, _ := json.Marshal(state.redactor.redactHeaders(resp.Header))
+	result.ResponseHeaders = headerBytes
+	result.ResponseBody = state.redactor.redactBody(body)
 
 	return result
 }
 
-func (e *Engine) prepareRequest(ctx context.Context, target *db.MonitoringTarget) (*http.Request, error) {
+func (e *Engine) prepareRequest(ctx context.Context, state *targetState) (*http.Request, error) {
+	target := state.target
 	var body io.Reader
-	if target.Body != nil {
+	if hasBody(target) {
 		body = bytes.NewReader(target.Body)
 	}
 
@@ -130,25 +459,61 @@ func (e *Engine) prepareRequest(ctx context.Context, target *db.MonitoringTarget
 	var headers map[string]string
 	if err := json.Unmarshal(target.Headers, &headers); err == nil {
 		for k, v := range headers {
+			if v, err = e.resolveSecrets(ctx, v); err != nil {
+				return nil, fmt.Errorf("header %s: %v", k, err)
+			}
 			req.Header.Set(k, v)
 		}
 	}
 
+	// Bodies arrive as JSON, so that is the default content type
+	if req.Header.Get("Content-Type") == "" {
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		} else if state.bodyGen != nil {
+			req.Header.Set("Content-Type", state.bodyGen.ContentType)
+		}
+	}
+
 	// Add auth if configured
-	if err := e.addAuth(req, target.AuthConfig); err != nil {
+	if err := e.addAuth(ctx, req, target.AuthConfig); err != nil {
 		return nil, err
 	}
 
+	// A generated body may be an open file, so it is set last: nothing
+	// after it can fail and leave the file open
+	if state.bodyGen != nil {
+		e.mu.RLock()
+		dir := e.bodyDir
+		e.mu.RUnlock()
+		if err := state.bodyGen.setBody(req, dir); err != nil {
+			return nil, fmt.Errorf("body: %v", err)
+		}
+	}
+
 	return req, nil
 }
 
-func (e *Engine) addAuth(req *http.Request, authConfig json.RawMessage) error {
+// hasBody reports whether target has a request body; a JSON null counts as
+// none.
+func hasBody(target *db.MonitoringTarget) bool {
+	return len(target.Body) > 0 && string(target.Body) != "null"
+}
+
+func methodOrGet(method string) string {
+	if method == "" {
+		return http.MethodGet
+	}
+	return method
+}
+
+func (e *Engine) addAuth(ctx context.Context, req *http.Request, authConfig json.RawMessage) error {
 	if len(authConfig) == 0 {
 		return nil
 	}
 
 	var auth struct {
-		Type   string `json:"type"`
+		Type   string          `json:"type"`
 		Config json.RawMessage `json:"config"`
 	}
 
@@ -164,6 +529,9 @@ func (e *Engine) addAuth(req *http.Request, authConfig json.RawMessage) error {
 		if err := json.Unmarshal(auth.Config, &bearer); err != nil {
 			return err
 		}
+		if err := e.resolveAll(ctx, &bearer.Token); err != nil {
+			return fmt.Errorf("auth: %v", err)
+		}
 		req.Header.Set("Authorization", "Bearer "+bearer.Token)
 
 	case "basic":
@@ -174,6 +542,9 @@ func (e *Engine) addAuth(req *http.Request, authConfig json.RawMessage) error {
 		if err := json.Unmarshal(auth.Config, &basic); err != nil {
 			return err
 		}
+		if err := e.resolveAll(ctx, &basic.Username, &basic.Password); err != nil {
+			return fmt.Errorf("auth: %v", err)
+		}
 		req.SetBasicAuth(basic.Username, basic.Password)
 
 	case "apikey":
@@ -185,6 +556,9 @@ func (e *Engine) addAuth(req *http.Request, authConfig json.RawMessage) error {
 		if err := json.Unmarshal(auth.Config, &apiKey); err != nil {
 			return err
 		}
+		if err := e.resolveAll(ctx, &apiKey.Key); err != nil {
+			return fmt.Errorf("auth: %v", err)
+		}
 		switch apiKey.Location {
 		case "header":
 			req.Header.Set(apiKey.Name, apiKey.Key)
@@ -197,43 +571,3 @@ func (e *Engine) addAuth(req *http.Request, authConfig json.RawMessage) error {
 
 	return nil
 }
-
-func (e *Engine) checkAssertions(target *db.MonitoringTarget, result *db.MonitoringResult) bool {
-	// Check status code
-	statusValid := false
-	for _, expected := range target.ExpectedStatus {
-		if result.StatusCode == expected {
-			statusValid = true
-			break
-		}
-	}
-	if !statusValid {
-		return false
-	}
-
-	// Check response rules
-	var rules []struct {
-		Type  string `json:"type"`
-		Path  string `json:"path"`
-		Value string `json:"value"`
-	}
-
-	if err := json.Unmarshal(target.ResponseRules, &rules); err != nil {
-		return false
-	}
-
-	for _, rule := range rules {
-		switch rule.Type {
-		case "json_path_exists":
-			// Implementation for JSON path checking
-		case "contains":
-			if !bytes.Contains(result.ResponseBody, []byte(rule.Value)) {
-				return false
-			}
-		case "regex":
-			// Implementation for regex matching
-		}
-	}
-
-	return true
-}
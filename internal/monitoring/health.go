@@ -0,0 +1,194 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Health statuses, from a target's health score
+const (
+	HealthGreen   = "green"
+	HealthYellow  = "yellow"
+	HealthRed     = "red"
+	HealthUnknown = "unknown"
+)
+
+// Scores at or above these are green and yellow; anything lower is red.
+const (
+	healthGreenAbove  = 90
+	healthYellowAbove = 70
+)
+
+// minBaselineChecks is how many checks a target's latency digest needs
+// before it serves as the latency baseline.
+const minBaselineChecks = 20
+
+// HealthWeights sets how much each component counts toward a health score.
+// Weights are relative; they needn't add up to one.
+type HealthWeights struct {
+	Success    float64 `json:"success"`
+	Latency    float64 `json:"latency"`
+	Assertions float64 `json:"assertions"`
+}
+
+// DefaultHealthWeights favours whether checks pass over how fast they are.
+var DefaultHealthWeights = HealthWeights{Success: 0.5, Latency: 0.25, Assertions: 0.25}
+
+// HealthComponent is one input to a health score. Score is 0-100; a nil
+// Score means there wasn't enough data and the component was left out.
+type HealthComponent struct {
+	Score  *float64 `json:"score"`
+	Weight float64  `json:"weight"`
+	Detail string   `json:"detail"`
+}
+
+// HealthScore is a 0-100 summary of a target's recent checks. Score is nil,
+// and Status unknown, when the window holds no checks.
+type HealthScore struct {
+	TargetID   string                     `json:"target_id"`
+	Score      *float64                   `json:"score"`
+	Status     string                     `json:"status"`
+	Checks     int                        `json:"checks"`
+	Window     string                     `json:"window"`
+	Components map[string]HealthComponent `json:"components"`
+}
+
+// SetHealthWeights replaces the weights used by TargetHealthScore.
+func (e *Engine) SetHealthWeights(weights HealthWeights) error {
+	var errs db.ValidationErrors
+	if weights.Success < 0 || weights.Latency < 0 || weights.Assertions < 0 {
+		errs.Add("weights", db.CodeInvalid, "weights must not be negative")
+	} else if weights.Success+weights.Latency+weights.Assertions == 0 {
+		errs.Add("weights", db.CodeInvalid, "at least one weight must be positive")
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.healthWeights = weights
+	return nil
+}
+
+// assertionCredit is how much a check counts toward the assertions
+// component, by the severity of its worst failed assertion.
+var assertionCredit = map[string]float64{
+	"":                        1,
+	db.ResultSeverityInfo:     0.8,
+	db.ResultSeverityWarning:  0.5,
+	db.ResultSeverityCritical: 0,
+}
+
+// TargetHealthScore combines a target's checks within window into a 0-100
+// score from three components:
+//
+//   - success: the share of checks that passed
+//   - latency: mean response time against the target's long-run p95
+//   - assertions: failed assertions, graded by severity, so info-level
+//     failures cost less than critical ones
+//
+// Each check is weighted by its age, halving every quarter of the window,
+// so the score follows recent behaviour but one failure only dents it.
+func (e *Engine) TargetHealthScore(ctx context.Context, targetID string, window time.Duration) (*HealthScore, error) {
+	e.mu.RLock()
+	state, exists := e.targets[targetID]
+	weights := e.healthWeights
+	e.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTargetNotFound, targetID)
+	}
+
+	end := time.Now()
+	halfLife := window / 4
+
+	var total, passed, credit, latencyWeight, latencySum float64
+	checks := 0
+	query := ResultQuery{TargetID: targetID, StartTime: end.Add(-window), EndTime: end}
+	err := e.storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		w := math.Exp2(-float64(end.Sub(r.Timestamp)) / float64(halfLife))
+		checks++
+		total += w
+		if r.Success {
+			passed += w
+		}
+		severity := r.ResultSeverity
+		if r.Success {
+			severity = ""
+		}
+		credit += w * assertionCredit[severity]
+		if r.ResponseTime > 0 {
+			latencyWeight += w
+			latencySum += w * r.ResponseTime
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	health := &HealthScore{
+		TargetID:   targetID,
+		Status:     HealthUnknown,
+		Checks:     checks,
+		Window:     window.String(),
+		Components: make(map[string]HealthComponent, 3),
+	}
+	if checks == 0 {
+		return health, nil
+	}
+
+	success := 100 * passed / total
+	health.Components["success"] = HealthComponent{
+		Score:  &success,
+		Weight: weights.Success,
+		Detail: fmt.Sprintf("%.1f%% of recent checks passed", success),
+	}
+
+	assertions := 100 * credit / total
+	health.Components["assertions"] = HealthComponent{
+		Score:  &assertions,
+		Weight: weights.Assertions,
+		Detail: "failed assertions, graded by severity",
+	}
+
+	latency := HealthComponent{Weight: weights.Latency, Detail: "not enough latency history for a baseline"}
+	if state.latency.Count() >= minBaselineChecks && latencyWeight > 0 {
+		baseline := state.latency.Quantile(0.95)
+		mean := latencySum / latencyWeight
+		score := 100.0
+		if mean > baseline {
+			score = 100 * baseline / mean
+		}
+		latency.Score = &score
+		latency.Detail = fmt.Sprintf("mean response time %.3fs against a p95 baseline of %.3fs", mean, baseline)
+	}
+	health.Components["latency"] = latency
+
+	var sum, weightSum float64
+	for _, component := range health.Components {
+		if component.Score != nil {
+			sum += *component.Score * component.Weight
+			weightSum += component.Weight
+		}
+	}
+	if weightSum == 0 {
+		return health, nil
+	}
+
+	score := sum / weightSum
+	health.Score = &score
+	switch {
+	case score >= healthGreenAbove:
+		health.Status = HealthGreen
+	case score >= healthYellowAbove:
+		health.Status = HealthYellow
+	default:
+		health.Status = HealthRed
+	}
+	return health, nil
+}
@@ -0,0 +1,65 @@
+package monitoring
+
+import (
+	"context"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// HistoryBucket summarizes a target's results over one time slice. Buckets
+// without results have zero Checks and nil ratio and latency.
+type HistoryBucket struct {
+	Start        time.Time `json:"start"`
+	Checks       int       `json:"checks"`
+	SuccessRatio *float64  `json:"success_ratio"`
+	AvgLatency   *float64  `json:"avg_latency"`
+}
+
+// History splits the window ending at end into evenly sized buckets and
+// reports uptime and mean response time (in seconds) for each.
+func (e *Engine) History(ctx context.Context, targetID string, end time.Time, window time.Duration, buckets int) ([]HistoryBucket, error) {
+	start := end.Add(-window)
+	width := window / time.Duration(buckets)
+
+	type totals struct {
+		checks, successes int
+		latency           float64
+	}
+	sums := make([]totals, buckets)
+
+	query := ResultQuery{TargetID: targetID, StartTime: start, EndTime: end}
+	err := e.storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		i := int(r.Timestamp.Sub(start) / width)
+		if i < 0 || r.Timestamp.After(end) {
+			return nil
+		}
+		if i >= buckets {
+			i = buckets - 1
+		}
+		sums[i].checks++
+		sums[i].latency += r.ResponseTime
+		if r.Success {
+			sums[i].successes++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]HistoryBucket, buckets)
+	for i, s := range sums {
+		history[i] = HistoryBucket{
+			Start:  start.Add(time.Duration(i) * width),
+			Checks: s.checks,
+		}
+		if s.checks > 0 {
+			ratio := float64(s.successes) / float64(s.checks)
+			latency := s.latency / float64(s.checks)
+			history[i].SuccessRatio = &ratio
+			history[i].AvgLatency = &latency
+		}
+	}
+	return history, nil
+}
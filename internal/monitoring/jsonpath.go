@@ -0,0 +1,178 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// Operators of json_path rules
+const (
+	OpEq       = "eq"
+	OpNeq      = "neq"
+	OpGt       = "gt"
+	OpLt       = "lt"
+	OpContains = "contains"
+)
+
+// compileJSONPathRule checks a json_path rule's path, operator and
+// expected value, storing their parsed forms on rule. A path wrapped in an
+// aggregate may select many values.
+func compileJSONPathRule(rule *responseRule, field string, errs *db.ValidationErrors) {
+	if rule.Path == "" {
+		errs.Add(field+".path", db.CodeRequired, "path is required")
+	} else if aggregate, inner, ok := splitAggregate(rule.Path); ok {
+		rule.aggregate = aggregate
+		if path, err := parseSteps(inner, true); err != nil {
+			errs.Add(field+".path", db.CodeInvalid, err.Error())
+		} else {
+			rule.path = path
+		}
+	} else if path, err := parsePath(rule.Path); err != nil {
+		errs.Add(field+".path", db.CodeInvalid, err.Error())
+	} else {
+		rule.path = path
+	}
+
+	switch rule.Operator {
+	case "":
+		rule.Operator = OpEq
+	case OpEq, OpNeq, OpGt, OpLt, OpContains:
+	default:
+		errs.Add(field+".operator", db.CodeUnsupported, fmt.Sprintf("unknown operator %q", rule.Operator))
+	}
+
+	if len(rule.Expected) == 0 {
+		errs.Add(field+".expected", db.CodeRequired, "expected is required")
+		return
+	}
+	expected, err := decodeJSON(rule.Expected)
+	if err != nil {
+		errs.Add(field+".expected", db.CodeInvalid, fmt.Sprintf("expected is not JSON: %v", err))
+		return
+	}
+	rule.expected = expected
+
+	if rule.Operator == OpGt || rule.Operator == OpLt {
+		if _, ok := expected.(json.Number); !ok {
+			errs.Add(field+".expected", db.CodeInvalid, fmt.Sprintf("%s needs a number", rule.Operator))
+		}
+	} else if numericAggregate(rule.aggregate) {
+		if rule.Operator == OpContains {
+			errs.Add(field+".operator", db.CodeUnsupported, fmt.Sprintf("%s yields a number, which contains can't use", rule.aggregate))
+		} else if _, ok := expected.(json.Number); !ok {
+			errs.Add(field+".expected", db.CodeInvalid, fmt.Sprintf("%s needs a number", rule.aggregate))
+		}
+	}
+}
+
+// evaluateJSONPath applies a json_path rule to the decoded body, returning
+// the actual value as JSON, the reason for a failure and whether it passed.
+func evaluateJSONPath(rule responseRule, doc interface{}) (string, string, bool) {
+	if rule.aggregate != "" {
+		return evaluateAggregate(rule, doc)
+	}
+
+	actual, found := lookupPath(doc, rule.path)
+	if !found {
+		if doc == nil {
+			return "", "response body is not JSON", false
+		}
+		return "", fmt.Sprintf("path %s not found", rule.Path), false
+	}
+
+	encoded, _ := json.Marshal(actual)
+	passed, reason := compare(rule.Operator, actual, rule.expected)
+	if !passed {
+		return string(encoded), fmt.Sprintf("%s %s %s: %s", rule.Path, rule.Operator, rule.Expected, reason), false
+	}
+	return string(encoded), "", true
+}
+
+// compare applies op to the actual and expected JSON values. Numbers
+// compare numerically, and values of different types are never equal. gt
+// and lt need a number; contains takes a substring of a string or an
+// element of an array.
+func compare(op string, actual, expected interface{}) (bool, string) {
+	switch op {
+	case OpEq:
+		if equalJSON(actual, expected) {
+			return true, ""
+		}
+		if jsonType(actual) != jsonType(expected) {
+			return false, fmt.Sprintf("got %s", jsonType(actual))
+		}
+		return false, "values differ"
+	case OpNeq:
+		if !equalJSON(actual, expected) {
+			return true, ""
+		}
+		return false, "values are equal"
+	case OpGt, OpLt:
+		a, ok := toFloat(actual)
+		if !ok {
+			return false, fmt.Sprintf("got %s, not a number", jsonType(actual))
+		}
+		e, _ := toFloat(expected)
+		if (op == OpGt && a > e) || (op == OpLt && a < e) {
+			return true, ""
+		}
+		return false, "comparison is false"
+	case OpContains:
+		switch a := actual.(type) {
+		case string:
+			if s, ok := expected.(string); ok && strings.Contains(a, s) {
+				return true, ""
+			}
+			return false, "string does not contain it"
+		case []interface{}:
+			for _, element := range a {
+				if equalJSON(element, expected) {
+					return true, ""
+				}
+			}
+			return false, "array does not contain it"
+		default:
+			return false, fmt.Sprintf("got %s, not a string or array", jsonType(actual))
+		}
+	default:
+		return false, fmt.Sprintf("unknown operator %q", op)
+	}
+}
+
+func equalJSON(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
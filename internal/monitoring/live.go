@@ -0,0 +1,40 @@
+package monitoring
+
+import (
+	"context"
+
+	"api-watchtower/internal/db"
+	"api-watchtower/internal/pubsub"
+)
+
+// liveBuffer is how many results a live subscriber may fall behind before
+// it is dropped.
+const liveBuffer = 64
+
+// SubscribeResults streams the results of scheduled checks as they are
+// recorded, without response bodies or headers. A nil filter accepts every
+// result. Subscribers that fall behind are dropped and their channel
+// closed; the caller must Close the subscription when done.
+func (e *Engine) SubscribeResults(filter func(*db.MonitoringResult) bool) *pubsub.Subscription[*db.MonitoringResult] {
+	return e.live.Subscribe(liveBuffer, filter)
+}
+
+// RecordResult stores and streams a result produced outside the engine's
+// scheduled checks, such as one of the system's self-checks, like a
+// scheduled check's.
+func (e *Engine) RecordResult(ctx context.Context, result *db.MonitoringResult) error {
+	if err := e.storage.SaveResult(ctx, result); err != nil {
+		return err
+	}
+	e.live.Publish(liveResult(result))
+	return nil
+}
+
+// liveResult copies result without its potentially large response, keeping
+// the status, latency, assertion outcome and extracted metrics.
+func liveResult(result *db.MonitoringResult) *db.MonitoringResult {
+	lite := *result
+	lite.ResponseBody = nil
+	lite.ResponseHeaders = nil
+	return &lite
+}
@@ -0,0 +1,261 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/ai"
+	"api-watchtower/internal/db"
+)
+
+// MetricExtraction pulls a numeric value out of a JSON response body on
+// every check so it can be trended like latency.
+type MetricExtraction struct {
+	Name string `json:"name"`
+	// Path is a JSONPath subset: "$.queue.depth", "$.items[0].count". The
+	// leading "$." is optional.
+	Path string `json:"path"`
+}
+
+type metricExtractor struct {
+	name string
+	path []pathStep
+}
+
+// pathStep is one object key or, when key is empty, one array index.
+// Aggregate paths may also use wildcard steps, which select every element,
+// and filter steps, which keep the array elements that match.
+type pathStep struct {
+	key   string
+	index int
+
+	wildcard bool
+	filter   *pathFilter
+}
+
+// compileMetrics parses a target's metrics config, reporting every entry
+// with a missing or duplicate name or an invalid path.
+func compileMetrics(raw json.RawMessage) ([]metricExtractor, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var configs []MetricExtraction
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid metrics config: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	extractors := make([]metricExtractor, 0, len(configs))
+	seen := make(map[string]bool)
+	for i, cfg := range configs {
+		field := fmt.Sprintf("[%d]", i)
+		switch {
+		case cfg.Name == "":
+			errs.Add(field+".name", db.CodeRequired, "name is required")
+		case seen[cfg.Name]:
+			errs.Add(field+".name", db.CodeInvalid, fmt.Sprintf("duplicate metric name %q", cfg.Name))
+		}
+		seen[cfg.Name] = true
+
+		path, err := parsePath(cfg.Path)
+		if err != nil {
+			errs.Add(field+".path", db.CodeInvalid, err.Error())
+			continue
+		}
+		extractors = append(extractors, metricExtractor{name: cfg.Name, path: path})
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return extractors, nil
+}
+
+// parsePath parses a path selecting a single value.
+func parsePath(path string) ([]pathStep, error) {
+	return parseSteps(path, false)
+}
+
+// parseSteps parses path, accepting wildcard and filter steps when multi is
+// set.
+func parseSteps(path string, multi bool) ([]pathStep, error) {
+	rest := strings.TrimPrefix(path, "$")
+	if rest == "" {
+		return nil, fmt.Errorf("path %q selects no field", path)
+	}
+	if rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	var steps []pathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("path %q has an empty key", path)
+			}
+			steps = append(steps, pathStep{key: key})
+			rest = rest[end+1:]
+		case '[':
+			if strings.HasPrefix(rest, "[*") || strings.HasPrefix(rest, "[?") {
+				if !multi {
+					return nil, fmt.Errorf("path %q selects many values; wrap it in an aggregate such as count(...)", path)
+				}
+				step, n, err := parseMultiStep(path, rest)
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, step)
+				rest = rest[n:]
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unclosed index", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q has an invalid index %q", path, rest[1:end])
+			}
+			steps = append(steps, pathStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q is malformed at %q", path, rest)
+		}
+	}
+	return steps, nil
+}
+
+// extractMetrics evaluates every extractor against body. Values that are
+// missing or not JSON numbers are left out.
+func extractMetrics(extractors []metricExtractor, body []byte) map[string]float64 {
+	if len(extractors) == 0 {
+		return nil
+	}
+
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return nil
+	}
+
+	metrics := make(map[string]float64)
+	for _, ex := range extractors {
+		if v, ok := lookupNumber(doc, ex.path); ok {
+			metrics[ex.name] = v
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	return metrics
+}
+
+// decodeJSON decodes body keeping numbers as json.Number.
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// lookupPath follows path through doc, reporting whether every step
+// exists. A present null is found.
+func lookupPath(doc interface{}, path []pathStep) (interface{}, bool) {
+	if doc == nil {
+		return nil, false
+	}
+	for _, step := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			if step.key == "" {
+				return nil, false
+			}
+			value, exists := node[step.key]
+			if !exists {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			if step.key != "" || step.index >= len(node) {
+				return nil, false
+			}
+			doc = node[step.index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func lookupNumber(doc interface{}, path []pathStep) (float64, bool) {
+	doc, found := lookupPath(doc, path)
+	if !found {
+		return 0, false
+	}
+
+	n, ok := doc.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	v, err := n.Float64()
+	return v, err == nil
+}
+
+// MetricPoint is one check's value of an extracted metric with the anomaly
+// detector's verdict on it.
+type MetricPoint struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Value         float64   `json:"value"`
+	Anomalous     bool      `json:"anomalous"`
+	ExpectedRange *ai.Range `json:"expected_range,omitempty"`
+}
+
+// metricMinPoints is how many values a metric needs before the detector
+// judges it; shorter series are returned without verdicts.
+const metricMinPoints = 10
+
+// MetricSeries returns an extracted metric's values between start and end,
+// each checked by the anomaly detector against the rest of the series.
+// Checks where the metric was absent are skipped.
+func (e *Engine) MetricSeries(ctx context.Context, targetID, metric string, start, end time.Time) ([]MetricPoint, error) {
+	var points []ai.TimeSeriesPoint
+	query := ResultQuery{TargetID: targetID, StartTime: start, EndTime: end}
+	err := e.storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		if v, ok := r.ExtractedMetrics[metric]; ok {
+			points = append(points, ai.TimeSeriesPoint{Timestamp: r.Timestamp, Value: v})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]MetricPoint, len(points))
+	for i, p := range points {
+		series[i] = MetricPoint{Timestamp: p.Timestamp, Value: p.Value}
+	}
+	if len(points) < metricMinPoints {
+		return series, nil
+	}
+
+	detector := ai.NewAnomalyDetector(metricMinPoints, trendConfidence, 0)
+	for i, result := range detector.DetectAnomalies(points) {
+		series[i].Anomalous = result.IsAnomaly
+		expected := result.ExpectedRange
+		series[i].ExpectedRange = &expected
+	}
+	return series, nil
+}
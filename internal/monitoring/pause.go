@@ -0,0 +1,143 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"api-watchtower/internal/db"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ErrTargetNotFound is returned for operations on a target that isn't
+// registered.
+var ErrTargetNotFound = errors.New("target not found")
+
+// PauseTarget stops scheduling checks for a target, e.g. during a planned
+// deployment, while keeping it registered. A paused target records no
+// results until it is resumed.
+func (e *Engine) PauseTarget(id string) error {
+	return e.PauseTargetUntil(id, time.Time{})
+}
+
+// PauseTargetUntil pauses a target like PauseTarget and resumes it
+// automatically at resumeAt. A zero resumeAt pauses it until ResumeTarget
+// is called. Pausing a paused target replaces its resume time.
+func (e *Engine) PauseTargetUntil(id string, resumeAt time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, exists := e.targets[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTargetNotFound, id)
+	}
+
+	if !state.target.Paused {
+		e.cron.Remove(state.entryID)
+		state.entryID = 0
+		state.target.Paused = true
+	}
+	e.scheduleResume(state, resumeAt)
+	return nil
+}
+
+// ResumeTarget schedules a paused target's checks again. Resuming a target
+// that isn't paused does nothing.
+func (e *Engine) ResumeTarget(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, exists := e.targets[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTargetNotFound, id)
+	}
+	return e.resume(state)
+}
+
+// resume must be called with e.mu held.
+func (e *Engine) resume(state *targetState) error {
+	e.scheduleResume(state, time.Time{})
+	if !state.target.Paused {
+		return nil
+	}
+	if err := e.schedule(state); err != nil {
+		return err
+	}
+	state.target.Paused = false
+	return nil
+}
+
+// scheduleResume replaces the target's pending automatic resume, if any.
+// It must be called with e.mu held.
+func (e *Engine) scheduleResume(state *targetState, resumeAt time.Time) {
+	if state.resumeTimer != nil {
+		state.resumeTimer.Stop()
+		state.resumeTimer = nil
+	}
+	state.target.ResumeAt = nil
+	if resumeAt.IsZero() {
+		return
+	}
+
+	state.target.ResumeAt = &resumeAt
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(resumeAt), func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		// A later pause, resume or removal replaced this timer
+		if state.resumeTimer != timer || e.targets[state.target.ID] != state {
+			return
+		}
+		if err := e.resume(state); err != nil {
+			log.Printf("Failed to resume target %s: %v", state.target.ID, err)
+		}
+	})
+	state.resumeTimer = timer
+}
+
+// schedule adds the target's checks to the cron schedule, at its adaptive
+// interval if it has one. It must be called with e.mu held.
+func (e *Engine) schedule(state *targetState) error {
+	job := cron.FuncJob(func() {
+		e.recordResult(state, e.checkTarget(state))
+	})
+	if state.adaptive != nil {
+		state.entryID = e.cron.Schedule(state.adaptive, job)
+		return nil
+	}
+
+	entryID, err := e.cron.AddJob(state.target.Frequency, job)
+	if err != nil {
+		return err
+	}
+	state.entryID = entryID
+	return nil
+}
+
+// paused reports whether a target is paused; checks that were already
+// running when it was paused aren't recorded.
+func (e *Engine) paused(state *targetState) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return state.target.Paused
+}
+
+// Targets returns copies of the registered targets, including whether each
+// is paused.
+func (e *Engine) Targets() []db.MonitoringTarget {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	targets := make([]db.MonitoringTarget, 0, len(e.targets))
+	for _, state := range e.targets {
+		target := *state.target
+		if target.ResumeAt != nil {
+			resumeAt := *target.ResumeAt
+			target.ResumeAt = &resumeAt
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
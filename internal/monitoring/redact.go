@@ -0,0 +1,98 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"api-watchtower/internal/db"
+)
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedHeaders are always redacted from stored responses.
+var defaultRedactedHeaders = []string{"Authorization", "Set-Cookie"}
+
+// RedactionConfig is the per-target redaction applied to captured responses
+// before they are stored.
+type RedactionConfig struct {
+	// Headers lists additional header names whose values are redacted
+	Headers []string `json:"headers"`
+	// Body lists regex replacements applied to the response body
+	Body []BodyRedaction `json:"body"`
+}
+
+type BodyRedaction struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type redactor struct {
+	headers map[string]bool
+	body    []compiledBodyRedaction
+}
+
+type compiledBodyRedaction struct {
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+func newRedactor(raw json.RawMessage) (*redactor, error) {
+	var cfg RedactionConfig
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid redaction config: %v", err)}
+		}
+	}
+
+	r := &redactor{headers: make(map[string]bool)}
+	for _, name := range defaultRedactedHeaders {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(name)] = true
+	}
+
+	var errs db.ValidationErrors
+	for i, rule := range cfg.Body {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			errs.Add(fmt.Sprintf("body[%d].pattern", i), db.CodeInvalid, fmt.Sprintf("invalid body redaction pattern %q: %v", rule.Pattern, err))
+			continue
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = redactedValue
+		}
+		r.body = append(r.body, compiledBodyRedaction{re: re, replacement: []byte(replacement)})
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *redactor) redactHeaders(headers http.Header) map[string][]string {
+	redacted := make(map[string][]string, len(headers))
+	for k, v := range headers {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			masked := make([]string, len(v))
+			for i := range masked {
+				masked[i] = redactedValue
+			}
+			redacted[k] = masked
+			continue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+func (r *redactor) redactBody(body []byte) []byte {
+	for _, rule := range r.body {
+		body = rule.re.ReplaceAll(body, rule.replacement)
+	}
+	return body
+}
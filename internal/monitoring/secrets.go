@@ -0,0 +1,123 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SecretProvider resolves the ${secret:NAME} references in target headers
+// and auth config at check time, so credentials aren't stored with the
+// target. A Vault or cloud secret manager client plugs in through
+// SecretProviderFunc.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// SecretProviderFunc adapts an ordinary function to a SecretProvider.
+type SecretProviderFunc func(ctx context.Context, name string) (string, error)
+
+func (f SecretProviderFunc) Secret(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// ErrSecretNotFound is returned by providers for names they don't hold.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// EnvSecrets reads secrets from environment variables named Prefix+NAME.
+type EnvSecrets struct {
+	Prefix string
+}
+
+func (p EnvSecrets) Secret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(p.Prefix + name)
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return value, nil
+}
+
+// FileSecrets reads each secret from the file Dir/NAME, as mounted by
+// Docker and Kubernetes secrets. A trailing newline is dropped.
+type FileSecrets struct {
+	Dir string
+}
+
+func (p FileSecrets) Secret(_ context.Context, name string) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// secretRef matches a ${secret:NAME} reference.
+var secretRef = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// SetSecretProvider sets where ${secret:NAME} references are resolved.
+// Without one, checks of targets using references fail.
+func (e *Engine) SetSecretProvider(provider SecretProvider) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.secrets = provider
+}
+
+// resolveSecrets replaces every secret reference in value. Errors name the
+// reference but never include secret values.
+func (e *Engine) resolveSecrets(ctx context.Context, value string) (string, error) {
+	if !strings.Contains(value, "${secret:") {
+		return value, nil
+	}
+
+	e.mu.RLock()
+	provider := e.secrets
+	e.mu.RUnlock()
+
+	var resolveErr error
+	resolved := secretRef.ReplaceAllStringFunc(value, func(ref string) string {
+		if resolveErr != nil {
+			return ""
+		}
+		name := secretRef.FindStringSubmatch(ref)[1]
+		if name == "" {
+			resolveErr = fmt.Errorf("empty secret reference %q", ref)
+			return ""
+		}
+		if provider == nil {
+			resolveErr = fmt.Errorf("can't resolve secret %q: no secret provider is configured", name)
+			return ""
+		}
+		secret, err := provider.Secret(ctx, name)
+		if err != nil {
+			resolveErr = fmt.Errorf("can't resolve secret %q: %v", name, err)
+			return ""
+		}
+		return secret
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return resolved, nil
+}
+
+// resolveAll resolves the secret references in each of values in place.
+func (e *Engine) resolveAll(ctx context.Context, values ...*string) error {
+	for _, v := range values {
+		resolved, err := e.resolveSecrets(ctx, *v)
+		if err != nil {
+			return err
+		}
+		*v = resolved
+	}
+	return nil
+}
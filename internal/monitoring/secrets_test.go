@@ -0,0 +1,55 @@
+package monitoring
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("WATCHTOWER_SECRET_API_TOKEN", "env-token")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "API_TOKEN"), []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	providers := map[string]SecretProvider{
+		"env":  EnvSecrets{Prefix: "WATCHTOWER_SECRET_"},
+		"file": FileSecrets{Dir: dir},
+	}
+	want := map[string]string{"env": "Bearer env-token", "file": "Bearer file-token"}
+	for name, provider := range providers {
+		t.Run(name, func(t *testing.T) {
+			e := NewEngine(&memStorage{})
+			e.SetSecretProvider(provider)
+
+			got, err := e.resolveSecrets(context.Background(), "Bearer ${secret:API_TOKEN}")
+			if err != nil {
+				t.Fatalf("resolveSecrets: %v", err)
+			}
+			if got != want[name] {
+				t.Errorf("resolved to %q, want %q", got, want[name])
+			}
+
+			if _, err := e.resolveSecrets(context.Background(), "${secret:API_TOKEN}/${secret:MISSING}"); err == nil || !strings.Contains(err.Error(), `"MISSING"`) {
+				t.Errorf("missing secret gave error %v, want one naming it", err)
+			} else if strings.Contains(err.Error(), "token") {
+				t.Errorf("error %q leaks a secret value", err)
+			}
+		})
+	}
+
+	if _, err := (FileSecrets{Dir: dir}).Secret(context.Background(), "../API_TOKEN"); err == nil {
+		t.Error("file provider read a secret outside its directory")
+	}
+
+	e := NewEngine(&memStorage{})
+	if _, err := e.resolveSecrets(context.Background(), "${secret:API_TOKEN}"); err == nil {
+		t.Error("resolved a secret with no provider configured")
+	}
+	if got, err := e.resolveSecrets(context.Background(), "plain"); err != nil || got != "plain" {
+		t.Errorf("value without references resolved to %q, %v", got, err)
+	}
+}
@@ -0,0 +1,225 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// SLOConfig is a target's availability objective: the share of checks, in
+// percent, that must succeed over Window.
+type SLOConfig struct {
+	Objective float64 `json:"objective"`
+	// Window defaults to 30 days
+	Window string `json:"window"`
+	// BurnWindows are the windows burn rates are tracked over for
+	// multi-window burn-rate alerts. They default to 1h and 6h.
+	BurnWindows []string `json:"burn_windows"`
+}
+
+const (
+	defaultSLOWindow = 30 * 24 * time.Hour
+	// minSLOChecks is the fewest checks a window needs before its success
+	// rate is trusted
+	minSLOChecks = 10
+)
+
+var defaultBurnWindows = []time.Duration{time.Hour, 6 * time.Hour}
+
+// ErrNoSLO is returned for SLO queries on a target without an SLO.
+var ErrNoSLO = errors.New("target has no slo")
+
+type sloSpec struct {
+	objective   float64 // fraction of checks, e.g. 0.999
+	window      time.Duration
+	burnWindows []time.Duration // ascending
+}
+
+// compileSLO parses a target's SLO config; an empty config means the target
+// has no SLO.
+func compileSLO(raw json.RawMessage) (*sloSpec, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var cfg SLOConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid slo config: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	spec := &sloSpec{objective: cfg.Objective / 100, window: defaultSLOWindow}
+	if cfg.Objective <= 0 || cfg.Objective >= 100 {
+		errs.Add("objective", db.CodeInvalid, "objective must be a percentage between 0 and 100, exclusive")
+	}
+	if cfg.Window != "" {
+		d, err := time.ParseDuration(cfg.Window)
+		if err != nil || d <= 0 {
+			errs.Add("window", db.CodeInvalid, fmt.Sprintf("invalid window %q", cfg.Window))
+		}
+		spec.window = d
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i, w := range cfg.BurnWindows {
+		field := fmt.Sprintf("burn_windows[%d]", i)
+		d, err := time.ParseDuration(w)
+		switch {
+		case err != nil || d <= 0:
+			errs.Add(field, db.CodeInvalid, fmt.Sprintf("invalid burn window %q", w))
+		case d > spec.window:
+			errs.Add(field, db.CodeInvalid, fmt.Sprintf("burn window %s is longer than the slo window", w))
+		case seen[d]:
+			errs.Add(field, db.CodeInvalid, fmt.Sprintf("duplicate burn window %q", w))
+		default:
+			seen[d] = true
+			spec.burnWindows = append(spec.burnWindows, d)
+		}
+	}
+	if len(cfg.BurnWindows) == 0 {
+		for _, d := range defaultBurnWindows {
+			if d <= spec.window {
+				spec.burnWindows = append(spec.burnWindows, d)
+			}
+		}
+	}
+	sort.Slice(spec.burnWindows, func(i, j int) bool { return spec.burnWindows[i] < spec.burnWindows[j] })
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// burnRate is how fast a failure ratio spends the error budget: 1 spends
+// exactly the budget over the SLO window, 14.4 spends 2% of a 30-day
+// budget in an hour.
+func (s *sloSpec) burnRate(checks, failures int) float64 {
+	return float64(failures) / float64(checks) / (1 - s.objective)
+}
+
+// BurnRate is the error budget burn rate over one window. Rate is nil
+// when the window has fewer checks than needed to judge it.
+type BurnRate struct {
+	Window string   `json:"window"`
+	Checks int      `json:"checks"`
+	Rate   *float64 `json:"rate"`
+}
+
+// SLOStatus reports a target's error budget over its SLO window.
+// BudgetRemaining is the share of the budget left, negative once it is
+// overspent; it and SuccessRatio are nil without enough checks.
+type SLOStatus struct {
+	TargetID        string     `json:"target_id"`
+	Objective       float64    `json:"objective"`
+	Window          string     `json:"window"`
+	Checks          int        `json:"checks"`
+	Failures        int        `json:"failures"`
+	SuccessRatio    *float64   `json:"success_ratio"`
+	BudgetRemaining *float64   `json:"budget_remaining"`
+	BurnRates       []BurnRate `json:"burn_rates"`
+}
+
+// SLOStatus computes a target's remaining error budget and burn rates as of
+// now from its stored results.
+func (e *Engine) SLOStatus(ctx context.Context, targetID string, now time.Time) (*SLOStatus, error) {
+	e.mu.RLock()
+	state, exists := e.targets[targetID]
+	e.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTargetNotFound, targetID)
+	}
+	spec := state.slo
+	if spec == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoSLO, targetID)
+	}
+
+	burnChecks := make([]int, len(spec.burnWindows))
+	burnFailures := make([]int, len(spec.burnWindows))
+	status := &SLOStatus{
+		TargetID:  targetID,
+		Objective: spec.objective * 100,
+		Window:    db.BurnWindowKey(spec.window),
+	}
+
+	query := ResultQuery{TargetID: targetID, StartTime: now.Add(-spec.window), EndTime: now}
+	err := e.storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		status.Checks++
+		if !r.Success {
+			status.Failures++
+		}
+		age := now.Sub(r.Timestamp)
+		for i, w := range spec.burnWindows {
+			if age <= w {
+				burnChecks[i]++
+				if !r.Success {
+					burnFailures[i]++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Checks >= minSLOChecks {
+		ratio := 1 - float64(status.Failures)/float64(status.Checks)
+		remaining := 1 - spec.burnRate(status.Checks, status.Failures)
+		status.SuccessRatio = &ratio
+		status.BudgetRemaining = &remaining
+	}
+	for i, w := range spec.burnWindows {
+		burn := BurnRate{Window: db.BurnWindowKey(w), Checks: burnChecks[i]}
+		if burnChecks[i] >= minSLOChecks {
+			rate := spec.burnRate(burnChecks[i], burnFailures[i])
+			burn.Rate = &rate
+		}
+		status.BurnRates = append(status.BurnRates, burn)
+	}
+	return status, nil
+}
+
+// burnRates computes result's BurnRates from the stored results in the
+// target's burn windows plus result itself, which isn't stored yet.
+func (e *Engine) burnRates(ctx context.Context, spec *sloSpec, result *db.MonitoringResult) (map[string]float64, error) {
+	longest := spec.burnWindows[len(spec.burnWindows)-1]
+	checks := make([]int, len(spec.burnWindows))
+	failures := make([]int, len(spec.burnWindows))
+	count := func(r *db.MonitoringResult) {
+		age := result.Timestamp.Sub(r.Timestamp)
+		for i, w := range spec.burnWindows {
+			if age <= w {
+				checks[i]++
+				if !r.Success {
+					failures[i]++
+				}
+			}
+		}
+	}
+
+	query := ResultQuery{TargetID: result.TargetID, StartTime: result.Timestamp.Add(-longest), EndTime: result.Timestamp}
+	err := e.storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		if r.ID != result.ID {
+			count(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	count(result)
+
+	rates := make(map[string]float64, len(spec.burnWindows))
+	for i, w := range spec.burnWindows {
+		if checks[i] >= minSLOChecks {
+			rates[db.BurnWindowKey(w)] = spec.burnRate(checks[i], failures[i])
+		}
+	}
+	return rates, nil
+}
@@ -0,0 +1,89 @@
+package monitoring
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// statusMatcher is a target's compiled expected status list.
+type statusMatcher struct {
+	ranges []statusRange
+}
+
+type statusRange struct {
+	lo, hi int
+}
+
+// compileStatus parses expected status expressions: exact codes ("200"),
+// wildcards ("2xx") and inclusive ranges ("200-204"). Every invalid
+// expression is reported, keyed by its index.
+func compileStatus(exprs []string) (*statusMatcher, error) {
+	m := &statusMatcher{}
+	var errs db.ValidationErrors
+	for i, expr := range exprs {
+		r, err := parseStatusExpr(strings.TrimSpace(expr))
+		if err != nil {
+			errs.Add(fmt.Sprintf("[%d]", i), db.CodeInvalid, err.Error())
+			continue
+		}
+		m.ranges = append(m.ranges, r)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseStatusExpr(expr string) (statusRange, error) {
+	if len(expr) == 3 && strings.EqualFold(expr[1:], "xx") {
+		class := int(expr[0] - '0')
+		if class < 1 || class > 5 {
+			return statusRange{}, fmt.Errorf("invalid expected status %q", expr)
+		}
+		return statusRange{lo: class * 100, hi: class*100 + 99}, nil
+	}
+
+	if lo, hi, ok := strings.Cut(expr, "-"); ok {
+		r := statusRange{}
+		var err error
+		if r.lo, err = parseStatusCode(lo); err != nil {
+			return r, fmt.Errorf("invalid expected status %q: %v", expr, err)
+		}
+		if r.hi, err = parseStatusCode(hi); err != nil {
+			return r, fmt.Errorf("invalid expected status %q: %v", expr, err)
+		}
+		if r.hi < r.lo {
+			return r, fmt.Errorf("invalid expected status %q: range is reversed", expr)
+		}
+		return r, nil
+	}
+
+	code, err := parseStatusCode(expr)
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid expected status %q: %v", expr, err)
+	}
+	return statusRange{lo: code, hi: code}, nil
+}
+
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("not a status code")
+	}
+	if code < 100 || code > 599 {
+		return 0, fmt.Errorf("%d is outside 100-599", code)
+	}
+	return code, nil
+}
+
+func (m *statusMatcher) matches(code int) bool {
+	for _, r := range m.ranges {
+		if code >= r.lo && code <= r.hi {
+			return true
+		}
+	}
+	return false
+}
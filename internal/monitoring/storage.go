@@ -0,0 +1,30 @@
+package monitoring
+
+import (
+	"context"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Storage persists and reads back monitoring results, including their
+// Encoding and compressed fields.
+type Storage interface {
+	SaveResult(ctx context.Context, result *db.MonitoringResult) error
+	GetResults(ctx context.Context, query ResultQuery) ([]*db.MonitoringResult, error)
+	// StreamResults calls fn for every result matching query, in timestamp
+	// order, without loading the whole result set into memory.
+	StreamResults(ctx context.Context, query ResultQuery, fn func(*db.MonitoringResult) error) error
+	// SaveDigest and LoadDigest persist a target's latency digest so it
+	// survives restarts. LoadDigest returns nil when none is stored.
+	SaveDigest(ctx context.Context, targetID string, digest []byte) error
+	LoadDigest(ctx context.Context, targetID string) ([]byte, error)
+}
+
+type ResultQuery struct {
+	TargetID  string
+	StartTime time.Time
+	EndTime   time.Time
+	Limit     int
+	Offset    int
+}
@@ -0,0 +1,82 @@
+package monitoring
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"api-watchtower/internal/db"
+)
+
+// stableHeaders are the response headers that count as a change of a
+// store-on-change target's detail. Others, such as Date, Age or request
+// IDs, differ on every response and would defeat the comparison.
+var stableHeaders = []string{
+	"Cache-Control",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"Etag",
+	"Location",
+	"Vary",
+}
+
+// detailBaseline is the last result of a store-on-change target whose
+// headers and body were stored in full.
+type detailBaseline struct {
+	id   string
+	hash string
+}
+
+// dropUnchangedDetail strips the headers and body from a successful result
+// of a store-on-change target when its body and stable headers match the
+// last stored ones, and points UnchangedSince at that result instead.
+// Otherwise it returns the baseline the result becomes, for setDetail once
+// the result is stored. Failed results always keep their detail but don't
+// move the baseline, so an error page is never what later results are
+// compared against.
+func (state *targetState) dropUnchangedDetail(result *db.MonitoringResult) *detailBaseline {
+	if !result.Success {
+		return nil
+	}
+
+	hash := detailHash(result)
+
+	state.detailMu.Lock()
+	defer state.detailMu.Unlock()
+	if state.detail.id != "" && state.detail.hash == hash {
+		result.ResponseHeaders = nil
+		result.ResponseBody = nil
+		result.UnchangedSince = state.detail.id
+		return nil
+	}
+	return &detailBaseline{id: result.ID, hash: hash}
+}
+
+// setDetail makes a stored result the baseline later results are compared
+// against.
+func (state *targetState) setDetail(baseline detailBaseline) {
+	state.detailMu.Lock()
+	defer state.detailMu.Unlock()
+	state.detail = baseline
+}
+
+// detailHash hashes a result's body and stableHeaders.
+func detailHash(result *db.MonitoringResult) string {
+	var headers http.Header
+	json.Unmarshal(result.ResponseHeaders, &headers)
+
+	h := sha256.New()
+	for _, name := range stableHeaders {
+		for _, value := range headers[name] {
+			h.Write([]byte(name))
+			h.Write([]byte{0})
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+	}
+	h.Write([]byte{0})
+	h.Write(result.ResponseBody)
+	return hex.EncodeToString(h.Sum(nil))
+}
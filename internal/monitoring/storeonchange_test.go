@@ -0,0 +1,46 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+func TestStoreOnChangeBaselineNeedsSave(t *testing.T) {
+	storage := &memStorage{}
+	e := NewEngine(storage)
+	target := &db.MonitoringTarget{ID: "t1", Name: "checkout", URL: "http://localhost", Method: "GET", Frequency: "@every 1m", Timeout: "5s", StoreOnChange: true}
+	if err := e.AddTarget(target); err != nil {
+		t.Fatalf("AddTarget: %v", err)
+	}
+	state := e.targets["t1"]
+
+	result := func(id string) *db.MonitoringResult {
+		return &db.MonitoringResult{ID: id, TargetID: "t1", Success: true, ResponseBody: json.RawMessage(`{"status":"ok"}`)}
+	}
+
+	// The first response is lost with the storage down
+	storage.mu.Lock()
+	storage.saveErr = errors.New("storage down")
+	storage.mu.Unlock()
+	e.recordResult(state, result("r1"))
+	storage.mu.Lock()
+	storage.saveErr = nil
+	storage.mu.Unlock()
+
+	e.recordResult(state, result("r2"))
+	e.recordResult(state, result("r3"))
+
+	results, _ := storage.GetResults(t.Context(), ResultQuery{TargetID: "t1"})
+	if len(results) != 2 {
+		t.Fatalf("stored %d results, want r2 and r3", len(results))
+	}
+	if r2 := results[0]; r2.ResponseBody == nil || r2.UnchangedSince != "" {
+		t.Errorf("r2 was stored as unchanged since %q, want it stored in full after r1 was lost", r2.UnchangedSince)
+	}
+	if r3 := results[1]; r3.ResponseBody != nil || r3.UnchangedSince != "r2" {
+		t.Errorf("r3 was stored unchanged since %q, want r2", r3.UnchangedSince)
+	}
+}
@@ -0,0 +1,139 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"api-watchtower/internal/db"
+)
+
+// successExpr is a compiled success expression: a tree of all, any and not
+// nodes over response rules. A target's expression is JSON such as
+//
+//	{"any": [
+//	  {"all": [{"type": "status", "value": "200"},
+//	           {"type": "json_path", "path": "$.ok", "expected": true}]},
+//	  {"all": [{"type": "status", "value": "503"},
+//	           {"type": "header_exists", "value": "Retry-After"}]}
+//	]}
+//
+// where each leaf is a rule as in response_rules.
+type successExpr struct {
+	// op is "all", "any" or "not"; empty for a rule leaf
+	op       string
+	children []*successExpr
+	rule     *responseRule
+}
+
+// compileSuccessExpr parses a target's success expression, reporting every
+// problem keyed by its position, e.g. "any[1].all[0].value". It returns nil
+// for an empty or null expression, like the other optional target configs.
+func compileSuccessExpr(raw json.RawMessage) (*successExpr, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	return compileSuccessNode(raw)
+}
+
+func compileSuccessNode(raw json.RawMessage) (*successExpr, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: "must be an object with all, any, not or a rule"}
+	}
+
+	var op string
+	for _, name := range []string{"all", "any", "not"} {
+		if _, ok := fields[name]; ok {
+			op = name
+			break
+		}
+	}
+	if op == "" {
+		return compileSuccessRule(raw)
+	}
+	if len(fields) != 1 {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("%s can't be combined with other fields", op)}
+	}
+
+	var errs db.ValidationErrors
+	node := &successExpr{op: op}
+	if op == "not" {
+		child, err := compileSuccessNode(fields[op])
+		errs.Merge(op, err)
+		node.children = []*successExpr{child}
+		return node, errs.Err()
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(fields[op], &items); err != nil || len(items) == 0 {
+		errs.Add(op, db.CodeInvalid, fmt.Sprintf("%s needs a non-empty list", op))
+		return nil, errs.Err()
+	}
+	for i, item := range items {
+		child, err := compileSuccessNode(item)
+		errs.Merge(fmt.Sprintf("%s[%d]", op, i), err)
+		node.children = append(node.children, child)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func compileSuccessRule(raw json.RawMessage) (*successExpr, error) {
+	var rule responseRule
+	if err := json.Unmarshal(raw, &rule); err != nil {
+		return nil, &db.ValidationError{Code: db.CodeInvalid, Message: fmt.Sprintf("invalid rule: %v", err)}
+	}
+
+	var errs db.ValidationErrors
+	compileRule(&rule, "", &errs)
+	if len(errs) > 0 {
+		// compileRule joins its fields onto ours with a dot
+		for i := range errs {
+			errs[i].Field = strings.TrimPrefix(errs[i].Field, ".")
+		}
+		return nil, errs
+	}
+	return &successExpr{rule: &rule}, nil
+}
+
+// eval reports whether the expression holds for a check, and otherwise why
+// not.
+func (x *successExpr) eval(result *db.MonitoringResult, header http.Header, body func() interface{}) (bool, string) {
+	switch x.op {
+	case "all":
+		for _, child := range x.children {
+			if ok, reason := child.eval(result, header, body); !ok {
+				return false, reason
+			}
+		}
+		return true, ""
+	case "any":
+		reasons := make([]string, 0, len(x.children))
+		for _, child := range x.children {
+			ok, reason := child.eval(result, header, body)
+			if ok {
+				return true, ""
+			}
+			reasons = append(reasons, reason)
+		}
+		return false, fmt.Sprintf("no alternative held: %s", strings.Join(reasons, "; "))
+	case "not":
+		if ok, _ := x.children[0].eval(result, header, body); ok {
+			return false, "negated condition held"
+		}
+		return true, ""
+	default:
+		rr := evaluateRule(*x.rule, result, header, body)
+		if rr.Passed {
+			return true, ""
+		}
+		if rr.Message == "" {
+			return false, fmt.Sprintf("%s failed", x.rule.Type)
+		}
+		return false, rr.Message
+	}
+}
@@ -0,0 +1,19 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOptionalConfigsAcceptNull(t *testing.T) {
+	null := json.RawMessage("null")
+	if expr, err := compileSuccessExpr(null); expr != nil || err != nil {
+		t.Errorf("success expression: got %v, %v, want none", expr, err)
+	}
+	if slo, err := compileSLO(null); slo != nil || err != nil {
+		t.Errorf("slo: got %v, %v, want none", slo, err)
+	}
+	if hasher, err := compileBodyHash(null, nil); hasher != nil || err != nil {
+		t.Errorf("body hash: got %v, %v, want none", hasher, err)
+	}
+}
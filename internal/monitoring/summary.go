@@ -0,0 +1,114 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// Summary reports response time percentiles (in seconds) for a target.
+type Summary struct {
+	TargetID string  `json:"target_id"`
+	Checks   int     `json:"checks"`
+	P50      float64 `json:"p50"`
+	P95      float64 `json:"p95"`
+	P99      float64 `json:"p99"`
+	// SuccessRatio is only computed for exact summaries
+	SuccessRatio *float64 `json:"success_ratio,omitempty"`
+	// Approximate is set when the percentiles come from the target's
+	// t-digest rather than from the stored results
+	Approximate bool `json:"approximate"`
+	// Trend is omitted when there isn't enough history to judge it
+	Trend *LatencyTrend `json:"trend,omitempty"`
+}
+
+// Summary returns latency percentiles for a registered target from its
+// running t-digest, which covers every scheduled check since the digest was
+// created, along with its latency trend. The trend is cached per target
+// and refreshed every trendRefreshInterval, so it may be that old.
+func (e *Engine) Summary(ctx context.Context, targetID string) (*Summary, error) {
+	e.mu.RLock()
+	state, exists := e.targets[targetID]
+	e.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("target not found: %s", targetID)
+	}
+
+	summary := &Summary{
+		TargetID:    targetID,
+		Checks:      state.latency.Count(),
+		Approximate: true,
+	}
+	if summary.Checks > 0 {
+		summary.P50 = state.latency.Quantile(0.50)
+		summary.P95 = state.latency.Quantile(0.95)
+		summary.P99 = state.latency.Quantile(0.99)
+	}
+
+	// The percentiles don't depend on storage, so a failed trend lookup
+	// only drops the trend
+	trend, err := e.cachedTrend(ctx, state)
+	if err != nil {
+		log.Printf("Failed to compute latency trend for target %s: %v", targetID, err)
+	}
+	summary.Trend = trend
+	return summary, nil
+}
+
+// ExactSummary computes percentiles and uptime from the stored results
+// between start and end, and the latency trend as of end. Identical
+// requests made while one is in flight share its result.
+func (e *Engine) ExactSummary(ctx context.Context, targetID string, start, end time.Time) (*Summary, error) {
+	key := fmt.Sprintf("%q|%d|%d", targetID, start.UnixNano(), end.UnixNano())
+	return e.summaries.Do(ctx, key, func(ctx context.Context) (*Summary, error) {
+		return e.exactSummary(ctx, targetID, start, end)
+	})
+}
+
+func (e *Engine) exactSummary(ctx context.Context, targetID string, start, end time.Time) (*Summary, error) {
+	var latencies []float64
+	successes := 0
+
+	query := ResultQuery{TargetID: targetID, StartTime: start, EndTime: end}
+	err := e.storage.StreamResults(ctx, query, func(r *db.MonitoringResult) error {
+		latencies = append(latencies, r.ResponseTime)
+		if r.Success {
+			successes++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{TargetID: targetID, Checks: len(latencies)}
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		summary.P50 = exactQuantile(latencies, 0.50)
+		summary.P95 = exactQuantile(latencies, 0.95)
+		summary.P99 = exactQuantile(latencies, 0.99)
+		ratio := float64(successes) / float64(len(latencies))
+		summary.SuccessRatio = &ratio
+	}
+
+	trend, err := e.LatencyTrend(ctx, targetID, end)
+	if err != nil {
+		return nil, err
+	}
+	summary.Trend = trend
+	return summary, nil
+}
+
+// exactQuantile interpolates linearly between the closest ranks.
+func exactQuantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
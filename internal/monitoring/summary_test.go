@@ -0,0 +1,43 @@
+package monitoring
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+// countingStorage counts the result streams read from it.
+type countingStorage struct {
+	*memStorage
+	streams atomic.Int32
+}
+
+func (s *countingStorage) StreamResults(ctx context.Context, query ResultQuery, fn func(*db.MonitoringResult) error) error {
+	s.streams.Add(1)
+	return s.memStorage.StreamResults(ctx, query, fn)
+}
+
+func TestSummaryCachesTrend(t *testing.T) {
+	storage := &countingStorage{memStorage: &memStorage{}}
+	e := NewEngine(storage)
+	target := &db.MonitoringTarget{ID: "t1", Name: "checkout", URL: "http://localhost", Method: "GET", Frequency: "@every 1m", Timeout: "5s"}
+	if err := e.AddTarget(target); err != nil {
+		t.Fatalf("AddTarget: %v", err)
+	}
+
+	for range 3 {
+		if _, err := e.Summary(context.Background(), "t1"); err != nil {
+			t.Fatalf("Summary: %v", err)
+		}
+	}
+	if got := storage.streams.Load(); got != 1 {
+		t.Errorf("three summaries read the history %d times, want once", got)
+	}
+
+	e.refreshTrends()
+	if got := storage.streams.Load(); got != 2 {
+		t.Errorf("read the history %d times after a refresh, want 2", got)
+	}
+}
@@ -0,0 +1,182 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+)
+
+// defaultCompression trades memory for accuracy. At 100 a digest holds at
+// most a few hundred centroids (a few KB) regardless of how many values it
+// has seen, and estimates p50 within roughly 1% of rank and p99 within about
+// 0.1%, since centroids shrink towards the tails. Estimates are exact while
+// only a handful of values have been added.
+const defaultCompression = 100
+
+// tdigest is a merging t-digest: an online, mergeable sketch of a
+// distribution answering quantile queries with bounded memory.
+type tdigest struct {
+	mu          sync.Mutex
+	compression float64
+	centroids   []centroid // sorted by mean
+	buffer      []float64
+	count       float64
+	min, max    float64
+}
+
+type centroid struct {
+	mean, weight float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (d *tdigest) Add(x float64) {
+	if math.IsNaN(x) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.buffer = append(d.buffer, x)
+	d.count++
+	d.min = math.Min(d.min, x)
+	d.max = math.Max(d.max, x)
+	if len(d.buffer) >= int(5*d.compression) {
+		d.compress()
+	}
+}
+
+func (d *tdigest) Count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return int(d.count)
+}
+
+// Quantile estimates the value at quantile q (0-1), or NaN when empty.
+func (d *tdigest) Quantile(q float64) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.compress()
+	if d.count == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return d.min
+	}
+	if q >= 1 {
+		return d.max
+	}
+
+	// Each centroid's mean sits at the middle of its weight; interpolate
+	// between neighbouring centres, and towards min/max at the ends.
+	target := q * d.count
+	cumulative := 0.0
+	prevCenter, prevMean := 0.0, d.min
+	for _, c := range d.centroids {
+		center := cumulative + c.weight/2
+		if target < center {
+			return interpolate(target, prevCenter, center, prevMean, c.mean)
+		}
+		cumulative += c.weight
+		prevCenter, prevMean = center, c.mean
+	}
+	return interpolate(target, prevCenter, d.count, prevMean, d.max)
+}
+
+func interpolate(x, x0, x1, y0, y1 float64) float64 {
+	if x1 <= x0 {
+		return y1
+	}
+	return y0 + (y1-y0)*(x-x0)/(x1-x0)
+}
+
+// compress merges buffered values into the centroids. Callers must hold
+// d.mu.
+func (d *tdigest) compress() {
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	all := make([]centroid, 0, len(d.centroids)+len(d.buffer))
+	all = append(all, d.centroids...)
+	for _, x := range d.buffer {
+		all = append(all, centroid{mean: x, weight: 1})
+	}
+	d.buffer = d.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := []centroid{all[0]}
+	before := 0.0 // weight of the centroids before the last merged one
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		proposed := last.weight + c.weight
+		q := (before + proposed/2) / d.count
+		// Centroids may hold more weight mid-distribution than in the tails
+		if proposed <= math.Max(1, 4*d.count*q*(1-q)/d.compression) {
+			last.mean += (c.mean - last.mean) * c.weight / proposed
+			last.weight = proposed
+			continue
+		}
+		before += last.weight
+		merged = append(merged, c)
+	}
+	d.centroids = merged
+}
+
+type tdigestState struct {
+	Compression float64      `json:"compression"`
+	Min         float64      `json:"min"`
+	Max         float64      `json:"max"`
+	Centroids   [][2]float64 `json:"centroids"`
+}
+
+func (d *tdigest) MarshalJSON() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.compress()
+	state := tdigestState{Compression: d.compression, Min: d.min, Max: d.max}
+	if d.count == 0 {
+		state.Min, state.Max = 0, 0
+	}
+	for _, c := range d.centroids {
+		state.Centroids = append(state.Centroids, [2]float64{c.mean, c.weight})
+	}
+	return json.Marshal(state)
+}
+
+func (d *tdigest) UnmarshalJSON(data []byte) error {
+	var state tdigestState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.compression = state.Compression
+	if d.compression <= 0 {
+		d.compression = defaultCompression
+	}
+	d.centroids = d.centroids[:0]
+	d.buffer = d.buffer[:0]
+	d.count = 0
+	d.min, d.max = math.Inf(1), math.Inf(-1)
+	for _, c := range state.Centroids {
+		d.centroids = append(d.centroids, centroid{mean: c[0], weight: c[1]})
+		d.count += c[1]
+	}
+	if d.count > 0 {
+		d.min, d.max = state.Min, state.Max
+	}
+	return nil
+}
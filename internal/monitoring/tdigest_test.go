@@ -0,0 +1,74 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"testing"
+
+	"api-watchtower/internal/db"
+)
+
+func TestTDigestMatchesExactQuantiles(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	d := newTDigest(defaultCompression)
+	values := make([]float64, 100000)
+	for i := range values {
+		// Latency-like: a long right tail
+		values[i] = math.Exp(rng.NormFloat64()*0.5 + 5)
+		d.Add(values[i])
+	}
+	sort.Float64s(values)
+
+	// Round-trip as when restored from storage
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	restored := newTDigest(defaultCompression)
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	// Allowed error in rank, per the accuracy documented at defaultCompression
+	tolerance := map[float64]float64{0.5: 0.01, 0.9: 0.005, 0.99: 0.001, 0.999: 0.0005}
+	for _, digest := range []*tdigest{d, restored} {
+		for q, tol := range tolerance {
+			estimate := digest.Quantile(q)
+			rank := float64(sort.SearchFloat64s(values, estimate)) / float64(len(values))
+			if math.Abs(rank-q) > tol {
+				exact := values[int(q*float64(len(values)))]
+				t.Errorf("p%v estimated %.2f at rank %.4f, exact %.2f; want within %v of rank", q*100, estimate, rank, exact, tol)
+			}
+		}
+	}
+	if got := restored.Count(); got != len(values) {
+		t.Errorf("restored digest counts %d values, want %d", got, len(values))
+	}
+}
+
+func TestStopSavesDigests(t *testing.T) {
+	storage := &memStorage{}
+	e := NewEngine(storage)
+	target := &db.MonitoringTarget{ID: "t1", Name: "checkout", URL: "http://localhost", Method: "GET", Frequency: "@every 1m", Timeout: "5s"}
+	if err := e.AddTarget(target); err != nil {
+		t.Fatalf("AddTarget: %v", err)
+	}
+	// Fewer checks than trigger a save
+	for i := range digestPersistEvery / 2 {
+		e.recordResult(e.targets["t1"], &db.MonitoringResult{ID: db.NewID(), TargetID: "t1", Success: true, ResponseTime: float64(100 + i)})
+	}
+	if err := e.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	restarted := NewEngine(storage)
+	if err := restarted.AddTarget(target); err != nil {
+		t.Fatalf("AddTarget: %v", err)
+	}
+	if got := restarted.targets["t1"].latency.Count(); got != digestPersistEvery/2 {
+		t.Errorf("restarted engine's digest holds %d checks, want the %d before Stop", got, digestPersistEvery/2)
+	}
+}
@@ -0,0 +1,191 @@
+package monitoring
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api-watchtower/internal/ai"
+)
+
+// Latency trend analysis works on hourly mean latencies over the last two
+// weeks, so seasonality lines up with the time of day and, given enough
+// history, the day of the week.
+const (
+	trendWindow     = 14 * 24 * time.Hour
+	trendBuckets    = 14 * 24
+	dailyPeriod     = 24
+	weeklyPeriod    = 7 * 24
+	trendConfidence = 0.95
+	// trendMaxGaps is the largest fraction of empty hours tolerated inside
+	// the series; gaps are filled with the previous hour's latency
+	trendMaxGaps = 0.2
+	// trendRefreshInterval is how often the trends Summary reports are
+	// recomputed; each takes two weeks of results
+	trendRefreshInterval = 10 * time.Minute
+	// trendRefreshTimeout bounds the recomputation of one target's trend
+	trendRefreshTimeout = time.Minute
+)
+
+// LatencyTrend is the expected latency for the current hour given the
+// target's trend and daily or weekly pattern.
+type LatencyTrend struct {
+	// Current is the mean latency so far this hour, in seconds
+	Current       float64  `json:"current"`
+	ExpectedRange ai.Range `json:"expected_range"`
+	Anomalous     bool     `json:"anomalous"`
+	Score         float64  `json:"score"`
+	// SlopePerDay is how much the trend component moved over the last day
+	SlopePerDay float64 `json:"slope_per_day"`
+	// Period is the seasonal period used: "daily" or "weekly"
+	Period string `json:"period"`
+	// DominantComponent is "trend" or "seasonal", whichever explains more of
+	// the current hour's offset from the mean
+	DominantComponent string `json:"dominant_component,omitempty"`
+}
+
+// LatencyTrend runs the target's hourly latency series ending at end
+// through the anomaly detector's trend and seasonal decomposition. It
+// returns nil when there isn't at least two days of reasonably continuous
+// history.
+func (e *Engine) LatencyTrend(ctx context.Context, targetID string, end time.Time) (*LatencyTrend, error) {
+	// Align buckets to clock hours; the last one is the current, partial hour
+	end = end.Truncate(time.Hour).Add(time.Hour)
+	history, err := e.History(ctx, targetID, end, trendWindow, trendBuckets)
+	if err != nil {
+		return nil, err
+	}
+
+	points := latencySeries(history)
+	if points == nil {
+		return nil, nil
+	}
+
+	period, periodName := dailyPeriod, "daily"
+	if len(points) >= 2*weeklyPeriod {
+		period, periodName = weeklyPeriod, "weekly"
+	}
+
+	detector := ai.NewAnomalyDetector(2*period, trendConfidence, period)
+	detector.Explain = true
+	results := detector.DetectAnomalies(points)
+
+	last := len(points) - 1
+	latest := results[last]
+	if latest.Explanation == nil {
+		return nil, nil
+	}
+
+	// The seasonal method's verdict is the one that accounts for the time
+	// of day or week
+	var seasonal ai.MethodVerdict
+	for _, v := range latest.Explanation.Methods {
+		if v.Method == ai.MethodSeasonal {
+			seasonal = v
+		}
+	}
+
+	trend := &LatencyTrend{
+		Current:           points[last].Value,
+		ExpectedRange:     seasonal.ExpectedRange,
+		Anomalous:         seasonal.IsAnomaly,
+		Score:             seasonal.Score,
+		Period:            periodName,
+		DominantComponent: latest.Explanation.DominantComponent,
+	}
+	if dayAgo := results[last-dailyPeriod].Explanation; dayAgo != nil {
+		trend.SlopePerDay = latest.Explanation.Trend - dayAgo.Trend
+	}
+	return trend, nil
+}
+
+// latencySeries turns hourly buckets into a gap-free series starting at the
+// first hour with results and ending at the last bucket, which must have
+// results. It returns nil when the series is shorter than two days or too
+// sparse to decompose.
+func latencySeries(history []HistoryBucket) []ai.TimeSeriesPoint {
+	first := -1
+	for i, b := range history {
+		if b.AvgLatency != nil {
+			first = i
+			break
+		}
+	}
+	if first < 0 || history[len(history)-1].AvgLatency == nil {
+		return nil
+	}
+
+	history = history[first:]
+	if len(history) < 2*dailyPeriod {
+		return nil
+	}
+
+	points := make([]ai.TimeSeriesPoint, len(history))
+	gaps := 0
+	var previous float64
+	for i, b := range history {
+		if b.AvgLatency == nil {
+			gaps++
+		} else {
+			previous = *b.AvgLatency
+		}
+		points[i] = ai.TimeSeriesPoint{Timestamp: b.Start, Value: previous}
+	}
+	if float64(gaps) > trendMaxGaps*float64(len(points)) {
+		return nil
+	}
+	return points
+}
+
+// cachedTrend returns the target's cached latency trend, computing it if
+// there is none yet.
+func (e *Engine) cachedTrend(ctx context.Context, state *targetState) (*LatencyTrend, error) {
+	state.trendMu.Lock()
+	trend, cached := state.trend, state.trendCached
+	state.trendMu.Unlock()
+	if cached {
+		return trend, nil
+	}
+	return e.refreshTrend(ctx, state)
+}
+
+// refreshTrend recomputes the target's latency trend and caches it. On
+// failure the cached trend is left as it was.
+func (e *Engine) refreshTrend(ctx context.Context, state *targetState) (*LatencyTrend, error) {
+	trend, err := e.LatencyTrend(ctx, state.target.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	state.trendMu.Lock()
+	state.trend, state.trendCached = trend, true
+	state.trendMu.Unlock()
+	return trend, nil
+}
+
+// refreshTrends recomputes the cached trend of every target that has one.
+// It runs every trendRefreshInterval.
+func (e *Engine) refreshTrends() {
+	e.mu.RLock()
+	states := make([]*targetState, 0, len(e.targets))
+	for _, state := range e.targets {
+		states = append(states, state)
+	}
+	e.mu.RUnlock()
+
+	for _, state := range states {
+		state.trendMu.Lock()
+		cached := state.trendCached
+		state.trendMu.Unlock()
+		if !cached {
+			// Computed on the first Summary, so targets nobody looks at
+			// cost nothing
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), trendRefreshTimeout)
+		if _, err := e.refreshTrend(ctx, state); err != nil {
+			log.Printf("Failed to refresh latency trend for target %s: %v", state.target.ID, err)
+		}
+		cancel()
+	}
+}
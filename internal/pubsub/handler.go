@@ -0,0 +1,97 @@
+package pubsub
+
+import "hash/fnv"
+
+// HandlerOptions configure a subscription whose values are passed to a
+// handler by a pool of workers.
+type HandlerOptions[T any] struct {
+	Options[T]
+	// Workers is how many values are handled at once. Defaults to 1,
+	// which handles every value in publish order.
+	Workers int
+	// OrderKey, when set, keeps values with the same key in publish order,
+	// e.g. one source's events, by always handling them on the same
+	// worker; values with different keys are handled in parallel. Without
+	// it values go to whichever worker is free, in no particular order.
+	OrderKey func(T) string
+}
+
+// Handle subscribes fn to the broker's values. The subscription's buffer
+// and overflow policy apply as for SubscribeWith, but values are consumed
+// by the workers rather than read from C. With an OrderKey each worker
+// also has a queue of Buffer values, and the overflow policy applies to it
+// too, so one slow key can't hold up the others. Values still buffered
+// when the subscription is closed or dropped are handled before the
+// workers exit. The caller must Close the subscription when done with it.
+func (b *Broker[T]) Handle(opts HandlerOptions[T], fn func(T)) *Subscription[T] {
+	sub := b.SubscribeWith(opts.Options)
+
+	workers := max(opts.Workers, 1)
+	var shared chan T
+	if opts.OrderKey == nil {
+		shared = make(chan T)
+	}
+	queues := make([]chan T, workers)
+	for i := range queues {
+		queues[i] = shared
+		if shared == nil {
+			queues[i] = make(chan T, max(opts.Buffer, 1))
+		}
+		go func(queue <-chan T) {
+			for v := range queue {
+				fn(v)
+			}
+		}(queues[i])
+	}
+
+	go func() {
+		for v := range sub.ch {
+			if shared != nil {
+				shared <- v
+				continue
+			}
+			h := fnv.New32a()
+			h.Write([]byte(opts.OrderKey(v)))
+			sub.enqueue(queues[h.Sum32()%uint32(workers)], v)
+		}
+		if shared != nil {
+			close(shared)
+			return
+		}
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+	return sub
+}
+
+// enqueue adds v to a worker's queue. A full queue overflows as the
+// subscription's buffer would: the subscription is dropped, though v and
+// the values already buffered are still handled, or the queue's oldest
+// value is discarded. Only the dispatcher sends on the queues, so once a
+// value is taken there is room.
+func (s *Subscription[T]) enqueue(queue chan T, v T) {
+	select {
+	case queue <- v:
+		return
+	default:
+	}
+
+	s.broker.mu.Lock()
+	if s.overflow != OverflowDropOldest {
+		if _, live := s.broker.subs[s]; live {
+			s.dropped = true
+			s.broker.remove(s)
+		}
+		s.broker.mu.Unlock()
+		queue <- v
+		return
+	}
+	select {
+	case <-queue:
+		s.discarded++
+	default:
+	}
+	s.broker.mu.Unlock()
+	queue <- v
+}
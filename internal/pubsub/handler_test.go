@@ -0,0 +1,88 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+type event struct {
+	key string
+	n   int
+}
+
+func TestHandleSlowKeyDoesNotBlockOthers(t *testing.T) {
+	var b Broker[event]
+	release := make(chan struct{})
+	handled := make(chan event, 16)
+	// "slow" and "fast" hash to different workers
+	sub := b.Handle(HandlerOptions[event]{
+		Options:  Options[event]{Buffer: 4},
+		Workers:  2,
+		OrderKey: func(e event) string { return e.key },
+	}, func(e event) {
+		if e.key == "slow" {
+			<-release
+		}
+		handled <- e
+	})
+	defer sub.Close()
+	defer close(release)
+
+	for n := range 3 {
+		b.Publish(event{"slow", n})
+	}
+	for n := range 10 {
+		b.Publish(event{"fast", n})
+		select {
+		case e := <-handled:
+			if e != (event{"fast", n}) {
+				t.Fatalf("handled %+v, want fast %d", e, n)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("fast %d not handled while the slow key is blocked", n)
+		}
+	}
+	if sub.Dropped() {
+		t.Error("subscription dropped while only one key was slow")
+	}
+}
+
+func TestHandleDropsOldestPerWorker(t *testing.T) {
+	var b Broker[event]
+	release := make(chan struct{})
+	handled := make(chan event, 16)
+	sub := b.Handle(HandlerOptions[event]{
+		Options:  Options[event]{Buffer: 2, Overflow: OverflowDropOldest},
+		Workers:  2,
+		OrderKey: func(e event) string { return e.key },
+	}, func(e event) {
+		<-release
+		handled <- e
+	})
+	defer sub.Close()
+
+	// The first value is taken by the worker; later ones wait their turn
+	// on the subscription buffer and the worker's queue, and the oldest
+	// waiting ones are discarded
+	for n := range 8 {
+		b.Publish(event{"slow", n})
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+
+	var got []int
+	for len(got) < 8-int(sub.Discarded()) {
+		select {
+		case e := <-handled:
+			got = append(got, e.n)
+		case <-time.After(time.Second):
+			t.Fatalf("handled %v, discarded %d of 8", got, sub.Discarded())
+		}
+	}
+	if sub.Discarded() == 0 || sub.Dropped() {
+		t.Errorf("discarded %d, dropped %v; want values discarded without dropping", sub.Discarded(), sub.Dropped())
+	}
+	if got[0] != 0 || got[len(got)-1] != 7 {
+		t.Errorf("handled %v, want the first and the latest values", got)
+	}
+}
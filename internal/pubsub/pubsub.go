@@ -0,0 +1,150 @@
+// Package pubsub fans values out to live subscribers, such as clients
+// streaming results as they are produced.
+package pubsub
+
+import "sync"
+
+// Broker delivers every published value to each subscriber whose filter
+// accepts it, in publish order. Publish never blocks: a subscriber that
+// falls a full buffer behind is dropped, or loses its oldest values if it
+// asked for OverflowDropOldest, so a slow consumer can't back up the
+// publisher. The zero value is ready to use.
+type Broker[T any] struct {
+	mu   sync.Mutex
+	subs map[*Subscription[T]]struct{}
+}
+
+// Overflow selects what happens when a subscriber's buffer is full.
+type Overflow int
+
+const (
+	// OverflowDrop drops the subscriber and closes its channel; it is the
+	// default, for consumers that can't make sense of a gap
+	OverflowDrop Overflow = iota
+	// OverflowDropOldest discards the subscriber's oldest buffered value to
+	// make room, for consumers that only care about recent values
+	OverflowDropOldest
+)
+
+// Options configure a subscription.
+type Options[T any] struct {
+	// Buffer is how many values the subscriber may fall behind
+	Buffer int
+	// Filter selects the values delivered; nil accepts every value
+	Filter   func(T) bool
+	Overflow Overflow
+}
+
+// Subscription receives a broker's values on C until it is closed or
+// dropped.
+type Subscription[T any] struct {
+	broker    *Broker[T]
+	ch        chan T
+	filter    func(T) bool
+	overflow  Overflow
+	dropped   bool
+	discarded uint64
+}
+
+// Subscribe registers a subscriber buffering up to buffer values, dropped
+// once it falls further behind. A nil filter accepts every value. The
+// caller must Close the subscription when done with it.
+func (b *Broker[T]) Subscribe(buffer int, filter func(T) bool) *Subscription[T] {
+	return b.SubscribeWith(Options[T]{Buffer: buffer, Filter: filter})
+}
+
+// SubscribeWith registers a subscriber configured by opts. The caller must
+// Close the subscription when done with it.
+func (b *Broker[T]) SubscribeWith(opts Options[T]) *Subscription[T] {
+	sub := &Subscription[T]{
+		broker:   b,
+		ch:       make(chan T, opts.Buffer),
+		filter:   opts.Filter,
+		overflow: opts.Overflow,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[*Subscription[T]]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers v to every subscriber that accepts it. Subscribers with
+// a full buffer are dropped or lose their oldest value, as they chose.
+func (b *Broker[T]) Publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.filter != nil && !sub.filter(v) {
+			continue
+		}
+		select {
+		case sub.ch <- v:
+			continue
+		default:
+		}
+
+		if sub.overflow != OverflowDropOldest || cap(sub.ch) == 0 {
+			sub.dropped = true
+			b.remove(sub)
+			continue
+		}
+		// Only Publish sends, under b.mu, so once a value is taken there
+		// is room, whether it was taken here or by the consumer
+		select {
+		case <-sub.ch:
+			sub.discarded++
+		default:
+		}
+		sub.ch <- v
+	}
+}
+
+// Subscribers returns the number of live subscriptions.
+func (b *Broker[T]) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// remove must be called with b.mu held.
+func (b *Broker[T]) remove(sub *Subscription[T]) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// C returns the channel values are delivered on. It is closed when the
+// subscription is closed or dropped.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Dropped reports whether the broker dropped the subscription for falling
+// behind.
+func (s *Subscription[T]) Dropped() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// Discarded returns how many values an OverflowDropOldest subscription
+// lost to a full buffer.
+func (s *Subscription[T]) Discarded() uint64 {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.discarded
+}
+
+// Close unsubscribes. It is safe to call more than once and after the
+// subscription was dropped.
+func (s *Subscription[T]) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
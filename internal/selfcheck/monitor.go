@@ -0,0 +1,218 @@
+// Package selfcheck monitors the watchtower's own subsystems, such as its
+// storage, log ingestion, analyzer and notification channels, and reports
+// them through the same results and alert rules as external targets, so
+// the system can page about itself.
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+// TargetPrefix starts the target ID of every self-check result, followed
+// by the probe's name, e.g. "self:storage".
+const TargetPrefix = "self:"
+
+// ErrorPrefix starts the error of every failed self-check result, so alert
+// rules can match self-checks with an error_match condition.
+const ErrorPrefix = "self-check "
+
+// Probe checks one subsystem. Check returns the measurements to report,
+// which become the result's extracted metrics, and an error when the
+// subsystem is degraded.
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context) (map[string]float64, error)
+}
+
+// Recorder stores and streams results; *monitoring.Engine implements it.
+type Recorder interface {
+	RecordResult(ctx context.Context, result *db.MonitoringResult) error
+}
+
+// AlertProcessor raises alerts from results; *alert.Manager implements it.
+type AlertProcessor interface {
+	ProcessMonitoringResult(ctx context.Context, result *db.MonitoringResult) error
+}
+
+// Config controls how often the probes run.
+type Config struct {
+	// Interval is the time between probe rounds. Defaults to 1m.
+	Interval time.Duration
+	// Timeout bounds each probe; a probe that runs over it fails.
+	// Defaults to 10s.
+	Timeout time.Duration
+}
+
+// Monitor runs its probes every interval and hands each outcome, as a
+// MonitoringResult, to the recorder and the alert processor.
+type Monitor struct {
+	probes   []Probe
+	interval time.Duration
+	timeout  time.Duration
+	recorder Recorder
+	alerts   AlertProcessor
+
+	// cancel stops the probe rounds, which close done on exit
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMonitor validates cfg and the probes and starts probing. Either of
+// recorder and alerts may be nil.
+func NewMonitor(cfg Config, recorder Recorder, alerts AlertProcessor, probes ...Probe) (*Monitor, error) {
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Interval < 0 || cfg.Timeout < 0 {
+		return nil, fmt.Errorf("interval and timeout must be positive, got %s and %s", cfg.Interval, cfg.Timeout)
+	}
+	names := make(map[string]bool, len(probes))
+	for i, probe := range probes {
+		switch {
+		case probe.Name == "":
+			return nil, fmt.Errorf("probe %d has no name", i)
+		case probe.Check == nil:
+			return nil, fmt.Errorf("probe %s has no check", probe.Name)
+		case names[probe.Name]:
+			return nil, fmt.Errorf("duplicate probe name: %s", probe.Name)
+		}
+		names[probe.Name] = true
+	}
+
+	m := &Monitor{
+		probes:   probes,
+		interval: cfg.Interval,
+		timeout:  cfg.Timeout,
+		recorder: recorder,
+		alerts:   alerts,
+		done:     make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go m.run(ctx)
+	return m, nil
+}
+
+// Stop ends the probing, cancelling a round in progress, and waits for it
+// to return. If ctx ends first it returns ctx's error.
+func (m *Monitor) Stop(ctx context.Context) error {
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("self-checks still running: %v", ctx.Err())
+	}
+}
+
+func (m *Monitor) run(ctx context.Context) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Round(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Round runs every probe at once and reports their results, which it
+// returns in probe order.
+func (m *Monitor) Round(ctx context.Context) []*db.MonitoringResult {
+	results := make([]*db.MonitoringResult, len(m.probes))
+	var wg sync.WaitGroup
+	for i, probe := range m.probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.check(ctx, probe)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		m.report(ctx, result)
+	}
+	return results
+}
+
+// probeOutcome is what a probe's Check returned.
+type probeOutcome struct {
+	metrics map[string]float64
+	err     error
+}
+
+// check runs one probe within the timeout. A degraded subsystem is
+// reported as a failed check with status 503 and critical severity. A
+// probe that ignores its context and runs over the timeout is left running
+// and reported as failed, so it can't hold up the round.
+func (m *Monitor) check(ctx context.Context, probe Probe) *db.MonitoringResult {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan probeOutcome, 1)
+	go func() {
+		metrics, err := probe.Check(ctx)
+		done <- probeOutcome{metrics, err}
+	}()
+
+	var outcome probeOutcome
+	select {
+	case outcome = <-done:
+	case <-ctx.Done():
+	}
+	metrics, err := outcome.metrics, outcome.err
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("probe timed out: %v", ctx.Err())
+	}
+
+	result := &db.MonitoringResult{
+		ID:               db.NewID(),
+		TargetID:         TargetPrefix + probe.Name,
+		StatusCode:       http.StatusOK,
+		ResponseTime:     time.Since(start).Seconds(),
+		Success:          true,
+		Timestamp:        start,
+		ExtractedMetrics: metrics,
+	}
+	if err != nil {
+		result.StatusCode = http.StatusServiceUnavailable
+		result.Success = false
+		result.Error = ErrorPrefix + probe.Name + ": " + err.Error()
+		result.ResultSeverity = db.ResultSeverityCritical
+	}
+	return result
+}
+
+// report records a result and runs the alert rules on it. Alerts are
+// processed even if recording fails, since failing storage is one of the
+// things worth paging about.
+func (m *Monitor) report(ctx context.Context, result *db.MonitoringResult) {
+	if m.recorder != nil {
+		if err := m.recorder.RecordResult(ctx, result); err != nil {
+			log.Printf("Failed to record self-check %s: %v", result.TargetID, err)
+		}
+	}
+	if m.alerts != nil {
+		if err := m.alerts.ProcessMonitoringResult(ctx, result); err != nil {
+			log.Printf("Failed to process self-check %s for alerts: %v", result.TargetID, err)
+		}
+	}
+}
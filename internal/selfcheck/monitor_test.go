@@ -0,0 +1,53 @@
+package selfcheck
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"api-watchtower/internal/db"
+)
+
+func TestRoundFailsHungProbe(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	hung := Probe{
+		Name: "hung",
+		Check: func(ctx context.Context) (map[string]float64, error) {
+			// Ignores ctx
+			<-release
+			return nil, nil
+		},
+	}
+	healthy := Probe{
+		Name:  "healthy",
+		Check: func(ctx context.Context) (map[string]float64, error) { return nil, nil },
+	}
+
+	m, err := NewMonitor(Config{Interval: time.Hour, Timeout: 20 * time.Millisecond}, nil, nil, hung, healthy)
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	defer m.Stop(context.Background())
+
+	done := make(chan []*db.MonitoringResult, 1)
+	go func() { done <- m.Round(context.Background()) }()
+	var results []*db.MonitoringResult
+	select {
+	case results = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Round blocked on a probe that ignores its context")
+	}
+
+	if r := results[0]; r.Success || r.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("hung probe reported success %v, status %d", r.Success, r.StatusCode)
+	}
+	if r := results[1]; !r.Success {
+		t.Errorf("healthy probe failed: %s", r.Error)
+	}
+	// Response times are in seconds, as for every other result
+	if r := results[0]; r.ResponseTime < 0.02 || r.ResponseTime > 1 {
+		t.Errorf("hung probe took %v, want the 20ms timeout in seconds", r.ResponseTime)
+	}
+}
@@ -0,0 +1,104 @@
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"api-watchtower/internal/alert"
+)
+
+// Pinger is a store that can be pinged, such as a *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingProbe checks that a store answers a ping.
+func PingProbe(name string, store Pinger) Probe {
+	return Probe{
+		Name: name,
+		Check: func(ctx context.Context) (map[string]float64, error) {
+			return nil, store.PingContext(ctx)
+		},
+	}
+}
+
+// IngestionProbe checks the log ingester's buffer, such as a
+// *log.Ingester's, is no more than maxPressure full, from 0 to 1.
+func IngestionProbe(ingester interface{ Pressure() float64 }, maxPressure float64) Probe {
+	return Probe{
+		Name: "ingestion",
+		Check: func(ctx context.Context) (map[string]float64, error) {
+			pressure := ingester.Pressure()
+			metrics := map[string]float64{"buffer_pressure": pressure}
+			if pressure > maxPressure {
+				return metrics, fmt.Errorf("log buffer is %.0f%% full", pressure*100)
+			}
+			return metrics, nil
+		},
+	}
+}
+
+// AnalyzerProbe checks the analyzer, such as an *ai.Analyzer, has completed
+// a cycle within maxAge. Until its first cycle, the age counts from when
+// the probe was made.
+func AnalyzerProbe(analyzer interface{ LastCycle() time.Time }, maxAge time.Duration) Probe {
+	started := time.Now()
+	return Probe{
+		Name: "analyzer",
+		Check: func(ctx context.Context) (map[string]float64, error) {
+			last := analyzer.LastCycle()
+			if last.IsZero() {
+				last = started
+			}
+			age := time.Since(last)
+			metrics := map[string]float64{"seconds_since_cycle": age.Seconds()}
+			if age > maxAge {
+				return metrics, fmt.Errorf("no analysis cycle for %s", age.Round(time.Second))
+			}
+			return metrics, nil
+		},
+	}
+}
+
+// NotificationProbe checks no notification channel's circuit breaker is
+// open, i.e. that alerts, including those about this system, can be sent.
+func NotificationProbe(notifications interface {
+	Stats() alert.NotificationStats
+}) Probe {
+	return Probe{
+		Name: "notifications",
+		Check: func(ctx context.Context) (map[string]float64, error) {
+			var open []string
+			for channel, breaker := range notifications.Stats().Breakers {
+				if breaker.State == alert.BreakerOpen {
+					open = append(open, channel)
+				}
+			}
+			metrics := map[string]float64{"open_breakers": float64(len(open))}
+			if len(open) > 0 {
+				sort.Strings(open)
+				return metrics, fmt.Errorf("circuit breaker open for %s", strings.Join(open, ", "))
+			}
+			return metrics, nil
+		},
+	}
+}
+
+// AlertRule returns a rule that raises a critical alert for any failed
+// self-check, at most once per cooldown for each probe. Its alerts are
+// sent even if they can't be saved, as when the storage is what failed.
+func AlertRule(cooldown time.Duration) *alert.Rule {
+	return &alert.Rule{
+		ID:         "self-check",
+		Type:       "monitoring",
+		Conditions: []byte(fmt.Sprintf(`{"error_match":%q}`, ErrorPrefix)),
+		Severity:   "critical",
+		Message:    "Watchtower self-check failed",
+		Cooldown:   cooldown,
+
+		NotifyUnsaved: true,
+	}
+}